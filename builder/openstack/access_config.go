@@ -12,17 +12,24 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"time"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
 	"github.com/gophercloud/utils/openstack/clientconfig"
 	"github.com/hashicorp/go-cleanhttp"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 )
 
+// microversionRegexp matches the Compute API microversions.
+var microversionRegexp = regexp.MustCompile(`^2\.\d+$`)
+
 // AccessConfig is for common configuration related to openstack access
 type AccessConfig struct {
 	// The username or id used to connect to the OpenStack service. If not
@@ -73,7 +80,14 @@ type AccessConfig struct {
 	// the OS_KEY environment variable can be used.
 	ClientKeyFile string `mapstructure:"key" required:"false"`
 	// the token (id) to use with token based authorization. Packer will use
-	// the environment variable OS_TOKEN, if set.
+	// the environment variable OS_TOKEN, if set. The token is scoped to the
+	// project of `tenant_id`, or `tenant_name` and `domain_name`, if set, and
+	// is used as is otherwise. It can't be used together with a username,
+	// password or application credential. A token can't be renewed, so the
+	// build fails to validate when the token expires before the timeouts of
+	// the communicator, `cloud_init_timeout`, `ipv6_address_timeout`,
+	// `image_creation_timeout`, `image_conversion_timeout` and
+	// `image_stores_timeout` that apply to the build add up.
 	Token string `mapstructure:"token" required:"false"`
 	// The application credential name to use with application credential based
 	// authorization. Packer will use the environment variable
@@ -90,10 +104,25 @@ type AccessConfig struct {
 	// An entry in a `clouds.yaml` file. See the OpenStack os-client-config
 	// [documentation](https://docs.openstack.org/os-client-config/latest/user/configuration.html)
 	// for more information about `clouds.yaml` files. If omitted, the
-	// `OS_CLOUD` environment variable is used.
+	// `OS_CLOUD` environment variable is used. As with python-openstackclient,
+	// the entry of the cloud in `secure.yaml` is merged over it, `secure.yaml`
+	// winning, and the result over the `clouds-public.yaml` profile of the
+	// cloud. The files are looked for in the current directory,
+	// `~/.config/openstack` and `/etc/openstack`, `OS_CLIENT_CONFIG_FILE` and
+	// `OS_CLIENT_SECURE_FILE` pointing to another `clouds.yaml` and
+	// `secure.yaml`.
 	Cloud string `mapstructure:"cloud" required:"false"`
-
-	osClient *gophercloud.ProviderClient
+	// The Compute API microversion to use for every request, such as `2.60`,
+	// or `auto` to use the newest microversion the options of the build
+	// require that the cloud supports. The build fails to validate when the
+	// cloud doesn't support the microversion, or when an option requires a
+	// newer one. By default, the requests use the microversion their option
+	// requires, if any.
+	ComputeAPIMicroversion string `mapstructure:"compute_api_microversion" required:"false"`
+
+	osClient            *gophercloud.ProviderClient
+	authOptions         gophercloud.AuthOptions
+	computeMicroversion string
 }
 
 func (c *AccessConfig) Prepare(ctx *interpolate.Context) []error {
@@ -104,6 +133,16 @@ func (c *AccessConfig) Prepare(ctx *interpolate.Context) []error {
 		return []error{fmt.Errorf("Invalid endpoint type provided")}
 	}
 
+	if c.ComputeAPIMicroversion != "" && c.ComputeAPIMicroversion != "auto" &&
+		!microversionRegexp.MatchString(c.ComputeAPIMicroversion) {
+		return []error{fmt.Errorf("compute_api_microversion must be auto or a microversion such as 2.60, got %s", c.ComputeAPIMicroversion)}
+	}
+
+	if c.Token != "" && (c.Username != "" || c.UserID != "" || c.Password != "" ||
+		c.ApplicationCredentialID != "" || c.ApplicationCredentialName != "" || c.ApplicationCredentialSecret != "") {
+		return []error{fmt.Errorf("token can't be used together with username, user_id, password or application credentials")}
+	}
+
 	// Legacy RackSpace stuff. We're keeping this around to keep things BC.
 	if c.Password == "" {
 		c.Password = os.Getenv("SDK_PASSWORD")
@@ -142,13 +181,24 @@ func (c *AccessConfig) Prepare(ctx *interpolate.Context) []error {
 	if c.Cloud != "" {
 		clientOpts.Cloud = c.Cloud
 
-		cloud, err := clientconfig.GetCloudFromYAML(clientOpts)
+		cloud, err := loadCloud(c.Cloud)
 		if err != nil {
 			return []error{err}
 		}
+		// clientconfig prefers OS_CLOUD over the cloud option, unlike
+		// python-openstackclient, so the cloud is handed over under both.
+		clouds := map[string]clientconfig.Cloud{
+			c.Cloud: *cloud,
+		}
+		if envCloud := os.Getenv("OS_CLOUD"); envCloud != "" {
+			clouds[envCloud] = *cloud
+		}
+		clientOpts.YAMLOpts = resolvedCloudYAML{
+			clouds: clouds,
+		}
 
-		if c.Region == "" && cloud.RegionName != "" {
-			c.Region = cloud.RegionName
+		if c.Region == "" {
+			c.Region = cloudRegion(cloud)
 		}
 	} else {
 		authInfo := &clientconfig.AuthInfo{
@@ -170,8 +220,9 @@ func (c *AccessConfig) Prepare(ctx *interpolate.Context) []error {
 		return []error{err}
 	}
 
-	// Make sure we reauth as needed
-	ao.AllowReauth = true
+	// Make sure we reauth as needed. A token can't be renewed, its expiry is
+	// checked against the timeouts of the build instead.
+	ao.AllowReauth = ao.TokenID == ""
 
 	// Override values if we have them in our config
 	overrides := []struct {
@@ -195,6 +246,12 @@ func (c *AccessConfig) Prepare(ctx *interpolate.Context) []error {
 			*s.To = *s.From
 		}
 	}
+	// With a token, the domain only scopes the project, which clientconfig
+	// did, and the Identity service rejects a user domain.
+	if ao.TokenID != "" {
+		ao.DomainID = ""
+		ao.DomainName = ""
+	}
 
 	// Build the client itself
 	client, err := openstack.NewClient(ao.IdentityEndpoint)
@@ -240,6 +297,39 @@ func (c *AccessConfig) Prepare(ctx *interpolate.Context) []error {
 	}
 
 	c.osClient = client
+	c.authOptions = *ao
+	return nil
+}
+
+// checkTokenLifetime checks that the token of token based authorization,
+// which can't be renewed, doesn't expire within the given duration.
+func (c *AccessConfig) checkTokenLifetime(required time.Duration) error {
+	if c.authOptions.TokenID == "" {
+		return nil
+	}
+
+	authResult, ok := c.osClient.GetAuthResult().(interface {
+		ExtractToken() (*tokens.Token, error)
+	})
+	if !ok {
+		log.Printf("[WARN] Unable to determine the expiry of the authentication token")
+		return nil
+	}
+	token, err := authResult.ExtractToken()
+	if err != nil {
+		return fmt.Errorf("Error getting the expiry of the authentication token: %s", err)
+	}
+	if token.ExpiresAt.IsZero() {
+		return nil
+	}
+
+	lifetime := time.Until(token.ExpiresAt).Round(time.Second)
+	log.Printf("[INFO] The authentication token expires at %s, in %s", token.ExpiresAt.Format(time.RFC3339), lifetime)
+	if lifetime < required {
+		return fmt.Errorf("The authentication token expires at %s, in %s, before the %s the timeouts of the build add up to. "+
+			"A token can't be renewed, use a token valid for longer, or a password or application credentials instead",
+			token.ExpiresAt.Format(time.RFC3339), lifetime, required)
+	}
 	return nil
 }
 
@@ -253,10 +343,40 @@ func (c *AccessConfig) enableDebug(ui packersdk.Ui) {
 }
 
 func (c *AccessConfig) computeV2Client() (*gophercloud.ServiceClient, error) {
-	return openstack.NewComputeV2(c.osClient, gophercloud.EndpointOpts{
+	client, err := openstack.NewComputeV2(c.osClient, gophercloud.EndpointOpts{
 		Region:       c.Region,
 		Availability: c.getEndpointType(),
 	})
+	if err != nil {
+		return nil, err
+	}
+	client.Microversion = c.computeMicroversion
+	return client, nil
+}
+
+// prepareComputeMicroversion sets the Compute API microversion of the
+// compute_api_microversion, checking it against the one the cloud supports
+// and the ones the features of the build require.
+func (c *AccessConfig) prepareComputeMicroversion(features []microversionFeature) []error {
+	if c.ComputeAPIMicroversion == "" {
+		return nil
+	}
+
+	client, err := c.computeV2Client()
+	if err != nil {
+		return []error{fmt.Errorf("Error initializing compute client: %s", err)}
+	}
+	maxMicroversion, err := computeMaxMicroversion(client)
+	if err != nil {
+		return []error{fmt.Errorf("Error getting the Compute API microversion: %s", err)}
+	}
+
+	microversion, errs := negotiateMicroversion(c.ComputeAPIMicroversion, maxMicroversion, features)
+	if len(errs) > 0 {
+		return errs
+	}
+	c.computeMicroversion = microversion
+	return nil
 }
 
 func (c *AccessConfig) imageV2Client() (*gophercloud.ServiceClient, error) {
@@ -280,6 +400,61 @@ func (c *AccessConfig) networkV2Client() (*gophercloud.ServiceClient, error) {
 	})
 }
 
+// imageV2ClientForProject returns an image client authenticated with the
+// same credentials, but scoped to the given project.
+func (c *AccessConfig) imageV2ClientForProject(projectID string) (*gophercloud.ServiceClient, error) {
+	ao := c.authOptions
+	ao.TenantID = projectID
+	ao.TenantName = ""
+	ao.Scope = &gophercloud.AuthScope{ProjectID: projectID}
+
+	client, err := openstack.NewClient(ao.IdentityEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	client.HTTPClient = c.osClient.HTTPClient
+
+	if err := openstack.Authenticate(client, ao); err != nil {
+		return nil, err
+	}
+
+	return openstack.NewImageServiceV2(client, gophercloud.EndpointOpts{
+		Region:       c.Region,
+		Availability: c.getEndpointType(),
+	})
+}
+
+// imageV2ClientForRegion returns an image service client for the given
+// region.
+func (c *AccessConfig) imageV2ClientForRegion(region string) (*gophercloud.ServiceClient, error) {
+	return openstack.NewImageServiceV2(c.osClient, gophercloud.EndpointOpts{
+		Region:       region,
+		Availability: c.getEndpointType(),
+	})
+}
+
+// projectID returns the ID of the project the client is authorized to.
+func (c *AccessConfig) projectID() (string, error) {
+	if c.TenantID != "" {
+		return c.TenantID, nil
+	}
+
+	authResult, ok := c.osClient.GetAuthResult().(interface {
+		ExtractProject() (*tokens.Project, error)
+	})
+	if !ok {
+		return "", fmt.Errorf("unable to determine the project ID from the authentication token")
+	}
+	project, err := authResult.ExtractProject()
+	if err != nil {
+		return "", err
+	}
+	if project == nil {
+		return "", fmt.Errorf("the authentication token isn't scoped to a project")
+	}
+	return project.ID, nil
+}
+
 func (c *AccessConfig) getEndpointType() gophercloud.Availability {
 	if c.EndpointType == "internal" || c.EndpointType == "internalURL" {
 		return gophercloud.AvailabilityInternal
@@ -0,0 +1,106 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessConfigPrepare_Token(t *testing.T) {
+	c := &AccessConfig{
+		Token:    "token",
+		Password: "secret",
+	}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("token together with password should error: %s", err)
+	}
+}
+
+// newTestIdentity returns a fake Identity service issuing tokens that expire
+// after the given duration.
+func newTestIdentity(t *testing.T, lifetime time.Duration) *testCloud {
+	t.Setenv("OS_CLOUD", "")
+	return newTestCloud(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/auth/tokens" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "issued")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {"expires_at": %q, "project": {"id": "project"}, "catalog": []}}`,
+			time.Now().Add(lifetime).UTC().Format(time.RFC3339))
+	})
+}
+
+func TestAccessConfigPrepare_TokenAuth(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      AccessConfig
+		allowReauth bool
+		domain      string
+	}{
+		{
+			name:        "password",
+			config:      AccessConfig{Username: "user", Password: "secret", TenantName: "project", DomainName: "Default"},
+			allowReauth: true,
+			domain:      "Default",
+		},
+		{
+			name:   "token",
+			config: AccessConfig{Token: "token", TenantName: "project", DomainName: "Default"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := newTestIdentity(t, time.Hour)
+			c := tc.config
+			c.IdentityEndpoint = cloud.URL + "/v3"
+			if errs := c.Prepare(nil); len(errs) != 0 {
+				t.Fatalf("err: %s", errs)
+			}
+
+			if c.authOptions.AllowReauth != tc.allowReauth {
+				t.Errorf("expected AllowReauth %t, got %t", tc.allowReauth, c.authOptions.AllowReauth)
+			}
+			if c.authOptions.DomainName != tc.domain || c.authOptions.DomainID != "" {
+				t.Errorf("expected domain %q, got %q and ID %q", tc.domain, c.authOptions.DomainName, c.authOptions.DomainID)
+			}
+			if tc.config.Token != "" {
+				requests := cloud.Requests()
+				if len(requests) != 1 || !strings.Contains(requests[0], `"token":{"id":"token"}`) {
+					t.Errorf("the token should be used to authenticate: %q", requests)
+				}
+			}
+		})
+	}
+}
+
+func TestAccessConfig_CheckTokenLifetime(t *testing.T) {
+	cloud := newTestIdentity(t, 10*time.Minute)
+	c := &AccessConfig{IdentityEndpoint: cloud.URL + "/v3", Token: "token", TenantID: "project"}
+	if errs := c.Prepare(nil); len(errs) != 0 {
+		t.Fatalf("err: %s", errs)
+	}
+
+	if err := c.checkTokenLifetime(5 * time.Minute); err != nil {
+		t.Fatalf("the token outlives the build: %s", err)
+	}
+	err := c.checkTokenLifetime(time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "before the 1h0m0s the timeouts of the build add up to") {
+		t.Fatalf("the token expiring during the build should error: %v", err)
+	}
+
+	password := &AccessConfig{IdentityEndpoint: cloud.URL + "/v3", Username: "user", Password: "secret", TenantID: "project", DomainName: "Default"}
+	if errs := password.Prepare(nil); len(errs) != 0 {
+		t.Fatalf("err: %s", errs)
+	}
+	if err := password.checkTokenLifetime(time.Hour); err != nil {
+		t.Fatalf("a password is reauthenticated, its token lifetime doesn't matter: %s", err)
+	}
+}
@@ -6,9 +6,15 @@ package openstack
 import (
 	"fmt"
 	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
 )
 
 // Artifact is an artifact implementation that contains built images.
@@ -22,6 +28,19 @@ type Artifact struct {
 	// OpenStack connection for performing API stuff.
 	Client *gophercloud.ServiceClient
 
+	// Region the image was built in
+	Region string
+
+	// ExportedFiles are the local files the image was exported to
+	ExportedFiles []string
+
+	// ImageCopies maps the regions the image was copied to to the ID of the
+	// copy
+	ImageCopies map[string]string
+
+	// copyClients are the image service clients of the ImageCopies regions
+	copyClients map[string]*gophercloud.ServiceClient
+
 	// StateData should store data such as GeneratedData
 	// to be shared with post-processors
 	StateData map[string]interface{}
@@ -31,9 +50,8 @@ func (a *Artifact) BuilderId() string {
 	return a.BuilderIdValue
 }
 
-func (*Artifact) Files() []string {
-	// We have no files
-	return nil
+func (a *Artifact) Files() []string {
+	return a.ExportedFiles
 }
 
 func (a *Artifact) Id() string {
@@ -41,14 +59,160 @@ func (a *Artifact) Id() string {
 }
 
 func (a *Artifact) String() string {
-	return fmt.Sprintf("An image was created: %v", a.ImageId)
+	var details []string
+	if name, _ := a.StateData["image_name"].(string); name != "" {
+		details = append(details, fmt.Sprintf("name: %s", name))
+	}
+	if format, _ := a.StateData["image_disk_format"].(string); format != "" {
+		details = append(details, fmt.Sprintf("disk format: %s", format))
+	}
+	if format, _ := a.StateData["image_container_format"].(string); format != "" {
+		details = append(details, fmt.Sprintf("container format: %s", format))
+	}
+	if size, _ := a.StateData["image_size"].(int64); size > 0 {
+		details = append(details, fmt.Sprintf("size: %d bytes", size))
+	}
+	if checksum, _ := a.StateData["image_checksum"].(string); checksum != "" {
+		algo, _ := a.StateData["image_checksum_algo"].(string)
+		details = append(details, fmt.Sprintf("checksum: %s:%s", algo, checksum))
+	}
+	if visibility, _ := a.StateData["image_visibility"].(string); visibility != "" {
+		details = append(details, fmt.Sprintf("visibility: %s", visibility))
+	}
+	if status, _ := a.StateData["image_status"].(string); status != "" && status != string(images.ImageStatusActive) {
+		details = append(details, fmt.Sprintf("status: %s", status))
+	}
+	if protected, _ := a.StateData["image_protected"].(bool); protected {
+		details = append(details, "protected")
+	}
+
+	summary := fmt.Sprintf("An image was created: %v", a.ImageId)
+	if len(details) > 0 {
+		summary = fmt.Sprintf("%s (%s)", summary, strings.Join(details, ", "))
+	}
+
+	if len(a.ImageCopies) > 0 {
+		copies := make([]string, 0, len(a.ImageCopies))
+		for _, region := range a.copyRegions() {
+			copies = append(copies, fmt.Sprintf("%s: %s", region, a.ImageCopies[region]))
+		}
+		summary = fmt.Sprintf("%s\nCopies: %s", summary, strings.Join(copies, ", "))
+	}
+	return summary
+}
+
+// copyRegions returns the regions of ImageCopies, sorted.
+func (a *Artifact) copyRegions() []string {
+	regions := make([]string, 0, len(a.ImageCopies))
+	for region := range a.ImageCopies {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
 }
 
 func (a *Artifact) State(name string) interface{} {
+	if name == registryimage.ArtifactStateURI {
+		return a.stateHCPPackerRegistryMetadata()
+	}
 	return a.StateData[name]
 }
 
+// stateHCPPackerRegistryMetadata returns the image metadata stored in the
+// HCP Packer registry.
+func (a *Artifact) stateHCPPackerRegistryMetadata() interface{} {
+	labels := map[string]string{}
+	for _, key := range []string{
+		"image_name",
+		"image_checksum",
+		"image_checksum_algo",
+		"image_disk_format",
+		"image_container_format",
+		"image_visibility",
+		"image_status",
+	} {
+		if value, _ := a.StateData[key].(string); value != "" {
+			labels[key] = value
+		}
+	}
+	if size, _ := a.StateData["image_size"].(int64); size > 0 {
+		labels["image_size"] = strconv.FormatInt(size, 10)
+	}
+	sourceImage, _ := a.StateData["source_image"].(string)
+
+	image := &registryimage.Image{
+		ImageID:        a.ImageId,
+		ProviderName:   "openstack",
+		ProviderRegion: a.Region,
+		Labels:         labels,
+		SourceImageID:  sourceImage,
+	}
+	if len(a.ImageCopies) == 0 {
+		return image
+	}
+
+	registryImages := []*registryimage.Image{image}
+	for _, region := range a.copyRegions() {
+		registryImages = append(registryImages, &registryimage.Image{
+			ImageID:        a.ImageCopies[region],
+			ProviderName:   "openstack",
+			ProviderRegion: region,
+			Labels:         labels,
+			SourceImageID:  sourceImage,
+		})
+	}
+	return registryImages
+}
+
+// imageStateData returns the artifact state describing the image.
+func imageStateData(image *images.Image) map[string]interface{} {
+	algo, checksum := "md5", image.Checksum
+	if value, _ := image.Properties["os_hash_value"].(string); value != "" {
+		algo, _ = image.Properties["os_hash_algo"].(string)
+		checksum = value
+	}
+
+	return map[string]interface{}{
+		"image_name":             image.Name,
+		"image_checksum":         checksum,
+		"image_checksum_algo":    algo,
+		"image_size":             image.SizeBytes,
+		"image_disk_format":      image.DiskFormat,
+		"image_container_format": image.ContainerFormat,
+		"image_visibility":       string(image.Visibility),
+		"image_status":           string(image.Status),
+	}
+}
+
+// Destroy deletes the exported files, the image copies and the image, going
+// on when some of them can't be deleted.
 func (a *Artifact) Destroy() error {
+	var errs *packersdk.MultiError
+	for _, path := range a.ExportedFiles {
+		log.Printf("Deleting exported image file: %s", path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = packersdk.MultiErrorAppend(errs, err)
+		}
+	}
+
+	for _, region := range a.copyRegions() {
+		client, ok := a.copyClients[region]
+		if !ok {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("no image service client for region %s", region))
+			continue
+		}
+		log.Printf("Destroying image copy in region %s: %s", region, a.ImageCopies[region])
+		if err := images.Delete(client, a.ImageCopies[region]).ExtractErr(); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("error deleting image copy %s in region %s: %s", a.ImageCopies[region], region, err))
+		}
+	}
+
 	log.Printf("Destroying image: %s", a.ImageId)
-	return images.Delete(a.Client, a.ImageId).ExtractErr()
+	if err := images.Delete(a.Client, a.ImageId).ExtractErr(); err != nil {
+		errs = packersdk.MultiErrorAppend(errs, err)
+	}
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
 }
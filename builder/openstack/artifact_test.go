@@ -4,9 +4,14 @@
 package openstack
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
 )
 
 func TestArtifact_Impl(t *testing.T) {
@@ -26,6 +31,20 @@ func TestArtifactId(t *testing.T) {
 	}
 }
 
+func TestArtifactFiles(t *testing.T) {
+	a := &Artifact{
+		ImageId: "b8cdf55b-c916-40bd-b190-389ec144c4ed",
+	}
+	if files := a.Files(); len(files) != 0 {
+		t.Fatalf("bad: %v", files)
+	}
+
+	a.ExportedFiles = []string{"output/image.qcow2"}
+	if files := a.Files(); !reflect.DeepEqual(files, []string{"output/image.qcow2"}) {
+		t.Fatalf("bad: %v", files)
+	}
+}
+
 func TestArtifactString(t *testing.T) {
 	expected := "An image was created: b8cdf55b-c916-40bd-b190-389ec144c4ed"
 
@@ -38,6 +57,113 @@ func TestArtifactString(t *testing.T) {
 	}
 }
 
+func TestArtifactString_Protected(t *testing.T) {
+	expected := "An image was created: b8cdf55b-c916-40bd-b190-389ec144c4ed (protected)"
+
+	a := &Artifact{
+		ImageId:   "b8cdf55b-c916-40bd-b190-389ec144c4ed",
+		StateData: map[string]interface{}{"image_protected": true},
+	}
+	result := a.String()
+	if result != expected {
+		t.Fatalf("bad: %s", result)
+	}
+}
+
+func TestArtifactString_Deactivated(t *testing.T) {
+	expected := "An image was created: b8cdf55b-c916-40bd-b190-389ec144c4ed (status: deactivated)"
+
+	a := &Artifact{
+		ImageId:   "b8cdf55b-c916-40bd-b190-389ec144c4ed",
+		StateData: map[string]interface{}{"image_status": "deactivated"},
+	}
+	result := a.String()
+	if result != expected {
+		t.Fatalf("bad: %s", result)
+	}
+}
+
+func TestArtifactString_ImageDetails(t *testing.T) {
+	expected := "An image was created: b8cdf55b-c916-40bd-b190-389ec144c4ed " +
+		"(name: golden, disk format: qcow2, container format: bare, size: 1024 bytes, " +
+		"checksum: sha512:abc, visibility: private)"
+
+	a := &Artifact{
+		ImageId: "b8cdf55b-c916-40bd-b190-389ec144c4ed",
+		StateData: imageStateData(&images.Image{
+			Name:            "golden",
+			DiskFormat:      "qcow2",
+			ContainerFormat: "bare",
+			SizeBytes:       1024,
+			Checksum:        "def",
+			Visibility:      images.ImageVisibilityPrivate,
+			Properties: map[string]interface{}{
+				"os_hash_algo":  "sha512",
+				"os_hash_value": "abc",
+			},
+		}),
+	}
+	result := a.String()
+	if result != expected {
+		t.Fatalf("bad: %s", result)
+	}
+}
+
+func TestArtifactState_HCPPackerRegistryMetadata(t *testing.T) {
+	a := &Artifact{
+		ImageId: "b8cdf55b-c916-40bd-b190-389ec144c4ed",
+		Region:  "RegionOne",
+		StateData: map[string]interface{}{
+			"source_image":      "86bc7e9a-0b23-4b49-a45b-1b0b1d0d7206",
+			"image_disk_format": "qcow2",
+			"image_size":        int64(1024),
+		},
+	}
+
+	result, ok := a.State(registryimage.ArtifactStateURI).(*registryimage.Image)
+	if !ok {
+		t.Fatalf("bad: %#v", a.State(registryimage.ArtifactStateURI))
+	}
+	expected := &registryimage.Image{
+		ImageID:        "b8cdf55b-c916-40bd-b190-389ec144c4ed",
+		ProviderName:   "openstack",
+		ProviderRegion: "RegionOne",
+		Labels: map[string]string{
+			"image_disk_format": "qcow2",
+			"image_size":        "1024",
+		},
+		SourceImageID: "86bc7e9a-0b23-4b49-a45b-1b0b1d0d7206",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestArtifactString_ImageCopies(t *testing.T) {
+	expected := "An image was created: b8cdf55b-c916-40bd-b190-389ec144c4ed\n" +
+		"Copies: RegionThree: 0a4b7a5c-1ad7-4b5f-a4f4-7b31b3a0f1c2, RegionTwo: 5e2c1f4d-5b93-4b1e-9c39-6a4f2a7d6e11"
+
+	a := &Artifact{
+		ImageId: "b8cdf55b-c916-40bd-b190-389ec144c4ed",
+		ImageCopies: map[string]string{
+			"RegionTwo":   "5e2c1f4d-5b93-4b1e-9c39-6a4f2a7d6e11",
+			"RegionThree": "0a4b7a5c-1ad7-4b5f-a4f4-7b31b3a0f1c2",
+		},
+	}
+	result := a.String()
+	if result != expected {
+		t.Fatalf("bad: %s", result)
+	}
+
+	images, ok := a.State(registryimage.ArtifactStateURI).([]*registryimage.Image)
+	if !ok || len(images) != 3 {
+		t.Fatalf("bad: %#v", a.State(registryimage.ArtifactStateURI))
+	}
+	if images[1].ProviderRegion != "RegionThree" || images[1].ImageID != "0a4b7a5c-1ad7-4b5f-a4f4-7b31b3a0f1c2" {
+		t.Fatalf("bad: %#v", images[1])
+	}
+}
+
 func TestArtifactState_StateData(t *testing.T) {
 	expectedData := "this is the data"
 	artifact := &Artifact{
@@ -63,3 +189,24 @@ func TestArtifactState_StateData(t *testing.T) {
 		t.Fatalf("Bad: State should be nil for nil StateData")
 	}
 }
+
+func TestArtifactDestroy_MissingRegionClient(t *testing.T) {
+	cloud := newTestCloud(t, nil)
+	a := &Artifact{
+		ImageId: "image",
+		Client: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       cloud.URL + "/",
+		},
+		ImageCopies: map[string]string{"RegionTwo": "copy"},
+	}
+
+	err := a.Destroy()
+	if err == nil || !strings.Contains(err.Error(), "RegionTwo") {
+		t.Fatalf("the missing region client should be reported: %v", err)
+	}
+	requests := cloud.Requests()
+	if len(requests) != 1 || requests[0] != "DELETE /images/image " {
+		t.Fatalf("the image should still be deleted: %q", requests)
+	}
+}
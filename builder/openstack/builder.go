@@ -1,7 +1,7 @@
 // Copyright (c) HashiCorp, Inc.
 // SPDX-License-Identifier: MPL-2.0
 
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config,ImageFilter,ImageFilterOptions
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,ImageFilter,ImageFilterOptions,InstancePort,InstancePortTrunk,TrunkSubport,AddressPair,BlockDeviceMapping,AttachVolume,SchedulerHints,FlavorFilter,UserDataPart,PersonalityFile,ImageRetention,ImageInheritProperties
 
 // The openstack package contains a packersdk.Builder implementation that
 // builds Images for openstack.
@@ -11,7 +11,11 @@ package openstack
 import (
 	"context"
 	"fmt"
+	"log"
+	"time"
 
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
@@ -47,23 +51,56 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 		PluginType:         BuilderId,
 		Interpolate:        true,
 		InterpolateContext: &b.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			// Rendered with the build variables in RunConfig.Prepare.
+			Exclude: []string{
+				"instance_metadata",
+				"instance_name",
+			},
+		},
 	}, raws...)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	var warns []string
+	if b.config.SkipCreateImage {
+		for _, option := range b.config.ImageConfig.imageOptions() {
+			warns = append(warns, fmt.Sprintf("%s is ignored because skip_create_image is true", option))
+		}
+	}
+
 	// Accumulate any errors
 	var errs *packersdk.MultiError
 	errs = packersdk.MultiErrorAppend(errs, b.config.AccessConfig.Prepare(&b.config.ctx)...)
 	errs = packersdk.MultiErrorAppend(errs, b.config.ImageConfig.Prepare(&b.config.ctx)...)
 	errs = packersdk.MultiErrorAppend(errs, b.config.RunConfig.Prepare(&b.config.ctx)...)
 
-	if errs != nil && len(errs.Errors) > 0 {
-		return nil, nil, errs
+	for _, region := range b.config.ImageCopyRegions {
+		if region == b.config.Region {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("image_copy_regions can't contain the build region %s", region))
+		}
+	}
+
+	if (b.config.SourceVolume != "" || b.config.SourceVolumeSnapshot != "") && !b.config.ImageInheritProperties.empty() {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("image_inherit_properties can't be used together with source_volume or source_volume_snapshot"))
+	}
+
+	if b.config.ImageContainerFormat != "" && !b.config.UseBlockStorageVolume {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("image_container_format can only be used together with use_blockstorage_volume"))
+	}
+
+	// The microversion is only checked against the cloud once the options
+	// are valid.
+	if errs == nil || len(errs.Errors) == 0 {
+		errs = packersdk.MultiErrorAppend(errs, b.config.AccessConfig.prepareComputeMicroversion(b.config.RunConfig.computeMicroversionFeatures())...)
+		if err := b.config.AccessConfig.checkTokenLifetime(b.config.timeouts()); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, err)
+		}
 	}
 
-	if b.config.ImageConfig.ImageDiskFormat != "" && !b.config.RunConfig.UseBlockStorageVolume {
-		return nil, nil, fmt.Errorf("use_blockstorage_volume must be true if image_disk_format is specified.")
+	if errs != nil && len(errs.Errors) > 0 {
+		return nil, warns, errs
 	}
 
 	// By default, instance name is same as image name
@@ -71,8 +108,51 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 		b.config.InstanceName = b.config.ImageName
 	}
 
+	// By default, floating IP description identifies the build
+	if b.config.FloatingIPDescription == "" {
+		b.config.FloatingIPDescription = fmt.Sprintf("packer:%s:%s",
+			b.config.PackerBuildName, time.Now().UTC().Format(time.RFC3339))
+	}
+
+	if b.config.OnFailureConsoleLog && b.config.ConsoleLogPath == "" {
+		b.config.ConsoleLogPath = fmt.Sprintf("packer_%s_console.log", b.config.PackerBuildName)
+	}
+
 	packersdk.LogSecretFilter.Set(b.config.Password)
-	return nil, nil, nil
+	if b.config.AdminPassword != "" {
+		packersdk.LogSecretFilter.Set(b.config.AdminPassword)
+	}
+	return nil, warns, nil
+}
+
+// timeouts returns the sum of the timeouts of the waits of the build, the
+// provisioners aside.
+func (c *Config) timeouts() time.Duration {
+	var total time.Duration
+	switch c.Comm.Type {
+	case "winrm":
+		total += c.Comm.WinRMTimeout
+	case "none":
+	default:
+		total += c.Comm.SSHTimeout
+	}
+	if c.WaitForCloudInit {
+		total += c.CloudInitTimeout
+	}
+	if c.UseIPv6 {
+		total += c.IPv6AddressTimeout
+	}
+	if c.SkipCreateImage {
+		return total
+	}
+	total += c.ImageCreationTimeout
+	if (c.ImageDiskFormat != "" && !c.UseBlockStorageVolume) || c.ImageUseImport {
+		total += c.ImageConversionTimeout
+	}
+	if len(c.ImageStores) > 0 {
+		total += c.ImageStoresTimeout
+	}
+	return total
 }
 
 func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
@@ -95,68 +175,218 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	state.Put("config", &b.config)
 	state.Put("hook", hook)
 	state.Put("ui", ui)
+	state.Put("build_start", time.Now().UTC())
+
+	log.Printf("[INFO] Polling the state waits every %s, backing off up to %s", b.config.StatePollInterval, b.config.StatePollMaxInterval)
+	if b.config.computeMicroversion != "" {
+		log.Printf("[INFO] Using the Compute API microversion %s (compute_api_microversion: %s)",
+			b.config.computeMicroversion, b.config.ComputeAPIMicroversion)
+	}
+	serverNetworks, instancePorts := b.config.serverNetworks()
+
+	var stopServer multistep.Step = &StepStopServer{
+		Skip: b.config.SkipStopBeforeImage || (b.config.InstanceID != "" && !b.config.StopExistingInstance),
+	}
+	if b.config.ShelveInstance {
+		stopServer = &StepShelveServer{
+			Offload: b.config.ShelveOffload,
+		}
+	} else if b.config.SnapshotConsistency != "stop" {
+		stopServer = &StepPauseServer{
+			Consistency: b.config.SnapshotConsistency,
+		}
+	}
+
+	sshKeyGen := &communicator.StepSSHKeyGen{
+		CommConf:            &b.config.Comm,
+		SSHTemporaryKeyPair: b.config.Comm.SSHTemporaryKeyPair,
+	}
+	consoleLog := &StepConsoleLog{
+		Enabled: b.config.OnFailureConsoleLog,
+		Path:    b.config.ConsoleLogPath,
+		Lines:   b.config.ConsoleLogLines,
+	}
+	keyPair := &StepKeyPair{
+		Debug:        b.config.PackerDebug,
+		Comm:         &b.config.Comm,
+		DebugKeyPath: fmt.Sprintf("os_%s.pem", b.config.PackerBuildName),
+		SavePath:     b.config.TemporaryKeyPairSavePath,
+	}
 
 	// Build the steps
 	steps := []multistep.Step{
 		&StepPreValidate{
 			ForceImageName: b.config.PackerConfig.PackerForce,
+			QoSPolicy:      b.config.PortQoSPolicy,
 		},
-		&StepLoadFlavor{
-			Flavor: b.config.Flavor,
-		},
-		&communicator.StepSSHKeyGen{
-			CommConf:            &b.config.Comm,
-			SSHTemporaryKeyPair: b.config.Comm.SSHTemporaryKeyPair,
-		},
-		&StepKeyPair{
-			Debug:        b.config.PackerDebug,
-			Comm:         &b.config.Comm,
-			DebugKeyPath: fmt.Sprintf("os_%s.pem", b.config.PackerBuildName),
-		},
-		&StepSourceImageInfo{
-			SourceImage:                   b.config.RunConfig.SourceImage,
-			SourceImageName:               b.config.RunConfig.SourceImageName,
-			ExternalSourceImageURL:        b.config.RunConfig.ExternalSourceImageURL,
-			ExternalSourceImageFormat:     b.config.RunConfig.ExternalSourceImageFormat,
-			ExternalSourceImageProperties: b.config.RunConfig.ExternalSourceImageProperties,
-			SourceImageOpts:               b.config.RunConfig.sourceImageOpts,
-			SourceMostRecent:              b.config.SourceImageFilters.MostRecent,
-			SourceProperties:              b.config.SourceImageFilters.Filters.Properties,
-		},
-		&StepDiscoverNetwork{
-			Networks:              b.config.Networks,
-			NetworkDiscoveryCIDRs: b.config.NetworkDiscoveryCIDRs,
-			Ports:                 b.config.Ports,
-		},
-		&StepCreateVolume{
-			UseBlockStorageVolume:  b.config.UseBlockStorageVolume,
-			VolumeName:             b.config.VolumeName,
-			VolumeType:             b.config.VolumeType,
-			VolumeAvailabilityZone: b.config.VolumeAvailabilityZone,
-		},
-		&StepRunSourceServer{
-			Name:                  b.config.InstanceName,
-			SecurityGroups:        b.config.SecurityGroups,
-			AvailabilityZone:      b.config.AvailabilityZone,
-			UserData:              b.config.UserData,
-			UserDataFile:          b.config.UserDataFile,
-			ConfigDrive:           b.config.ConfigDrive,
-			InstanceMetadata:      b.config.InstanceMetadata,
-			UseBlockStorageVolume: b.config.UseBlockStorageVolume,
-			ForceDelete:           b.config.ForceDelete,
+		&StepCheckFloatingIPQuota{
+			Skip:               b.config.SkipFloatingIPQuotaCheck,
+			FloatingIPNetworks: b.config.floatingIPNetworks(),
+			ForceNewFloatingIP: b.config.ForceNewFloatingIP,
+			FloatingIP:         b.config.FloatingIP,
+			ReuseIPs:           b.config.ReuseIPs,
+			FloatingIPTags:     b.config.FloatingIPTags,
 		},
+	}
+	if b.config.InstanceID != "" {
+		steps = append(steps,
+			&StepLoadExistingServer{
+				InstanceID: b.config.InstanceID,
+			},
+			consoleLog,
+			sshKeyGen,
+			keyPair,
+		)
+	} else {
+		steps = append(steps,
+			&StepLoadFlavor{
+				Flavor:          b.config.Flavor,
+				FlavorFallbacks: b.config.FlavorFallbacks,
+				FlavorFilter:    b.config.FlavorFilter,
+				FlavorRegex:     b.config.flavorRegex,
+				RegexSelect:     b.config.FlavorRegexSelect,
+				EphemeralSizeGB: b.config.EphemeralSizeGB,
+				SwapSizeMB:      b.config.SwapSizeMB,
+			},
+			&StepSourceImageInfo{
+				SourceImage:                   b.config.RunConfig.SourceImage,
+				SourceImageName:               b.config.RunConfig.SourceImageName,
+				ExternalSourceImageURL:        b.config.RunConfig.ExternalSourceImageURL,
+				SourceImageFile:               b.config.RunConfig.SourceImageFile,
+				ExternalSourceImageFormat:     b.config.RunConfig.ExternalSourceImageFormat,
+				ExternalSourceImageProperties: b.config.RunConfig.ExternalSourceImageProperties,
+				ExternalSourceImageChecksum:   b.config.RunConfig.externalSourceImageChecksum,
+				ExternalSourceImageHashAlgo:   b.config.RunConfig.externalSourceImageChecksumAlgo,
+				KeepSourceImage:               b.config.RunConfig.KeepSourceImage,
+				SourceImageOpts:               b.config.RunConfig.sourceImageOpts,
+				SourceMostRecent:              b.config.SourceImageFilters.MostRecent,
+				SourceProperties:              b.config.SourceImageFilters.Filters.Properties,
+				SourceImageNameRegex:          b.config.RunConfig.sourceImageNameRegex,
+				SourceVolume:                  b.config.RunConfig.SourceVolume,
+				SourceVolumeSnapshot:          b.config.RunConfig.SourceVolumeSnapshot,
+				AcceptMembership:              b.config.RunConfig.SourceImageAcceptMembership,
+			},
+			&StepCheckFlavor{
+				PropertiesCheck:       b.config.SourceImageFlavorCheck,
+				BootProperties:        b.config.bootProperties(),
+				RequireGuestAgent:     b.config.SnapshotConsistency == "quiesce",
+				LiveSnapshot:          b.config.SkipStopBeforeImage,
+				UseBlockStorageVolume: b.config.UseBlockStorageVolume,
+				VolumeSize:            b.config.VolumeSize,
+			},
+			&StepSecurityGroups{
+				SecurityGroups:                    b.config.SecurityGroups,
+				TemporarySecurityGroupSourceCIDRs: b.config.TemporarySecurityGroupSourceCIDRs,
+				Comm:                              &b.config.Comm,
+			},
+			sshKeyGen,
+			keyPair,
+			&StepDiscoverNetwork{
+				Networks:              serverNetworks,
+				NetworkDiscoveryCIDRs: b.config.NetworkDiscoveryCIDRs,
+				IPVersion:             b.config.NetworkDiscoveryIPVersion,
+				RequireDHCP:           b.config.NetworkDiscoveryRequireDHCP,
+				Tags:                  b.config.NetworkDiscoveryTags,
+				MatchAll:              b.config.NetworkDiscoveryMatch == "all",
+				Ports:                 b.config.Ports,
+				InstancePorts:         instancePorts,
+				FixedIPs:              b.config.NetworkFixedIPs,
+			},
+			&StepCleanupPorts{
+				Ports: b.config.Ports,
+			},
+			&StepCreatePorts{
+				InstancePorts: instancePorts,
+			},
+			&StepCreateVolume{
+				UseBlockStorageVolume:   b.config.UseBlockStorageVolume,
+				VolumeName:              b.config.VolumeName,
+				VolumeType:              b.config.VolumeType,
+				VolumeAvailabilityZone:  b.config.VolumeAvailabilityZone,
+				DefaultAvailabilityZone: b.config.volumeAvailabilityZoneDefaulted,
+				KeepVolume:              b.config.KeepVolume,
+				SourceVolume:            b.config.SourceVolume,
+				CloneSourceVolume:       b.config.CloneSourceVolume,
+				SourceVolumeSnapshot:    b.config.SourceVolumeSnapshot,
+				SnapshotMostRecent:      b.config.SourceVolumeSnapshotMostRecent,
+				BootProperties:          b.config.bootProperties(),
+			},
+			&StepCreateBlockDevices{
+				BlockDeviceMappings:     b.config.BlockDeviceMappings,
+				VolumeAvailabilityZone:  b.config.VolumeAvailabilityZone,
+				DefaultAvailabilityZone: b.config.volumeAvailabilityZoneDefaulted,
+			},
+			&StepCreateServerGroup{
+				Policy: b.config.ServerGroupPolicy,
+				Name:   fmt.Sprintf("packer_%s_%s", b.config.runUUID, b.config.ServerGroupPolicy),
+			},
+			&StepRunSourceServer{
+				Name:                       b.config.InstanceName,
+				AvailabilityZone:           b.config.AvailabilityZone,
+				AvailabilityZones:          b.config.AvailabilityZones,
+				AttemptTimeout:             b.config.AvailabilityZoneTimeout,
+				SchedulingRetries:          b.config.SchedulingRetries,
+				SchedulingRetryDelay:       b.config.SchedulingRetryDelay,
+				UserData:                   b.config.UserData,
+				UserDataFile:               b.config.UserDataFile,
+				UserDataParts:              b.config.UserDataParts,
+				UserDataGzip:               b.config.UserDataGzip,
+				Personality:                b.config.Personality,
+				AdminPassword:              b.config.AdminPassword,
+				TrustedImageCertificateIDs: b.config.TrustedImageCertificateIDs,
+				InstanceTags:               b.config.InstanceTags,
+				Description:                b.config.InstanceDescription,
+				ConfigDrive:                b.config.ConfigDrive,
+				InstanceMetadata:           b.config.InstanceMetadata,
+				SchedulerHints:             b.config.SchedulerHints.hints(),
+				UseBlockStorageVolume:      b.config.UseBlockStorageVolume,
+				DeleteOnTermination:        b.config.BootVolumeDeleteOnTermination,
+				EphemeralSizeGB:            b.config.EphemeralSizeGB,
+				EphemeralGuestFormat:       b.config.EphemeralGuestFormat,
+				SwapSizeMB:                 b.config.SwapSizeMB,
+				ForceDelete:                b.config.ForceDelete,
+			},
+			consoleLog,
+			&StepUpdateInstancePort{
+				AllowedAddressPairs: b.config.AllowedAddressPairs,
+				QoSPolicy:           b.config.PortQoSPolicy,
+				DNSName:             b.config.PortDNSName,
+				DNSDomain:           b.config.PortDNSDomain,
+				Ports:               b.config.Ports,
+			},
+		)
+	}
+	steps = append(steps,
 		&StepGetPassword{
-			Debug: b.config.PackerDebug,
-			Comm:  &b.config.RunConfig.Comm,
+			Debug:        b.config.PackerDebug,
+			Comm:         &b.config.RunConfig.Comm,
+			Timeout:      b.config.WindowsPasswordTimeout,
+			PollInterval: b.config.WindowsPasswordPollInterval,
 		},
 		&StepWaitForRackConnect{
 			Wait: b.config.RackconnectWait,
 		},
+		&StepCommunicatorNetwork{
+			Network: b.config.CommunicatorNetwork,
+		},
+		&StepWaitForIPv6{
+			UseIPv6: b.config.UseIPv6,
+			Timeout: b.config.IPv6AddressTimeout,
+		},
 		&StepAllocateIp{
-			FloatingIPNetwork:     b.config.FloatingIPNetwork,
-			FloatingIP:            b.config.FloatingIP,
-			ReuseIPs:              b.config.ReuseIPs,
-			InstanceFloatingIPNet: b.config.InstanceFloatingIPNet,
+			FloatingIPNetworks:            b.config.floatingIPNetworks(),
+			FloatingIPSubnet:              b.config.FloatingIPSubnet,
+			FloatingIPDescription:         b.config.FloatingIPDescription,
+			FloatingIP:                    b.config.FloatingIP,
+			ReuseIPs:                      b.config.ReuseIPs,
+			ForceNewFloatingIP:            b.config.ForceNewFloatingIP,
+			FloatingIPTags:                b.config.FloatingIPTags,
+			InstanceFloatingIPNet:         b.config.InstanceFloatingIPNet,
+			InstanceFloatingIPNetFallback: b.config.InstanceFloatingIPNetFallback,
+			AssociateRetries:              *b.config.FloatingIPAssociateRetries,
+			AssociateRetryDelay:           b.config.FloatingIPAssociateRetryDelay,
+			ActiveTimeout:                 b.config.FloatingIPActiveTimeout,
+			PortActiveTimeout:             b.config.FloatingIPPortActiveTimeout,
 		},
 		&communicator.StepConnect{
 			Config: &b.config.RunConfig.Comm,
@@ -167,22 +397,52 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 				b.config.SSHIPVersion),
 			SSHConfig: b.config.RunConfig.Comm.SSHConfigFunc(),
 		},
+		&StepWaitForCloudInit{
+			Wait:          b.config.WaitForCloudInit,
+			WinRM:         b.config.Comm.Type == "winrm",
+			Timeout:       b.config.CloudInitTimeout,
+			AllowDegraded: b.config.CloudInitAllowDegraded,
+		},
+		&StepAttachNetworks{
+			Networks: b.config.AttachNetworksAfterBoot,
+		},
+		&StepAttachVolumes{
+			Volumes: b.config.AttachVolumes,
+		},
 		&commonsteps.StepProvision{},
 		&commonsteps.StepCleanupTempKeys{
 			Comm: &b.config.RunConfig.Comm,
 		},
-		&StepStopServer{},
+		&StepDetachNetworks{
+			KeepAttachedNetworks: b.config.KeepAttachedNetworks,
+		},
+		&StepDetachVolumes{},
+		stopServer,
+		&StepDetachBlockDevices{},
 		&StepDeleteServer{
-			UseBlockStorageVolume: b.config.UseBlockStorageVolume,
+			UseBlockStorageVolume:    b.config.UseBlockStorageVolume,
+			ClearDeleteOnTermination: b.config.BootVolumeDeleteOnTermination,
+			ShelveInstance:           b.config.ShelveInstance,
 		},
 		&stepCreateImage{
 			UseBlockStorageVolume: b.config.UseBlockStorageVolume,
 		},
+		&stepExcludeBlockDevices{},
+		&stepConvertImage{},
+		&stepInheritImageProperties{},
 		&stepUpdateImageTags{},
 		&stepUpdateImageVisibility{},
+		&stepUpdateImageHidden{},
 		&stepAddImageMembers{},
 		&stepUpdateImageMinDisk{},
-	}
+		&stepCopyImageStores{},
+		&stepCopyImageRegions{},
+		&stepExportImage{},
+		&stepDeactivateImage{},
+		&stepUpdateImageProtected{},
+		&stepOverwriteImage{},
+		&stepImageRetention{},
+	)
 
 	// Run!
 	b.runner = commonsteps.NewRunner(steps, b.config.PackerConfig, ui)
@@ -198,12 +458,52 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		return nil, nil
 	}
 
+	var exportedFiles []string
+	if path, ok := state.GetOk("image_export_path"); ok {
+		exportedFiles = append(exportedFiles, path.(string))
+	}
+
 	// Build the artifact and return it
 	artifact := &Artifact{
 		ImageId:        state.Get("image").(string),
 		BuilderIdValue: BuilderId,
 		Client:         imageClient,
-		StateData:      map[string]interface{}{"generated_data": state.Get("generated_data")},
+		Region:         b.config.Region,
+		ExportedFiles:  exportedFiles,
+		StateData: map[string]interface{}{
+			"generated_data":          state.Get("generated_data"),
+			"source_image":            state.Get("source_image"),
+			"image_min_disk":          state.Get("image_min_disk"),
+			"image_min_ram":           state.Get("image_min_ram"),
+			"image_protected":         state.Get("image_protected") != nil,
+			"image_provenance":        state.Get("image_provenance"),
+			"image_stores":            state.Get("image_stores"),
+			"image_copies":            state.Get("image_copies"),
+			"availability_zone":       state.Get("availability_zone"),
+			"temporary_key_pair_path": state.Get("temporary_key_pair_path"),
+		},
+	}
+
+	if copies, ok := state.GetOk("image_copies"); ok {
+		artifact.ImageCopies = copies.(map[string]string)
+		artifact.copyClients = make(map[string]*gophercloud.ServiceClient, len(artifact.ImageCopies))
+		for region := range artifact.ImageCopies {
+			client, err := b.config.imageV2ClientForRegion(region)
+			if err != nil {
+				log.Printf("[WARN] Error initializing image service client for region %s: %s", region, err)
+				continue
+			}
+			artifact.copyClients[region] = client
+		}
+	}
+
+	image, err := images.Get(imageClient, artifact.ImageId).Extract()
+	if err != nil {
+		log.Printf("[WARN] Error getting image %s: %s", artifact.ImageId, err)
+	} else {
+		for k, v := range imageStateData(image) {
+			artifact.StateData[k] = v
+		}
 	}
 
 	return artifact, nil
@@ -8,127 +8,325 @@ import (
 	"github.com/zclconf/go-cty/cty"
 )
 
+// FlatAddressPair is an auto-generated flat version of AddressPair.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatAddressPair struct {
+	IPAddress  *string `mapstructure:"ip_address" required:"true" cty:"ip_address" hcl:"ip_address"`
+	MACAddress *string `mapstructure:"mac_address" required:"false" cty:"mac_address" hcl:"mac_address"`
+}
+
+// FlatMapstructure returns a new FlatAddressPair.
+// FlatAddressPair is an auto-generated flat version of AddressPair.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*AddressPair) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatAddressPair)
+}
+
+// HCL2Spec returns the hcl spec of a AddressPair.
+// This spec is used by HCL to read the fields of AddressPair.
+// The decoded values from this spec will then be applied to a FlatAddressPair.
+func (*FlatAddressPair) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"ip_address":  &hcldec.AttrSpec{Name: "ip_address", Type: cty.String, Required: false},
+		"mac_address": &hcldec.AttrSpec{Name: "mac_address", Type: cty.String, Required: false},
+	}
+	return s
+}
+
+// FlatAttachVolume is an auto-generated flat version of AttachVolume.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatAttachVolume struct {
+	Volume *string `mapstructure:"volume" required:"true" cty:"volume" hcl:"volume"`
+	Device *string `mapstructure:"device" required:"false" cty:"device" hcl:"device"`
+}
+
+// FlatMapstructure returns a new FlatAttachVolume.
+// FlatAttachVolume is an auto-generated flat version of AttachVolume.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*AttachVolume) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatAttachVolume)
+}
+
+// HCL2Spec returns the hcl spec of a AttachVolume.
+// This spec is used by HCL to read the fields of AttachVolume.
+// The decoded values from this spec will then be applied to a FlatAttachVolume.
+func (*FlatAttachVolume) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"volume": &hcldec.AttrSpec{Name: "volume", Type: cty.String, Required: false},
+		"device": &hcldec.AttrSpec{Name: "device", Type: cty.String, Required: false},
+	}
+	return s
+}
+
+// FlatBlockDeviceMapping is an auto-generated flat version of BlockDeviceMapping.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatBlockDeviceMapping struct {
+	SourceType          *string `mapstructure:"source_type" required:"false" cty:"source_type" hcl:"source_type"`
+	SourceID            *string `mapstructure:"source_id" required:"false" cty:"source_id" hcl:"source_id"`
+	VolumeSize          *int    `mapstructure:"volume_size" required:"false" cty:"volume_size" hcl:"volume_size"`
+	VolumeType          *string `mapstructure:"volume_type" required:"false" cty:"volume_type" hcl:"volume_type"`
+	DeleteOnTermination *bool   `mapstructure:"delete_on_termination" required:"false" cty:"delete_on_termination" hcl:"delete_on_termination"`
+	BootIndex           *int    `mapstructure:"boot_index" required:"false" cty:"boot_index" hcl:"boot_index"`
+	DeviceName          *string `mapstructure:"device_name" required:"false" cty:"device_name" hcl:"device_name"`
+	DetachBeforeImage   *bool   `mapstructure:"detach_before_image" required:"false" cty:"detach_before_image" hcl:"detach_before_image"`
+	SnapshotMode        *string `mapstructure:"snapshot_mode" required:"false" cty:"snapshot_mode" hcl:"snapshot_mode"`
+}
+
+// FlatMapstructure returns a new FlatBlockDeviceMapping.
+// FlatBlockDeviceMapping is an auto-generated flat version of BlockDeviceMapping.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*BlockDeviceMapping) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatBlockDeviceMapping)
+}
+
+// HCL2Spec returns the hcl spec of a BlockDeviceMapping.
+// This spec is used by HCL to read the fields of BlockDeviceMapping.
+// The decoded values from this spec will then be applied to a FlatBlockDeviceMapping.
+func (*FlatBlockDeviceMapping) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"source_type":           &hcldec.AttrSpec{Name: "source_type", Type: cty.String, Required: false},
+		"source_id":             &hcldec.AttrSpec{Name: "source_id", Type: cty.String, Required: false},
+		"volume_size":           &hcldec.AttrSpec{Name: "volume_size", Type: cty.Number, Required: false},
+		"volume_type":           &hcldec.AttrSpec{Name: "volume_type", Type: cty.String, Required: false},
+		"delete_on_termination": &hcldec.AttrSpec{Name: "delete_on_termination", Type: cty.Bool, Required: false},
+		"boot_index":            &hcldec.AttrSpec{Name: "boot_index", Type: cty.Number, Required: false},
+		"device_name":           &hcldec.AttrSpec{Name: "device_name", Type: cty.String, Required: false},
+		"detach_before_image":   &hcldec.AttrSpec{Name: "detach_before_image", Type: cty.Bool, Required: false},
+		"snapshot_mode":         &hcldec.AttrSpec{Name: "snapshot_mode", Type: cty.String, Required: false},
+	}
+	return s
+}
+
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
-	PackerBuildName               *string                 `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
-	PackerBuilderType             *string                 `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
-	PackerCoreVersion             *string                 `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
-	PackerDebug                   *bool                   `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
-	PackerForce                   *bool                   `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
-	PackerOnError                 *string                 `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
-	PackerUserVars                map[string]string       `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
-	PackerSensitiveVars           []string                `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
-	Username                      *string                 `mapstructure:"username" required:"true" cty:"username" hcl:"username"`
-	UserID                        *string                 `mapstructure:"user_id" cty:"user_id" hcl:"user_id"`
-	Password                      *string                 `mapstructure:"password" required:"true" cty:"password" hcl:"password"`
-	IdentityEndpoint              *string                 `mapstructure:"identity_endpoint" required:"true" cty:"identity_endpoint" hcl:"identity_endpoint"`
-	TenantID                      *string                 `mapstructure:"tenant_id" required:"false" cty:"tenant_id" hcl:"tenant_id"`
-	TenantName                    *string                 `mapstructure:"tenant_name" cty:"tenant_name" hcl:"tenant_name"`
-	DomainID                      *string                 `mapstructure:"domain_id" cty:"domain_id" hcl:"domain_id"`
-	DomainName                    *string                 `mapstructure:"domain_name" required:"false" cty:"domain_name" hcl:"domain_name"`
-	Insecure                      *bool                   `mapstructure:"insecure" required:"false" cty:"insecure" hcl:"insecure"`
-	Region                        *string                 `mapstructure:"region" required:"false" cty:"region" hcl:"region"`
-	EndpointType                  *string                 `mapstructure:"endpoint_type" required:"false" cty:"endpoint_type" hcl:"endpoint_type"`
-	CACertFile                    *string                 `mapstructure:"cacert" required:"false" cty:"cacert" hcl:"cacert"`
-	ClientCertFile                *string                 `mapstructure:"cert" required:"false" cty:"cert" hcl:"cert"`
-	ClientKeyFile                 *string                 `mapstructure:"key" required:"false" cty:"key" hcl:"key"`
-	Token                         *string                 `mapstructure:"token" required:"false" cty:"token" hcl:"token"`
-	ApplicationCredentialName     *string                 `mapstructure:"application_credential_name" required:"false" cty:"application_credential_name" hcl:"application_credential_name"`
-	ApplicationCredentialID       *string                 `mapstructure:"application_credential_id" required:"false" cty:"application_credential_id" hcl:"application_credential_id"`
-	ApplicationCredentialSecret   *string                 `mapstructure:"application_credential_secret" required:"false" cty:"application_credential_secret" hcl:"application_credential_secret"`
-	Cloud                         *string                 `mapstructure:"cloud" required:"false" cty:"cloud" hcl:"cloud"`
-	ImageName                     *string                 `mapstructure:"image_name" required:"true" cty:"image_name" hcl:"image_name"`
-	ImageMetadata                 map[string]string       `mapstructure:"metadata" required:"false" cty:"metadata" hcl:"metadata"`
-	ImageVisibility               *images.ImageVisibility `mapstructure:"image_visibility" required:"false" cty:"image_visibility" hcl:"image_visibility"`
-	ImageMembers                  []string                `mapstructure:"image_members" required:"false" cty:"image_members" hcl:"image_members"`
-	ImageAutoAcceptMembers        *bool                   `mapstructure:"image_auto_accept_members" required:"false" cty:"image_auto_accept_members" hcl:"image_auto_accept_members"`
-	ImageDiskFormat               *string                 `mapstructure:"image_disk_format" required:"false" cty:"image_disk_format" hcl:"image_disk_format"`
-	ImageTags                     []string                `mapstructure:"image_tags" required:"false" cty:"image_tags" hcl:"image_tags"`
-	ImageMinDisk                  *int                    `mapstructure:"image_min_disk" required:"false" cty:"image_min_disk" hcl:"image_min_disk"`
-	SkipCreateImage               *bool                   `mapstructure:"skip_create_image" required:"false" cty:"skip_create_image" hcl:"skip_create_image"`
-	Type                          *string                 `mapstructure:"communicator" cty:"communicator" hcl:"communicator"`
-	PauseBeforeConnect            *string                 `mapstructure:"pause_before_connecting" cty:"pause_before_connecting" hcl:"pause_before_connecting"`
-	SSHHost                       *string                 `mapstructure:"ssh_host" cty:"ssh_host" hcl:"ssh_host"`
-	SSHPort                       *int                    `mapstructure:"ssh_port" cty:"ssh_port" hcl:"ssh_port"`
-	SSHUsername                   *string                 `mapstructure:"ssh_username" cty:"ssh_username" hcl:"ssh_username"`
-	SSHPassword                   *string                 `mapstructure:"ssh_password" cty:"ssh_password" hcl:"ssh_password"`
-	SSHKeyPairName                *string                 `mapstructure:"ssh_keypair_name" undocumented:"true" cty:"ssh_keypair_name" hcl:"ssh_keypair_name"`
-	SSHTemporaryKeyPairName       *string                 `mapstructure:"temporary_key_pair_name" undocumented:"true" cty:"temporary_key_pair_name" hcl:"temporary_key_pair_name"`
-	SSHTemporaryKeyPairType       *string                 `mapstructure:"temporary_key_pair_type" cty:"temporary_key_pair_type" hcl:"temporary_key_pair_type"`
-	SSHTemporaryKeyPairBits       *int                    `mapstructure:"temporary_key_pair_bits" cty:"temporary_key_pair_bits" hcl:"temporary_key_pair_bits"`
-	SSHCiphers                    []string                `mapstructure:"ssh_ciphers" cty:"ssh_ciphers" hcl:"ssh_ciphers"`
-	SSHClearAuthorizedKeys        *bool                   `mapstructure:"ssh_clear_authorized_keys" cty:"ssh_clear_authorized_keys" hcl:"ssh_clear_authorized_keys"`
-	SSHKEXAlgos                   []string                `mapstructure:"ssh_key_exchange_algorithms" cty:"ssh_key_exchange_algorithms" hcl:"ssh_key_exchange_algorithms"`
-	SSHPrivateKeyFile             *string                 `mapstructure:"ssh_private_key_file" undocumented:"true" cty:"ssh_private_key_file" hcl:"ssh_private_key_file"`
-	SSHCertificateFile            *string                 `mapstructure:"ssh_certificate_file" cty:"ssh_certificate_file" hcl:"ssh_certificate_file"`
-	SSHPty                        *bool                   `mapstructure:"ssh_pty" cty:"ssh_pty" hcl:"ssh_pty"`
-	SSHTimeout                    *string                 `mapstructure:"ssh_timeout" cty:"ssh_timeout" hcl:"ssh_timeout"`
-	SSHWaitTimeout                *string                 `mapstructure:"ssh_wait_timeout" undocumented:"true" cty:"ssh_wait_timeout" hcl:"ssh_wait_timeout"`
-	SSHAgentAuth                  *bool                   `mapstructure:"ssh_agent_auth" undocumented:"true" cty:"ssh_agent_auth" hcl:"ssh_agent_auth"`
-	SSHDisableAgentForwarding     *bool                   `mapstructure:"ssh_disable_agent_forwarding" cty:"ssh_disable_agent_forwarding" hcl:"ssh_disable_agent_forwarding"`
-	SSHHandshakeAttempts          *int                    `mapstructure:"ssh_handshake_attempts" cty:"ssh_handshake_attempts" hcl:"ssh_handshake_attempts"`
-	SSHBastionHost                *string                 `mapstructure:"ssh_bastion_host" cty:"ssh_bastion_host" hcl:"ssh_bastion_host"`
-	SSHBastionPort                *int                    `mapstructure:"ssh_bastion_port" cty:"ssh_bastion_port" hcl:"ssh_bastion_port"`
-	SSHBastionAgentAuth           *bool                   `mapstructure:"ssh_bastion_agent_auth" cty:"ssh_bastion_agent_auth" hcl:"ssh_bastion_agent_auth"`
-	SSHBastionUsername            *string                 `mapstructure:"ssh_bastion_username" cty:"ssh_bastion_username" hcl:"ssh_bastion_username"`
-	SSHBastionPassword            *string                 `mapstructure:"ssh_bastion_password" cty:"ssh_bastion_password" hcl:"ssh_bastion_password"`
-	SSHBastionInteractive         *bool                   `mapstructure:"ssh_bastion_interactive" cty:"ssh_bastion_interactive" hcl:"ssh_bastion_interactive"`
-	SSHBastionPrivateKeyFile      *string                 `mapstructure:"ssh_bastion_private_key_file" cty:"ssh_bastion_private_key_file" hcl:"ssh_bastion_private_key_file"`
-	SSHBastionCertificateFile     *string                 `mapstructure:"ssh_bastion_certificate_file" cty:"ssh_bastion_certificate_file" hcl:"ssh_bastion_certificate_file"`
-	SSHFileTransferMethod         *string                 `mapstructure:"ssh_file_transfer_method" cty:"ssh_file_transfer_method" hcl:"ssh_file_transfer_method"`
-	SSHProxyHost                  *string                 `mapstructure:"ssh_proxy_host" cty:"ssh_proxy_host" hcl:"ssh_proxy_host"`
-	SSHProxyPort                  *int                    `mapstructure:"ssh_proxy_port" cty:"ssh_proxy_port" hcl:"ssh_proxy_port"`
-	SSHProxyUsername              *string                 `mapstructure:"ssh_proxy_username" cty:"ssh_proxy_username" hcl:"ssh_proxy_username"`
-	SSHProxyPassword              *string                 `mapstructure:"ssh_proxy_password" cty:"ssh_proxy_password" hcl:"ssh_proxy_password"`
-	SSHKeepAliveInterval          *string                 `mapstructure:"ssh_keep_alive_interval" cty:"ssh_keep_alive_interval" hcl:"ssh_keep_alive_interval"`
-	SSHReadWriteTimeout           *string                 `mapstructure:"ssh_read_write_timeout" cty:"ssh_read_write_timeout" hcl:"ssh_read_write_timeout"`
-	SSHRemoteTunnels              []string                `mapstructure:"ssh_remote_tunnels" cty:"ssh_remote_tunnels" hcl:"ssh_remote_tunnels"`
-	SSHLocalTunnels               []string                `mapstructure:"ssh_local_tunnels" cty:"ssh_local_tunnels" hcl:"ssh_local_tunnels"`
-	SSHPublicKey                  []byte                  `mapstructure:"ssh_public_key" undocumented:"true" cty:"ssh_public_key" hcl:"ssh_public_key"`
-	SSHPrivateKey                 []byte                  `mapstructure:"ssh_private_key" undocumented:"true" cty:"ssh_private_key" hcl:"ssh_private_key"`
-	WinRMUser                     *string                 `mapstructure:"winrm_username" cty:"winrm_username" hcl:"winrm_username"`
-	WinRMPassword                 *string                 `mapstructure:"winrm_password" cty:"winrm_password" hcl:"winrm_password"`
-	WinRMHost                     *string                 `mapstructure:"winrm_host" cty:"winrm_host" hcl:"winrm_host"`
-	WinRMNoProxy                  *bool                   `mapstructure:"winrm_no_proxy" cty:"winrm_no_proxy" hcl:"winrm_no_proxy"`
-	WinRMPort                     *int                    `mapstructure:"winrm_port" cty:"winrm_port" hcl:"winrm_port"`
-	WinRMTimeout                  *string                 `mapstructure:"winrm_timeout" cty:"winrm_timeout" hcl:"winrm_timeout"`
-	WinRMUseSSL                   *bool                   `mapstructure:"winrm_use_ssl" cty:"winrm_use_ssl" hcl:"winrm_use_ssl"`
-	WinRMInsecure                 *bool                   `mapstructure:"winrm_insecure" cty:"winrm_insecure" hcl:"winrm_insecure"`
-	WinRMUseNTLM                  *bool                   `mapstructure:"winrm_use_ntlm" cty:"winrm_use_ntlm" hcl:"winrm_use_ntlm"`
-	SSHInterface                  *string                 `mapstructure:"ssh_interface" required:"false" cty:"ssh_interface" hcl:"ssh_interface"`
-	SSHIPVersion                  *string                 `mapstructure:"ssh_ip_version" required:"false" cty:"ssh_ip_version" hcl:"ssh_ip_version"`
-	SourceImage                   *string                 `mapstructure:"source_image" required:"true" cty:"source_image" hcl:"source_image"`
-	SourceImageName               *string                 `mapstructure:"source_image_name" required:"true" cty:"source_image_name" hcl:"source_image_name"`
-	ExternalSourceImageURL        *string                 `mapstructure:"external_source_image_url" required:"true" cty:"external_source_image_url" hcl:"external_source_image_url"`
-	ExternalSourceImageFormat     *string                 `mapstructure:"external_source_image_format" required:"false" cty:"external_source_image_format" hcl:"external_source_image_format"`
-	ExternalSourceImageProperties map[string]string       `mapstructure:"external_source_image_properties" required:"false" cty:"external_source_image_properties" hcl:"external_source_image_properties"`
-	SourceImageFilters            *FlatImageFilter        `mapstructure:"source_image_filter" required:"true" cty:"source_image_filter" hcl:"source_image_filter"`
-	Flavor                        *string                 `mapstructure:"flavor" required:"true" cty:"flavor" hcl:"flavor"`
-	AvailabilityZone              *string                 `mapstructure:"availability_zone" required:"false" cty:"availability_zone" hcl:"availability_zone"`
-	RackconnectWait               *bool                   `mapstructure:"rackconnect_wait" required:"false" cty:"rackconnect_wait" hcl:"rackconnect_wait"`
-	FloatingIPNetwork             *string                 `mapstructure:"floating_ip_network" required:"false" cty:"floating_ip_network" hcl:"floating_ip_network"`
-	InstanceFloatingIPNet         *string                 `mapstructure:"instance_floating_ip_net" required:"false" cty:"instance_floating_ip_net" hcl:"instance_floating_ip_net"`
-	FloatingIP                    *string                 `mapstructure:"floating_ip" required:"false" cty:"floating_ip" hcl:"floating_ip"`
-	ReuseIPs                      *bool                   `mapstructure:"reuse_ips" required:"false" cty:"reuse_ips" hcl:"reuse_ips"`
-	SecurityGroups                []string                `mapstructure:"security_groups" required:"false" cty:"security_groups" hcl:"security_groups"`
-	Networks                      []string                `mapstructure:"networks" required:"false" cty:"networks" hcl:"networks"`
-	Ports                         []string                `mapstructure:"ports" required:"false" cty:"ports" hcl:"ports"`
-	NetworkDiscoveryCIDRs         []string                `mapstructure:"network_discovery_cidrs" required:"false" cty:"network_discovery_cidrs" hcl:"network_discovery_cidrs"`
-	UserData                      *string                 `mapstructure:"user_data" required:"false" cty:"user_data" hcl:"user_data"`
-	UserDataFile                  *string                 `mapstructure:"user_data_file" required:"false" cty:"user_data_file" hcl:"user_data_file"`
-	InstanceName                  *string                 `mapstructure:"instance_name" required:"false" cty:"instance_name" hcl:"instance_name"`
-	InstanceMetadata              map[string]string       `mapstructure:"instance_metadata" required:"false" cty:"instance_metadata" hcl:"instance_metadata"`
-	ForceDelete                   *bool                   `mapstructure:"force_delete" required:"false" cty:"force_delete" hcl:"force_delete"`
-	ConfigDrive                   *bool                   `mapstructure:"config_drive" required:"false" cty:"config_drive" hcl:"config_drive"`
-	FloatingIPPool                *string                 `mapstructure:"floating_ip_pool" required:"false" cty:"floating_ip_pool" hcl:"floating_ip_pool"`
-	UseBlockStorageVolume         *bool                   `mapstructure:"use_blockstorage_volume" required:"false" cty:"use_blockstorage_volume" hcl:"use_blockstorage_volume"`
-	VolumeName                    *string                 `mapstructure:"volume_name" required:"false" cty:"volume_name" hcl:"volume_name"`
-	VolumeType                    *string                 `mapstructure:"volume_type" required:"false" cty:"volume_type" hcl:"volume_type"`
-	VolumeSize                    *int                    `mapstructure:"volume_size" required:"false" cty:"volume_size" hcl:"volume_size"`
-	VolumeAvailabilityZone        *string                 `mapstructure:"volume_availability_zone" required:"false" cty:"volume_availability_zone" hcl:"volume_availability_zone"`
-	OpenstackProvider             *string                 `mapstructure:"openstack_provider" cty:"openstack_provider" hcl:"openstack_provider"`
-	UseFloatingIp                 *bool                   `mapstructure:"use_floating_ip" required:"false" cty:"use_floating_ip" hcl:"use_floating_ip"`
+	PackerBuildName                   *string                     `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType                 *string                     `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion                 *string                     `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug                       *bool                       `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce                       *bool                       `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError                     *string                     `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars                    map[string]string           `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars               []string                    `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	Username                          *string                     `mapstructure:"username" required:"true" cty:"username" hcl:"username"`
+	UserID                            *string                     `mapstructure:"user_id" cty:"user_id" hcl:"user_id"`
+	Password                          *string                     `mapstructure:"password" required:"true" cty:"password" hcl:"password"`
+	IdentityEndpoint                  *string                     `mapstructure:"identity_endpoint" required:"true" cty:"identity_endpoint" hcl:"identity_endpoint"`
+	TenantID                          *string                     `mapstructure:"tenant_id" required:"false" cty:"tenant_id" hcl:"tenant_id"`
+	TenantName                        *string                     `mapstructure:"tenant_name" cty:"tenant_name" hcl:"tenant_name"`
+	DomainID                          *string                     `mapstructure:"domain_id" cty:"domain_id" hcl:"domain_id"`
+	DomainName                        *string                     `mapstructure:"domain_name" required:"false" cty:"domain_name" hcl:"domain_name"`
+	Insecure                          *bool                       `mapstructure:"insecure" required:"false" cty:"insecure" hcl:"insecure"`
+	Region                            *string                     `mapstructure:"region" required:"false" cty:"region" hcl:"region"`
+	EndpointType                      *string                     `mapstructure:"endpoint_type" required:"false" cty:"endpoint_type" hcl:"endpoint_type"`
+	CACertFile                        *string                     `mapstructure:"cacert" required:"false" cty:"cacert" hcl:"cacert"`
+	ClientCertFile                    *string                     `mapstructure:"cert" required:"false" cty:"cert" hcl:"cert"`
+	ClientKeyFile                     *string                     `mapstructure:"key" required:"false" cty:"key" hcl:"key"`
+	Token                             *string                     `mapstructure:"token" required:"false" cty:"token" hcl:"token"`
+	ApplicationCredentialName         *string                     `mapstructure:"application_credential_name" required:"false" cty:"application_credential_name" hcl:"application_credential_name"`
+	ApplicationCredentialID           *string                     `mapstructure:"application_credential_id" required:"false" cty:"application_credential_id" hcl:"application_credential_id"`
+	ApplicationCredentialSecret       *string                     `mapstructure:"application_credential_secret" required:"false" cty:"application_credential_secret" hcl:"application_credential_secret"`
+	Cloud                             *string                     `mapstructure:"cloud" required:"false" cty:"cloud" hcl:"cloud"`
+	ComputeAPIMicroversion            *string                     `mapstructure:"compute_api_microversion" required:"false" cty:"compute_api_microversion" hcl:"compute_api_microversion"`
+	ImageName                         *string                     `mapstructure:"image_name" required:"true" cty:"image_name" hcl:"image_name"`
+	ImageMetadata                     map[string]string           `mapstructure:"metadata" required:"false" cty:"metadata" hcl:"metadata"`
+	ImageProvenanceMetadata           *bool                       `mapstructure:"image_provenance_metadata" required:"false" cty:"image_provenance_metadata" hcl:"image_provenance_metadata"`
+	ImageGuestAgent                   *bool                       `mapstructure:"image_guest_agent" required:"false" cty:"image_guest_agent" hcl:"image_guest_agent"`
+	ImageDiskBus                      *string                     `mapstructure:"image_disk_bus" required:"false" cty:"image_disk_bus" hcl:"image_disk_bus"`
+	ImageSCSIModel                    *string                     `mapstructure:"image_scsi_model" required:"false" cty:"image_scsi_model" hcl:"image_scsi_model"`
+	ImageVIFModel                     *string                     `mapstructure:"image_vif_model" required:"false" cty:"image_vif_model" hcl:"image_vif_model"`
+	ImageVIFMultiqueue                *bool                       `mapstructure:"image_vif_multiqueue" required:"false" cty:"image_vif_multiqueue" hcl:"image_vif_multiqueue"`
+	BootFirmware                      *string                     `mapstructure:"boot_firmware" required:"false" cty:"boot_firmware" hcl:"boot_firmware"`
+	SecureBoot                        *bool                       `mapstructure:"secure_boot" required:"false" cty:"secure_boot" hcl:"secure_boot"`
+	VTPM                              *bool                       `mapstructure:"vtpm" required:"false" cty:"vtpm" hcl:"vtpm"`
+	ImageVisibility                   *images.ImageVisibility     `mapstructure:"image_visibility" required:"false" cty:"image_visibility" hcl:"image_visibility"`
+	ImageMembers                      []string                    `mapstructure:"image_members" required:"false" cty:"image_members" hcl:"image_members"`
+	ImageAutoAcceptMembers            *bool                       `mapstructure:"image_auto_accept_members" required:"false" cty:"image_auto_accept_members" hcl:"image_auto_accept_members"`
+	ImageDiskFormat                   *string                     `mapstructure:"image_disk_format" required:"false" cty:"image_disk_format" hcl:"image_disk_format"`
+	ImageContainerFormat              *string                     `mapstructure:"image_container_format" required:"false" cty:"image_container_format" hcl:"image_container_format"`
+	ImageConversionLocalFallback      *bool                       `mapstructure:"image_conversion_local_fallback" required:"false" cty:"image_conversion_local_fallback" hcl:"image_conversion_local_fallback"`
+	ImageConversionTimeout            *string                     `mapstructure:"image_conversion_timeout" required:"false" cty:"image_conversion_timeout" hcl:"image_conversion_timeout"`
+	ImageUseImport                    *bool                       `mapstructure:"image_use_import" required:"false" cty:"image_use_import" hcl:"image_use_import"`
+	ImageTags                         []string                    `mapstructure:"image_tags" required:"false" cty:"image_tags" hcl:"image_tags"`
+	ImageMinDisk                      *string                     `mapstructure:"image_min_disk" required:"false" cty:"image_min_disk" hcl:"image_min_disk"`
+	ImageMinRam                       *int                        `mapstructure:"image_min_ram" required:"false" cty:"image_min_ram" hcl:"image_min_ram"`
+	ImageProtected                    *bool                       `mapstructure:"image_protected" required:"false" cty:"image_protected" hcl:"image_protected"`
+	ImageHidden                       *bool                       `mapstructure:"image_hidden" required:"false" cty:"image_hidden" hcl:"image_hidden"`
+	ImageInheritProperties            *FlatImageInheritProperties `mapstructure:"image_inherit_properties" required:"false" cty:"image_inherit_properties" hcl:"image_inherit_properties"`
+	ImageDeactivate                   *bool                       `mapstructure:"image_deactivate" required:"false" cty:"image_deactivate" hcl:"image_deactivate"`
+	ImageCreationTimeout              *string                     `mapstructure:"image_creation_timeout" required:"false" cty:"image_creation_timeout" hcl:"image_creation_timeout"`
+	ImageUpdateTimeout                *string                     `mapstructure:"image_update_timeout" required:"false" cty:"image_update_timeout" hcl:"image_update_timeout"`
+	ImageExportPath                   *string                     `mapstructure:"image_export_path" required:"false" cty:"image_export_path" hcl:"image_export_path"`
+	ImageStores                       []string                    `mapstructure:"image_stores" required:"false" cty:"image_stores" hcl:"image_stores"`
+	ImageStoresTimeout                *string                     `mapstructure:"image_stores_timeout" required:"false" cty:"image_stores_timeout" hcl:"image_stores_timeout"`
+	ImageCopyRegions                  []string                    `mapstructure:"image_copy_regions" required:"false" cty:"image_copy_regions" hcl:"image_copy_regions"`
+	OverwriteImage                    *bool                       `mapstructure:"overwrite_image" required:"false" cty:"overwrite_image" hcl:"overwrite_image"`
+	ImageRetention                    *FlatImageRetention         `mapstructure:"image_retention" required:"false" cty:"image_retention" hcl:"image_retention"`
+	SkipCreateImage                   *bool                       `mapstructure:"skip_create_image" required:"false" cty:"skip_create_image" hcl:"skip_create_image"`
+	Type                              *string                     `mapstructure:"communicator" cty:"communicator" hcl:"communicator"`
+	PauseBeforeConnect                *string                     `mapstructure:"pause_before_connecting" cty:"pause_before_connecting" hcl:"pause_before_connecting"`
+	SSHHost                           *string                     `mapstructure:"ssh_host" cty:"ssh_host" hcl:"ssh_host"`
+	SSHPort                           *int                        `mapstructure:"ssh_port" cty:"ssh_port" hcl:"ssh_port"`
+	SSHUsername                       *string                     `mapstructure:"ssh_username" cty:"ssh_username" hcl:"ssh_username"`
+	SSHPassword                       *string                     `mapstructure:"ssh_password" cty:"ssh_password" hcl:"ssh_password"`
+	SSHKeyPairName                    *string                     `mapstructure:"ssh_keypair_name" undocumented:"true" cty:"ssh_keypair_name" hcl:"ssh_keypair_name"`
+	SSHTemporaryKeyPairName           *string                     `mapstructure:"temporary_key_pair_name" undocumented:"true" cty:"temporary_key_pair_name" hcl:"temporary_key_pair_name"`
+	SSHTemporaryKeyPairType           *string                     `mapstructure:"temporary_key_pair_type" cty:"temporary_key_pair_type" hcl:"temporary_key_pair_type"`
+	SSHTemporaryKeyPairBits           *int                        `mapstructure:"temporary_key_pair_bits" cty:"temporary_key_pair_bits" hcl:"temporary_key_pair_bits"`
+	SSHCiphers                        []string                    `mapstructure:"ssh_ciphers" cty:"ssh_ciphers" hcl:"ssh_ciphers"`
+	SSHClearAuthorizedKeys            *bool                       `mapstructure:"ssh_clear_authorized_keys" cty:"ssh_clear_authorized_keys" hcl:"ssh_clear_authorized_keys"`
+	SSHKEXAlgos                       []string                    `mapstructure:"ssh_key_exchange_algorithms" cty:"ssh_key_exchange_algorithms" hcl:"ssh_key_exchange_algorithms"`
+	SSHPrivateKeyFile                 *string                     `mapstructure:"ssh_private_key_file" undocumented:"true" cty:"ssh_private_key_file" hcl:"ssh_private_key_file"`
+	SSHCertificateFile                *string                     `mapstructure:"ssh_certificate_file" cty:"ssh_certificate_file" hcl:"ssh_certificate_file"`
+	SSHPty                            *bool                       `mapstructure:"ssh_pty" cty:"ssh_pty" hcl:"ssh_pty"`
+	SSHTimeout                        *string                     `mapstructure:"ssh_timeout" cty:"ssh_timeout" hcl:"ssh_timeout"`
+	SSHWaitTimeout                    *string                     `mapstructure:"ssh_wait_timeout" undocumented:"true" cty:"ssh_wait_timeout" hcl:"ssh_wait_timeout"`
+	SSHAgentAuth                      *bool                       `mapstructure:"ssh_agent_auth" undocumented:"true" cty:"ssh_agent_auth" hcl:"ssh_agent_auth"`
+	SSHDisableAgentForwarding         *bool                       `mapstructure:"ssh_disable_agent_forwarding" cty:"ssh_disable_agent_forwarding" hcl:"ssh_disable_agent_forwarding"`
+	SSHHandshakeAttempts              *int                        `mapstructure:"ssh_handshake_attempts" cty:"ssh_handshake_attempts" hcl:"ssh_handshake_attempts"`
+	SSHBastionHost                    *string                     `mapstructure:"ssh_bastion_host" cty:"ssh_bastion_host" hcl:"ssh_bastion_host"`
+	SSHBastionPort                    *int                        `mapstructure:"ssh_bastion_port" cty:"ssh_bastion_port" hcl:"ssh_bastion_port"`
+	SSHBastionAgentAuth               *bool                       `mapstructure:"ssh_bastion_agent_auth" cty:"ssh_bastion_agent_auth" hcl:"ssh_bastion_agent_auth"`
+	SSHBastionUsername                *string                     `mapstructure:"ssh_bastion_username" cty:"ssh_bastion_username" hcl:"ssh_bastion_username"`
+	SSHBastionPassword                *string                     `mapstructure:"ssh_bastion_password" cty:"ssh_bastion_password" hcl:"ssh_bastion_password"`
+	SSHBastionInteractive             *bool                       `mapstructure:"ssh_bastion_interactive" cty:"ssh_bastion_interactive" hcl:"ssh_bastion_interactive"`
+	SSHBastionPrivateKeyFile          *string                     `mapstructure:"ssh_bastion_private_key_file" cty:"ssh_bastion_private_key_file" hcl:"ssh_bastion_private_key_file"`
+	SSHBastionCertificateFile         *string                     `mapstructure:"ssh_bastion_certificate_file" cty:"ssh_bastion_certificate_file" hcl:"ssh_bastion_certificate_file"`
+	SSHFileTransferMethod             *string                     `mapstructure:"ssh_file_transfer_method" cty:"ssh_file_transfer_method" hcl:"ssh_file_transfer_method"`
+	SSHProxyHost                      *string                     `mapstructure:"ssh_proxy_host" cty:"ssh_proxy_host" hcl:"ssh_proxy_host"`
+	SSHProxyPort                      *int                        `mapstructure:"ssh_proxy_port" cty:"ssh_proxy_port" hcl:"ssh_proxy_port"`
+	SSHProxyUsername                  *string                     `mapstructure:"ssh_proxy_username" cty:"ssh_proxy_username" hcl:"ssh_proxy_username"`
+	SSHProxyPassword                  *string                     `mapstructure:"ssh_proxy_password" cty:"ssh_proxy_password" hcl:"ssh_proxy_password"`
+	SSHKeepAliveInterval              *string                     `mapstructure:"ssh_keep_alive_interval" cty:"ssh_keep_alive_interval" hcl:"ssh_keep_alive_interval"`
+	SSHReadWriteTimeout               *string                     `mapstructure:"ssh_read_write_timeout" cty:"ssh_read_write_timeout" hcl:"ssh_read_write_timeout"`
+	SSHRemoteTunnels                  []string                    `mapstructure:"ssh_remote_tunnels" cty:"ssh_remote_tunnels" hcl:"ssh_remote_tunnels"`
+	SSHLocalTunnels                   []string                    `mapstructure:"ssh_local_tunnels" cty:"ssh_local_tunnels" hcl:"ssh_local_tunnels"`
+	SSHPublicKey                      []byte                      `mapstructure:"ssh_public_key" undocumented:"true" cty:"ssh_public_key" hcl:"ssh_public_key"`
+	SSHPrivateKey                     []byte                      `mapstructure:"ssh_private_key" undocumented:"true" cty:"ssh_private_key" hcl:"ssh_private_key"`
+	WinRMUser                         *string                     `mapstructure:"winrm_username" cty:"winrm_username" hcl:"winrm_username"`
+	WinRMPassword                     *string                     `mapstructure:"winrm_password" cty:"winrm_password" hcl:"winrm_password"`
+	WinRMHost                         *string                     `mapstructure:"winrm_host" cty:"winrm_host" hcl:"winrm_host"`
+	WinRMNoProxy                      *bool                       `mapstructure:"winrm_no_proxy" cty:"winrm_no_proxy" hcl:"winrm_no_proxy"`
+	WinRMPort                         *int                        `mapstructure:"winrm_port" cty:"winrm_port" hcl:"winrm_port"`
+	WinRMTimeout                      *string                     `mapstructure:"winrm_timeout" cty:"winrm_timeout" hcl:"winrm_timeout"`
+	WinRMUseSSL                       *bool                       `mapstructure:"winrm_use_ssl" cty:"winrm_use_ssl" hcl:"winrm_use_ssl"`
+	WinRMInsecure                     *bool                       `mapstructure:"winrm_insecure" cty:"winrm_insecure" hcl:"winrm_insecure"`
+	WinRMUseNTLM                      *bool                       `mapstructure:"winrm_use_ntlm" cty:"winrm_use_ntlm" hcl:"winrm_use_ntlm"`
+	SSHInterface                      *string                     `mapstructure:"ssh_interface" required:"false" cty:"ssh_interface" hcl:"ssh_interface"`
+	CommunicatorNetwork               *string                     `mapstructure:"communicator_network" required:"false" cty:"communicator_network" hcl:"communicator_network"`
+	AttachNetworksAfterBoot           []string                    `mapstructure:"attach_networks_after_boot" required:"false" cty:"attach_networks_after_boot" hcl:"attach_networks_after_boot"`
+	KeepAttachedNetworks              *bool                       `mapstructure:"keep_attached_networks" required:"false" cty:"keep_attached_networks" hcl:"keep_attached_networks"`
+	SSHIPVersion                      *string                     `mapstructure:"ssh_ip_version" required:"false" cty:"ssh_ip_version" hcl:"ssh_ip_version"`
+	UseIPv6                           *bool                       `mapstructure:"use_ipv6" required:"false" cty:"use_ipv6" hcl:"use_ipv6"`
+	IPv6AddressTimeout                *string                     `mapstructure:"ipv6_address_timeout" required:"false" cty:"ipv6_address_timeout" hcl:"ipv6_address_timeout"`
+	WindowsPasswordTimeout            *string                     `mapstructure:"windows_password_timeout" required:"false" cty:"windows_password_timeout" hcl:"windows_password_timeout"`
+	WindowsPasswordPollInterval       *string                     `mapstructure:"windows_password_poll_interval" required:"false" cty:"windows_password_poll_interval" hcl:"windows_password_poll_interval"`
+	StatePollInterval                 *string                     `mapstructure:"state_poll_interval" required:"false" cty:"state_poll_interval" hcl:"state_poll_interval"`
+	StatePollMaxInterval              *string                     `mapstructure:"state_poll_max_interval" required:"false" cty:"state_poll_max_interval" hcl:"state_poll_max_interval"`
+	WaitForCloudInit                  *bool                       `mapstructure:"wait_for_cloud_init" required:"false" cty:"wait_for_cloud_init" hcl:"wait_for_cloud_init"`
+	CloudInitTimeout                  *string                     `mapstructure:"cloud_init_timeout" required:"false" cty:"cloud_init_timeout" hcl:"cloud_init_timeout"`
+	CloudInitAllowDegraded            *bool                       `mapstructure:"cloud_init_allow_degraded" required:"false" cty:"cloud_init_allow_degraded" hcl:"cloud_init_allow_degraded"`
+	OnFailureConsoleLog               *bool                       `mapstructure:"on_failure_console_log" required:"false" cty:"on_failure_console_log" hcl:"on_failure_console_log"`
+	ConsoleLogPath                    *string                     `mapstructure:"console_log_path" required:"false" cty:"console_log_path" hcl:"console_log_path"`
+	ConsoleLogLines                   *int                        `mapstructure:"console_log_lines" required:"false" cty:"console_log_lines" hcl:"console_log_lines"`
+	TemporaryKeyPairSavePath          *string                     `mapstructure:"temporary_key_pair_save_path" required:"false" cty:"temporary_key_pair_save_path" hcl:"temporary_key_pair_save_path"`
+	SourceImage                       *string                     `mapstructure:"source_image" required:"true" cty:"source_image" hcl:"source_image"`
+	SourceImageName                   *string                     `mapstructure:"source_image_name" required:"true" cty:"source_image_name" hcl:"source_image_name"`
+	ExternalSourceImageURL            *string                     `mapstructure:"external_source_image_url" required:"true" cty:"external_source_image_url" hcl:"external_source_image_url"`
+	SourceVolume                      *string                     `mapstructure:"source_volume" required:"false" cty:"source_volume" hcl:"source_volume"`
+	CloneSourceVolume                 *bool                       `mapstructure:"clone_source_volume" required:"false" cty:"clone_source_volume" hcl:"clone_source_volume"`
+	SourceVolumeSnapshot              *string                     `mapstructure:"source_volume_snapshot" required:"false" cty:"source_volume_snapshot" hcl:"source_volume_snapshot"`
+	SourceVolumeSnapshotMostRecent    *bool                       `mapstructure:"source_volume_snapshot_most_recent" required:"false" cty:"source_volume_snapshot_most_recent" hcl:"source_volume_snapshot_most_recent"`
+	SourceImageFile                   *string                     `mapstructure:"source_image_file" required:"false" cty:"source_image_file" hcl:"source_image_file"`
+	ExternalSourceImageFormat         *string                     `mapstructure:"external_source_image_format" required:"false" cty:"external_source_image_format" hcl:"external_source_image_format"`
+	ExternalSourceImageProperties     map[string]string           `mapstructure:"external_source_image_properties" required:"false" cty:"external_source_image_properties" hcl:"external_source_image_properties"`
+	ExternalSourceImageChecksum       *string                     `mapstructure:"external_source_image_checksum" required:"false" cty:"external_source_image_checksum" hcl:"external_source_image_checksum"`
+	KeepSourceImage                   *bool                       `mapstructure:"keep_source_image" required:"false" cty:"keep_source_image" hcl:"keep_source_image"`
+	SourceImageFilters                *FlatImageFilter            `mapstructure:"source_image_filter" required:"true" cty:"source_image_filter" hcl:"source_image_filter"`
+	SourceImageAcceptMembership       *bool                       `mapstructure:"source_image_accept_membership" required:"false" cty:"source_image_accept_membership" hcl:"source_image_accept_membership"`
+	Flavor                            *string                     `mapstructure:"flavor" required:"true" cty:"flavor" hcl:"flavor"`
+	FlavorFilter                      *FlatFlavorFilter           `mapstructure:"flavor_filter" required:"false" cty:"flavor_filter" hcl:"flavor_filter"`
+	FlavorRegex                       *string                     `mapstructure:"flavor_regex" required:"false" cty:"flavor_regex" hcl:"flavor_regex"`
+	FlavorRegexSelect                 *string                     `mapstructure:"flavor_regex_select" required:"false" cty:"flavor_regex_select" hcl:"flavor_regex_select"`
+	SourceImageFlavorCheck            *string                     `mapstructure:"source_image_flavor_check" required:"false" cty:"source_image_flavor_check" hcl:"source_image_flavor_check"`
+	AvailabilityZone                  *string                     `mapstructure:"availability_zone" required:"false" cty:"availability_zone" hcl:"availability_zone"`
+	AvailabilityZones                 []string                    `mapstructure:"availability_zones" required:"false" cty:"availability_zones" hcl:"availability_zones"`
+	AvailabilityZoneTimeout           *string                     `mapstructure:"availability_zone_timeout" required:"false" cty:"availability_zone_timeout" hcl:"availability_zone_timeout"`
+	SchedulingRetries                 *int                        `mapstructure:"scheduling_retries" required:"false" cty:"scheduling_retries" hcl:"scheduling_retries"`
+	SchedulingRetryDelay              *string                     `mapstructure:"scheduling_retry_delay" required:"false" cty:"scheduling_retry_delay" hcl:"scheduling_retry_delay"`
+	FlavorFallbacks                   []string                    `mapstructure:"flavor_fallbacks" required:"false" cty:"flavor_fallbacks" hcl:"flavor_fallbacks"`
+	RackconnectWait                   *bool                       `mapstructure:"rackconnect_wait" required:"false" cty:"rackconnect_wait" hcl:"rackconnect_wait"`
+	FloatingIPNetwork                 *string                     `mapstructure:"floating_ip_network" required:"false" cty:"floating_ip_network" hcl:"floating_ip_network"`
+	FloatingIPNetworks                []string                    `mapstructure:"floating_ip_networks" required:"false" cty:"floating_ip_networks" hcl:"floating_ip_networks"`
+	FloatingIPSubnet                  *string                     `mapstructure:"floating_ip_subnet" required:"false" cty:"floating_ip_subnet" hcl:"floating_ip_subnet"`
+	FloatingIPDescription             *string                     `mapstructure:"floating_ip_description" required:"false" cty:"floating_ip_description" hcl:"floating_ip_description"`
+	InstanceFloatingIPNet             *string                     `mapstructure:"instance_floating_ip_net" required:"false" cty:"instance_floating_ip_net" hcl:"instance_floating_ip_net"`
+	InstanceFloatingIPNetFallback     *bool                       `mapstructure:"instance_floating_ip_net_fallback" required:"false" cty:"instance_floating_ip_net_fallback" hcl:"instance_floating_ip_net_fallback"`
+	FloatingIP                        *string                     `mapstructure:"floating_ip" required:"false" cty:"floating_ip" hcl:"floating_ip"`
+	ReuseIPs                          *bool                       `mapstructure:"reuse_ips" required:"false" cty:"reuse_ips" hcl:"reuse_ips"`
+	ForceNewFloatingIP                *bool                       `mapstructure:"force_new_floating_ip" required:"false" cty:"force_new_floating_ip" hcl:"force_new_floating_ip"`
+	SkipFloatingIPQuotaCheck          *bool                       `mapstructure:"skip_floating_ip_quota_check" required:"false" cty:"skip_floating_ip_quota_check" hcl:"skip_floating_ip_quota_check"`
+	FloatingIPTags                    []string                    `mapstructure:"floating_ip_tags" required:"false" cty:"floating_ip_tags" hcl:"floating_ip_tags"`
+	FloatingIPAssociateRetries        *int                        `mapstructure:"floating_ip_associate_retries" required:"false" cty:"floating_ip_associate_retries" hcl:"floating_ip_associate_retries"`
+	FloatingIPAssociateRetryDelay     *string                     `mapstructure:"floating_ip_associate_retry_delay" required:"false" cty:"floating_ip_associate_retry_delay" hcl:"floating_ip_associate_retry_delay"`
+	FloatingIPActiveTimeout           *string                     `mapstructure:"floating_ip_active_timeout" required:"false" cty:"floating_ip_active_timeout" hcl:"floating_ip_active_timeout"`
+	FloatingIPPortActiveTimeout       *string                     `mapstructure:"floating_ip_port_active_timeout" required:"false" cty:"floating_ip_port_active_timeout" hcl:"floating_ip_port_active_timeout"`
+	SecurityGroups                    []string                    `mapstructure:"security_groups" required:"false" cty:"security_groups" hcl:"security_groups"`
+	TemporarySecurityGroupSourceCIDRs []string                    `mapstructure:"temporary_security_group_source_cidrs" required:"false" cty:"temporary_security_group_source_cidrs" hcl:"temporary_security_group_source_cidrs"`
+	Networks                          []string                    `mapstructure:"networks" required:"false" cty:"networks" hcl:"networks"`
+	NetworkFixedIPs                   map[string]string           `mapstructure:"network_fixed_ips" required:"false" cty:"network_fixed_ips" hcl:"network_fixed_ips"`
+	NetworkFixedIPPorts               *bool                       `mapstructure:"network_fixed_ip_ports" required:"false" cty:"network_fixed_ip_ports" hcl:"network_fixed_ip_ports"`
+	Ports                             []string                    `mapstructure:"ports" required:"false" cty:"ports" hcl:"ports"`
+	InstancePorts                     []FlatInstancePort          `mapstructure:"instance_port" required:"false" cty:"instance_port" hcl:"instance_port"`
+	AllowedAddressPairs               []FlatAddressPair           `mapstructure:"allowed_address_pairs" required:"false" cty:"allowed_address_pairs" hcl:"allowed_address_pairs"`
+	PortQoSPolicy                     *string                     `mapstructure:"port_qos_policy" required:"false" cty:"port_qos_policy" hcl:"port_qos_policy"`
+	PortDNSName                       *string                     `mapstructure:"port_dns_name" required:"false" cty:"port_dns_name" hcl:"port_dns_name"`
+	PortDNSDomain                     *string                     `mapstructure:"port_dns_domain" required:"false" cty:"port_dns_domain" hcl:"port_dns_domain"`
+	NetworkDiscoveryCIDRs             []string                    `mapstructure:"network_discovery_cidrs" required:"false" cty:"network_discovery_cidrs" hcl:"network_discovery_cidrs"`
+	NetworkDiscoveryIPVersion         *int                        `mapstructure:"network_discovery_ip_version" required:"false" cty:"network_discovery_ip_version" hcl:"network_discovery_ip_version"`
+	NetworkDiscoveryRequireDHCP       *bool                       `mapstructure:"network_discovery_require_dhcp" required:"false" cty:"network_discovery_require_dhcp" hcl:"network_discovery_require_dhcp"`
+	NetworkDiscoveryTags              []string                    `mapstructure:"network_discovery_tags" required:"false" cty:"network_discovery_tags" hcl:"network_discovery_tags"`
+	NetworkDiscoveryMatch             *string                     `mapstructure:"network_discovery_match" required:"false" cty:"network_discovery_match" hcl:"network_discovery_match"`
+	UserData                          *string                     `mapstructure:"user_data" required:"false" cty:"user_data" hcl:"user_data"`
+	UserDataFile                      *string                     `mapstructure:"user_data_file" required:"false" cty:"user_data_file" hcl:"user_data_file"`
+	UserDataParts                     []FlatUserDataPart          `mapstructure:"user_data_parts" required:"false" cty:"user_data_parts" hcl:"user_data_parts"`
+	UserDataGzip                      *bool                       `mapstructure:"user_data_gzip" required:"false" cty:"user_data_gzip" hcl:"user_data_gzip"`
+	Personality                       []FlatPersonalityFile       `mapstructure:"personality" required:"false" cty:"personality" hcl:"personality"`
+	AdminPassword                     *string                     `mapstructure:"admin_password" required:"false" cty:"admin_password" hcl:"admin_password"`
+	TrustedImageCertificateIDs        []string                    `mapstructure:"trusted_image_certificate_ids" required:"false" cty:"trusted_image_certificate_ids" hcl:"trusted_image_certificate_ids"`
+	TrustedImageCertificateProperty   *bool                       `mapstructure:"trusted_image_certificate_property" required:"false" cty:"trusted_image_certificate_property" hcl:"trusted_image_certificate_property"`
+	InstanceName                      *string                     `mapstructure:"instance_name" required:"false" cty:"instance_name" hcl:"instance_name"`
+	InstanceMetadata                  map[string]string           `mapstructure:"instance_metadata" required:"false" cty:"instance_metadata" hcl:"instance_metadata"`
+	SchedulerHints                    *FlatSchedulerHints         `mapstructure:"scheduler_hints" required:"false" cty:"scheduler_hints" hcl:"scheduler_hints"`
+	ServerGroupPolicy                 *string                     `mapstructure:"server_group_policy" required:"false" cty:"server_group_policy" hcl:"server_group_policy"`
+	InstanceMetadataDefaults          *bool                       `mapstructure:"instance_metadata_defaults" required:"false" cty:"instance_metadata_defaults" hcl:"instance_metadata_defaults"`
+	ForceDelete                       *bool                       `mapstructure:"force_delete" required:"false" cty:"force_delete" hcl:"force_delete"`
+	InstanceDescription               *string                     `mapstructure:"instance_description" required:"false" cty:"instance_description" hcl:"instance_description"`
+	InstanceTags                      []string                    `mapstructure:"instance_tags" required:"false" cty:"instance_tags" hcl:"instance_tags"`
+	ConfigDrive                       *bool                       `mapstructure:"config_drive" required:"false" cty:"config_drive" hcl:"config_drive"`
+	FloatingIPPool                    *string                     `mapstructure:"floating_ip_pool" required:"false" cty:"floating_ip_pool" hcl:"floating_ip_pool"`
+	InstanceID                        *string                     `mapstructure:"instance_id" required:"false" cty:"instance_id" hcl:"instance_id"`
+	StopExistingInstance              *bool                       `mapstructure:"stop_existing_instance" required:"false" cty:"stop_existing_instance" hcl:"stop_existing_instance"`
+	ShelveInstance                    *bool                       `mapstructure:"shelve_instance" required:"false" cty:"shelve_instance" hcl:"shelve_instance"`
+	ShelveOffload                     *bool                       `mapstructure:"shelve_offload" required:"false" cty:"shelve_offload" hcl:"shelve_offload"`
+	SnapshotConsistency               *string                     `mapstructure:"snapshot_consistency" required:"false" cty:"snapshot_consistency" hcl:"snapshot_consistency"`
+	SkipStopBeforeImage               *bool                       `mapstructure:"skip_stop_before_image" required:"false" cty:"skip_stop_before_image" hcl:"skip_stop_before_image"`
+	UseBlockStorageVolume             *bool                       `mapstructure:"use_blockstorage_volume" required:"false" cty:"use_blockstorage_volume" hcl:"use_blockstorage_volume"`
+	VolumeName                        *string                     `mapstructure:"volume_name" required:"false" cty:"volume_name" hcl:"volume_name"`
+	VolumeType                        *string                     `mapstructure:"volume_type" required:"false" cty:"volume_type" hcl:"volume_type"`
+	VolumeSize                        *int                        `mapstructure:"volume_size" required:"false" cty:"volume_size" hcl:"volume_size"`
+	VolumeAvailabilityZone            *string                     `mapstructure:"volume_availability_zone" required:"false" cty:"volume_availability_zone" hcl:"volume_availability_zone"`
+	VolumeUploadForce                 *bool                       `mapstructure:"volume_upload_force" required:"false" cty:"volume_upload_force" hcl:"volume_upload_force"`
+	KeepVolume                        *bool                       `mapstructure:"keep_volume" required:"false" cty:"keep_volume" hcl:"keep_volume"`
+	BootVolumeDeleteOnTermination     *bool                       `mapstructure:"boot_volume_delete_on_termination" required:"false" cty:"boot_volume_delete_on_termination" hcl:"boot_volume_delete_on_termination"`
+	BlockDeviceMappings               []FlatBlockDeviceMapping    `mapstructure:"block_device_mappings" required:"false" cty:"block_device_mappings" hcl:"block_device_mappings"`
+	BlockDeviceSnapshotMode           *string                     `mapstructure:"block_device_snapshot_mode" required:"false" cty:"block_device_snapshot_mode" hcl:"block_device_snapshot_mode"`
+	AttachVolumes                     []FlatAttachVolume          `mapstructure:"attach_volumes" required:"false" cty:"attach_volumes" hcl:"attach_volumes"`
+	EphemeralSizeGB                   *int                        `mapstructure:"ephemeral_size_gb" required:"false" cty:"ephemeral_size_gb" hcl:"ephemeral_size_gb"`
+	EphemeralGuestFormat              *string                     `mapstructure:"ephemeral_guest_format" required:"false" cty:"ephemeral_guest_format" hcl:"ephemeral_guest_format"`
+	SwapSizeMB                        *int                        `mapstructure:"swap_size_mb" required:"false" cty:"swap_size_mb" hcl:"swap_size_mb"`
+	OpenstackProvider                 *string                     `mapstructure:"openstack_provider" cty:"openstack_provider" hcl:"openstack_provider"`
+	UseFloatingIp                     *bool                       `mapstructure:"use_floating_ip" required:"false" cty:"use_floating_ip" hcl:"use_floating_ip"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -143,124 +341,264 @@ func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec }
 // The decoded values from this spec will then be applied to a FlatConfig.
 func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"packer_build_name":                &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
-		"packer_builder_type":              &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
-		"packer_core_version":              &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
-		"packer_debug":                     &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
-		"packer_force":                     &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
-		"packer_on_error":                  &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
-		"packer_user_variables":            &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
-		"packer_sensitive_variables":       &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
-		"username":                         &hcldec.AttrSpec{Name: "username", Type: cty.String, Required: false},
-		"user_id":                          &hcldec.AttrSpec{Name: "user_id", Type: cty.String, Required: false},
-		"password":                         &hcldec.AttrSpec{Name: "password", Type: cty.String, Required: false},
-		"identity_endpoint":                &hcldec.AttrSpec{Name: "identity_endpoint", Type: cty.String, Required: false},
-		"tenant_id":                        &hcldec.AttrSpec{Name: "tenant_id", Type: cty.String, Required: false},
-		"tenant_name":                      &hcldec.AttrSpec{Name: "tenant_name", Type: cty.String, Required: false},
-		"domain_id":                        &hcldec.AttrSpec{Name: "domain_id", Type: cty.String, Required: false},
-		"domain_name":                      &hcldec.AttrSpec{Name: "domain_name", Type: cty.String, Required: false},
-		"insecure":                         &hcldec.AttrSpec{Name: "insecure", Type: cty.Bool, Required: false},
-		"region":                           &hcldec.AttrSpec{Name: "region", Type: cty.String, Required: false},
-		"endpoint_type":                    &hcldec.AttrSpec{Name: "endpoint_type", Type: cty.String, Required: false},
-		"cacert":                           &hcldec.AttrSpec{Name: "cacert", Type: cty.String, Required: false},
-		"cert":                             &hcldec.AttrSpec{Name: "cert", Type: cty.String, Required: false},
-		"key":                              &hcldec.AttrSpec{Name: "key", Type: cty.String, Required: false},
-		"token":                            &hcldec.AttrSpec{Name: "token", Type: cty.String, Required: false},
-		"application_credential_name":      &hcldec.AttrSpec{Name: "application_credential_name", Type: cty.String, Required: false},
-		"application_credential_id":        &hcldec.AttrSpec{Name: "application_credential_id", Type: cty.String, Required: false},
-		"application_credential_secret":    &hcldec.AttrSpec{Name: "application_credential_secret", Type: cty.String, Required: false},
-		"cloud":                            &hcldec.AttrSpec{Name: "cloud", Type: cty.String, Required: false},
-		"image_name":                       &hcldec.AttrSpec{Name: "image_name", Type: cty.String, Required: false},
-		"metadata":                         &hcldec.AttrSpec{Name: "metadata", Type: cty.Map(cty.String), Required: false},
-		"image_visibility":                 &hcldec.AttrSpec{Name: "image_visibility", Type: cty.String, Required: false},
-		"image_members":                    &hcldec.AttrSpec{Name: "image_members", Type: cty.List(cty.String), Required: false},
-		"image_auto_accept_members":        &hcldec.AttrSpec{Name: "image_auto_accept_members", Type: cty.Bool, Required: false},
-		"image_disk_format":                &hcldec.AttrSpec{Name: "image_disk_format", Type: cty.String, Required: false},
-		"image_tags":                       &hcldec.AttrSpec{Name: "image_tags", Type: cty.List(cty.String), Required: false},
-		"image_min_disk":                   &hcldec.AttrSpec{Name: "image_min_disk", Type: cty.Number, Required: false},
-		"skip_create_image":                &hcldec.AttrSpec{Name: "skip_create_image", Type: cty.Bool, Required: false},
-		"communicator":                     &hcldec.AttrSpec{Name: "communicator", Type: cty.String, Required: false},
-		"pause_before_connecting":          &hcldec.AttrSpec{Name: "pause_before_connecting", Type: cty.String, Required: false},
-		"ssh_host":                         &hcldec.AttrSpec{Name: "ssh_host", Type: cty.String, Required: false},
-		"ssh_port":                         &hcldec.AttrSpec{Name: "ssh_port", Type: cty.Number, Required: false},
-		"ssh_username":                     &hcldec.AttrSpec{Name: "ssh_username", Type: cty.String, Required: false},
-		"ssh_password":                     &hcldec.AttrSpec{Name: "ssh_password", Type: cty.String, Required: false},
-		"ssh_keypair_name":                 &hcldec.AttrSpec{Name: "ssh_keypair_name", Type: cty.String, Required: false},
-		"temporary_key_pair_name":          &hcldec.AttrSpec{Name: "temporary_key_pair_name", Type: cty.String, Required: false},
-		"temporary_key_pair_type":          &hcldec.AttrSpec{Name: "temporary_key_pair_type", Type: cty.String, Required: false},
-		"temporary_key_pair_bits":          &hcldec.AttrSpec{Name: "temporary_key_pair_bits", Type: cty.Number, Required: false},
-		"ssh_ciphers":                      &hcldec.AttrSpec{Name: "ssh_ciphers", Type: cty.List(cty.String), Required: false},
-		"ssh_clear_authorized_keys":        &hcldec.AttrSpec{Name: "ssh_clear_authorized_keys", Type: cty.Bool, Required: false},
-		"ssh_key_exchange_algorithms":      &hcldec.AttrSpec{Name: "ssh_key_exchange_algorithms", Type: cty.List(cty.String), Required: false},
-		"ssh_private_key_file":             &hcldec.AttrSpec{Name: "ssh_private_key_file", Type: cty.String, Required: false},
-		"ssh_certificate_file":             &hcldec.AttrSpec{Name: "ssh_certificate_file", Type: cty.String, Required: false},
-		"ssh_pty":                          &hcldec.AttrSpec{Name: "ssh_pty", Type: cty.Bool, Required: false},
-		"ssh_timeout":                      &hcldec.AttrSpec{Name: "ssh_timeout", Type: cty.String, Required: false},
-		"ssh_wait_timeout":                 &hcldec.AttrSpec{Name: "ssh_wait_timeout", Type: cty.String, Required: false},
-		"ssh_agent_auth":                   &hcldec.AttrSpec{Name: "ssh_agent_auth", Type: cty.Bool, Required: false},
-		"ssh_disable_agent_forwarding":     &hcldec.AttrSpec{Name: "ssh_disable_agent_forwarding", Type: cty.Bool, Required: false},
-		"ssh_handshake_attempts":           &hcldec.AttrSpec{Name: "ssh_handshake_attempts", Type: cty.Number, Required: false},
-		"ssh_bastion_host":                 &hcldec.AttrSpec{Name: "ssh_bastion_host", Type: cty.String, Required: false},
-		"ssh_bastion_port":                 &hcldec.AttrSpec{Name: "ssh_bastion_port", Type: cty.Number, Required: false},
-		"ssh_bastion_agent_auth":           &hcldec.AttrSpec{Name: "ssh_bastion_agent_auth", Type: cty.Bool, Required: false},
-		"ssh_bastion_username":             &hcldec.AttrSpec{Name: "ssh_bastion_username", Type: cty.String, Required: false},
-		"ssh_bastion_password":             &hcldec.AttrSpec{Name: "ssh_bastion_password", Type: cty.String, Required: false},
-		"ssh_bastion_interactive":          &hcldec.AttrSpec{Name: "ssh_bastion_interactive", Type: cty.Bool, Required: false},
-		"ssh_bastion_private_key_file":     &hcldec.AttrSpec{Name: "ssh_bastion_private_key_file", Type: cty.String, Required: false},
-		"ssh_bastion_certificate_file":     &hcldec.AttrSpec{Name: "ssh_bastion_certificate_file", Type: cty.String, Required: false},
-		"ssh_file_transfer_method":         &hcldec.AttrSpec{Name: "ssh_file_transfer_method", Type: cty.String, Required: false},
-		"ssh_proxy_host":                   &hcldec.AttrSpec{Name: "ssh_proxy_host", Type: cty.String, Required: false},
-		"ssh_proxy_port":                   &hcldec.AttrSpec{Name: "ssh_proxy_port", Type: cty.Number, Required: false},
-		"ssh_proxy_username":               &hcldec.AttrSpec{Name: "ssh_proxy_username", Type: cty.String, Required: false},
-		"ssh_proxy_password":               &hcldec.AttrSpec{Name: "ssh_proxy_password", Type: cty.String, Required: false},
-		"ssh_keep_alive_interval":          &hcldec.AttrSpec{Name: "ssh_keep_alive_interval", Type: cty.String, Required: false},
-		"ssh_read_write_timeout":           &hcldec.AttrSpec{Name: "ssh_read_write_timeout", Type: cty.String, Required: false},
-		"ssh_remote_tunnels":               &hcldec.AttrSpec{Name: "ssh_remote_tunnels", Type: cty.List(cty.String), Required: false},
-		"ssh_local_tunnels":                &hcldec.AttrSpec{Name: "ssh_local_tunnels", Type: cty.List(cty.String), Required: false},
-		"ssh_public_key":                   &hcldec.AttrSpec{Name: "ssh_public_key", Type: cty.List(cty.Number), Required: false},
-		"ssh_private_key":                  &hcldec.AttrSpec{Name: "ssh_private_key", Type: cty.List(cty.Number), Required: false},
-		"winrm_username":                   &hcldec.AttrSpec{Name: "winrm_username", Type: cty.String, Required: false},
-		"winrm_password":                   &hcldec.AttrSpec{Name: "winrm_password", Type: cty.String, Required: false},
-		"winrm_host":                       &hcldec.AttrSpec{Name: "winrm_host", Type: cty.String, Required: false},
-		"winrm_no_proxy":                   &hcldec.AttrSpec{Name: "winrm_no_proxy", Type: cty.Bool, Required: false},
-		"winrm_port":                       &hcldec.AttrSpec{Name: "winrm_port", Type: cty.Number, Required: false},
-		"winrm_timeout":                    &hcldec.AttrSpec{Name: "winrm_timeout", Type: cty.String, Required: false},
-		"winrm_use_ssl":                    &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
-		"winrm_insecure":                   &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
-		"winrm_use_ntlm":                   &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
-		"ssh_interface":                    &hcldec.AttrSpec{Name: "ssh_interface", Type: cty.String, Required: false},
-		"ssh_ip_version":                   &hcldec.AttrSpec{Name: "ssh_ip_version", Type: cty.String, Required: false},
-		"source_image":                     &hcldec.AttrSpec{Name: "source_image", Type: cty.String, Required: false},
-		"source_image_name":                &hcldec.AttrSpec{Name: "source_image_name", Type: cty.String, Required: false},
-		"external_source_image_url":        &hcldec.AttrSpec{Name: "external_source_image_url", Type: cty.String, Required: false},
-		"external_source_image_format":     &hcldec.AttrSpec{Name: "external_source_image_format", Type: cty.String, Required: false},
-		"external_source_image_properties": &hcldec.AttrSpec{Name: "external_source_image_properties", Type: cty.Map(cty.String), Required: false},
-		"source_image_filter":              &hcldec.BlockSpec{TypeName: "source_image_filter", Nested: hcldec.ObjectSpec((*FlatImageFilter)(nil).HCL2Spec())},
-		"flavor":                           &hcldec.AttrSpec{Name: "flavor", Type: cty.String, Required: false},
-		"availability_zone":                &hcldec.AttrSpec{Name: "availability_zone", Type: cty.String, Required: false},
-		"rackconnect_wait":                 &hcldec.AttrSpec{Name: "rackconnect_wait", Type: cty.Bool, Required: false},
-		"floating_ip_network":              &hcldec.AttrSpec{Name: "floating_ip_network", Type: cty.String, Required: false},
-		"instance_floating_ip_net":         &hcldec.AttrSpec{Name: "instance_floating_ip_net", Type: cty.String, Required: false},
-		"floating_ip":                      &hcldec.AttrSpec{Name: "floating_ip", Type: cty.String, Required: false},
-		"reuse_ips":                        &hcldec.AttrSpec{Name: "reuse_ips", Type: cty.Bool, Required: false},
-		"security_groups":                  &hcldec.AttrSpec{Name: "security_groups", Type: cty.List(cty.String), Required: false},
-		"networks":                         &hcldec.AttrSpec{Name: "networks", Type: cty.List(cty.String), Required: false},
-		"ports":                            &hcldec.AttrSpec{Name: "ports", Type: cty.List(cty.String), Required: false},
-		"network_discovery_cidrs":          &hcldec.AttrSpec{Name: "network_discovery_cidrs", Type: cty.List(cty.String), Required: false},
-		"user_data":                        &hcldec.AttrSpec{Name: "user_data", Type: cty.String, Required: false},
-		"user_data_file":                   &hcldec.AttrSpec{Name: "user_data_file", Type: cty.String, Required: false},
-		"instance_name":                    &hcldec.AttrSpec{Name: "instance_name", Type: cty.String, Required: false},
-		"instance_metadata":                &hcldec.AttrSpec{Name: "instance_metadata", Type: cty.Map(cty.String), Required: false},
-		"force_delete":                     &hcldec.AttrSpec{Name: "force_delete", Type: cty.Bool, Required: false},
-		"config_drive":                     &hcldec.AttrSpec{Name: "config_drive", Type: cty.Bool, Required: false},
-		"floating_ip_pool":                 &hcldec.AttrSpec{Name: "floating_ip_pool", Type: cty.String, Required: false},
-		"use_blockstorage_volume":          &hcldec.AttrSpec{Name: "use_blockstorage_volume", Type: cty.Bool, Required: false},
-		"volume_name":                      &hcldec.AttrSpec{Name: "volume_name", Type: cty.String, Required: false},
-		"volume_type":                      &hcldec.AttrSpec{Name: "volume_type", Type: cty.String, Required: false},
-		"volume_size":                      &hcldec.AttrSpec{Name: "volume_size", Type: cty.Number, Required: false},
-		"volume_availability_zone":         &hcldec.AttrSpec{Name: "volume_availability_zone", Type: cty.String, Required: false},
-		"openstack_provider":               &hcldec.AttrSpec{Name: "openstack_provider", Type: cty.String, Required: false},
-		"use_floating_ip":                  &hcldec.AttrSpec{Name: "use_floating_ip", Type: cty.Bool, Required: false},
+		"packer_build_name":                     &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":                   &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":                   &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":                          &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":                          &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":                       &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":                 &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables":            &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"username":                              &hcldec.AttrSpec{Name: "username", Type: cty.String, Required: false},
+		"user_id":                               &hcldec.AttrSpec{Name: "user_id", Type: cty.String, Required: false},
+		"password":                              &hcldec.AttrSpec{Name: "password", Type: cty.String, Required: false},
+		"identity_endpoint":                     &hcldec.AttrSpec{Name: "identity_endpoint", Type: cty.String, Required: false},
+		"tenant_id":                             &hcldec.AttrSpec{Name: "tenant_id", Type: cty.String, Required: false},
+		"tenant_name":                           &hcldec.AttrSpec{Name: "tenant_name", Type: cty.String, Required: false},
+		"domain_id":                             &hcldec.AttrSpec{Name: "domain_id", Type: cty.String, Required: false},
+		"domain_name":                           &hcldec.AttrSpec{Name: "domain_name", Type: cty.String, Required: false},
+		"insecure":                              &hcldec.AttrSpec{Name: "insecure", Type: cty.Bool, Required: false},
+		"region":                                &hcldec.AttrSpec{Name: "region", Type: cty.String, Required: false},
+		"endpoint_type":                         &hcldec.AttrSpec{Name: "endpoint_type", Type: cty.String, Required: false},
+		"cacert":                                &hcldec.AttrSpec{Name: "cacert", Type: cty.String, Required: false},
+		"cert":                                  &hcldec.AttrSpec{Name: "cert", Type: cty.String, Required: false},
+		"key":                                   &hcldec.AttrSpec{Name: "key", Type: cty.String, Required: false},
+		"token":                                 &hcldec.AttrSpec{Name: "token", Type: cty.String, Required: false},
+		"application_credential_name":           &hcldec.AttrSpec{Name: "application_credential_name", Type: cty.String, Required: false},
+		"application_credential_id":             &hcldec.AttrSpec{Name: "application_credential_id", Type: cty.String, Required: false},
+		"application_credential_secret":         &hcldec.AttrSpec{Name: "application_credential_secret", Type: cty.String, Required: false},
+		"cloud":                                 &hcldec.AttrSpec{Name: "cloud", Type: cty.String, Required: false},
+		"compute_api_microversion":              &hcldec.AttrSpec{Name: "compute_api_microversion", Type: cty.String, Required: false},
+		"image_name":                            &hcldec.AttrSpec{Name: "image_name", Type: cty.String, Required: false},
+		"metadata":                              &hcldec.AttrSpec{Name: "metadata", Type: cty.Map(cty.String), Required: false},
+		"image_provenance_metadata":             &hcldec.AttrSpec{Name: "image_provenance_metadata", Type: cty.Bool, Required: false},
+		"image_guest_agent":                     &hcldec.AttrSpec{Name: "image_guest_agent", Type: cty.Bool, Required: false},
+		"image_disk_bus":                        &hcldec.AttrSpec{Name: "image_disk_bus", Type: cty.String, Required: false},
+		"image_scsi_model":                      &hcldec.AttrSpec{Name: "image_scsi_model", Type: cty.String, Required: false},
+		"image_vif_model":                       &hcldec.AttrSpec{Name: "image_vif_model", Type: cty.String, Required: false},
+		"image_vif_multiqueue":                  &hcldec.AttrSpec{Name: "image_vif_multiqueue", Type: cty.Bool, Required: false},
+		"boot_firmware":                         &hcldec.AttrSpec{Name: "boot_firmware", Type: cty.String, Required: false},
+		"secure_boot":                           &hcldec.AttrSpec{Name: "secure_boot", Type: cty.Bool, Required: false},
+		"vtpm":                                  &hcldec.AttrSpec{Name: "vtpm", Type: cty.Bool, Required: false},
+		"image_visibility":                      &hcldec.AttrSpec{Name: "image_visibility", Type: cty.String, Required: false},
+		"image_members":                         &hcldec.AttrSpec{Name: "image_members", Type: cty.List(cty.String), Required: false},
+		"image_auto_accept_members":             &hcldec.AttrSpec{Name: "image_auto_accept_members", Type: cty.Bool, Required: false},
+		"image_disk_format":                     &hcldec.AttrSpec{Name: "image_disk_format", Type: cty.String, Required: false},
+		"image_container_format":                &hcldec.AttrSpec{Name: "image_container_format", Type: cty.String, Required: false},
+		"image_conversion_local_fallback":       &hcldec.AttrSpec{Name: "image_conversion_local_fallback", Type: cty.Bool, Required: false},
+		"image_conversion_timeout":              &hcldec.AttrSpec{Name: "image_conversion_timeout", Type: cty.String, Required: false},
+		"image_use_import":                      &hcldec.AttrSpec{Name: "image_use_import", Type: cty.Bool, Required: false},
+		"image_tags":                            &hcldec.AttrSpec{Name: "image_tags", Type: cty.List(cty.String), Required: false},
+		"image_min_disk":                        &hcldec.AttrSpec{Name: "image_min_disk", Type: cty.String, Required: false},
+		"image_min_ram":                         &hcldec.AttrSpec{Name: "image_min_ram", Type: cty.Number, Required: false},
+		"image_protected":                       &hcldec.AttrSpec{Name: "image_protected", Type: cty.Bool, Required: false},
+		"image_hidden":                          &hcldec.AttrSpec{Name: "image_hidden", Type: cty.Bool, Required: false},
+		"image_inherit_properties":              &hcldec.BlockSpec{TypeName: "image_inherit_properties", Nested: hcldec.ObjectSpec((*FlatImageInheritProperties)(nil).HCL2Spec())},
+		"image_deactivate":                      &hcldec.AttrSpec{Name: "image_deactivate", Type: cty.Bool, Required: false},
+		"image_creation_timeout":                &hcldec.AttrSpec{Name: "image_creation_timeout", Type: cty.String, Required: false},
+		"image_update_timeout":                  &hcldec.AttrSpec{Name: "image_update_timeout", Type: cty.String, Required: false},
+		"image_export_path":                     &hcldec.AttrSpec{Name: "image_export_path", Type: cty.String, Required: false},
+		"image_stores":                          &hcldec.AttrSpec{Name: "image_stores", Type: cty.List(cty.String), Required: false},
+		"image_stores_timeout":                  &hcldec.AttrSpec{Name: "image_stores_timeout", Type: cty.String, Required: false},
+		"image_copy_regions":                    &hcldec.AttrSpec{Name: "image_copy_regions", Type: cty.List(cty.String), Required: false},
+		"overwrite_image":                       &hcldec.AttrSpec{Name: "overwrite_image", Type: cty.Bool, Required: false},
+		"image_retention":                       &hcldec.BlockSpec{TypeName: "image_retention", Nested: hcldec.ObjectSpec((*FlatImageRetention)(nil).HCL2Spec())},
+		"skip_create_image":                     &hcldec.AttrSpec{Name: "skip_create_image", Type: cty.Bool, Required: false},
+		"communicator":                          &hcldec.AttrSpec{Name: "communicator", Type: cty.String, Required: false},
+		"pause_before_connecting":               &hcldec.AttrSpec{Name: "pause_before_connecting", Type: cty.String, Required: false},
+		"ssh_host":                              &hcldec.AttrSpec{Name: "ssh_host", Type: cty.String, Required: false},
+		"ssh_port":                              &hcldec.AttrSpec{Name: "ssh_port", Type: cty.Number, Required: false},
+		"ssh_username":                          &hcldec.AttrSpec{Name: "ssh_username", Type: cty.String, Required: false},
+		"ssh_password":                          &hcldec.AttrSpec{Name: "ssh_password", Type: cty.String, Required: false},
+		"ssh_keypair_name":                      &hcldec.AttrSpec{Name: "ssh_keypair_name", Type: cty.String, Required: false},
+		"temporary_key_pair_name":               &hcldec.AttrSpec{Name: "temporary_key_pair_name", Type: cty.String, Required: false},
+		"temporary_key_pair_type":               &hcldec.AttrSpec{Name: "temporary_key_pair_type", Type: cty.String, Required: false},
+		"temporary_key_pair_bits":               &hcldec.AttrSpec{Name: "temporary_key_pair_bits", Type: cty.Number, Required: false},
+		"ssh_ciphers":                           &hcldec.AttrSpec{Name: "ssh_ciphers", Type: cty.List(cty.String), Required: false},
+		"ssh_clear_authorized_keys":             &hcldec.AttrSpec{Name: "ssh_clear_authorized_keys", Type: cty.Bool, Required: false},
+		"ssh_key_exchange_algorithms":           &hcldec.AttrSpec{Name: "ssh_key_exchange_algorithms", Type: cty.List(cty.String), Required: false},
+		"ssh_private_key_file":                  &hcldec.AttrSpec{Name: "ssh_private_key_file", Type: cty.String, Required: false},
+		"ssh_certificate_file":                  &hcldec.AttrSpec{Name: "ssh_certificate_file", Type: cty.String, Required: false},
+		"ssh_pty":                               &hcldec.AttrSpec{Name: "ssh_pty", Type: cty.Bool, Required: false},
+		"ssh_timeout":                           &hcldec.AttrSpec{Name: "ssh_timeout", Type: cty.String, Required: false},
+		"ssh_wait_timeout":                      &hcldec.AttrSpec{Name: "ssh_wait_timeout", Type: cty.String, Required: false},
+		"ssh_agent_auth":                        &hcldec.AttrSpec{Name: "ssh_agent_auth", Type: cty.Bool, Required: false},
+		"ssh_disable_agent_forwarding":          &hcldec.AttrSpec{Name: "ssh_disable_agent_forwarding", Type: cty.Bool, Required: false},
+		"ssh_handshake_attempts":                &hcldec.AttrSpec{Name: "ssh_handshake_attempts", Type: cty.Number, Required: false},
+		"ssh_bastion_host":                      &hcldec.AttrSpec{Name: "ssh_bastion_host", Type: cty.String, Required: false},
+		"ssh_bastion_port":                      &hcldec.AttrSpec{Name: "ssh_bastion_port", Type: cty.Number, Required: false},
+		"ssh_bastion_agent_auth":                &hcldec.AttrSpec{Name: "ssh_bastion_agent_auth", Type: cty.Bool, Required: false},
+		"ssh_bastion_username":                  &hcldec.AttrSpec{Name: "ssh_bastion_username", Type: cty.String, Required: false},
+		"ssh_bastion_password":                  &hcldec.AttrSpec{Name: "ssh_bastion_password", Type: cty.String, Required: false},
+		"ssh_bastion_interactive":               &hcldec.AttrSpec{Name: "ssh_bastion_interactive", Type: cty.Bool, Required: false},
+		"ssh_bastion_private_key_file":          &hcldec.AttrSpec{Name: "ssh_bastion_private_key_file", Type: cty.String, Required: false},
+		"ssh_bastion_certificate_file":          &hcldec.AttrSpec{Name: "ssh_bastion_certificate_file", Type: cty.String, Required: false},
+		"ssh_file_transfer_method":              &hcldec.AttrSpec{Name: "ssh_file_transfer_method", Type: cty.String, Required: false},
+		"ssh_proxy_host":                        &hcldec.AttrSpec{Name: "ssh_proxy_host", Type: cty.String, Required: false},
+		"ssh_proxy_port":                        &hcldec.AttrSpec{Name: "ssh_proxy_port", Type: cty.Number, Required: false},
+		"ssh_proxy_username":                    &hcldec.AttrSpec{Name: "ssh_proxy_username", Type: cty.String, Required: false},
+		"ssh_proxy_password":                    &hcldec.AttrSpec{Name: "ssh_proxy_password", Type: cty.String, Required: false},
+		"ssh_keep_alive_interval":               &hcldec.AttrSpec{Name: "ssh_keep_alive_interval", Type: cty.String, Required: false},
+		"ssh_read_write_timeout":                &hcldec.AttrSpec{Name: "ssh_read_write_timeout", Type: cty.String, Required: false},
+		"ssh_remote_tunnels":                    &hcldec.AttrSpec{Name: "ssh_remote_tunnels", Type: cty.List(cty.String), Required: false},
+		"ssh_local_tunnels":                     &hcldec.AttrSpec{Name: "ssh_local_tunnels", Type: cty.List(cty.String), Required: false},
+		"ssh_public_key":                        &hcldec.AttrSpec{Name: "ssh_public_key", Type: cty.List(cty.Number), Required: false},
+		"ssh_private_key":                       &hcldec.AttrSpec{Name: "ssh_private_key", Type: cty.List(cty.Number), Required: false},
+		"winrm_username":                        &hcldec.AttrSpec{Name: "winrm_username", Type: cty.String, Required: false},
+		"winrm_password":                        &hcldec.AttrSpec{Name: "winrm_password", Type: cty.String, Required: false},
+		"winrm_host":                            &hcldec.AttrSpec{Name: "winrm_host", Type: cty.String, Required: false},
+		"winrm_no_proxy":                        &hcldec.AttrSpec{Name: "winrm_no_proxy", Type: cty.Bool, Required: false},
+		"winrm_port":                            &hcldec.AttrSpec{Name: "winrm_port", Type: cty.Number, Required: false},
+		"winrm_timeout":                         &hcldec.AttrSpec{Name: "winrm_timeout", Type: cty.String, Required: false},
+		"winrm_use_ssl":                         &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
+		"winrm_insecure":                        &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
+		"winrm_use_ntlm":                        &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
+		"ssh_interface":                         &hcldec.AttrSpec{Name: "ssh_interface", Type: cty.String, Required: false},
+		"communicator_network":                  &hcldec.AttrSpec{Name: "communicator_network", Type: cty.String, Required: false},
+		"attach_networks_after_boot":            &hcldec.AttrSpec{Name: "attach_networks_after_boot", Type: cty.List(cty.String), Required: false},
+		"keep_attached_networks":                &hcldec.AttrSpec{Name: "keep_attached_networks", Type: cty.Bool, Required: false},
+		"ssh_ip_version":                        &hcldec.AttrSpec{Name: "ssh_ip_version", Type: cty.String, Required: false},
+		"use_ipv6":                              &hcldec.AttrSpec{Name: "use_ipv6", Type: cty.Bool, Required: false},
+		"ipv6_address_timeout":                  &hcldec.AttrSpec{Name: "ipv6_address_timeout", Type: cty.String, Required: false},
+		"windows_password_timeout":              &hcldec.AttrSpec{Name: "windows_password_timeout", Type: cty.String, Required: false},
+		"windows_password_poll_interval":        &hcldec.AttrSpec{Name: "windows_password_poll_interval", Type: cty.String, Required: false},
+		"state_poll_interval":                   &hcldec.AttrSpec{Name: "state_poll_interval", Type: cty.String, Required: false},
+		"state_poll_max_interval":               &hcldec.AttrSpec{Name: "state_poll_max_interval", Type: cty.String, Required: false},
+		"wait_for_cloud_init":                   &hcldec.AttrSpec{Name: "wait_for_cloud_init", Type: cty.Bool, Required: false},
+		"cloud_init_timeout":                    &hcldec.AttrSpec{Name: "cloud_init_timeout", Type: cty.String, Required: false},
+		"cloud_init_allow_degraded":             &hcldec.AttrSpec{Name: "cloud_init_allow_degraded", Type: cty.Bool, Required: false},
+		"on_failure_console_log":                &hcldec.AttrSpec{Name: "on_failure_console_log", Type: cty.Bool, Required: false},
+		"console_log_path":                      &hcldec.AttrSpec{Name: "console_log_path", Type: cty.String, Required: false},
+		"console_log_lines":                     &hcldec.AttrSpec{Name: "console_log_lines", Type: cty.Number, Required: false},
+		"temporary_key_pair_save_path":          &hcldec.AttrSpec{Name: "temporary_key_pair_save_path", Type: cty.String, Required: false},
+		"source_image":                          &hcldec.AttrSpec{Name: "source_image", Type: cty.String, Required: false},
+		"source_image_name":                     &hcldec.AttrSpec{Name: "source_image_name", Type: cty.String, Required: false},
+		"external_source_image_url":             &hcldec.AttrSpec{Name: "external_source_image_url", Type: cty.String, Required: false},
+		"source_volume":                         &hcldec.AttrSpec{Name: "source_volume", Type: cty.String, Required: false},
+		"clone_source_volume":                   &hcldec.AttrSpec{Name: "clone_source_volume", Type: cty.Bool, Required: false},
+		"source_volume_snapshot":                &hcldec.AttrSpec{Name: "source_volume_snapshot", Type: cty.String, Required: false},
+		"source_volume_snapshot_most_recent":    &hcldec.AttrSpec{Name: "source_volume_snapshot_most_recent", Type: cty.Bool, Required: false},
+		"source_image_file":                     &hcldec.AttrSpec{Name: "source_image_file", Type: cty.String, Required: false},
+		"external_source_image_format":          &hcldec.AttrSpec{Name: "external_source_image_format", Type: cty.String, Required: false},
+		"external_source_image_properties":      &hcldec.AttrSpec{Name: "external_source_image_properties", Type: cty.Map(cty.String), Required: false},
+		"external_source_image_checksum":        &hcldec.AttrSpec{Name: "external_source_image_checksum", Type: cty.String, Required: false},
+		"keep_source_image":                     &hcldec.AttrSpec{Name: "keep_source_image", Type: cty.Bool, Required: false},
+		"source_image_filter":                   &hcldec.BlockSpec{TypeName: "source_image_filter", Nested: hcldec.ObjectSpec((*FlatImageFilter)(nil).HCL2Spec())},
+		"source_image_accept_membership":        &hcldec.AttrSpec{Name: "source_image_accept_membership", Type: cty.Bool, Required: false},
+		"flavor":                                &hcldec.AttrSpec{Name: "flavor", Type: cty.String, Required: false},
+		"flavor_filter":                         &hcldec.BlockSpec{TypeName: "flavor_filter", Nested: hcldec.ObjectSpec((*FlatFlavorFilter)(nil).HCL2Spec())},
+		"flavor_regex":                          &hcldec.AttrSpec{Name: "flavor_regex", Type: cty.String, Required: false},
+		"flavor_regex_select":                   &hcldec.AttrSpec{Name: "flavor_regex_select", Type: cty.String, Required: false},
+		"source_image_flavor_check":             &hcldec.AttrSpec{Name: "source_image_flavor_check", Type: cty.String, Required: false},
+		"availability_zone":                     &hcldec.AttrSpec{Name: "availability_zone", Type: cty.String, Required: false},
+		"availability_zones":                    &hcldec.AttrSpec{Name: "availability_zones", Type: cty.List(cty.String), Required: false},
+		"availability_zone_timeout":             &hcldec.AttrSpec{Name: "availability_zone_timeout", Type: cty.String, Required: false},
+		"scheduling_retries":                    &hcldec.AttrSpec{Name: "scheduling_retries", Type: cty.Number, Required: false},
+		"scheduling_retry_delay":                &hcldec.AttrSpec{Name: "scheduling_retry_delay", Type: cty.String, Required: false},
+		"flavor_fallbacks":                      &hcldec.AttrSpec{Name: "flavor_fallbacks", Type: cty.List(cty.String), Required: false},
+		"rackconnect_wait":                      &hcldec.AttrSpec{Name: "rackconnect_wait", Type: cty.Bool, Required: false},
+		"floating_ip_network":                   &hcldec.AttrSpec{Name: "floating_ip_network", Type: cty.String, Required: false},
+		"floating_ip_networks":                  &hcldec.AttrSpec{Name: "floating_ip_networks", Type: cty.List(cty.String), Required: false},
+		"floating_ip_subnet":                    &hcldec.AttrSpec{Name: "floating_ip_subnet", Type: cty.String, Required: false},
+		"floating_ip_description":               &hcldec.AttrSpec{Name: "floating_ip_description", Type: cty.String, Required: false},
+		"instance_floating_ip_net":              &hcldec.AttrSpec{Name: "instance_floating_ip_net", Type: cty.String, Required: false},
+		"instance_floating_ip_net_fallback":     &hcldec.AttrSpec{Name: "instance_floating_ip_net_fallback", Type: cty.Bool, Required: false},
+		"floating_ip":                           &hcldec.AttrSpec{Name: "floating_ip", Type: cty.String, Required: false},
+		"reuse_ips":                             &hcldec.AttrSpec{Name: "reuse_ips", Type: cty.Bool, Required: false},
+		"force_new_floating_ip":                 &hcldec.AttrSpec{Name: "force_new_floating_ip", Type: cty.Bool, Required: false},
+		"skip_floating_ip_quota_check":          &hcldec.AttrSpec{Name: "skip_floating_ip_quota_check", Type: cty.Bool, Required: false},
+		"floating_ip_tags":                      &hcldec.AttrSpec{Name: "floating_ip_tags", Type: cty.List(cty.String), Required: false},
+		"floating_ip_associate_retries":         &hcldec.AttrSpec{Name: "floating_ip_associate_retries", Type: cty.Number, Required: false},
+		"floating_ip_associate_retry_delay":     &hcldec.AttrSpec{Name: "floating_ip_associate_retry_delay", Type: cty.String, Required: false},
+		"floating_ip_active_timeout":            &hcldec.AttrSpec{Name: "floating_ip_active_timeout", Type: cty.String, Required: false},
+		"floating_ip_port_active_timeout":       &hcldec.AttrSpec{Name: "floating_ip_port_active_timeout", Type: cty.String, Required: false},
+		"security_groups":                       &hcldec.AttrSpec{Name: "security_groups", Type: cty.List(cty.String), Required: false},
+		"temporary_security_group_source_cidrs": &hcldec.AttrSpec{Name: "temporary_security_group_source_cidrs", Type: cty.List(cty.String), Required: false},
+		"networks":                              &hcldec.AttrSpec{Name: "networks", Type: cty.List(cty.String), Required: false},
+		"network_fixed_ips":                     &hcldec.AttrSpec{Name: "network_fixed_ips", Type: cty.Map(cty.String), Required: false},
+		"network_fixed_ip_ports":                &hcldec.AttrSpec{Name: "network_fixed_ip_ports", Type: cty.Bool, Required: false},
+		"ports":                                 &hcldec.AttrSpec{Name: "ports", Type: cty.List(cty.String), Required: false},
+		"instance_port":                         &hcldec.BlockListSpec{TypeName: "instance_port", Nested: hcldec.ObjectSpec((*FlatInstancePort)(nil).HCL2Spec())},
+		"allowed_address_pairs":                 &hcldec.BlockListSpec{TypeName: "allowed_address_pairs", Nested: hcldec.ObjectSpec((*FlatAddressPair)(nil).HCL2Spec())},
+		"port_qos_policy":                       &hcldec.AttrSpec{Name: "port_qos_policy", Type: cty.String, Required: false},
+		"port_dns_name":                         &hcldec.AttrSpec{Name: "port_dns_name", Type: cty.String, Required: false},
+		"port_dns_domain":                       &hcldec.AttrSpec{Name: "port_dns_domain", Type: cty.String, Required: false},
+		"network_discovery_cidrs":               &hcldec.AttrSpec{Name: "network_discovery_cidrs", Type: cty.List(cty.String), Required: false},
+		"network_discovery_ip_version":          &hcldec.AttrSpec{Name: "network_discovery_ip_version", Type: cty.Number, Required: false},
+		"network_discovery_require_dhcp":        &hcldec.AttrSpec{Name: "network_discovery_require_dhcp", Type: cty.Bool, Required: false},
+		"network_discovery_tags":                &hcldec.AttrSpec{Name: "network_discovery_tags", Type: cty.List(cty.String), Required: false},
+		"network_discovery_match":               &hcldec.AttrSpec{Name: "network_discovery_match", Type: cty.String, Required: false},
+		"user_data":                             &hcldec.AttrSpec{Name: "user_data", Type: cty.String, Required: false},
+		"user_data_file":                        &hcldec.AttrSpec{Name: "user_data_file", Type: cty.String, Required: false},
+		"user_data_parts":                       &hcldec.BlockListSpec{TypeName: "user_data_parts", Nested: hcldec.ObjectSpec((*FlatUserDataPart)(nil).HCL2Spec())},
+		"user_data_gzip":                        &hcldec.AttrSpec{Name: "user_data_gzip", Type: cty.Bool, Required: false},
+		"personality":                           &hcldec.BlockListSpec{TypeName: "personality", Nested: hcldec.ObjectSpec((*FlatPersonalityFile)(nil).HCL2Spec())},
+		"admin_password":                        &hcldec.AttrSpec{Name: "admin_password", Type: cty.String, Required: false},
+		"trusted_image_certificate_ids":         &hcldec.AttrSpec{Name: "trusted_image_certificate_ids", Type: cty.List(cty.String), Required: false},
+		"trusted_image_certificate_property":    &hcldec.AttrSpec{Name: "trusted_image_certificate_property", Type: cty.Bool, Required: false},
+		"instance_name":                         &hcldec.AttrSpec{Name: "instance_name", Type: cty.String, Required: false},
+		"instance_metadata":                     &hcldec.AttrSpec{Name: "instance_metadata", Type: cty.Map(cty.String), Required: false},
+		"scheduler_hints":                       &hcldec.BlockSpec{TypeName: "scheduler_hints", Nested: hcldec.ObjectSpec((*FlatSchedulerHints)(nil).HCL2Spec())},
+		"server_group_policy":                   &hcldec.AttrSpec{Name: "server_group_policy", Type: cty.String, Required: false},
+		"instance_metadata_defaults":            &hcldec.AttrSpec{Name: "instance_metadata_defaults", Type: cty.Bool, Required: false},
+		"force_delete":                          &hcldec.AttrSpec{Name: "force_delete", Type: cty.Bool, Required: false},
+		"instance_description":                  &hcldec.AttrSpec{Name: "instance_description", Type: cty.String, Required: false},
+		"instance_tags":                         &hcldec.AttrSpec{Name: "instance_tags", Type: cty.List(cty.String), Required: false},
+		"config_drive":                          &hcldec.AttrSpec{Name: "config_drive", Type: cty.Bool, Required: false},
+		"floating_ip_pool":                      &hcldec.AttrSpec{Name: "floating_ip_pool", Type: cty.String, Required: false},
+		"instance_id":                           &hcldec.AttrSpec{Name: "instance_id", Type: cty.String, Required: false},
+		"stop_existing_instance":                &hcldec.AttrSpec{Name: "stop_existing_instance", Type: cty.Bool, Required: false},
+		"shelve_instance":                       &hcldec.AttrSpec{Name: "shelve_instance", Type: cty.Bool, Required: false},
+		"shelve_offload":                        &hcldec.AttrSpec{Name: "shelve_offload", Type: cty.Bool, Required: false},
+		"snapshot_consistency":                  &hcldec.AttrSpec{Name: "snapshot_consistency", Type: cty.String, Required: false},
+		"skip_stop_before_image":                &hcldec.AttrSpec{Name: "skip_stop_before_image", Type: cty.Bool, Required: false},
+		"use_blockstorage_volume":               &hcldec.AttrSpec{Name: "use_blockstorage_volume", Type: cty.Bool, Required: false},
+		"volume_name":                           &hcldec.AttrSpec{Name: "volume_name", Type: cty.String, Required: false},
+		"volume_type":                           &hcldec.AttrSpec{Name: "volume_type", Type: cty.String, Required: false},
+		"volume_size":                           &hcldec.AttrSpec{Name: "volume_size", Type: cty.Number, Required: false},
+		"volume_availability_zone":              &hcldec.AttrSpec{Name: "volume_availability_zone", Type: cty.String, Required: false},
+		"volume_upload_force":                   &hcldec.AttrSpec{Name: "volume_upload_force", Type: cty.Bool, Required: false},
+		"keep_volume":                           &hcldec.AttrSpec{Name: "keep_volume", Type: cty.Bool, Required: false},
+		"boot_volume_delete_on_termination":     &hcldec.AttrSpec{Name: "boot_volume_delete_on_termination", Type: cty.Bool, Required: false},
+		"block_device_mappings":                 &hcldec.BlockListSpec{TypeName: "block_device_mappings", Nested: hcldec.ObjectSpec((*FlatBlockDeviceMapping)(nil).HCL2Spec())},
+		"block_device_snapshot_mode":            &hcldec.AttrSpec{Name: "block_device_snapshot_mode", Type: cty.String, Required: false},
+		"attach_volumes":                        &hcldec.BlockListSpec{TypeName: "attach_volumes", Nested: hcldec.ObjectSpec((*FlatAttachVolume)(nil).HCL2Spec())},
+		"ephemeral_size_gb":                     &hcldec.AttrSpec{Name: "ephemeral_size_gb", Type: cty.Number, Required: false},
+		"ephemeral_guest_format":                &hcldec.AttrSpec{Name: "ephemeral_guest_format", Type: cty.String, Required: false},
+		"swap_size_mb":                          &hcldec.AttrSpec{Name: "swap_size_mb", Type: cty.Number, Required: false},
+		"openstack_provider":                    &hcldec.AttrSpec{Name: "openstack_provider", Type: cty.String, Required: false},
+		"use_floating_ip":                       &hcldec.AttrSpec{Name: "use_floating_ip", Type: cty.Bool, Required: false},
+	}
+	return s
+}
+
+// FlatFlavorFilter is an auto-generated flat version of FlavorFilter.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatFlavorFilter struct {
+	MinVCPUs   *int     `mapstructure:"min_vcpus" required:"false" cty:"min_vcpus" hcl:"min_vcpus"`
+	MinRAMMB   *int     `mapstructure:"min_ram_mb" required:"false" cty:"min_ram_mb" hcl:"min_ram_mb"`
+	MinDiskGB  *int     `mapstructure:"min_disk_gb" required:"false" cty:"min_disk_gb" hcl:"min_disk_gb"`
+	NamePrefix *string  `mapstructure:"name_prefix" required:"false" cty:"name_prefix" hcl:"name_prefix"`
+	Exclude    []string `mapstructure:"exclude" required:"false" cty:"exclude" hcl:"exclude"`
+}
+
+// FlatMapstructure returns a new FlatFlavorFilter.
+// FlatFlavorFilter is an auto-generated flat version of FlavorFilter.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*FlavorFilter) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatFlavorFilter)
+}
+
+// HCL2Spec returns the hcl spec of a FlavorFilter.
+// This spec is used by HCL to read the fields of FlavorFilter.
+// The decoded values from this spec will then be applied to a FlatFlavorFilter.
+func (*FlatFlavorFilter) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"min_vcpus":   &hcldec.AttrSpec{Name: "min_vcpus", Type: cty.Number, Required: false},
+		"min_ram_mb":  &hcldec.AttrSpec{Name: "min_ram_mb", Type: cty.Number, Required: false},
+		"min_disk_gb": &hcldec.AttrSpec{Name: "min_disk_gb", Type: cty.Number, Required: false},
+		"name_prefix": &hcldec.AttrSpec{Name: "name_prefix", Type: cty.String, Required: false},
+		"exclude":     &hcldec.AttrSpec{Name: "exclude", Type: cty.List(cty.String), Required: false},
 	}
 	return s
 }
@@ -294,6 +632,7 @@ func (*FlatImageFilter) HCL2Spec() map[string]hcldec.Spec {
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatImageFilterOptions struct {
 	Name       *string           `mapstructure:"name" cty:"name" hcl:"name"`
+	NameRegex  *string           `mapstructure:"name_regex" cty:"name_regex" hcl:"name_regex"`
 	Owner      *string           `mapstructure:"owner" cty:"owner" hcl:"owner"`
 	Tags       []string          `mapstructure:"tags" cty:"tags" hcl:"tags"`
 	Visibility *string           `mapstructure:"visibility" cty:"visibility" hcl:"visibility"`
@@ -313,6 +652,7 @@ func (*ImageFilterOptions) FlatMapstructure() interface{ HCL2Spec() map[string]h
 func (*FlatImageFilterOptions) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
 		"name":       &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"name_regex": &hcldec.AttrSpec{Name: "name_regex", Type: cty.String, Required: false},
 		"owner":      &hcldec.AttrSpec{Name: "owner", Type: cty.String, Required: false},
 		"tags":       &hcldec.AttrSpec{Name: "tags", Type: cty.List(cty.String), Required: false},
 		"visibility": &hcldec.AttrSpec{Name: "visibility", Type: cty.String, Required: false},
@@ -320,3 +660,233 @@ func (*FlatImageFilterOptions) HCL2Spec() map[string]hcldec.Spec {
 	}
 	return s
 }
+
+// FlatImageInheritProperties is an auto-generated flat version of ImageInheritProperties.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatImageInheritProperties struct {
+	Allow []string `mapstructure:"allow" required:"false" cty:"allow" hcl:"allow"`
+	Deny  []string `mapstructure:"deny" required:"false" cty:"deny" hcl:"deny"`
+}
+
+// FlatMapstructure returns a new FlatImageInheritProperties.
+// FlatImageInheritProperties is an auto-generated flat version of ImageInheritProperties.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*ImageInheritProperties) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatImageInheritProperties)
+}
+
+// HCL2Spec returns the hcl spec of a ImageInheritProperties.
+// This spec is used by HCL to read the fields of ImageInheritProperties.
+// The decoded values from this spec will then be applied to a FlatImageInheritProperties.
+func (*FlatImageInheritProperties) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"allow": &hcldec.AttrSpec{Name: "allow", Type: cty.List(cty.String), Required: false},
+		"deny":  &hcldec.AttrSpec{Name: "deny", Type: cty.List(cty.String), Required: false},
+	}
+	return s
+}
+
+// FlatImageRetention is an auto-generated flat version of ImageRetention.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatImageRetention struct {
+	Keep         *int    `mapstructure:"keep" required:"true" cty:"keep" hcl:"keep"`
+	Action       *string `mapstructure:"action" required:"false" cty:"action" hcl:"action"`
+	NamePrefix   *string `mapstructure:"name_prefix" required:"false" cty:"name_prefix" hcl:"name_prefix"`
+	NameRegex    *string `mapstructure:"name_regex" required:"false" cty:"name_regex" hcl:"name_regex"`
+	RenameSuffix *string `mapstructure:"rename_suffix" required:"false" cty:"rename_suffix" hcl:"rename_suffix"`
+	DryRun       *bool   `mapstructure:"dry_run" required:"false" cty:"dry_run" hcl:"dry_run"`
+}
+
+// FlatMapstructure returns a new FlatImageRetention.
+// FlatImageRetention is an auto-generated flat version of ImageRetention.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*ImageRetention) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatImageRetention)
+}
+
+// HCL2Spec returns the hcl spec of a ImageRetention.
+// This spec is used by HCL to read the fields of ImageRetention.
+// The decoded values from this spec will then be applied to a FlatImageRetention.
+func (*FlatImageRetention) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"keep":          &hcldec.AttrSpec{Name: "keep", Type: cty.Number, Required: false},
+		"action":        &hcldec.AttrSpec{Name: "action", Type: cty.String, Required: false},
+		"name_prefix":   &hcldec.AttrSpec{Name: "name_prefix", Type: cty.String, Required: false},
+		"name_regex":    &hcldec.AttrSpec{Name: "name_regex", Type: cty.String, Required: false},
+		"rename_suffix": &hcldec.AttrSpec{Name: "rename_suffix", Type: cty.String, Required: false},
+		"dry_run":       &hcldec.AttrSpec{Name: "dry_run", Type: cty.Bool, Required: false},
+	}
+	return s
+}
+
+// FlatInstancePort is an auto-generated flat version of InstancePort.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatInstancePort struct {
+	Network        *string                `mapstructure:"network" required:"true" cty:"network" hcl:"network"`
+	Name           *string                `mapstructure:"name" required:"false" cty:"name" hcl:"name"`
+	FixedIP        *string                `mapstructure:"fixed_ip" required:"false" cty:"fixed_ip" hcl:"fixed_ip"`
+	SubnetID       *string                `mapstructure:"subnet_id" required:"false" cty:"subnet_id" hcl:"subnet_id"`
+	SecurityGroups []string               `mapstructure:"security_groups" required:"false" cty:"security_groups" hcl:"security_groups"`
+	VNICType       *string                `mapstructure:"vnic_type" required:"false" cty:"vnic_type" hcl:"vnic_type"`
+	Trunk          *FlatInstancePortTrunk `mapstructure:"trunk" required:"false" cty:"trunk" hcl:"trunk"`
+}
+
+// FlatMapstructure returns a new FlatInstancePort.
+// FlatInstancePort is an auto-generated flat version of InstancePort.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*InstancePort) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatInstancePort)
+}
+
+// HCL2Spec returns the hcl spec of a InstancePort.
+// This spec is used by HCL to read the fields of InstancePort.
+// The decoded values from this spec will then be applied to a FlatInstancePort.
+func (*FlatInstancePort) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"network":         &hcldec.AttrSpec{Name: "network", Type: cty.String, Required: false},
+		"name":            &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"fixed_ip":        &hcldec.AttrSpec{Name: "fixed_ip", Type: cty.String, Required: false},
+		"subnet_id":       &hcldec.AttrSpec{Name: "subnet_id", Type: cty.String, Required: false},
+		"security_groups": &hcldec.AttrSpec{Name: "security_groups", Type: cty.List(cty.String), Required: false},
+		"vnic_type":       &hcldec.AttrSpec{Name: "vnic_type", Type: cty.String, Required: false},
+		"trunk":           &hcldec.BlockSpec{TypeName: "trunk", Nested: hcldec.ObjectSpec((*FlatInstancePortTrunk)(nil).HCL2Spec())},
+	}
+	return s
+}
+
+// FlatInstancePortTrunk is an auto-generated flat version of InstancePortTrunk.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatInstancePortTrunk struct {
+	Name     *string            `mapstructure:"name" required:"false" cty:"name" hcl:"name"`
+	Subports []FlatTrunkSubport `mapstructure:"subport" required:"false" cty:"subport" hcl:"subport"`
+}
+
+// FlatMapstructure returns a new FlatInstancePortTrunk.
+// FlatInstancePortTrunk is an auto-generated flat version of InstancePortTrunk.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*InstancePortTrunk) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatInstancePortTrunk)
+}
+
+// HCL2Spec returns the hcl spec of a InstancePortTrunk.
+// This spec is used by HCL to read the fields of InstancePortTrunk.
+// The decoded values from this spec will then be applied to a FlatInstancePortTrunk.
+func (*FlatInstancePortTrunk) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"name":    &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"subport": &hcldec.BlockListSpec{TypeName: "subport", Nested: hcldec.ObjectSpec((*FlatTrunkSubport)(nil).HCL2Spec())},
+	}
+	return s
+}
+
+// FlatPersonalityFile is an auto-generated flat version of PersonalityFile.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatPersonalityFile struct {
+	Path    *string `mapstructure:"path" required:"true" cty:"path" hcl:"path"`
+	File    *string `mapstructure:"file" required:"false" cty:"file" hcl:"file"`
+	Content *string `mapstructure:"content" required:"false" cty:"content" hcl:"content"`
+}
+
+// FlatMapstructure returns a new FlatPersonalityFile.
+// FlatPersonalityFile is an auto-generated flat version of PersonalityFile.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*PersonalityFile) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatPersonalityFile)
+}
+
+// HCL2Spec returns the hcl spec of a PersonalityFile.
+// This spec is used by HCL to read the fields of PersonalityFile.
+// The decoded values from this spec will then be applied to a FlatPersonalityFile.
+func (*FlatPersonalityFile) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"path":    &hcldec.AttrSpec{Name: "path", Type: cty.String, Required: false},
+		"file":    &hcldec.AttrSpec{Name: "file", Type: cty.String, Required: false},
+		"content": &hcldec.AttrSpec{Name: "content", Type: cty.String, Required: false},
+	}
+	return s
+}
+
+// FlatSchedulerHints is an auto-generated flat version of SchedulerHints.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatSchedulerHints struct {
+	Group                *string           `mapstructure:"group" required:"false" cty:"group" hcl:"group"`
+	SameHost             []string          `mapstructure:"same_host" required:"false" cty:"same_host" hcl:"same_host"`
+	DifferentHost        []string          `mapstructure:"different_host" required:"false" cty:"different_host" hcl:"different_host"`
+	Query                *string           `mapstructure:"query" required:"false" cty:"query" hcl:"query"`
+	TargetCell           *string           `mapstructure:"target_cell" required:"false" cty:"target_cell" hcl:"target_cell"`
+	AdditionalProperties map[string]string `mapstructure:"additional_properties" required:"false" cty:"additional_properties" hcl:"additional_properties"`
+}
+
+// FlatMapstructure returns a new FlatSchedulerHints.
+// FlatSchedulerHints is an auto-generated flat version of SchedulerHints.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*SchedulerHints) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatSchedulerHints)
+}
+
+// HCL2Spec returns the hcl spec of a SchedulerHints.
+// This spec is used by HCL to read the fields of SchedulerHints.
+// The decoded values from this spec will then be applied to a FlatSchedulerHints.
+func (*FlatSchedulerHints) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"group":                 &hcldec.AttrSpec{Name: "group", Type: cty.String, Required: false},
+		"same_host":             &hcldec.AttrSpec{Name: "same_host", Type: cty.List(cty.String), Required: false},
+		"different_host":        &hcldec.AttrSpec{Name: "different_host", Type: cty.List(cty.String), Required: false},
+		"query":                 &hcldec.AttrSpec{Name: "query", Type: cty.String, Required: false},
+		"target_cell":           &hcldec.AttrSpec{Name: "target_cell", Type: cty.String, Required: false},
+		"additional_properties": &hcldec.AttrSpec{Name: "additional_properties", Type: cty.Map(cty.String), Required: false},
+	}
+	return s
+}
+
+// FlatTrunkSubport is an auto-generated flat version of TrunkSubport.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatTrunkSubport struct {
+	Network          *string `mapstructure:"network" required:"true" cty:"network" hcl:"network"`
+	SegmentationID   *int    `mapstructure:"segmentation_id" required:"true" cty:"segmentation_id" hcl:"segmentation_id"`
+	SegmentationType *string `mapstructure:"segmentation_type" required:"false" cty:"segmentation_type" hcl:"segmentation_type"`
+}
+
+// FlatMapstructure returns a new FlatTrunkSubport.
+// FlatTrunkSubport is an auto-generated flat version of TrunkSubport.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*TrunkSubport) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatTrunkSubport)
+}
+
+// HCL2Spec returns the hcl spec of a TrunkSubport.
+// This spec is used by HCL to read the fields of TrunkSubport.
+// The decoded values from this spec will then be applied to a FlatTrunkSubport.
+func (*FlatTrunkSubport) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"network":           &hcldec.AttrSpec{Name: "network", Type: cty.String, Required: false},
+		"segmentation_id":   &hcldec.AttrSpec{Name: "segmentation_id", Type: cty.Number, Required: false},
+		"segmentation_type": &hcldec.AttrSpec{Name: "segmentation_type", Type: cty.String, Required: false},
+	}
+	return s
+}
+
+// FlatUserDataPart is an auto-generated flat version of UserDataPart.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatUserDataPart struct {
+	File        *string `mapstructure:"file" required:"true" cty:"file" hcl:"file"`
+	ContentType *string `mapstructure:"content_type" required:"true" cty:"content_type" hcl:"content_type"`
+}
+
+// FlatMapstructure returns a new FlatUserDataPart.
+// FlatUserDataPart is an auto-generated flat version of UserDataPart.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*UserDataPart) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatUserDataPart)
+}
+
+// HCL2Spec returns the hcl spec of a UserDataPart.
+// This spec is used by HCL to read the fields of UserDataPart.
+// The decoded values from this spec will then be applied to a FlatUserDataPart.
+func (*FlatUserDataPart) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"file":         &hcldec.AttrSpec{Name: "file", Type: cty.String, Required: false},
+		"content_type": &hcldec.AttrSpec{Name: "content_type", Type: cty.String, Required: false},
+	}
+	return s
+}
@@ -5,6 +5,7 @@ package openstack
 
 import (
 	"testing"
+	"time"
 
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
@@ -31,3 +32,46 @@ func TestBuilder_Prepare_BadType(t *testing.T) {
 		t.Fatalf("prepare should fail")
 	}
 }
+
+func TestConfig_Timeouts(t *testing.T) {
+	base := func() *Config {
+		c := &Config{}
+		c.Comm.Type = "ssh"
+		c.Comm.SSHTimeout = 5 * time.Minute
+		c.ImageCreationTimeout = 10 * time.Minute
+		c.ImageConversionTimeout = 20 * time.Minute
+		c.ImageStoresTimeout = 40 * time.Minute
+		return c
+	}
+
+	cases := []struct {
+		name     string
+		modify   func(*Config)
+		expected time.Duration
+	}{
+		{"image creation", func(c *Config) {}, 15 * time.Minute},
+		{"skip image creation", func(c *Config) {
+			c.SkipCreateImage = true
+			c.ImageDiskFormat = "qcow2"
+			c.ImageStores = []string{"ceph"}
+		}, 5 * time.Minute},
+		{"conversion", func(c *Config) { c.ImageDiskFormat = "qcow2" }, 35 * time.Minute},
+		{"no conversion from a volume", func(c *Config) {
+			c.ImageDiskFormat = "qcow2"
+			c.UseBlockStorageVolume = true
+		}, 15 * time.Minute},
+		{"import", func(c *Config) {
+			c.ImageUseImport = true
+			c.UseBlockStorageVolume = true
+		}, 35 * time.Minute},
+		{"stores", func(c *Config) { c.ImageStores = []string{"ceph"} }, 55 * time.Minute},
+		{"no communicator", func(c *Config) { c.Comm.Type = "none" }, 10 * time.Minute},
+	}
+	for _, tc := range cases {
+		c := base()
+		tc.modify(c)
+		if got := c.timeouts(); got != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, got)
+		}
+	}
+}
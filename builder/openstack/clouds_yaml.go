@@ -0,0 +1,255 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"gopkg.in/yaml.v2"
+)
+
+// cloudsFileExtensions are the extensions the clouds.yaml, secure.yaml and
+// clouds-public.yaml files are looked for with, in order.
+var cloudsFileExtensions = []string{".yaml", ".yml", ".json"}
+
+// loadCloud returns the named cloud entry of the clouds.yaml file, merged
+// the way python-openstackclient does: the secure.yaml entry of the cloud is
+// merged over it, secure.yaml winning, and the result over the
+// clouds-public.yaml profile of the cloud, if any.
+func loadCloud(name string) (*clientconfig.Cloud, error) {
+	cloudsPath := findCloudsFile("clouds", "OS_CLIENT_CONFIG_FILE")
+	clouds, err := loadCloudsFile(cloudsPath, "clouds")
+	if err != nil {
+		return nil, err
+	}
+	securePath := findCloudsFile("secure", "OS_CLIENT_SECURE_FILE")
+	secureClouds, err := loadCloudsFile(securePath, "clouds")
+	if err != nil {
+		return nil, err
+	}
+
+	cloud, ok := clouds[name]
+	secureCloud, secureOk := secureClouds[name]
+	if !ok && !secureOk {
+		if cloudsPath == "" && securePath == "" {
+			return nil, fmt.Errorf("cloud %s not found, no clouds.yaml or secure.yaml file found", name)
+		}
+		return nil, fmt.Errorf("cloud %s not found in %s", name, strings.Join(nonEmpty(cloudsPath, securePath), " or "))
+	}
+	if secureOk {
+		cloud = mergeCloudConfig(cloud, secureCloud)
+	}
+
+	// The profile is the legacy cloud key in older files.
+	profile, _ := cloud["profile"].(string)
+	if profile == "" {
+		profile, _ = cloud["cloud"].(string)
+	}
+	if profile != "" {
+		publicPath := findCloudsFile("clouds-public", "")
+		publicClouds, err := loadCloudsFile(publicPath, "public-clouds")
+		if err != nil {
+			return nil, err
+		}
+		vendor, ok := publicClouds[profile]
+		if !ok {
+			log.Printf("[WARN] Couldn't find the vendor profile %s for cloud %s", profile, name)
+		} else {
+			status, _ := vendor["status"].(string)
+			message, _ := vendor["message"].(string)
+			switch status {
+			case "shutdown":
+				return nil, fmt.Errorf("cloud %s uses profile %s, which is shut down: %s", name, profile, message)
+			case "deprecated":
+				log.Printf("[WARN] Cloud %s uses profile %s, which is deprecated: %s", name, profile, message)
+			}
+			delete(vendor, "status")
+			delete(vendor, "message")
+			cloud = mergeCloudConfig(vendor, cloud)
+		}
+		delete(cloud, "profile")
+		delete(cloud, "cloud")
+	}
+
+	content, err := json.Marshal(cloud)
+	if err != nil {
+		return nil, fmt.Errorf("error merging the configuration of cloud %s: %s", name, err)
+	}
+	var result clientconfig.Cloud
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, fmt.Errorf("invalid configuration of cloud %s: %s", name, err)
+	}
+	return &result, nil
+}
+
+// cloudRegion returns the region of the cloud entry, the first one of its
+// regions when it has no region_name.
+func cloudRegion(cloud *clientconfig.Cloud) string {
+	if cloud.RegionName != "" || len(cloud.Regions) == 0 {
+		return cloud.RegionName
+	}
+	switch region := cloud.Regions[0].(type) {
+	case string:
+		return region
+	case map[string]interface{}:
+		name, _ := region["name"].(string)
+		return name
+	}
+	return ""
+}
+
+// findCloudsFile returns the path of the file the environment variable points
+// to, if set and the file exists, or else of the first file with the name
+// found in the current directory, the user configuration directories and
+// the site configuration directories. It returns an empty path when there is
+// no such file.
+func findCloudsFile(name, envVar string) string {
+	if envVar != "" {
+		if path := os.Getenv(envVar); path != "" && fileExists(path) {
+			return path
+		}
+	}
+	for _, dir := range cloudsFileDirs() {
+		for _, ext := range cloudsFileExtensions {
+			if path := filepath.Join(dir, name+ext); fileExists(path) {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// cloudsFileDirs returns the directories the clouds files are looked for in,
+// in order, as with python-openstackclient.
+func cloudsFileDirs() []string {
+	var dirs []string
+	if cwd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, cwd)
+	}
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		dirs = append(dirs, filepath.Join(configHome, "openstack"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "openstack"))
+	}
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	for _, dir := range filepath.SplitList(configDirs) {
+		dirs = append(dirs, filepath.Join(dir, "openstack"))
+	}
+	return append(dirs, "/etc/openstack")
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// loadCloudsFile returns the cloud entries under the key of the file, none
+// when the path is empty.
+func loadCloudsFile(path, key string) (map[string]map[string]interface{}, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file map[string]interface{}
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", path, err)
+	}
+
+	entries, _ := normalizeYAML(file[key]).(map[string]interface{})
+	clouds := make(map[string]map[string]interface{}, len(entries))
+	for name, entry := range entries {
+		cloud, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("error parsing %s: cloud %s isn't a mapping", path, name)
+		}
+		clouds[name] = cloud
+	}
+	return clouds, nil
+}
+
+// normalizeYAML turns the mappings the YAML parser returns into mappings
+// with string keys, as JSON has.
+func normalizeYAML(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			m[fmt.Sprint(k)] = normalizeYAML(v)
+		}
+		return m
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k] = normalizeYAML(v)
+		}
+		return value
+	case []interface{}:
+		for i, v := range value {
+			value[i] = normalizeYAML(v)
+		}
+		return value
+	}
+	return value
+}
+
+// mergeCloudConfig returns the cloud configuration base with override merged
+// over it. The mappings, such as auth, are merged recursively, the other
+// values of override replacing the ones of base.
+func mergeCloudConfig(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		baseMap, baseOk := merged[k].(map[string]interface{})
+		overrideMap, overrideOk := v.(map[string]interface{})
+		if baseOk && overrideOk {
+			merged[k] = mergeCloudConfig(baseMap, overrideMap)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// resolvedCloudYAML hands the cloud entry loadCloud resolved over to
+// clientconfig, in place of its own loading of the files.
+type resolvedCloudYAML struct {
+	clouds map[string]clientconfig.Cloud
+}
+
+func (r resolvedCloudYAML) LoadCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return r.clouds, nil
+}
+
+func (r resolvedCloudYAML) LoadSecureCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return nil, nil
+}
+
+func (r resolvedCloudYAML) LoadPublicCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return nil, nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCloud(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return path
+	}
+	t.Setenv("OS_CLIENT_CONFIG_FILE", writeFile("config/clouds.yaml", `
+clouds:
+  build:
+    profile: vendor
+    auth:
+      username: packer
+      project_name: images
+`))
+	t.Setenv("OS_CLIENT_SECURE_FILE", writeFile("config/secure.yaml", `
+clouds:
+  build:
+    auth:
+      username: builder
+      password: secret
+`))
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	writeFile("openstack/clouds-public.yml", `
+public-clouds:
+  vendor:
+    auth:
+      auth_url: https://identity.example.com/v3
+      project_name: vendor
+    regions:
+      - region-1
+      - region-2
+`)
+
+	cloud, err := loadCloud("build")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if cloud.AuthInfo == nil {
+		t.Fatalf("cloud should have auth: %#v", cloud)
+	}
+	if cloud.AuthInfo.Username != "builder" || cloud.AuthInfo.Password != "secret" {
+		t.Fatalf("secure.yaml should win over clouds.yaml: %#v", cloud.AuthInfo)
+	}
+	if cloud.AuthInfo.ProjectName != "images" {
+		t.Fatalf("clouds.yaml should win over the profile: %#v", cloud.AuthInfo)
+	}
+	if cloud.AuthInfo.AuthURL != "https://identity.example.com/v3" {
+		t.Fatalf("the profile should be expanded: %#v", cloud.AuthInfo)
+	}
+	if region := cloudRegion(cloud); region != "region-1" {
+		t.Fatalf("the region should default to the first region of the profile: %s", region)
+	}
+
+	if _, err := loadCloud("missing"); err == nil {
+		t.Fatalf("a missing cloud should error")
+	}
+}
@@ -7,7 +7,12 @@ package openstack
 
 import (
 	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	imageservice "github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
@@ -19,25 +24,160 @@ type ImageConfig struct {
 	ImageName string `mapstructure:"image_name" required:"true"`
 	// Glance metadata that will be applied to the image.
 	ImageMetadata map[string]string `mapstructure:"metadata" required:"false"`
-	// One of "public", "private", "shared", or "community".
+	// Add metadata describing how the image was built: the source image ID
+	// and name, the flavor and the flavor it fell back from, the plugin and
+	// Packer versions, the build start and end times, and the build name and
+	// UUID. The keys are prefixed with `packer:`, and `metadata` wins over
+	// them. Defaults to false.
+	ImageProvenanceMetadata bool `mapstructure:"image_provenance_metadata" required:"false"`
+	// Enable the QEMU guest agent of the instances booted from the image,
+	// through the `hw_qemu_guest_agent` image property. `metadata` wins over
+	// the hardware options. Defaults to false.
+	ImageGuestAgent bool `mapstructure:"image_guest_agent" required:"false"`
+	// The disk bus of the instances booted from the image, through the
+	// `hw_disk_bus` image property. One of `scsi`, `virtio`, `ide`, `sata`,
+	// `usb`, `fdc`, `uml`, `xen` or `lxc`.
+	ImageDiskBus string `mapstructure:"image_disk_bus" required:"false"`
+	// The SCSI controller model of the instances booted from the image,
+	// through the `hw_scsi_model` image property. One of `virtio-scsi`,
+	// `lsisas1068`, `lsilogic`, `buslogic` or `vmpvscsi`.
+	ImageSCSIModel string `mapstructure:"image_scsi_model" required:"false"`
+	// The virtual NIC model of the instances booted from the image, through
+	// the `hw_vif_model` image property. One of `virtio`, `e1000`, `e1000e`,
+	// `ne2k_pci`, `pcnet`, `rtl8139`, `vmxnet3` or `spapr-vlan`.
+	ImageVIFModel string `mapstructure:"image_vif_model" required:"false"`
+	// Enable multiqueue networking for the instances booted from the image,
+	// through the `hw_vif_multiqueue_enabled` image property. Defaults to
+	// false.
+	ImageVIFMultiqueue bool `mapstructure:"image_vif_multiqueue" required:"false"`
+	// The firmware the instance and the instances booted from the image boot
+	// with, through the `hw_firmware_type` image property. One of `bios` or
+	// `uefi`. The source image and the flavor are checked before launching
+	// the instance, the build failing when they set another firmware, or
+	// when neither of them sets `uefi`. When the instance boots from a volume
+	// created from the source image, the volume is given the property.
+	BootFirmware string `mapstructure:"boot_firmware" required:"false"`
+	// Require UEFI secure boot, through the `os_secure_boot` image property.
+	// Requires `boot_firmware` to be `uefi`, and is checked like it. Defaults
+	// to false.
+	SecureBoot bool `mapstructure:"secure_boot" required:"false"`
+	// Add a TPM 2.0 virtual device, through the `hw_tpm_version` image
+	// property, for example for Windows 11. It's checked like
+	// `boot_firmware`. Defaults to false.
+	VTPM bool `mapstructure:"vtpm" required:"false"`
+	// One of "public", "private", "shared", or "community". Defaults to
+	// "shared" when `image_members` is set, which is the only visibility
+	// image members can be added to.
 	ImageVisibility imageservice.ImageVisibility `mapstructure:"image_visibility" required:"false"`
 	// List of members to add to the image after creation. An image member is
 	// usually a project (also called the "tenant") with whom the image is
 	// shared.
 	ImageMembers []string `mapstructure:"image_members" required:"false"`
 	// When true, perform the image accept so the members can see the image in their
-	// project. This requires a user with priveleges both in the build project and
-	// in the members provided. Defaults to false.
+	// project. The image is accepted by authenticating with the same
+	// credentials scoped to each of the member projects, so this requires a
+	// user with priveleges both in the build project and in the members
+	// provided. Members the user can't authenticate to are skipped with a
+	// warning. Defaults to false.
 	ImageAutoAcceptMembers bool `mapstructure:"image_auto_accept_members" required:"false"`
-	// Disk format of the resulting image. This option works if
-	// use_blockstorage_volume is true.
+	// Disk format of the resulting image. When use_blockstorage_volume is
+	// true, the volume is uploaded in this format. Otherwise, if the snapshot
+	// has another format, it is converted through the Glance interoperable
+	// import, which requires the glance-image-conversion plugin to be
+	// enabled, and the snapshot is deleted.
 	ImageDiskFormat string `mapstructure:"image_disk_format" required:"false"`
-	// List of tags to add to the image after creation.
+	// Container format of the resulting image, for example `bare` or `ovf`.
+	// Only used when use_blockstorage_volume is true, the volume is uploaded
+	// with this container format. If this isn't specified, the default
+	// enforced by your OpenStack cluster will be used.
+	ImageContainerFormat string `mapstructure:"image_container_format" required:"false"`
+	// Convert the snapshot locally with `qemu-img` and upload the result when
+	// Glance can't convert it to `image_disk_format`. The image is
+	// downloaded to a temporary directory, which needs room for both the
+	// snapshot and the converted image. Defaults to false.
+	ImageConversionLocalFallback bool `mapstructure:"image_conversion_local_fallback" required:"false"`
+	// The amount of time to wait for the snapshot to be converted to
+	// `image_disk_format`. Defaults to `30m`.
+	ImageConversionTimeout time.Duration `mapstructure:"image_conversion_timeout" required:"false"`
+	// Import the image data into a new image through the `glance-direct`
+	// method of the Glance interoperable import, so that the import plugins
+	// of the cloud run on it, for example to inspect or sign the image. The
+	// new image becomes the artifact and the original image is deleted.
+	// `image_disk_format` conversions are always imported. Defaults to false.
+	ImageUseImport bool `mapstructure:"image_use_import" required:"false"`
+	// List of tags to add to the image after creation, through the Glance
+	// tags API. Duplicated tags are only added once.
 	ImageTags []string `mapstructure:"image_tags" required:"false"`
-	// Minimum disk size needed to boot image, in gigabytes.
-	ImageMinDisk int `mapstructure:"image_min_disk" required:"false"`
-	// Skip creating the image. Useful for setting to `true` during a build test stage. Defaults to `false`.
+	// Minimum disk size needed to boot image, in gigabytes. Set to `auto` to
+	// use the root disk size of the flavor, or the size of the boot volume
+	// when `use_blockstorage_volume` is true. `auto` fails with a flavor that
+	// has no root disk.
+	ImageMinDisk string `mapstructure:"image_min_disk" required:"false"`
+	// Minimum amount of RAM needed to boot image, in megabytes.
+	ImageMinRam int `mapstructure:"image_min_ram" required:"false"`
+	// Protect the image against deletion. The image is protected once all the
+	// other image updates succeeded. Defaults to false.
+	ImageProtected bool `mapstructure:"image_protected" required:"false"`
+	// Hide the image from the default image list of Glance, through the
+	// `os_hidden` image property. Hidden images can still be booted by ID
+	// or used as `source_image_name`. Defaults to false.
+	ImageHidden bool `mapstructure:"image_hidden" required:"false"`
+	// Copy properties of the source image onto the image, and remove
+	// properties copied by Nova, once the snapshot is active. `metadata`
+	// wins over the inherited properties. See the inherited properties
+	// configuration below.
+	ImageInheritProperties ImageInheritProperties `mapstructure:"image_inherit_properties" required:"false"`
+	// Deactivate the image once it's built, so that nobody can boot it until
+	// an administrator or the image owner reactivates it. The image is
+	// deactivated after the other image updates, before it's protected, and
+	// its status is available in the artifact. Defaults to false.
+	ImageDeactivate bool `mapstructure:"image_deactivate" required:"false"`
+	// The amount of time to wait for the snapshot to become active. The
+	// image status is reported every 30 seconds while waiting. Defaults to
+	// waiting forever.
+	ImageCreationTimeout time.Duration `mapstructure:"image_creation_timeout" required:"false"`
+	// The amount of time to keep retrying the image updates done after the
+	// image is active, such as the visibility, tags, members and min disk
+	// updates, when Glance answers with a conflict or a transient error.
+	// Defaults to `5m`.
+	ImageUpdateTimeout time.Duration `mapstructure:"image_update_timeout" required:"false"`
+	// The path of a local file to download the image to once it is created.
+	// The download is resumed if the connection drops, and the file is
+	// verified against the checksum reported by Glance. The file is part of
+	// the artifact, so that post-processors such as `compress` or `checksum`
+	// can use it. Note that destroying the artifact, when a post-processor
+	// doesn't keep its input artifact, deletes the image as well as the file.
+	ImageExportPath string `mapstructure:"image_export_path" required:"false"`
+	// A list of Glance stores to copy the image to once it is created,
+	// through the copy-image import method of Glance multi-store. The build
+	// fails, listing the stores, if the image can't be copied to some of
+	// them.
+	ImageStores []string `mapstructure:"image_stores" required:"false"`
+	// The amount of time to wait for the image to be copied to
+	// `image_stores`. Defaults to `30m`.
+	ImageStoresTimeout time.Duration `mapstructure:"image_stores_timeout" required:"false"`
+	// List of additional regions to copy the image to once it's active. The
+	// image data is streamed from the build region into a new image with
+	// the same name, formats, tags and metadata in each region. A region
+	// that fails is reported, the copies in the other regions are kept. The
+	// copies are hidden, deactivated and protected like the image once all
+	// the regions succeeded.
+	ImageCopyRegions []string `mapstructure:"image_copy_regions" required:"false"`
+	// Delete the images of the project named `image_name` once the image is
+	// created, so that the name refers to a single image. Protected images
+	// are never deleted. Defaults to false.
+	OverwriteImage bool `mapstructure:"overwrite_image" required:"false"`
+	// Retire the older images of the build once the image is created. See
+	// the image retention configuration below.
+	ImageRetention ImageRetention `mapstructure:"image_retention" required:"false"`
+	// Skip creating the image. Useful for setting to `true` during a build test stage.
+	// The server is still launched, provisioned and deleted, but no image is
+	// snapshotted and no artifact is produced. The image options are ignored
+	// with a warning. Defaults to `false`.
 	SkipCreateImage bool `mapstructure:"skip_create_image" required:"false"`
+
+	imageMinDisk     int
+	autoImageMinDisk bool
 }
 
 func (c *ImageConfig) Prepare(ctx *interpolate.Context) []error {
@@ -57,6 +197,36 @@ func (c *ImageConfig) Prepare(ctx *interpolate.Context) []error {
 		c.ImageMetadata["image_type"] = "image"
 	}
 
+	// Hardware image properties, accepted values from
+	// https://docs.openstack.org/glance/latest/admin/useful-image-properties.html
+	if c.ImageDiskBus != "" && !containsString([]string{"scsi", "virtio", "ide", "sata", "usb", "fdc", "uml", "xen", "lxc"}, c.ImageDiskBus) {
+		errs = append(errs, fmt.Errorf("Unknown image_disk_bus value %s", c.ImageDiskBus))
+	}
+	if c.ImageSCSIModel != "" && !containsString([]string{"virtio-scsi", "lsisas1068", "lsilogic", "buslogic", "vmpvscsi"}, c.ImageSCSIModel) {
+		errs = append(errs, fmt.Errorf("Unknown image_scsi_model value %s", c.ImageSCSIModel))
+	}
+	if c.ImageVIFModel != "" && !containsString([]string{"virtio", "e1000", "e1000e", "ne2k_pci", "pcnet", "rtl8139", "vmxnet3", "spapr-vlan"}, c.ImageVIFModel) {
+		errs = append(errs, fmt.Errorf("Unknown image_vif_model value %s", c.ImageVIFModel))
+	}
+	if c.BootFirmware != "" && c.BootFirmware != "bios" && c.BootFirmware != "uefi" {
+		errs = append(errs, fmt.Errorf("Unknown boot_firmware value %s", c.BootFirmware))
+	}
+	if c.SecureBoot && c.BootFirmware != "uefi" {
+		errs = append(errs, fmt.Errorf("secure_boot requires boot_firmware to be uefi"))
+	}
+	// The boot mode properties can't be changed through the metadata, the
+	// image wouldn't boot the way the build checked.
+	for _, p := range c.bootProperties() {
+		if value, ok := c.ImageMetadata[p.Property]; ok && value != p.Value {
+			errs = append(errs, fmt.Errorf("metadata %s %s conflicts with %s", p.Property, value, p.Option))
+		}
+	}
+	for key, value := range c.hardwareProperties() {
+		if _, ok := c.ImageMetadata[key]; !ok {
+			c.ImageMetadata[key] = value
+		}
+	}
+
 	// ImageVisibility values
 	// https://wiki.openstack.org/wiki/Glance-v2-community-image-visibility-design
 	if c.ImageVisibility != "" {
@@ -74,8 +244,63 @@ func (c *ImageConfig) Prepare(ctx *interpolate.Context) []error {
 		}
 	}
 
-	if c.ImageMinDisk < 0 {
-		errs = append(errs, fmt.Errorf("An image min disk size must be greater than or equal to 0"))
+	if len(c.ImageMembers) > 0 {
+		if c.ImageVisibility == "" {
+			c.ImageVisibility = imageservice.ImageVisibilityShared
+		} else if c.ImageVisibility != imageservice.ImageVisibilityShared {
+			errs = append(errs, fmt.Errorf("image_members can only be used with the shared visibility, not %s", c.ImageVisibility))
+		}
+	}
+
+	if c.ImageAutoAcceptMembers && len(c.ImageMembers) == 0 {
+		errs = append(errs, fmt.Errorf("image_auto_accept_members can only be used together with image_members"))
+	}
+
+	switch c.ImageMinDisk {
+	case "":
+	case "auto":
+		c.autoImageMinDisk = true
+	default:
+		minDisk, err := strconv.Atoi(c.ImageMinDisk)
+		if err != nil || minDisk < 0 {
+			errs = append(errs, fmt.Errorf("An image min disk size must be auto or an integer greater than or equal to 0"))
+		}
+		c.imageMinDisk = minDisk
+	}
+
+	if c.ImageMinRam < 0 {
+		errs = append(errs, fmt.Errorf("An image min ram size must be greater than or equal to 0"))
+	}
+
+	var tags []string
+	for _, tag := range c.ImageTags {
+		if !containsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	c.ImageTags = tags
+
+	errs = append(errs, c.ImageRetention.Prepare()...)
+	errs = append(errs, c.ImageInheritProperties.Prepare()...)
+
+	if c.ImageConversionLocalFallback && c.ImageDiskFormat == "" {
+		errs = append(errs, fmt.Errorf("image_conversion_local_fallback can only be used together with image_disk_format"))
+	}
+
+	if c.ImageConversionLocalFallback && c.ImageUseImport {
+		errs = append(errs, fmt.Errorf("image_conversion_local_fallback can't be used together with image_use_import"))
+	}
+
+	if c.ImageConversionTimeout == 0 {
+		c.ImageConversionTimeout = 30 * time.Minute
+	}
+
+	if c.ImageStoresTimeout == 0 {
+		c.ImageStoresTimeout = 30 * time.Minute
+	}
+
+	if c.ImageUpdateTimeout == 0 {
+		c.ImageUpdateTimeout = 5 * time.Minute
 	}
 
 	if len(errs) > 0 {
@@ -84,3 +309,298 @@ func (c *ImageConfig) Prepare(ctx *interpolate.Context) []error {
 
 	return nil
 }
+
+// ImageRetention describes what happens to the older images of the build
+// once the image is created. The images of the project are matched by name,
+// and all but the newest ones are retired. Protected images and images
+// servers are booted from are never retired.
+type ImageRetention struct {
+	// The number of images to keep, including the created image. Images
+	// are only retired when this is set.
+	Keep int `mapstructure:"keep" required:"true"`
+	// What to do with the retired images, one of "delete", "deactivate" or
+	// "rename". Defaults to "delete".
+	Action string `mapstructure:"action" required:"false"`
+	// Match the images whose name starts with this prefix. By default, the
+	// images named exactly `image_name` are matched.
+	NamePrefix string `mapstructure:"name_prefix" required:"false"`
+	// Match the images whose name matches this regular expression. Can't be
+	// used together with `name_prefix`.
+	NameRegex string `mapstructure:"name_regex" required:"false"`
+	// The suffix appended to the name of the retired images when `action` is
+	// "rename". Defaults to "-deprecated".
+	RenameSuffix string `mapstructure:"rename_suffix" required:"false"`
+	// Only log the images that would be retired. Defaults to false.
+	DryRun bool `mapstructure:"dry_run" required:"false"`
+
+	nameRegex *regexp.Regexp
+}
+
+func (r *ImageRetention) Prepare() []error {
+	var errs []error
+	if r.Keep == 0 {
+		if r.Action != "" || r.NamePrefix != "" || r.NameRegex != "" {
+			errs = append(errs, fmt.Errorf("image_retention keep must be set"))
+		}
+		return errs
+	}
+	if r.Keep < 0 {
+		errs = append(errs, fmt.Errorf("image_retention keep must be greater than 0"))
+	}
+
+	if r.Action == "" {
+		r.Action = "delete"
+	}
+	if r.Action != "delete" && r.Action != "deactivate" && r.Action != "rename" {
+		errs = append(errs, fmt.Errorf("image_retention action must be delete, deactivate or rename"))
+	}
+	if r.RenameSuffix == "" {
+		r.RenameSuffix = "-deprecated"
+	}
+
+	if r.NamePrefix != "" && r.NameRegex != "" {
+		errs = append(errs, fmt.Errorf("Only one of image_retention name_prefix or name_regex can be specified, not both."))
+	}
+	if r.NameRegex != "" {
+		re, err := regexp.Compile(r.NameRegex)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid image_retention name_regex: %s", err))
+		}
+		r.nameRegex = re
+	}
+
+	return errs
+}
+
+// matches tells whether an image name matches the retention, imageName
+// being the name of the created image.
+func (r *ImageRetention) matches(imageName, name string) bool {
+	switch {
+	case r.nameRegex != nil:
+		return r.nameRegex.MatchString(name)
+	case r.NamePrefix != "":
+		return strings.HasPrefix(name, r.NamePrefix)
+	default:
+		return name == imageName
+	}
+}
+
+// retiredImages returns the images beyond the newest Keep ones that aren't
+// retired yet, the created image always being kept.
+func (r *ImageRetention) retiredImages(imgs []imageservice.Image, imageId string) []imageservice.Image {
+	sorted := make([]imageservice.Image, 0, len(imgs))
+	for _, image := range imgs {
+		if image.ID != imageId {
+			sorted = append(sorted, image)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	// The created image is one of the kept images.
+	if r.Keep-1 >= len(sorted) {
+		return nil
+	}
+
+	var retired []imageservice.Image
+	for _, image := range sorted[r.Keep-1:] {
+		switch {
+		case r.Action == "deactivate" && image.Status == imageservice.ImageStatusDeactivated:
+		case r.Action == "rename" && strings.HasSuffix(image.Name, r.RenameSuffix):
+		default:
+			retired = append(retired, image)
+		}
+	}
+	return retired
+}
+
+// ImageInheritProperties describes the properties of the source image that
+// are copied onto the image. The keys are matched with shell patterns, for
+// example `hw_*`.
+type ImageInheritProperties struct {
+	// The source image properties to copy onto the image.
+	Allow []string `mapstructure:"allow" required:"false"`
+	// The properties to remove from the image when Nova copied them from the
+	// source image.
+	Deny []string `mapstructure:"deny" required:"false"`
+}
+
+func (p *ImageInheritProperties) Prepare() []error {
+	var errs []error
+	for _, pattern := range append(append([]string{}, p.Allow...), p.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid image_inherit_properties pattern %q: %s", pattern, err))
+		}
+	}
+	return errs
+}
+
+func (p *ImageInheritProperties) empty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+// updateOpts returns the updates copying the allowed properties of source
+// onto image and removing its denied properties, the keys of metadata
+// being left alone.
+func (p *ImageInheritProperties) updateOpts(source, image *imageservice.Image, metadata map[string]string) imageservice.UpdateOpts {
+	var opts imageservice.UpdateOpts
+	for _, key := range sortedKeys(source.Properties) {
+		value, ok := source.Properties[key].(string)
+		if _, set := metadata[key]; set || !ok || !matchesAny(p.Allow, key) {
+			continue
+		}
+
+		current, exists := image.Properties[key]
+		if exists && current == value {
+			continue
+		}
+		op := imageservice.AddOp
+		if exists {
+			op = imageservice.ReplaceOp
+		}
+		opts = append(opts, imageservice.UpdateImageProperty{
+			Op:    op,
+			Name:  key,
+			Value: value,
+		})
+	}
+
+	for _, key := range sortedKeys(image.Properties) {
+		if _, set := metadata[key]; set || matchesAny(p.Allow, key) || !matchesAny(p.Deny, key) {
+			continue
+		}
+		opts = append(opts, imageservice.UpdateImageProperty{
+			Op:   imageservice.RemoveOp,
+			Name: key,
+		})
+	}
+	return opts
+}
+
+func matchesAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hardwareProperties returns the Glance image properties of the hardware
+// options.
+func (c *ImageConfig) hardwareProperties() map[string]string {
+	props := map[string]string{}
+	if c.ImageGuestAgent {
+		props["hw_qemu_guest_agent"] = "yes"
+	}
+	if c.ImageDiskBus != "" {
+		props["hw_disk_bus"] = c.ImageDiskBus
+	}
+	if c.ImageSCSIModel != "" {
+		props["hw_scsi_model"] = c.ImageSCSIModel
+	}
+	if c.ImageVIFModel != "" {
+		props["hw_vif_model"] = c.ImageVIFModel
+	}
+	if c.ImageVIFMultiqueue {
+		props["hw_vif_multiqueue_enabled"] = "true"
+	}
+	for _, p := range c.bootProperties() {
+		props[p.Property] = p.Value
+	}
+	return props
+}
+
+// bootProperty is an image property of the boot mode options, along with the
+// flavor extra spec setting it too, and the trait the Compute service
+// requires from the hosts for it.
+type bootProperty struct {
+	Option    string
+	Property  string
+	Value     string
+	ExtraSpec string
+	Trait     string
+}
+
+// bootProperties returns the image properties of the boot_firmware,
+// secure_boot and vtpm options.
+func (c *ImageConfig) bootProperties() []bootProperty {
+	var props []bootProperty
+	if c.BootFirmware != "" {
+		props = append(props, bootProperty{
+			Option:    "boot_firmware",
+			Property:  "hw_firmware_type",
+			Value:     c.BootFirmware,
+			ExtraSpec: "hw:firmware_type",
+		})
+	}
+	if c.SecureBoot {
+		props = append(props, bootProperty{
+			Option:    "secure_boot",
+			Property:  "os_secure_boot",
+			Value:     "required",
+			ExtraSpec: "os:secure_boot",
+			Trait:     "COMPUTE_SECURITY_UEFI_SECURE_BOOT",
+		})
+	}
+	if c.VTPM {
+		props = append(props, bootProperty{
+			Option:    "vtpm",
+			Property:  "hw_tpm_version",
+			Value:     "2.0",
+			ExtraSpec: "hw:tpm_version",
+			Trait:     "COMPUTE_SECURITY_TPM_2_0",
+		})
+	}
+	return props
+}
+
+// imageOptions returns the options that are set and only apply to the
+// created image.
+func (c *ImageConfig) imageOptions() []string {
+	var options []string
+	set := []struct {
+		name  string
+		isSet bool
+	}{
+		{"image_guest_agent", c.ImageGuestAgent},
+		{"image_disk_bus", c.ImageDiskBus != ""},
+		{"image_scsi_model", c.ImageSCSIModel != ""},
+		{"image_vif_model", c.ImageVIFModel != ""},
+		{"image_vif_multiqueue", c.ImageVIFMultiqueue},
+		{"image_visibility", c.ImageVisibility != ""},
+		{"image_members", len(c.ImageMembers) > 0},
+		{"image_auto_accept_members", c.ImageAutoAcceptMembers},
+		{"image_disk_format", c.ImageDiskFormat != ""},
+		{"image_use_import", c.ImageUseImport},
+		{"image_container_format", c.ImageContainerFormat != ""},
+		{"image_tags", len(c.ImageTags) > 0},
+		{"image_min_disk", c.ImageMinDisk != ""},
+		{"image_min_ram", c.ImageMinRam != 0},
+		{"image_protected", c.ImageProtected},
+		{"image_hidden", c.ImageHidden},
+		{"image_deactivate", c.ImageDeactivate},
+		{"image_export_path", c.ImageExportPath != ""},
+		{"image_stores", len(c.ImageStores) > 0},
+		{"image_copy_regions", len(c.ImageCopyRegions) > 0},
+		{"overwrite_image", c.OverwriteImage},
+		{"image_retention", c.ImageRetention.Keep != 0},
+		{"image_inherit_properties", !c.ImageInheritProperties.empty()},
+	}
+	for _, option := range set {
+		if option.isSet {
+			options = append(options, option.name)
+		}
+	}
+	return options
+}
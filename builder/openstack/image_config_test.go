@@ -4,7 +4,11 @@
 package openstack
 
 import (
+	"reflect"
 	"testing"
+	"time"
+
+	imageservice "github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 )
 
 func testImageConfig() *ImageConfig {
@@ -24,3 +28,338 @@ func TestImageConfigPrepare_Region(t *testing.T) {
 		t.Fatal("should have error")
 	}
 }
+
+func TestImageConfigPrepare_ImageUpdateTimeout(t *testing.T) {
+	c := testImageConfig()
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	if c.ImageUpdateTimeout != 5*time.Minute {
+		t.Fatalf("invalid value: %s", c.ImageUpdateTimeout)
+	}
+}
+
+func TestImageConfigPrepare_ImageTags(t *testing.T) {
+	c := testImageConfig()
+	c.ImageTags = []string{"release", "abc123", "release"}
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	if !reflect.DeepEqual(c.ImageTags, []string{"release", "abc123"}) {
+		t.Fatalf("invalid value: %v", c.ImageTags)
+	}
+}
+
+func TestImageConfigPrepare_ImageMinRam(t *testing.T) {
+	c := testImageConfig()
+	c.ImageMinDisk = "10"
+	c.ImageMinRam = 2048
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	c.ImageMinRam = -1
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestImageConfigPrepare_ImageMinDisk(t *testing.T) {
+	c := testImageConfig()
+	c.ImageMinDisk = "40"
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+	if c.imageMinDisk != 40 || c.autoImageMinDisk {
+		t.Fatalf("invalid value: %d", c.imageMinDisk)
+	}
+
+	c = testImageConfig()
+	c.ImageMinDisk = "auto"
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+	if !c.autoImageMinDisk {
+		t.Fatal("image_min_disk should be computed")
+	}
+
+	for _, value := range []string{"-1", "large"} {
+		c = testImageConfig()
+		c.ImageMinDisk = value
+		if err := c.Prepare(nil); err == nil {
+			t.Fatalf("image_min_disk %s should have error", value)
+		}
+	}
+}
+
+func TestImageConfigPrepare_ImageMembers(t *testing.T) {
+	c := testImageConfig()
+	c.ImageMembers = []string{"project"}
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+	if c.ImageVisibility != "shared" {
+		t.Fatalf("invalid value: %s", c.ImageVisibility)
+	}
+
+	for _, visibility := range []string{"private", "community", "public"} {
+		c = testImageConfig()
+		c.ImageMembers = []string{"project"}
+		c.ImageVisibility = imageservice.ImageVisibility(visibility)
+		if err := c.Prepare(nil); err == nil {
+			t.Fatalf("image_members with visibility %s should have error", visibility)
+		}
+	}
+
+	c = testImageConfig()
+	c.ImageAutoAcceptMembers = true
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("image_auto_accept_members without image_members should have error")
+	}
+}
+
+func TestImageConfigPrepare_ImageConversion(t *testing.T) {
+	c := testImageConfig()
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+	if c.ImageConversionTimeout != 30*time.Minute {
+		t.Fatalf("invalid value: %s", c.ImageConversionTimeout)
+	}
+	if c.ImageStoresTimeout != 30*time.Minute {
+		t.Fatalf("invalid value: %s", c.ImageStoresTimeout)
+	}
+
+	c.ImageConversionLocalFallback = true
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("image_conversion_local_fallback without image_disk_format should have error")
+	}
+
+	c.ImageDiskFormat = "qcow2"
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	c.ImageUseImport = true
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("image_conversion_local_fallback with image_use_import should have error")
+	}
+}
+
+func TestImageConfigPrepare_HardwareProperties(t *testing.T) {
+	c := testImageConfig()
+	c.ImageDiskBus = "floppy"
+	c.ImageSCSIModel = "virtio"
+	c.ImageVIFModel = "virtio-net"
+	if err := c.Prepare(nil); len(err) != 3 {
+		t.Fatalf("unknown hardware values should error: %s", err)
+	}
+
+	c = testImageConfig()
+	c.ImageMetadata = map[string]string{"hw_disk_bus": "virtio"}
+	c.ImageGuestAgent = true
+	c.ImageDiskBus = "scsi"
+	c.ImageSCSIModel = "virtio-scsi"
+	c.ImageVIFMultiqueue = true
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	expected := map[string]string{
+		"image_type":                "image",
+		"hw_qemu_guest_agent":       "yes",
+		"hw_disk_bus":               "virtio",
+		"hw_scsi_model":             "virtio-scsi",
+		"hw_vif_multiqueue_enabled": "true",
+	}
+	if !reflect.DeepEqual(c.ImageMetadata, expected) {
+		t.Fatalf("bad: %v", c.ImageMetadata)
+	}
+}
+
+func TestImageConfigPrepare_BootMode(t *testing.T) {
+	c := testImageConfig()
+	c.BootFirmware = "uefi"
+	c.SecureBoot = true
+	c.VTPM = true
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+	expected := map[string]string{
+		"image_type":       "image",
+		"hw_firmware_type": "uefi",
+		"os_secure_boot":   "required",
+		"hw_tpm_version":   "2.0",
+	}
+	if !reflect.DeepEqual(c.ImageMetadata, expected) {
+		t.Fatalf("bad: %v", c.ImageMetadata)
+	}
+
+	c = testImageConfig()
+	c.BootFirmware = "efi"
+	c.SecureBoot = true
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("unknown boot_firmware and secure_boot without uefi should error: %s", err)
+	}
+
+	c = testImageConfig()
+	c.ImageMetadata = map[string]string{"hw_firmware_type": "bios"}
+	c.BootFirmware = "uefi"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("metadata conflicting with boot_firmware should error: %s", err)
+	}
+}
+
+func TestImageConfig_ImageOptions(t *testing.T) {
+	c := testImageConfig()
+	if options := c.imageOptions(); len(options) != 0 {
+		t.Fatalf("bad: %v", options)
+	}
+
+	c.ImageMembers = []string{"project"}
+	c.ImageTags = []string{"release"}
+	c.ImageProtected = true
+	expected := []string{"image_members", "image_tags", "image_protected"}
+	if options := c.imageOptions(); !reflect.DeepEqual(options, expected) {
+		t.Fatalf("bad: %v", options)
+	}
+}
+
+func TestImageConfigPrepare_ImageRetention(t *testing.T) {
+	c := testImageConfig()
+	c.ImageRetention.Keep = 5
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+	if c.ImageRetention.Action != "delete" {
+		t.Fatalf("invalid value: %s", c.ImageRetention.Action)
+	}
+
+	c.ImageRetention.Action = "archive"
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("invalid image_retention action should have error")
+	}
+
+	c = testImageConfig()
+	c.ImageRetention.Action = "rename"
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("image_retention without keep should have error")
+	}
+
+	c = testImageConfig()
+	c.ImageRetention.Keep = 5
+	c.ImageRetention.NamePrefix = "golden-"
+	c.ImageRetention.NameRegex = "^golden-"
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("setting both name_prefix and name_regex should have error")
+	}
+
+	c.ImageRetention.NamePrefix = ""
+	c.ImageRetention.NameRegex = "golden-("
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("invalid name_regex should have error")
+	}
+}
+
+func TestImageRetention_Matches(t *testing.T) {
+	r := &ImageRetention{Keep: 1}
+	if err := r.Prepare(); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+	if !r.matches("golden", "golden") || r.matches("golden", "golden-1") {
+		t.Fatal("only the image name should match")
+	}
+
+	r = &ImageRetention{Keep: 1, NamePrefix: "golden-"}
+	if err := r.Prepare(); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+	if !r.matches("golden-3", "golden-1") || r.matches("golden-3", "silver-1") {
+		t.Fatal("only the images with the prefix should match")
+	}
+
+	r = &ImageRetention{Keep: 1, NameRegex: "^golden-[0-9]+$"}
+	if err := r.Prepare(); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+	if !r.matches("golden-3", "golden-1") || r.matches("golden-3", "golden-1-deprecated") {
+		t.Fatal("only the images matching the regex should match")
+	}
+}
+
+func TestImageRetention_RetiredImages(t *testing.T) {
+	now := time.Now()
+	imgs := []imageservice.Image{
+		{ID: "old", Name: "golden", CreatedAt: now.Add(-3 * time.Hour)},
+		{ID: "new", Name: "golden", CreatedAt: now},
+		{ID: "older", Name: "golden", CreatedAt: now.Add(-4 * time.Hour)},
+		{ID: "recent", Name: "golden", CreatedAt: now.Add(-time.Hour)},
+		{ID: "deactivated", Name: "golden", CreatedAt: now.Add(-5 * time.Hour), Status: imageservice.ImageStatusDeactivated},
+	}
+
+	r := &ImageRetention{Keep: 2, Action: "delete"}
+	var ids []string
+	for _, image := range r.retiredImages(imgs, "new") {
+		ids = append(ids, image.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"old", "older", "deactivated"}) {
+		t.Fatalf("bad: %v", ids)
+	}
+
+	r.Action = "deactivate"
+	ids = nil
+	for _, image := range r.retiredImages(imgs, "new") {
+		ids = append(ids, image.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"old", "older"}) {
+		t.Fatalf("bad: %v", ids)
+	}
+
+	r.Keep = 5
+	if retired := r.retiredImages(imgs, "new"); len(retired) != 0 {
+		t.Fatalf("bad: %v", retired)
+	}
+}
+
+func TestImageInheritProperties_UpdateOpts(t *testing.T) {
+	p := ImageInheritProperties{
+		Allow: []string{"os_distro", "hw_*"},
+		Deny:  []string{"base_image_ref", "boot_*", "os_distro"},
+	}
+	if err := p.Prepare(); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	source := &imageservice.Image{
+		Properties: map[string]interface{}{
+			"os_distro":        "ubuntu",
+			"hw_firmware_type": "uefi",
+			"hw_disk_bus":      "scsi",
+			"license_key":      "secret",
+		},
+	}
+	image := &imageservice.Image{
+		Properties: map[string]interface{}{
+			"os_distro":      "ubuntu",
+			"base_image_ref": "86bc7e9a-0b23-4b49-a45b-1b0b1d0d7206",
+			"boot_roles":     "admin",
+			"image_type":     "image",
+		},
+	}
+	metadata := map[string]string{"hw_disk_bus": "virtio", "boot_roles": "admin"}
+
+	expected := imageservice.UpdateOpts{
+		imageservice.UpdateImageProperty{Op: imageservice.AddOp, Name: "hw_firmware_type", Value: "uefi"},
+		imageservice.UpdateImageProperty{Op: imageservice.RemoveOp, Name: "base_image_ref"},
+	}
+	if opts := p.updateOpts(source, image, metadata); !reflect.DeepEqual(opts, expected) {
+		t.Fatalf("bad: %#v", opts)
+	}
+
+	p.Allow = []string{"["}
+	if err := p.Prepare(); len(err) != 1 {
+		t.Fatalf("invalid pattern should error: %s", err)
+	}
+}
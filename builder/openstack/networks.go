@@ -4,43 +4,88 @@
 package openstack
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/attachinterfaces"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/external"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/qos/policies"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
 	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
 )
 
-// CheckFloatingIP gets a floating IP by its ID and checks if it is already
-// associated with any internal interface.
+// CheckFloatingIP gets a floating IP by its ID or address and checks if it is
+// already associated with any internal interface.
 // It returns floating IP if it can be used.
-func CheckFloatingIP(client *gophercloud.ServiceClient, id string) (*floatingips.FloatingIP, error) {
-	floatingIP, err := floatingips.Get(client, id).Extract()
-	if err != nil {
-		return nil, err
+func CheckFloatingIP(client *gophercloud.ServiceClient, ref string) (*floatingips.FloatingIP, error) {
+	var floatingIP *floatingips.FloatingIP
+	if net.ParseIP(ref) != nil {
+		allPages, err := floatingips.List(client, floatingips.ListOpts{
+			FloatingIP: ref,
+		}).AllPages()
+		if err != nil {
+			return nil, err
+		}
+
+		allFloatingIPs, err := floatingips.ExtractFloatingIPs(allPages)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(allFloatingIPs) == 0 {
+			return nil, fmt.Errorf("can't find floating IP with address %s", ref)
+		}
+		floatingIP = &allFloatingIPs[0]
+	} else {
+		var err error
+		floatingIP, err = floatingips.Get(client, ref).Extract()
+		if err != nil {
+			return nil, err
+		}
 	}
+
 	if floatingIP.PortID != "" {
 		return nil, fmt.Errorf("provided floating IP '%s' is already associated with port '%s'",
-			id, floatingIP.PortID)
+			ref, floatingIP.PortID)
 	}
 
 	return floatingIP, nil
 }
 
-// FindFreeFloatingIP returns free unassociated floating IP.
+// ErrNoFreeFloatingIP is returned by FindFreeFloatingIP when no unassociated
+// floating IP matches the search.
+var ErrNoFreeFloatingIP = errors.New("no free floating IPs found")
+
+// FreeFloatingIPOpts restricts the floating IPs FindFreeFloatingIP can return.
+type FreeFloatingIPOpts struct {
+	// Tags the floating IP must carry.
+	Tags []string
+	// IDs of floating IPs that must be skipped.
+	Exclude []string
+	// Range the floating IP address must be part of.
+	CIDR *net.IPNet
+}
+
+// FindFreeFloatingIP returns free unassociated floating IP matching opts.
 // It will return first floating IP if there are many.
-func FindFreeFloatingIP(client *gophercloud.ServiceClient) (*floatingips.FloatingIP, error) {
+func FindFreeFloatingIP(client *gophercloud.ServiceClient, opts FreeFloatingIPOpts) (*floatingips.FloatingIP, error) {
 	var freeFloatingIP *floatingips.FloatingIP
 
 	pager := floatingips.List(client, floatingips.ListOpts{
 		Status: "DOWN",
+		Tags:   strings.Join(opts.Tags, ","),
 	})
 	err := pager.EachPage(func(page pagination.Page) (bool, error) {
 		candidates, err := floatingips.ExtractFloatingIPs(page)
@@ -52,6 +97,12 @@ func FindFreeFloatingIP(client *gophercloud.ServiceClient) (*floatingips.Floatin
 			if candidate.PortID != "" {
 				continue // this floating IP is associated with port, move to next in list
 			}
+			if containsString(opts.Exclude, candidate.ID) {
+				continue // this floating IP was already tried, move to next in list
+			}
+			if opts.CIDR != nil && !opts.CIDR.Contains(net.ParseIP(candidate.FloatingIP)) {
+				continue // this floating IP is out of the requested range, move to next in list
+			}
 
 			// Floating IP is able to be allocated.
 			freeFloatingIP = &candidate
@@ -63,41 +114,153 @@ func FindFreeFloatingIP(client *gophercloud.ServiceClient) (*floatingips.Floatin
 		return nil, err
 	}
 	if freeFloatingIP == nil {
-		return nil, fmt.Errorf("no free floating IPs found")
+		return nil, ErrNoFreeFloatingIP
 	}
 
 	return freeFloatingIP, nil
 }
 
+// CheckTagsSupported makes sure the Networking service supports tagging of
+// its resources, so tag based filters aren't silently ignored.
+func CheckTagsSupported(client *gophercloud.ServiceClient) error {
+	return checkExtension(client, "standard-attr-tag", "resource tags")
+}
+
+// CheckDNSSupported makes sure the Networking service supports setting the
+// DNS name, and optionally the DNS domain, of ports.
+func CheckDNSSupported(client *gophercloud.ServiceClient, domain bool) error {
+	if err := checkExtension(client, "dns-integration", "DNS integration"); err != nil {
+		return err
+	}
+	if domain {
+		return checkExtension(client, "dns-domain-ports", "DNS domains on ports")
+	}
+	return nil
+}
+
+// checkExtension makes sure the Networking service has the extension with
+// the given alias, described by `feature` in the error.
+func checkExtension(client *gophercloud.ServiceClient, alias, feature string) error {
+	if err := extensions.Get(client, alias).Err; err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			return fmt.Errorf("the networking service does not support %s (%s extension)", feature, alias)
+		}
+		return err
+	}
+
+	return nil
+}
+
 // GetInstancePortID returns internal port of the instance that can be used for
 // the association of a floating IP.
 // It will return an ID of a first port if there are many.
-func GetInstancePortID(client *gophercloud.ServiceClient, id string, instance_float_net string) (string, error) {
+func GetInstancePortID(client *gophercloud.ServiceClient, id string, instance_float_net string, fallback bool) (string, error) {
+	portIDs, err := getInstancePortIDs(client, id, instance_float_net, fallback)
+	if err != nil {
+		return "", err
+	}
 
-	selected_interface := 0
+	return portIDs[0], nil
+}
 
-	interfacesPage, err := attachinterfaces.List(client, id).AllPages()
+// waitForActiveInstancePort returns the first internal port of the instance
+// that can be used for the association of a floating IP and whose status is
+// ACTIVE. Ports that aren't ACTIVE yet are skipped, and the ports are checked
+// again until one of them becomes ACTIVE, the timeout is reached or the build
+// is cancelled.
+func waitForActiveInstancePort(state multistep.StateBag, computeClient, networkClient *gophercloud.ServiceClient, id string, instance_float_net string, fallback bool, timeout time.Duration, polling pollConfig) (string, error) {
+	portIDs, err := getInstancePortIDs(computeClient, id, instance_float_net, fallback)
 	if err != nil {
 		return "", err
 	}
+
+	statuses := map[string]string{}
+	deadline := time.Now().Add(timeout)
+	poll := newPoller(polling)
+	for {
+		for _, portID := range portIDs {
+			port, err := ports.Get(networkClient, portID).Extract()
+			if poll.Throttled(err) {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+
+			if previous, ok := statuses[portID]; !ok || previous != port.Status {
+				log.Printf("[INFO] Instance port %s status: %s", portID, port.Status)
+				statuses[portID] = port.Status
+			}
+			if port.Status == "ACTIVE" {
+				log.Printf("[INFO] Using instance port %s", portID)
+				return portID, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			var details []string
+			for _, portID := range portIDs {
+				details = append(details, fmt.Sprintf("%s (%s)", portID, statuses[portID]))
+			}
+			return "", fmt.Errorf("timeout after %s waiting for an ACTIVE instance port, candidate ports are: %s",
+				timeout, strings.Join(details, ", "))
+		}
+
+		if _, ok := state.GetOk(multistep.StateCancelled); ok {
+			return "", errWaitInterrupted
+		}
+
+		poll.Wait()
+	}
+}
+
+func getInstancePortIDs(client *gophercloud.ServiceClient, id string, instance_float_net string, fallback bool) ([]string, error) {
+	interfacesPage, err := attachinterfaces.List(client, id).AllPages()
+	if err != nil {
+		return nil, err
+	}
 	interfaces, err := attachinterfaces.ExtractInterfaces(interfacesPage)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if len(interfaces) == 0 {
-		return "", fmt.Errorf("instance '%s' has no interfaces", id)
+		return nil, fmt.Errorf("instance '%s' has no interfaces", id)
 	}
 
+	return selectInstancePortIDs(interfaces, instance_float_net, fallback)
+}
+
+// selectInstancePortIDs returns the ports of the interfaces attached to
+// instance_float_net, or all of them if instance_float_net is empty. If none
+// of the interfaces is attached to instance_float_net, all of them are only
+// returned when fallback is true.
+func selectInstancePortIDs(interfaces []attachinterfaces.Interface, instance_float_net string, fallback bool) ([]string, error) {
+	var all, preferred, attached []string
 	for i := 0; i < len(interfaces); i++ {
 		log.Printf("Instance interface: %v: %+v\n", i, interfaces[i])
+		all = append(all, interfaces[i].PortID)
 		if interfaces[i].NetID == instance_float_net {
 			log.Printf("Found preferred interface: %v\n", i)
-			selected_interface = i
-			log.Printf("Using interface value: %v", selected_interface)
+			preferred = append(preferred, interfaces[i].PortID)
 		}
+		attached = append(attached, interfaces[i].NetID)
+	}
+
+	if instance_float_net == "" {
+		return all, nil
 	}
 
-	return interfaces[selected_interface].PortID, nil
+	if len(preferred) > 0 {
+		return preferred, nil
+	}
+
+	if fallback {
+		log.Printf("[WARN] No interface attached to network %s, using the first one", instance_float_net)
+		return all, nil
+	}
+
+	return nil, fmt.Errorf("instance has no interface attached to network %s, attached networks are: %s",
+		instance_float_net, strings.Join(attached, ", "))
 }
 
 // CheckFloatingIPNetwork checks provided network reference and returns a valid
@@ -110,6 +273,205 @@ func CheckFloatingIPNetwork(client *gophercloud.ServiceClient, networkRef string
 	return networkRef, nil
 }
 
+// CheckFloatingIPSubnet resolves the provided subnet reference (ID or name)
+// and makes sure the subnet belongs to the given external network.
+func CheckFloatingIPSubnet(client *gophercloud.ServiceClient, networkID string, subnetRef string) (*subnets.Subnet, error) {
+	if _, err := uuid.Parse(subnetRef); err == nil {
+		subnet, err := subnets.Get(client, subnetRef).Extract()
+		if err != nil {
+			return nil, err
+		}
+		if subnet.NetworkID != networkID {
+			return nil, fmt.Errorf("subnet %s does not belong to network %s", subnetRef, networkID)
+		}
+		return subnet, nil
+	}
+
+	allPages, err := subnets.List(client, subnets.ListOpts{
+		Name:      subnetRef,
+		NetworkID: networkID,
+	}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	allSubnets, err := subnets.ExtractSubnets(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(allSubnets) {
+	case 0:
+		return nil, fmt.Errorf("can't find subnet %s in network %s", subnetRef, networkID)
+	case 1:
+		return &allSubnets[0], nil
+	default:
+		return nil, fmt.Errorf("found %d subnets named %s in network %s, please use an ID instead",
+			len(allSubnets), subnetRef, networkID)
+	}
+}
+
+// CheckNetwork checks provided network reference (ID or name) and returns a
+// valid Networking service ID. It fails if the name is shared by multiple
+// networks.
+func CheckNetwork(client *gophercloud.ServiceClient, networkRef string) (string, error) {
+	if _, err := uuid.Parse(networkRef); err == nil {
+		return networkRef, nil
+	}
+
+	allPages, err := networks.List(client, networks.ListOpts{
+		Name: networkRef,
+	}).AllPages()
+	if err != nil {
+		return "", err
+	}
+
+	allNetworks, err := networks.ExtractNetworks(allPages)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(allNetworks) {
+	case 0:
+		return "", fmt.Errorf("can't find network %s", networkRef)
+	case 1:
+		return allNetworks[0].ID, nil
+	default:
+		return "", fmt.Errorf("found %d networks named %s, please use an ID instead",
+			len(allNetworks), networkRef)
+	}
+}
+
+// CheckSecurityGroup checks provided security group reference (ID or name)
+// and returns a valid Networking service ID.
+func CheckSecurityGroup(client *gophercloud.ServiceClient, groupRef string) (string, error) {
+	if _, err := uuid.Parse(groupRef); err == nil {
+		return groupRef, nil
+	}
+
+	allPages, err := groups.List(client, groups.ListOpts{
+		Name: groupRef,
+	}).AllPages()
+	if err != nil {
+		return "", err
+	}
+
+	allGroups, err := groups.ExtractGroups(allPages)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(allGroups) {
+	case 0:
+		// Help with typos by suggesting the groups with a similar name.
+		allPages, err := groups.List(client, groups.ListOpts{}).AllPages()
+		if err != nil {
+			return "", fmt.Errorf("can't find security group %s", groupRef)
+		}
+		allGroups, err := groups.ExtractGroups(allPages)
+		if err != nil {
+			return "", fmt.Errorf("can't find security group %s", groupRef)
+		}
+
+		names := make([]string, 0, len(allGroups))
+		for _, group := range allGroups {
+			names = append(names, group.Name)
+		}
+		if similar := similarNames(groupRef, names); len(similar) > 0 {
+			return "", fmt.Errorf("can't find security group %s, did you mean %s?",
+				groupRef, strings.Join(similar, ", "))
+		}
+		return "", fmt.Errorf("can't find security group %s", groupRef)
+	case 1:
+		return allGroups[0].ID, nil
+	default:
+		matches := make([]string, 0, len(allGroups))
+		for _, group := range allGroups {
+			matches = append(matches, fmt.Sprintf("%s (project %s)", group.ID, group.ProjectID))
+		}
+		return "", fmt.Errorf("found %d security groups named %s, please use an ID instead: %s",
+			len(allGroups), groupRef, strings.Join(matches, ", "))
+	}
+}
+
+// CheckQoSPolicy checks provided QoS policy reference (ID or name) and returns
+// a valid Networking service ID. It fails if the name is shared by multiple
+// QoS policies.
+func CheckQoSPolicy(client *gophercloud.ServiceClient, policyRef string) (string, error) {
+	if _, err := uuid.Parse(policyRef); err == nil {
+		if _, err := policies.Get(client, policyRef).Extract(); err != nil {
+			return "", fmt.Errorf("can't find QoS policy %s: %s", policyRef, err)
+		}
+		return policyRef, nil
+	}
+
+	allPages, err := policies.List(client, policies.ListOpts{
+		Name: policyRef,
+	}).AllPages()
+	if err != nil {
+		return "", err
+	}
+
+	allPolicies, err := policies.ExtractPolicies(allPages)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(allPolicies) {
+	case 0:
+		return "", fmt.Errorf("can't find QoS policy %s", policyRef)
+	case 1:
+		return allPolicies[0].ID, nil
+	default:
+		return "", fmt.Errorf("found %d QoS policies named %s, please use an ID instead",
+			len(allPolicies), policyRef)
+	}
+}
+
+// similarNames returns the names of `list` that look like a misspelling of
+// `name`.
+func similarNames(name string, list []string) []string {
+	var similar []string
+	lower := strings.ToLower(name)
+	for _, candidate := range list {
+		if candidate == "" || containsString(similar, candidate) {
+			continue
+		}
+		c := strings.ToLower(candidate)
+		if strings.Contains(c, lower) || strings.Contains(lower, c) || levenshtein(c, lower) <= 2 {
+			similar = append(similar, candidate)
+		}
+	}
+	return similar
+}
+
+// levenshtein returns the edit distance between `a` and `b`.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
 // ExternalNetwork is a network with external router.
 type ExternalNetwork struct {
 	networks.Network
@@ -131,20 +493,105 @@ func GetFloatingIPNetworkIDByName(client *gophercloud.ServiceClient, networkName
 		return "", err
 	}
 
-	if len(externalNetworks) == 0 {
+	return selectExternalNetwork(networkName, externalNetworks)
+}
+
+// selectExternalNetwork returns the ID of the only external network among the
+// networks named networkName. It fails if none or several of them are
+// external.
+func selectExternalNetwork(networkName string, allNetworks []ExternalNetwork) (string, error) {
+	if len(allNetworks) == 0 {
 		return "", fmt.Errorf("can't find external network %s", networkName)
 	}
-	// Check and return the first external network.
-	if !externalNetworks[0].External {
+
+	var candidates []string
+	for _, network := range allNetworks {
+		if network.External {
+			candidates = append(candidates, network.ID)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
 		return "", fmt.Errorf("network %s is not external", networkName)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("found %d external networks named %s, please use an ID instead: %s",
+			len(candidates), networkName, strings.Join(candidates, ", "))
+	}
+}
+
+// DiscoverExternalNetwork returns the ID of the external network to allocate
+// floating IPs from. It fails if there are none or several of them.
+func DiscoverExternalNetwork(client *gophercloud.ServiceClient) (string, error) {
+	var externalNetworks []ExternalNetwork
+
+	isExternal := true
+	allPages, err := networks.List(client, external.ListOptsExt{
+		ListOptsBuilder: networks.ListOpts{},
+		External:        &isExternal,
+	}).AllPages()
+	if err != nil {
+		return "", err
+	}
+
+	if err := networks.ExtractNetworksInto(allPages, &externalNetworks); err != nil {
+		return "", err
+	}
+
+	return selectDiscoveredExternalNetwork(externalNetworks)
+}
+
+// selectDiscoveredExternalNetwork returns the ID of the only external network
+// of allNetworks.
+func selectDiscoveredExternalNetwork(allNetworks []ExternalNetwork) (string, error) {
+	var candidates []ExternalNetwork
+	for _, network := range allNetworks {
+		if network.External {
+			candidates = append(candidates, network)
+		}
 	}
 
-	return externalNetworks[0].ID, nil
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no external network found, floating IPs can't be used in this cloud")
+	case 1:
+		return candidates[0].ID, nil
+	default:
+		names := make([]string, 0, len(candidates))
+		for _, network := range candidates {
+			names = append(names, fmt.Sprintf("%s (%s)", network.Name, network.ID))
+		}
+		return "", fmt.Errorf("found %d external networks, please set floating_ip_network to one of: %s",
+			len(candidates), strings.Join(names, ", "))
+	}
+}
+
+// ProvisioningNetworkOpts are the constraints used to discover the
+// provisioning network.
+type ProvisioningNetworkOpts struct {
+	// The network ranges the subnet must be contained in.
+	CIDRs []string
+	// The IP version of the subnet, any version if 0.
+	IPVersion int
+	// Only consider subnets with DHCP enabled.
+	RequireDHCP bool
 }
 
-// DiscoverProvisioningNetwork finds the first network whose subnet matches the given network ranges.
-func DiscoverProvisioningNetwork(client *gophercloud.ServiceClient, cidrs []string) (string, error) {
-	allPages, err := subnets.List(client, subnets.ListOpts{}).AllPages()
+// DiscoverProvisioningNetwork finds the network whose subnet matches the given
+// network ranges. Subnets with DHCP enabled are preferred when several of them
+// match.
+func DiscoverProvisioningNetwork(client *gophercloud.ServiceClient, opts ProvisioningNetworkOpts) (string, error) {
+	listOpts := subnets.ListOpts{
+		IPVersion: opts.IPVersion,
+	}
+	if opts.RequireDHCP {
+		enableDHCP := true
+		listOpts.EnableDHCP = &enableDHCP
+	}
+
+	allPages, err := subnets.List(client, listOpts).AllPages()
 	if err != nil {
 		return "", err
 	}
@@ -154,30 +601,166 @@ func DiscoverProvisioningNetwork(client *gophercloud.ServiceClient, cidrs []stri
 		return "", err
 	}
 
+	subnet, err := selectProvisioningSubnet(allSubnets, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return subnet.NetworkID, nil
+}
+
+// selectProvisioningSubnet returns the subnet to provision on among the ones
+// matching the given constraints.
+func selectProvisioningSubnet(allSubnets []subnets.Subnet, opts ProvisioningNetworkOpts) (*subnets.Subnet, error) {
+	ranges := make([]*net.IPNet, 0, len(opts.CIDRs))
+	for _, cidr := range opts.CIDRs {
+		_, candidateIPNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, candidateIPNet)
+	}
+
+	var candidates []subnets.Subnet
 	for _, subnet := range allSubnets {
+		if opts.IPVersion != 0 && subnet.IPVersion != opts.IPVersion {
+			continue
+		}
+		if opts.RequireDHCP && !subnet.EnableDHCP {
+			continue
+		}
+
 		_, tenantIPNet, err := net.ParseCIDR(subnet.CIDR)
 		if err != nil {
-			return "", err
+			log.Printf("[WARN] Skipping subnet %s with invalid CIDR %q: %s", subnet.ID, subnet.CIDR, err)
+			continue
 		}
 
-		for _, cidr := range cidrs {
-			_, candidateIPNet, err := net.ParseCIDR(cidr)
-			if err != nil {
-				return "", err
-			}
-
+		for _, candidateIPNet := range ranges {
 			if containsNet(candidateIPNet, tenantIPNet) {
-				return subnet.NetworkID, nil
+				log.Printf("[INFO] Provisioning network candidate: subnet %s (%s, IPv%d, DHCP enabled: %t) of network %s",
+					subnet.ID, subnet.CIDR, subnet.IPVersion, subnet.EnableDHCP, subnet.NetworkID)
+				candidates = append(candidates, subnet)
+				break
 			}
 		}
 	}
 
-	return "", fmt.Errorf("failed to discover a provisioning network")
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("failed to discover a provisioning network")
+	}
+
+	selected := candidates[0]
+	for _, subnet := range candidates {
+		if subnet.EnableDHCP {
+			selected = subnet
+			break
+		}
+	}
+
+	log.Printf("[INFO] Selected subnet %s of network %s as provisioning network", selected.ID, selected.NetworkID)
+	return &selected, nil
+}
+
+// CheckFixedIP checks that the fixed IP address is in one of the subnets of
+// the network, and isn't allocated to a port already.
+func CheckFixedIP(client *gophercloud.ServiceClient, networkID string, ip string) error {
+	allPages, err := subnets.List(client, subnets.ListOpts{NetworkID: networkID}).AllPages()
+	if err != nil {
+		return err
+	}
+	allSubnets, err := subnets.ExtractSubnets(allPages)
+	if err != nil {
+		return err
+	}
+	if subnetForIP(allSubnets, ip) == nil {
+		return fmt.Errorf("fixed IP %s isn't in any subnet of network %s", ip, networkID)
+	}
+
+	allPages, err = ports.List(client, ports.ListOpts{
+		NetworkID: networkID,
+		FixedIPs:  []ports.FixedIPOpts{{IPAddress: ip}},
+	}).AllPages()
+	if err != nil {
+		return err
+	}
+	allPorts, err := ports.ExtractPorts(allPages)
+	if err != nil {
+		return err
+	}
+	if len(allPorts) > 0 {
+		return fmt.Errorf("fixed IP %s already allocated on network %s", ip, networkID)
+	}
+	return nil
+}
+
+// subnetForIP returns the subnet the IP address is in, or nil.
+func subnetForIP(allSubnets []subnets.Subnet, ip string) *subnets.Subnet {
+	addr := net.ParseIP(ip)
+	for i, subnet := range allSubnets {
+		_, ipNet, err := net.ParseCIDR(subnet.CIDR)
+		if err == nil && ipNet.Contains(addr) {
+			return &allSubnets[i]
+		}
+	}
+	return nil
+}
+
+// DiscoverNetworksByTags finds the networks carrying all of the given tags.
+// When single is true, exactly one network must match.
+func DiscoverNetworksByTags(client *gophercloud.ServiceClient, tags []string, single bool) ([]string, error) {
+	allPages, err := networks.List(client, networks.ListOpts{
+		Tags: strings.Join(tags, ","),
+	}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	allNetworks, err := networks.ExtractNetworks(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids, names []string
+	for _, network := range allNetworks {
+		ids = append(ids, network.ID)
+		names = append(names, fmt.Sprintf("%s (%s)", network.Name, network.ID))
+	}
+
+	switch {
+	case len(ids) == 0:
+		return nil, fmt.Errorf("failed to discover a network tagged with %s", strings.Join(tags, ", "))
+	case single && len(ids) > 1:
+		return nil, fmt.Errorf("found %d networks tagged with %s: %s", len(ids),
+			strings.Join(tags, ", "), strings.Join(names, ", "))
+	}
+
+	return ids, nil
 }
 
 // containsNet returns true whenever IPNet `a` contains IPNet `b`
+// IPNets of different address families never contain each other.
 func containsNet(a *net.IPNet, b *net.IPNet) bool {
-	aMask, _ := a.Mask.Size()
-	bMask, _ := b.Mask.Size()
-	return a.Contains(b.IP) && aMask <= bMask
+	if (a.IP.To4() == nil) != (b.IP.To4() == nil) {
+		return false
+	}
+	aMask, aBits := a.Mask.Size()
+	bMask, bBits := b.Mask.Size()
+	return aBits == bBits && a.Contains(b.IP) && aMask <= bMask
+}
+
+// isUUID returns true whenever `s` is a UUID, as opposed to a name
+func isUUID(s string) bool {
+	_, err := uuid.Parse(s)
+	return err == nil
+}
+
+// containsString returns true whenever `s` is an element of `list`
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
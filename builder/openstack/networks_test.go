@@ -4,8 +4,19 @@
 package openstack
 
 import (
+	"errors"
+	"fmt"
 	"net"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/attachinterfaces"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/external"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
 )
 
 func testYes(t *testing.T, a, b string) {
@@ -55,3 +66,248 @@ func TestNetworkDiscovery_SubnetContainsGood_IPv6(t *testing.T) {
 	testNot(t, "2001:db8::/64", "::/0")
 	testNot(t, "::/1", "::/0")
 }
+
+func TestNetworkDiscovery_SubnetContainsGood_MixedFamilies(t *testing.T) {
+	testNot(t, "0.0.0.0/0", "::/64")
+	testNot(t, "10.0.0.0/8", "a00::/64")
+	testNot(t, "::/0", "10.0.0.0/24")
+	testNot(t, "::/0", "0.0.0.0/8")
+}
+
+func TestSelectInstancePortIDs(t *testing.T) {
+	interfaces := []attachinterfaces.Interface{
+		{PortID: "port-a", NetID: "net-a"},
+		{PortID: "port-b", NetID: "net-b"},
+	}
+
+	portIDs, err := selectInstancePortIDs(interfaces, "", false)
+	if err != nil || len(portIDs) != 2 || portIDs[0] != "port-a" {
+		t.Fatalf("expected all ports, first one first, got %v: %s", portIDs, err)
+	}
+
+	portIDs, err = selectInstancePortIDs(interfaces, "net-b", false)
+	if err != nil || len(portIDs) != 1 || portIDs[0] != "port-b" {
+		t.Fatalf("expected port attached to net-b, got %v: %s", portIDs, err)
+	}
+}
+
+func TestSelectInstancePortIDs_SharedNetwork(t *testing.T) {
+	interfaces := []attachinterfaces.Interface{
+		{PortID: "port-a", NetID: "net-a"},
+		{PortID: "port-b", NetID: "net-b"},
+		{PortID: "port-c", NetID: "net-b"},
+	}
+
+	portIDs, err := selectInstancePortIDs(interfaces, "net-b", false)
+	if err != nil || len(portIDs) != 2 || portIDs[0] != "port-b" || portIDs[1] != "port-c" {
+		t.Fatalf("expected ports attached to net-b, got %v: %s", portIDs, err)
+	}
+
+	portIDs, err = selectInstancePortIDs(interfaces, "net-c", true)
+	if err != nil || len(portIDs) != 3 {
+		t.Fatalf("expected all ports, got %v: %s", portIDs, err)
+	}
+}
+
+func TestSelectInstancePortIDs_NetworkNotAttached(t *testing.T) {
+	interfaces := []attachinterfaces.Interface{
+		{PortID: "port-a", NetID: "net-a"},
+		{PortID: "port-b", NetID: "net-b"},
+	}
+
+	if _, err := selectInstancePortIDs(interfaces, "net-c", false); err == nil {
+		t.Fatalf("should error when the network isn't attached")
+	}
+
+	portIDs, err := selectInstancePortIDs(interfaces, "net-c", true)
+	if err != nil || len(portIDs) != 2 || portIDs[0] != "port-a" {
+		t.Fatalf("expected all ports, first one first, with fallback, got %v: %s", portIDs, err)
+	}
+}
+
+func TestWaitForActiveInstancePort_Interrupted(t *testing.T) {
+	cloud := newTestCloud(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/servers/server/os-interface" {
+			fmt.Fprint(w, `{"interfaceAttachments": [{"port_id": "port", "net_id": "net"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"port": {"id": "port", "status": "DOWN"}}`)
+	})
+	state := cloud.state(t)
+	config := state.Get("config").(*Config)
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	networkClient, err := config.networkV2Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	state.Put(multistep.StateCancelled, true)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := waitForActiveInstancePort(state, computeClient, networkClient, "server", "", false, time.Hour, pollConfig{Interval: time.Millisecond})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !errors.Is(err, errWaitInterrupted) {
+			t.Fatalf("expected the wait to be interrupted, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the wait should stop once the build is cancelled")
+	}
+}
+
+func TestSelectProvisioningSubnet(t *testing.T) {
+	allSubnets := []subnets.Subnet{
+		{ID: "mgmt", NetworkID: "net-a", CIDR: "10.0.0.0/24", IPVersion: 4, EnableDHCP: false},
+		{ID: "v6", NetworkID: "net-b", CIDR: "2001:db8::/64", IPVersion: 6, EnableDHCP: true},
+		{ID: "v4", NetworkID: "net-b", CIDR: "10.0.1.0/24", IPVersion: 4, EnableDHCP: true},
+	}
+	cidrs := []string{"10.0.0.0/16", "2001:db8::/32"}
+
+	subnet, err := selectProvisioningSubnet(allSubnets, ProvisioningNetworkOpts{CIDRs: cidrs})
+	if err != nil || subnet.ID != "v6" {
+		t.Fatalf("expected first subnet with DHCP enabled, got %v: %s", subnet, err)
+	}
+
+	subnet, err = selectProvisioningSubnet(allSubnets, ProvisioningNetworkOpts{CIDRs: cidrs, IPVersion: 4})
+	if err != nil || subnet.ID != "v4" {
+		t.Fatalf("expected IPv4 subnet with DHCP enabled, got %v: %s", subnet, err)
+	}
+
+	subnet, err = selectProvisioningSubnet(allSubnets[:1], ProvisioningNetworkOpts{CIDRs: cidrs})
+	if err != nil || subnet.ID != "mgmt" {
+		t.Fatalf("expected subnet without DHCP, got %v: %s", subnet, err)
+	}
+
+	_, err = selectProvisioningSubnet(allSubnets[:1], ProvisioningNetworkOpts{CIDRs: cidrs, RequireDHCP: true})
+	if err == nil {
+		t.Fatal("expected no subnet when DHCP is required")
+	}
+}
+
+func TestSelectProvisioningSubnet_IPv6(t *testing.T) {
+	allSubnets := []subnets.Subnet{
+		{ID: "broken", NetworkID: "net-a", CIDR: "not-a-cidr", IPVersion: 4, EnableDHCP: true},
+		{ID: "v6-only", NetworkID: "net-b", CIDR: "a00::/64", IPVersion: 6, EnableDHCP: true},
+		{ID: "v4", NetworkID: "net-c", CIDR: "10.1.0.0/24", IPVersion: 4, EnableDHCP: true},
+		{ID: "v6", NetworkID: "net-d", CIDR: "2001:db8:1::/64", IPVersion: 6, EnableDHCP: true},
+	}
+
+	subnet, err := selectProvisioningSubnet(allSubnets, ProvisioningNetworkOpts{CIDRs: []string{"10.0.0.0/8"}})
+	if err != nil || subnet.ID != "v4" {
+		t.Fatalf("expected the IPv4 subnet, got %v: %s", subnet, err)
+	}
+
+	subnet, err = selectProvisioningSubnet(allSubnets, ProvisioningNetworkOpts{CIDRs: []string{"2001:db8::/32"}})
+	if err != nil || subnet.ID != "v6" {
+		t.Fatalf("expected the IPv6 subnet, got %v: %s", subnet, err)
+	}
+
+	subnet, err = selectProvisioningSubnet(allSubnets[1:], ProvisioningNetworkOpts{CIDRs: []string{"2001:db8::/32", "10.0.0.0/8"}})
+	if err != nil || subnet.ID != "v4" {
+		t.Fatalf("expected the first matching subnet, got %v: %s", subnet, err)
+	}
+
+	if _, err := selectProvisioningSubnet(allSubnets, ProvisioningNetworkOpts{CIDRs: []string{"192.168.0.0/16"}}); err == nil {
+		t.Fatal("expected no subnet to match")
+	}
+}
+
+func TestSimilarNames(t *testing.T) {
+	names := []string{"default", "packer-ssh", "Packer_SSH", "web", ""}
+
+	similar := similarNames("packer_ssh", names)
+	if len(similar) != 2 || similar[0] != "packer-ssh" || similar[1] != "Packer_SSH" {
+		t.Fatalf("unexpected similar names: %v", similar)
+	}
+
+	similar = similarNames("defualt", names)
+	if len(similar) != 1 || similar[0] != "default" {
+		t.Fatalf("unexpected similar names: %v", similar)
+	}
+
+	if similar := similarNames("database", names); len(similar) != 0 {
+		t.Fatalf("unexpected similar names: %v", similar)
+	}
+}
+
+func testExternalNetwork(id string, isExternal bool) ExternalNetwork {
+	return ExternalNetwork{
+		Network:            networks.Network{ID: id, Name: "public"},
+		NetworkExternalExt: external.NetworkExternalExt{External: isExternal},
+	}
+}
+
+func TestSelectExternalNetwork(t *testing.T) {
+	networkID, err := selectExternalNetwork("public", []ExternalNetwork{
+		testExternalNetwork("internal", false),
+		testExternalNetwork("external", true),
+	})
+	if err != nil || networkID != "external" {
+		t.Fatalf("expected the external network, got %q: %s", networkID, err)
+	}
+
+	_, err = selectExternalNetwork("public", []ExternalNetwork{
+		testExternalNetwork("internal", false),
+	})
+	if err == nil {
+		t.Fatal("expected an error without external network")
+	}
+
+	_, err = selectExternalNetwork("public", []ExternalNetwork{
+		testExternalNetwork("external-a", true),
+		testExternalNetwork("internal", false),
+		testExternalNetwork("external-b", true),
+	})
+	if err == nil || !strings.Contains(err.Error(), "external-a, external-b") {
+		t.Fatalf("expected an error listing the external networks, got: %s", err)
+	}
+
+	if _, err := selectExternalNetwork("public", nil); err == nil {
+		t.Fatal("expected an error without network")
+	}
+}
+
+func TestSelectDiscoveredExternalNetwork(t *testing.T) {
+	networkID, err := selectDiscoveredExternalNetwork([]ExternalNetwork{
+		testExternalNetwork("internal", false),
+		testExternalNetwork("external", true),
+	})
+	if err != nil || networkID != "external" {
+		t.Fatalf("expected the external network, got %q: %s", networkID, err)
+	}
+
+	if _, err := selectDiscoveredExternalNetwork(nil); err == nil {
+		t.Fatal("expected an error without external network")
+	}
+
+	_, err = selectDiscoveredExternalNetwork([]ExternalNetwork{
+		testExternalNetwork("external-a", true),
+		testExternalNetwork("external-b", true),
+	})
+	if err == nil || !strings.Contains(err.Error(), "public (external-a), public (external-b)") {
+		t.Fatalf("expected an error listing the external networks, got: %s", err)
+	}
+}
+
+func TestSubnetForIP(t *testing.T) {
+	allSubnets := []subnets.Subnet{
+		{ID: "v4", CIDR: "10.0.0.0/24"},
+		{ID: "v6", CIDR: "2001:db8::/64"},
+	}
+
+	if subnet := subnetForIP(allSubnets, "10.0.0.40"); subnet == nil || subnet.ID != "v4" {
+		t.Fatalf("10.0.0.40 should be in subnet v4: %v", subnet)
+	}
+	if subnet := subnetForIP(allSubnets, "2001:db8::40"); subnet == nil || subnet.ID != "v6" {
+		t.Fatalf("2001:db8::40 should be in subnet v6: %v", subnet)
+	}
+	if subnet := subnetForIP(allSubnets, "10.0.1.40"); subnet != nil {
+		t.Fatalf("10.0.1.40 shouldn't be in any subnet: %v", subnet)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/limits"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+)
+
+// maxPersonalityPathSize is the maximum length of the path of a personality
+// file the Compute service accepts.
+const maxPersonalityPathSize = 255
+
+// serverPersonality returns the files injected into the server, reading the
+// ones with a source file.
+func serverPersonality(files []PersonalityFile) (servers.Personality, error) {
+	var personality servers.Personality
+	for _, file := range files {
+		contents := []byte(file.Content)
+		if file.File != "" {
+			var err error
+			contents, err = ioutil.ReadFile(file.File)
+			if err != nil {
+				return nil, fmt.Errorf("error reading personality file: %s", err)
+			}
+		}
+		personality = append(personality, &servers.File{
+			Path:     file.Path,
+			Contents: contents,
+		})
+	}
+	return personality, nil
+}
+
+// checkPersonalityLimits checks the personality files against the limits of
+// the project. The limits aren't checked when they can't be retrieved.
+func checkPersonalityLimits(client *gophercloud.ServiceClient, personality servers.Personality) error {
+	projectLimits, err := limits.Get(client, limits.GetOpts{}).Extract()
+	if err != nil {
+		log.Printf("[WARN] Error getting the compute limits, not checking the personality files: %s", err)
+		return nil
+	}
+
+	// A negative limit means unlimited.
+	maxFiles := projectLimits.Absolute.MaxPersonality
+	if maxFiles >= 0 && len(personality) > maxFiles {
+		return fmt.Errorf("%d personality files are set, the project allows %d", len(personality), maxFiles)
+	}
+	maxSize := projectLimits.Absolute.MaxPersonalitySize
+	for _, file := range personality {
+		if maxSize >= 0 && len(file.Contents) > maxSize {
+			return fmt.Errorf("personality file %s is %d bytes, the project allows %d", file.Path, len(file.Contents), maxSize)
+		}
+	}
+	return nil
+}
+
+// personalityError explains the error returned when launching the server
+// when it's because the cloud doesn't allow file injection.
+func personalityError(err error) error {
+	switch err.(type) {
+	case gophercloud.ErrDefault400, gophercloud.ErrDefault403:
+	default:
+		return err
+	}
+	if !strings.Contains(strings.ToLower(err.Error()), "personality") {
+		return err
+	}
+	return fmt.Errorf("the cloud refused the personality files, file injection is deprecated "+
+		"since Compute API microversion 2.57 and may be disabled; use user_data or config_drive instead: %s", err)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+)
+
+func TestCheckPersonalityLimits(t *testing.T) {
+	personality := servers.Personality{
+		{Path: "/etc/motd", Contents: []byte("welcome")},
+		{Path: "/etc/build", Contents: []byte("a longer build description")},
+	}
+
+	cases := []struct {
+		name   string
+		limits string
+		err    string
+	}{
+		{"within the limits", `{"maxPersonality": 5, "maxPersonalitySize": 10240}`, ""},
+		{"unlimited", `{"maxPersonality": -1, "maxPersonalitySize": -1}`, ""},
+		{"too many files", `{"maxPersonality": 1, "maxPersonalitySize": 10240}`, "2 personality files are set, the project allows 1"},
+		{"file too large", `{"maxPersonality": 5, "maxPersonalitySize": 10}`, "personality file /etc/build is 26 bytes, the project allows 10"},
+		{"limits unavailable", "", ""},
+	}
+	for _, tc := range cases {
+		cloud := newTestCloud(t, func(w http.ResponseWriter, r *http.Request) {
+			if tc.limits == "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"limits": {"absolute": %s}}`, tc.limits)
+		})
+		client, err := cloud.state(t).Get("config").(*Config).computeV2Client()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		err = checkPersonalityLimits(client, personality)
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: err: %s", tc.name, err)
+		}
+		if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestPersonalityError(t *testing.T) {
+	personalityBody := []byte(`{"badRequest": {"code": 400, "message": "Personality file injection is disabled"}}`)
+	otherBody := []byte(`{"badRequest": {"code": 400, "message": "Invalid flavorRef provided."}}`)
+
+	cases := []struct {
+		name      string
+		err       error
+		explained bool
+	}{
+		{"bad request", gophercloud.ErrDefault400{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Body: personalityBody}}, true},
+		{"forbidden", gophercloud.ErrDefault403{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Body: personalityBody}}, true},
+		{"other bad request", gophercloud.ErrDefault400{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Body: otherBody}}, false},
+		{"other status", gophercloud.ErrDefault500{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Body: personalityBody}}, false},
+		{"other error", errors.New("personality"), false},
+	}
+	for _, tc := range cases {
+		err := personalityError(tc.err)
+		explained := strings.HasPrefix(err.Error(), "the cloud refused the personality files")
+		if explained != tc.explained {
+			t.Errorf("%s: expected explained %t, got %s", tc.name, tc.explained, err)
+		}
+		if !strings.HasSuffix(err.Error(), tc.err.Error()) {
+			t.Errorf("%s: the original error should be kept: %s", tc.name, err)
+		}
+	}
+}
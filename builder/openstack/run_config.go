@@ -6,8 +6,17 @@
 package openstack
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
@@ -23,11 +32,82 @@ type RunConfig struct {
 	// are "public" or "private", and the default behavior is to connect via
 	// whichever is returned first from the OpenStack API.
 	SSHInterface string `mapstructure:"ssh_interface" required:"false"`
+	// The name or ID of the network the communicator connects through when
+	// the instance is attached to several networks. The build fails if the
+	// instance isn't attached to it. The floating IP, if any, is associated
+	// with the port on this network unless `instance_floating_ip_net` is set.
+	// Can't be used together with `ssh_interface`.
+	CommunicatorNetwork string `mapstructure:"communicator_network" required:"false"`
+	// A list of networks, by name or ID, to hot-attach an interface on once
+	// the communicator is connected. Packer waits for the interfaces to become
+	// active before provisioning, and detaches them before the image is
+	// created unless `keep_attached_networks` is true.
+	AttachNetworksAfterBoot []string `mapstructure:"attach_networks_after_boot" required:"false"`
+	// Don't detach the interfaces attached through
+	// `attach_networks_after_boot` before the image is created. Defaults to
+	// false.
+	KeepAttachedNetworks bool `mapstructure:"keep_attached_networks" required:"false"`
 	// The IP version to use for SSH connections, valid values are `4` and `6`.
 	// Useful on dual stacked instances where the default behavior is to
 	// connect via whichever IP address is returned first from the OpenStack
 	// API.
 	SSHIPVersion string `mapstructure:"ssh_ip_version" required:"false"`
+	// Connect to the instance through its IPv6 fixed address instead of a
+	// floating IP. Packer waits for the instance to get a global IPv6 address
+	// before connecting. This implies `ssh_ip_version` `6`, and can't be used
+	// together with any of the floating IP options. Defaults to false.
+	UseIPv6 bool `mapstructure:"use_ipv6" required:"false"`
+	// The amount of time to wait for the instance to get a global IPv6
+	// address when `use_ipv6` is true. Defaults to `5m`.
+	IPv6AddressTimeout time.Duration `mapstructure:"ipv6_address_timeout" required:"false"`
+	// The amount of time to wait for the instance to post its encrypted
+	// administrator password when the communicator is `winrm` and
+	// `winrm_password` isn't set. Defaults to `20m`.
+	WindowsPasswordTimeout time.Duration `mapstructure:"windows_password_timeout" required:"false"`
+	// The delay between the attempts to retrieve the administrator password.
+	// Defaults to `5s`.
+	WindowsPasswordPollInterval time.Duration `mapstructure:"windows_password_poll_interval" required:"false"`
+	// The interval between the polls of the waits for the server, volumes,
+	// ports and images to change state. Defaults to `2s`.
+	StatePollInterval time.Duration `mapstructure:"state_poll_interval" required:"false"`
+	// The maximum interval the polls back off to, the interval doubling
+	// after each poll of a wait. The waits keep their timeouts. The polls
+	// back off up to a minute anyway when the cloud answers with 429 Too
+	// Many Requests. Defaults to `state_poll_interval`, without backoff.
+	StatePollMaxInterval time.Duration `mapstructure:"state_poll_max_interval" required:"false"`
+	// Wait for cloud-init, or cloudbase-init when the communicator is
+	// `winrm`, to finish booting the instance once the communicator is
+	// connected, before running the provisioners. The build fails when it
+	// finishes with errors, with the errors it reports. Defaults to false.
+	WaitForCloudInit bool `mapstructure:"wait_for_cloud_init" required:"false"`
+	// The amount of time to wait for cloud-init to finish when
+	// `wait_for_cloud_init` is true. Defaults to `30m`.
+	CloudInitTimeout time.Duration `mapstructure:"cloud_init_timeout" required:"false"`
+	// Proceed with the build when cloud-init finishes degraded, that is with
+	// recoverable errors, instead of failing it. The errors are shown as a
+	// warning. Defaults to false.
+	CloudInitAllowDegraded bool `mapstructure:"cloud_init_allow_degraded" required:"false"`
+	// Save the console log of the instance when the build fails once the
+	// instance is launched, for example when the communicator never
+	// connects, before the instance is deleted. The path of the file is shown
+	// in the error output. The console log is also fetched before the
+	// instance is stopped or shelved, the Compute service refusing to return
+	// it afterwards. Defaults to false.
+	OnFailureConsoleLog bool `mapstructure:"on_failure_console_log" required:"false"`
+	// The path of the file the console log is saved to when
+	// `on_failure_console_log` is true. Defaults to
+	// `packer_<build name>_console.log`.
+	ConsoleLogPath string `mapstructure:"console_log_path" required:"false"`
+	// The number of lines to save from the end of the console log. Defaults
+	// to the whole console log.
+	ConsoleLogLines int `mapstructure:"console_log_lines" required:"false"`
+	// Save the private key of the temporary key pair generated by Packer to
+	// this path, readable by the user only, for example to SSH into the
+	// instance of a failed build before it's deleted. The file is left in
+	// place once the build is done, even when it fails, and is recorded as
+	// `temporary_key_pair_path` in the artifact state. Nothing is saved when
+	// an existing key pair is used.
+	TemporaryKeyPairSavePath string `mapstructure:"temporary_key_pair_save_path" required:"false"`
 	// The ID or full URL to the base image to use. This is the image that will
 	// be used to launch a new server and provision it. Unless you specify
 	// completely custom SSH settings, the source image must have cloud-init
@@ -39,10 +119,46 @@ type RunConfig struct {
 	// The URL of an external base image to use. This is an alternative way of
 	// providing source_image and only either of them can be specified.
 	ExternalSourceImageURL string `mapstructure:"external_source_image_url" required:"true"`
-	// The format of the external source image to use, e.g. qcow2, raw.
+	// The ID or name of a bootable Block Storage service volume to boot the
+	// server from, instead of a base image. The image is created from the
+	// volume once provisioned, which implies `use_blockstorage_volume`. The
+	// volume must be available, or multiattach, which requires the Compute
+	// API microversion 2.60. This is an alternative way of providing
+	// source_image and only either of them can be specified.
+	SourceVolume string `mapstructure:"source_volume" required:"false"`
+	// Boot the server from a clone of `source_volume`, so that the source
+	// volume is left untouched. The clone is deleted after the build.
+	// Defaults to false.
+	CloneSourceVolume bool `mapstructure:"clone_source_volume" required:"false"`
+	// The ID or name of a Block Storage service volume snapshot to boot the
+	// server from, instead of a base image. A volume is created from the
+	// snapshot, with the size of the snapshot unless `volume_size` is set,
+	// and deleted once the image is created from it. This implies
+	// `use_blockstorage_volume`, and is an alternative way of providing
+	// source_image and only either of them can be specified.
+	SourceVolumeSnapshot string `mapstructure:"source_volume_snapshot" required:"false"`
+	// Selects the newest volume snapshot when several of them are named
+	// `source_volume_snapshot`. Defaults to false.
+	SourceVolumeSnapshotMostRecent bool `mapstructure:"source_volume_snapshot_most_recent" required:"false"`
+	// The path to a local image file to use as the base image, e.g. a qcow2
+	// built by the qemu builder. The file is uploaded into a temporary image
+	// that is deleted after the build. This is an alternative way of
+	// providing source_image and only either of them can be specified.
+	SourceImageFile string `mapstructure:"source_image_file" required:"false"`
+	// The format of the external source image or source image file to use,
+	// e.g. qcow2, raw.
 	ExternalSourceImageFormat string `mapstructure:"external_source_image_format" required:"false"`
-	// Properties to set for the external source image
+	// Properties to set for the external source image or source image file
 	ExternalSourceImageProperties map[string]string `mapstructure:"external_source_image_properties" required:"false"`
+	// The checksum of the external source image or source image file, as `<algorithm>:<value>`
+	// where algorithm is one of `sha256`, `sha512` or `md5`, or the SHA-256
+	// value alone. The imported image is verified against it before the
+	// server is launched.
+	ExternalSourceImageChecksum string `mapstructure:"external_source_image_checksum" required:"false"`
+	// Keep the image imported from `external_source_image_url` or
+	// `source_image_file` after the build instead of deleting it. Defaults to
+	// false.
+	KeepSourceImage bool `mapstructure:"keep_source_image" required:"false"`
 	// Filters used to populate filter options. Example:
 	//
 	// ```json
@@ -50,7 +166,7 @@ type RunConfig struct {
 	//     "source_image_filter": {
 	//         "filters": {
 	//             "name": "ubuntu-16.04",
-	//             "visibility": "protected",
+	//             "visibility": "shared",
 	//             "owner": "d1a588cf4b0743344508dc145649372d1",
 	//             "tags": ["prod", "ready"],
 	//             "properties": {
@@ -76,6 +192,8 @@ type RunConfig struct {
 	//     following are valid:
 	//
 	//     -   name (string)
+	//     -   name_regex (string) (a regular expression the whole image name
+	//         must match, can't be used together with `name`)
 	//     -   owner (string)
 	//     -   tags (array of strings)
 	//     -   visibility (string)
@@ -90,45 +208,264 @@ type RunConfig struct {
 	// is provided alongside `source_image`, the `source_image` will override
 	// the filter. The filter will not be used in this case.
 	SourceImageFilters ImageFilter `mapstructure:"source_image_filter" required:"true"`
+	// Accept the membership of the project on the source image when it's
+	// shared with the project and the membership is still pending, so it
+	// can be found and booted from. Images owned by the project and
+	// memberships that are already accepted are left alone. Defaults to
+	// false.
+	SourceImageAcceptMembership bool `mapstructure:"source_image_accept_membership" required:"false"`
 	// The ID, name, or full URL for the desired flavor for the server to be
 	// created.
 	Flavor string `mapstructure:"flavor" required:"true"`
+	// Select the flavor from its size rather than its name, as flavor names
+	// differ across clouds. The smallest flavor matching the filter is
+	// used, by RAM then vCPUs. If `flavor` is set too, it wins and the
+	// filter isn't used.
+	//
+	// ```json
+	// {
+	//   "flavor_filter": {
+	//     "min_vcpus": 2,
+	//     "min_ram_mb": 4096,
+	//     "min_disk_gb": 20,
+	//     "exclude": ["m1.xlarge"]
+	//   }
+	// }
+	// ```
+	FlavorFilter FlavorFilter `mapstructure:"flavor_filter" required:"false"`
+	// A regular expression the whole flavor name must match, for flavors
+	// published in versions such as `build-worker-v3`. This is an
+	// alternative to `flavor` and `flavor_filter`. When several flavors
+	// match, `flavor_regex_select` decides which one is used.
+	FlavorRegex string `mapstructure:"flavor_regex" required:"false"`
+	// How to select the flavor when several of them match `flavor_regex`.
+	// `error` (default) fails the build with the list of matches, `name`
+	// selects the last one by name, comparing the numbers in the names by
+	// value so that `v10` comes after `v9`. The Compute service doesn't
+	// expose when the flavors were created.
+	FlavorRegexSelect string `mapstructure:"flavor_regex_select" required:"false"`
+	// How to handle a source image whose `architecture`, `hw_machine_type`
+	// or `hw_firmware_type` property doesn't match the flavor extra specs,
+	// for example an `aarch64` image with a flavor requiring the
+	// `HW_ARCH_X86_64` trait. One of `warn` (default), `error` or `skip`
+	// for clouds that don't populate these properties.
+	SourceImageFlavorCheck string `mapstructure:"source_image_flavor_check" required:"false"`
 	// The availability zone to launch the server in. If this isn't specified,
 	// the default enforced by your OpenStack cluster will be used. This may be
-	// required for some OpenStack clusters.
+	// required for some OpenStack clusters. The `zone:host` and
+	// `zone:host:node` forms land the server on the given compute host or
+	// hypervisor node, such as `nova:compute-17`, which requires admin
+	// credentials. The zone part alone is then used as the default
+	// `volume_availability_zone`.
 	AvailabilityZone string `mapstructure:"availability_zone" required:"false"`
+	// A list of availability zones to try in turn to launch the server in.
+	// When the server can't be created in a zone, or goes to `ERROR` with a
+	// scheduling fault such as `No valid host was found`, it's deleted and
+	// launched again in the next zone. The zone the server was launched in
+	// is exposed as `availability_zone` in the artifact state. This can't
+	// be used with `availability_zone`. The Block Storage volumes aren't
+	// created in these zones, set `volume_availability_zone` if needed.
+	AvailabilityZones []string `mapstructure:"availability_zones" required:"false"`
+	// The amount of time to wait for the server to become `ACTIVE` in each
+	// of the `availability_zones` before trying the next one. Defaults to
+	// `10m`.
+	AvailabilityZoneTimeout time.Duration `mapstructure:"availability_zone_timeout" required:"false"`
+	// The number of times to retry launching the server when it fails to be
+	// scheduled, the server ending up in `ERROR` because no valid host was
+	// found. The failed server is deleted before each retry. Defaults to
+	// `0`, no retry.
+	SchedulingRetries int `mapstructure:"scheduling_retries" required:"false"`
+	// The amount of time to wait before retrying to launch the server.
+	// Defaults to `30s`.
+	SchedulingRetryDelay time.Duration `mapstructure:"scheduling_retry_delay" required:"false"`
+	// The IDs or names of the flavors to fall back to, in order, when the
+	// server fails to be scheduled with the flavor, retries included. Each
+	// fallback flavor is tried with `scheduling_retries` retries too. The
+	// flavor the image was built with is recorded in the image provenance
+	// metadata.
+	FlavorFallbacks []string `mapstructure:"flavor_fallbacks" required:"false"`
 	// For rackspace, whether or not to wait for Rackconnect to assign the
 	// machine an IP address before connecting via SSH. Defaults to false.
 	RackconnectWait bool `mapstructure:"rackconnect_wait" required:"false"`
 	// The ID or name of an external network that can be used for creation of a
-	// new floating IP.
+	// new floating IP. When a new floating IP is required but neither this
+	// nor `floating_ip_networks` is set, the external network is discovered:
+	// the build fails unless the cloud has exactly one.
 	FloatingIPNetwork string `mapstructure:"floating_ip_network" required:"false"`
-	// The ID of the network to which the instance is attached and which should
-	// be used to associate with the floating IP. This provides control over
-	// the floating ip association on multi-homed instances. The association
-	// otherwise depends on a first-returned-interface policy which could fail
-	// if the network to which it is connected is unreachable from the floating
-	// IP network.
+	// A list of IDs or names of external networks that can be used for
+	// creation of a new floating IP. The networks are tried in order: a
+	// network that can't be found, or that has no floating IP left for the
+	// project (quota exceeded or no more addresses), is skipped in favor of
+	// the next one. This is an alternative to `floating_ip_network` and only
+	// either of them can be specified.
+	FloatingIPNetworks []string `mapstructure:"floating_ip_networks" required:"false"`
+	// The ID or name of a subnet of `floating_ip_network` to allocate the
+	// new floating IP from. When `reuse_ips` is true, only floating IPs whose
+	// address is part of this subnet are considered for reuse.
+	FloatingIPSubnet string `mapstructure:"floating_ip_subnet" required:"false"`
+	// The description to set on the floating IP allocated by Packer. This
+	// helps tracking down the build a leaked floating IP came from. Defaults
+	// to `packer:<build name>:<timestamp>`. The description of reused
+	// floating IPs is left untouched.
+	FloatingIPDescription string `mapstructure:"floating_ip_description" required:"false"`
+	// The ID or name of the network to which the instance is attached and
+	// which should be used to associate with the floating IP. This provides
+	// control over the floating ip association on multi-homed instances. The
+	// association otherwise depends on a first-returned-interface policy which
+	// could fail if the network to which it is connected is unreachable from
+	// the floating IP network.
 	InstanceFloatingIPNet string `mapstructure:"instance_floating_ip_net" required:"false"`
-	// A specific floating IP to assign to this instance.
+	// By default the build fails when none of the instance interfaces is
+	// attached to `instance_floating_ip_net`. Set this to true to associate
+	// the floating IP with the first interface instead. Defaults to false.
+	InstanceFloatingIPNetFallback bool `mapstructure:"instance_floating_ip_net_fallback" required:"false"`
+	// The ID or address of a specific floating IP to assign to this
+	// instance. The floating IP is disassociated from the instance at the
+	// end of the build but never deleted.
 	FloatingIP string `mapstructure:"floating_ip" required:"false"`
 	// Whether or not to attempt to reuse existing unassigned floating ips in
 	// the project before allocating a new one. Note that it is not possible to
 	// safely do this concurrently, so if you are running multiple openstack
 	// builds concurrently, or if other processes are assigning and using
 	// floating IPs in the same openstack project while packer is running, you
-	// should not set this to true. Defaults to false.
+	// should not set this to true. Reused floating IPs are disassociated at
+	// the end of the build but never deleted. Defaults to false.
 	ReuseIPs bool `mapstructure:"reuse_ips" required:"false"`
-	// A list of security groups by name to add to this instance.
+	// Always allocate a new floating IP from `floating_ip_network` (or
+	// `floating_ip_networks`, or the discovered external network) and delete
+	// it at the end of the build. Free floating IPs of the project are never
+	// considered, and the build fails with the error returned by Neutron, for
+	// example when the floating IP quota is exceeded. Can't be used together
+	// with `floating_ip` or `reuse_ips`. Defaults to false.
+	ForceNewFloatingIP bool `mapstructure:"force_new_floating_ip" required:"false"`
+	// Skip the check of the floating IP quota of the project done before
+	// the build starts when a new floating IP may be allocated. The build
+	// otherwise fails early if the quota is exhausted, unless `reuse_ips` is
+	// set and a free floating IP exists. Defaults to false.
+	SkipFloatingIPQuotaCheck bool `mapstructure:"skip_floating_ip_quota_check" required:"false"`
+	// A list of Neutron tags used to restrict which floating IPs can be
+	// reused when `reuse_ips` is true. Only floating IPs carrying all of the
+	// given tags are considered. If none of them is free, a new floating IP
+	// is allocated from `floating_ip_network`, tagged and kept after the
+	// build so that it can be reused later on. Requires the networking
+	// service to support resource tags.
+	FloatingIPTags []string `mapstructure:"floating_ip_tags" required:"false"`
+	// The number of times to retry the association of a reused floating IP
+	// when it was associated by another process in the meantime, for example
+	// by a concurrent build. A different free floating IP is searched for
+	// before each retry. Only applies when `reuse_ips` is true. Set to 0 to
+	// not retry. Defaults to 3.
+	FloatingIPAssociateRetries *int `mapstructure:"floating_ip_associate_retries" required:"false"`
+	// The base delay between floating IP association retries. Each retry
+	// waits a bit longer than the previous one, plus a random jitter.
+	// Defaults to `2s`.
+	FloatingIPAssociateRetryDelay time.Duration `mapstructure:"floating_ip_associate_retry_delay" required:"false"`
+	// The amount of time to wait for the floating IP to become `ACTIVE`
+	// after it has been associated with the instance. The communicator
+	// isn't started before that. Defaults to `2m`.
+	FloatingIPActiveTimeout time.Duration `mapstructure:"floating_ip_active_timeout" required:"false"`
+	// The amount of time to wait for an instance port to become `ACTIVE`
+	// before associating the floating IP with it. Ports that aren't `ACTIVE`
+	// are skipped in favor of the other candidate ports. Defaults to `2m`.
+	FloatingIPPortActiveTimeout time.Duration `mapstructure:"floating_ip_port_active_timeout" required:"false"`
+	// A list of security groups by name or ID to add to this instance. Names
+	// are resolved to IDs with the networking service before the build
+	// starts, and the build fails if a name is unknown or ambiguous.
 	SecurityGroups []string `mapstructure:"security_groups" required:"false"`
+	// A list of IPv4 or IPv6 CIDR blocks to be authorized access to the
+	// instance, when `security_groups` isn't set. A temporary security group
+	// allowing the communicator port from these blocks is created, attached
+	// to the instance and deleted at the end of the build.
+	TemporarySecurityGroupSourceCIDRs []string `mapstructure:"temporary_security_group_source_cidrs" required:"false"`
 	// A list of networks by UUID to attach to this instance.
 	Networks []string `mapstructure:"networks" required:"false"`
+	// The fixed IP address to launch the instance with on some of the
+	// `networks`, by network UUID. The addresses must be in a subnet of
+	// their network and not allocated yet. The communicator connects to the
+	// first fixed IP, by address, unless a floating IP or `ssh_interface`
+	// is used. Example:
+	//
+	// ```hcl
+	// networks          = ["0ddc5e42-e4b3-4f45-9a02-a4e1b1f4ed4b"]
+	// network_fixed_ips = {
+	//   "0ddc5e42-e4b3-4f45-9a02-a4e1b1f4ed4b" = "10.0.0.40"
+	// }
+	// ```
+	NetworkFixedIPs map[string]string `mapstructure:"network_fixed_ips" required:"false"`
+	// Create the ports with the `network_fixed_ips` addresses in the
+	// Networking service before launching the instance, as with
+	// `instance_port`, for networks whose policy doesn't let the Compute
+	// service allocate fixed IPs. These ports are attached after the other
+	// `networks`. Defaults to false.
+	NetworkFixedIPPorts bool `mapstructure:"network_fixed_ip_ports" required:"false"`
 	// A list of ports by UUID to attach to this instance.
 	Ports []string `mapstructure:"ports" required:"false"`
+	// Ports to create in the Networking service and to attach to this
+	// instance. Unlike `ports`, these are created by Packer before launching
+	// the instance, which allows setting port attributes such as a fixed IP
+	// address, and deleted once the build is done. Example:
+	//
+	// ```hcl
+	// instance_port {
+	//   network         = "private"
+	//   fixed_ip        = "10.0.0.10"
+	//   security_groups = ["default"]
+	// }
+	// ```
+	//
+	// Refer to the [InstancePort](#instance-port-configuration) section for
+	// the available options.
+	InstancePorts []InstancePort `mapstructure:"instance_port" required:"false"`
+	// A list of address pairs to allow on the first port of the instance,
+	// for example to let the instance bring up a virtual IP address during
+	// the build. Ignored with a warning when port security is disabled on
+	// the port. Example:
+	//
+	// ```hcl
+	// allowed_address_pairs {
+	//   ip_address  = "10.0.0.100"
+	//   mac_address = "fa:16:3e:00:00:01"
+	// }
+	// ```
+	//
+	// -   `ip_address` (string) - The IP address or CIDR to allow. Required.
+	// -   `mac_address` (string) - The MAC address to allow. Defaults to the
+	//     MAC address of the port.
+	AllowedAddressPairs []AddressPair `mapstructure:"allowed_address_pairs" required:"false"`
+	// The name or ID of a QoS policy to apply to the primary port of the
+	// instance once it is running, for example to rate-limit the traffic of
+	// the build. The previous policy of a port given in `ports` is restored
+	// at the end of the build.
+	PortQoSPolicy string `mapstructure:"port_qos_policy" required:"false"`
+	// The DNS name to set on the primary port of the instance once it is
+	// running, for example `{{ build_name }}`. Requires the `dns-integration`
+	// networking extension.
+	PortDNSName string `mapstructure:"port_dns_name" required:"false"`
+	// The DNS domain to set on the primary port of the instance, it must end
+	// with a dot. Requires the `dns-domain-ports` networking extension.
+	PortDNSDomain string `mapstructure:"port_dns_domain" required:"false"`
 	// A list of network CIDRs to discover the network to attach to this instance.
 	// The first network whose subnet is contained within any of the given CIDRs
-	// is used. Ignored if either of the above two options are provided.
+	// is used, preferring subnets with DHCP enabled. Ignored if any of the
+	// above three options are provided.
 	NetworkDiscoveryCIDRs []string `mapstructure:"network_discovery_cidrs" required:"false"`
+	// Only consider subnets of the given IP version, `4` or `6`, when
+	// discovering the network with `network_discovery_cidrs`. Defaults to
+	// any version.
+	NetworkDiscoveryIPVersion int `mapstructure:"network_discovery_ip_version" required:"false"`
+	// Only consider subnets with DHCP enabled when discovering the network
+	// with `network_discovery_cidrs`. When several subnets match, the ones
+	// with DHCP enabled are preferred anyway. Defaults to false.
+	NetworkDiscoveryRequireDHCP bool `mapstructure:"network_discovery_require_dhcp" required:"false"`
+	// A list of Neutron tags to discover the networks to attach to this
+	// instance. Only networks carrying all of the given tags are considered.
+	// Ignored if `networks`, `ports` or `instance_port` are provided, and
+	// can't be used together with `network_discovery_cidrs`.
+	NetworkDiscoveryTags []string `mapstructure:"network_discovery_tags" required:"false"`
+	// What to do when several networks match `network_discovery_tags`. With
+	// `single` the build fails, with `all` the instance is attached to all of
+	// them. Defaults to `single`.
+	NetworkDiscoveryMatch string `mapstructure:"network_discovery_match" required:"false"`
 	// User data to apply when launching the instance. Note that you need to be
 	// careful about escaping characters due to the templates being JSON. It is
 	// often more convenient to use user_data_file, instead. Packer will not
@@ -138,21 +475,160 @@ type RunConfig struct {
 	// Path to a file that will be used for the user data when launching the
 	// instance.
 	UserDataFile string `mapstructure:"user_data_file" required:"false"`
+	// Files assembled into a multipart MIME archive used for the user data,
+	// which is how cloud-init combines, for example, a cloud-config with a
+	// shell script. This can't be used with `user_data` or `user_data_file`.
+	//
+	// ```json
+	// {
+	//   "user_data_parts": [
+	//     {"file": "cloud-config.yaml", "content_type": "text/cloud-config"},
+	//     {"file": "setup.sh", "content_type": "text/x-shellscript"}
+	//   ]
+	// }
+	// ```
+	UserDataParts []UserDataPart `mapstructure:"user_data_parts" required:"false"`
+	// Compress the user data with gzip, which cloud-init decompresses, to fit
+	// larger user data in the 64 KB the Compute API allows once base64
+	// encoded. Defaults to false.
+	UserDataGzip bool `mapstructure:"user_data_gzip" required:"false"`
+	// Files injected into the instance at boot by the Compute service, for
+	// images without cloud-init. The number and size of the files are
+	// checked against the limits of the project. File injection is
+	// deprecated by the Compute API and may be disabled in the cloud.
+	//
+	// ```json
+	// {
+	//   "personality": [
+	//     {"path": "/root/.ssh/authorized_keys", "file": "id_rsa.pub"},
+	//     {"path": "/etc/motd", "content": "Built by Packer"}
+	//   ]
+	// }
+	// ```
+	Personality []PersonalityFile `mapstructure:"personality" required:"false"`
+	// The password of the administrator or root user, set by the Compute
+	// service when launching the instance. When the communicator is `winrm`
+	// and `winrm_password` isn't set, this password is used for WinRM rather
+	// than retrieving the one encrypted with the keypair. The source image
+	// must accept the injected password.
+	AdminPassword string `mapstructure:"admin_password" required:"false"`
+	// The IDs of the certificates used to validate the signature of the
+	// source image, for clouds that enforce image signature validation.
+	// This requires the Compute API microversion 2.63, and can't be used with
+	// `personality`.
+	TrustedImageCertificateIDs []string `mapstructure:"trusted_image_certificate_ids" required:"false"`
+	// Set the `img_signature_certificate_uuid` property of the image to the
+	// certificate of `trusted_image_certificate_ids`, which must then contain
+	// a single ID, so that the image can be validated with it. The image
+	// must still be signed, setting the `img_signature`,
+	// `img_signature_hash_method` and `img_signature_key_type` properties,
+	// before it boots under image signature validation. Defaults to false.
+	TrustedImageCertificateProperty bool `mapstructure:"trusted_image_certificate_property" required:"false"`
 	// Name that is applied to the server instance created by Packer. If this
-	// isn't specified, the default is same as image_name.
+	// isn't specified, the default is same as image_name. This is a
+	// [template engine](/packer/docs/templates/legacy_json_templates/engine)
+	// with the same variables as `instance_metadata`, for example
+	// `packer-{{ .BuildName }}-{{ timestamp }}`. The name is at most 255
+	// characters, and can't contain control characters nor start or end with
+	// a space.
 	InstanceName string `mapstructure:"instance_name" required:"false"`
 	// Metadata that is applied to the server instance created by Packer. Also
 	// called server properties in some documentation. The strings have a max
-	// size of 255 bytes each.
+	// size of 255 bytes each. The values are [template
+	// engines](/packer/docs/templates/legacy_json_templates/engine), the
+	// following variables are available:
+	//
+	// - `BuildName` - The name of the build.
+	// - `BuildType` - The type of the builder.
+	// - `RunUUID` - A UUID identifying this run of `packer build`.
+	//
+	// ```hcl
+	// instance_metadata = {
+	//   cost_center = "images-{{ .BuildName }}"
+	// }
+	// ```
 	InstanceMetadata map[string]string `mapstructure:"instance_metadata" required:"false"`
+	// Scheduler hints passed to the Compute service when launching the
+	// instance, for example to place it in a server group or away from a
+	// given server. The hints are passed as is, their meaning depends on the
+	// filters enabled in the cluster. Refer to the
+	// [SchedulerHints](#scheduler-hints-configuration) section for the
+	// available options.
+	SchedulerHints SchedulerHints `mapstructure:"scheduler_hints" required:"false"`
+	// Launch the instance in a temporary server group with the given policy,
+	// one of `affinity`, `anti-affinity`, `soft-affinity` or
+	// `soft-anti-affinity`. The builds of a `packer build` run with the same
+	// policy share one server group, named after the run, so that
+	// `anti-affinity` spreads parallel builds over compute hosts. The server
+	// group is deleted once none of the builds uses it anymore. The soft
+	// policies require the Compute API microversion 2.15. Can't be used
+	// together with the scheduler_hints group.
+	ServerGroupPolicy string `mapstructure:"server_group_policy" required:"false"`
+	// Add the `packer_build_name` and `packer_run_uuid` keys to
+	// instance_metadata, unless they are set already. Defaults to false.
+	InstanceMetadataDefaults bool `mapstructure:"instance_metadata_defaults" required:"false"`
 	// Whether to force the OpenStack instance to be forcefully deleted. This
 	// is useful for environments that have reclaim / soft deletion enabled. By
-	// default this is false.
+	// default this is false. The instance is deleted normally when the cloud
+	// doesn't allow force deleting it, and the build fails when it's soft
+	// deleted, as it holds on to its resources until it's reclaimed.
 	ForceDelete bool `mapstructure:"force_delete" required:"false"`
+	// The description of the instance, for example to tell who to contact
+	// about it. This requires the Compute API microversion 2.19, the
+	// description isn't set on older clouds. When the instance is stopped
+	// to create the image, ` (stopped for image creation)` is appended to
+	// the description. At most 255 characters.
+	InstanceDescription string `mapstructure:"instance_description" required:"false"`
+	// Tags to set on the instance, with the Compute API microversion 2.52 or
+	// the tags API once the instance is created on older clouds, so that
+	// tooling relying on tags finds the instances of the builds. A tag is
+	// at most 60 characters and can't contain `/` or `,`. No tags are set
+	// by default.
+	InstanceTags []string `mapstructure:"instance_tags" required:"false"`
 	// Whether or not nova should use ConfigDrive for cloud-init metadata.
 	ConfigDrive bool `mapstructure:"config_drive" required:"false"`
 	// Deprecated use floating_ip_network instead.
 	FloatingIPPool string `mapstructure:"floating_ip_pool" required:"false"`
+	// The ID or name of an existing server to build the image from, instead
+	// of launching one. The communicator connects to the running server,
+	// the provisioners run on it and the image is created from it, and the
+	// server is left as it was: it's neither stopped, unless
+	// `stop_existing_instance` is true, nor deleted. Can't be used with the
+	// source image and flavor options, `use_blockstorage_volume` or
+	// `shelve_instance`. The communicator must be given the credentials of
+	// the server, no temporary key pair is created.
+	InstanceID string `mapstructure:"instance_id" required:"false"`
+	// Stop the server of `instance_id` before creating the image. It's left
+	// stopped afterwards. Defaults to `false`.
+	StopExistingInstance bool `mapstructure:"stop_existing_instance" required:"false"`
+	// Shelve the server instead of stopping it once provisioned. The
+	// snapshot the Compute service takes of the server when shelving it
+	// becomes the image, instead of one taken through the image creation
+	// API. Can't be used with `use_blockstorage_volume`, shelving a
+	// volume-backed server doesn't snapshot its root volume.
+	ShelveInstance bool `mapstructure:"shelve_instance" required:"false"`
+	// Offload the shelved server from its host, instead of leaving it to the
+	// `shelved_offload_time` of the Compute service. Requires
+	// `shelve_instance`.
+	ShelveOffload bool `mapstructure:"shelve_offload" required:"false"`
+	// How the server is made consistent before its image is created: `stop`
+	// stops it, `pause` pauses it for a crash-consistent snapshot of the
+	// running server, and `quiesce` keeps it running and has the Compute
+	// service freeze its filesystems through the QEMU guest agent while
+	// taking the snapshot. `quiesce` requires the source image to have the
+	// `hw_qemu_guest_agent` property set to `yes`, and the snapshot is only
+	// guaranteed to be quiesced when it has `os_require_quiesce` set to `yes`
+	// too. Defaults to `stop`. Can't be used with `use_blockstorage_volume`
+	// or `shelve_instance` unless `stop`.
+	SnapshotConsistency string `mapstructure:"snapshot_consistency" required:"false"`
+	// Don't stop the server before creating the image, the image is a live
+	// snapshot of the running server. This saves the time the server takes
+	// to shut down, but the image may not be filesystem-consistent unless
+	// the source image sets the `hw_qemu_guest_agent` and
+	// `os_require_quiesce` properties, the build warns when it doesn't.
+	// Can't be used with `use_blockstorage_volume`, `shelve_instance` or
+	// `snapshot_consistency` other than `stop`.
+	SkipStopBeforeImage bool `mapstructure:"skip_stop_before_image" required:"false"`
 	// Use Block Storage service volume for the instance root volume instead of
 	// Compute service local volume (default).
 	UseBlockStorageVolume bool `mapstructure:"use_blockstorage_volume" required:"false"`
@@ -168,17 +644,93 @@ type RunConfig struct {
 	// specified, if use_blockstorage_volume is true.
 	VolumeSize int `mapstructure:"volume_size" required:"false"`
 	// Availability zone of the Block Storage service volume. If omitted,
-	// Compute instance availability zone will be used. If both of Compute
+	// Compute instance availability zone will be used when the Block Storage
+	// service has an availability zone with the same name. If both of Compute
 	// instance and Block Storage volume availability zones aren't specified,
-	// the default enforced by your OpenStack cluster will be used.
+	// the default enforced by your OpenStack cluster will be used. The
+	// build fails before creating the volume if the Block Storage service
+	// has no such availability zone.
 	VolumeAvailabilityZone string `mapstructure:"volume_availability_zone" required:"false"`
+	// Upload the Block Storage service volume to the image service even when
+	// the volume is still in use. Only needed when the volume can't be
+	// detached cleanly. Defaults to false.
+	VolumeUploadForce bool `mapstructure:"volume_upload_force" required:"false"`
+	// Keep the Block Storage service volume after a successful build instead
+	// of deleting it. The volume is deleted anyway when the build fails.
+	// Defaults to false.
+	KeepVolume bool `mapstructure:"keep_volume" required:"false"`
+	// Let the Compute service delete the Block Storage service volume
+	// together with the instance, so the volume doesn't outlive an instance
+	// Packer couldn't clean up. Packer still deletes the volume itself when
+	// the Compute service didn't. Before deleting the instance to create the
+	// image, Packer clears the flag so the volume survives, which requires
+	// the Compute API microversion 2.85. A volume kept with keep_volume is
+	// never deleted by Packer after a successful build. Can't be used with
+	// source_volume unless clone_source_volume is true. Defaults to false.
+	BootVolumeDeleteOnTermination bool `mapstructure:"boot_volume_delete_on_termination" required:"false"`
+	// Additional Block Storage service volumes attached to the instance,
+	// for example a scratch disk or a data volume formatted by the
+	// provisioners. The volumes are created by Packer and deleted once the
+	// build is done, unless delete_on_termination is false. Example:
+	//
+	// ```hcl
+	// block_device_mappings {
+	//   volume_size           = 20
+	//   delete_on_termination = true
+	//   snapshot_mode         = "detach"
+	// }
+	// ```
+	//
+	// Refer to the [BlockDeviceMapping](#block-device-mapping-configuration)
+	// section for the available options.
+	BlockDeviceMappings []BlockDeviceMapping `mapstructure:"block_device_mappings" required:"false"`
+	// The snapshot_mode of the block_device_mappings volumes that don't set
+	// one. Defaults to `include`.
+	BlockDeviceSnapshotMode string `mapstructure:"block_device_snapshot_mode" required:"false"`
+	// Existing Block Storage service volumes to attach to the instance once
+	// it's `ACTIVE`, for example a dataset the provisioners read from that
+	// shouldn't end up in the image. Packer waits for the volumes to be
+	// attached, and detaches them before the instance is stopped, and when
+	// the build fails. Example:
+	//
+	// ```hcl
+	// attach_volumes {
+	//   volume = "datasets"
+	//   device = "/dev/vdc"
+	// }
+	// ```
+	//
+	// Refer to the [AttachVolume](#attach-volume-configuration) section for
+	// the available options.
+	AttachVolumes []AttachVolume `mapstructure:"attach_volumes" required:"false"`
+	// Size in GB of the Compute service ephemeral disk attached to the
+	// instance, for example for scratch space that shouldn't end up in the
+	// image. The flavor must allow an ephemeral disk of this size.
+	EphemeralSizeGB int `mapstructure:"ephemeral_size_gb" required:"false"`
+	// The file system the ephemeral disk is formatted with, for example
+	// `ext4`. If this isn't specified, the default enforced by your
+	// OpenStack cluster will be used.
+	EphemeralGuestFormat string `mapstructure:"ephemeral_guest_format" required:"false"`
+	// Size in MB of the Compute service swap disk attached to the instance.
+	// The flavor must allow a swap disk of this size.
+	SwapSizeMB int `mapstructure:"swap_size_mb" required:"false"`
 
 	// Not really used, but here for BC
 	OpenstackProvider string `mapstructure:"openstack_provider"`
 	// *Deprecated* use `floating_ip` or `floating_ip_pool` instead.
 	UseFloatingIp bool `mapstructure:"use_floating_ip" required:"false"`
 
-	sourceImageOpts images.ListOpts
+	sourceImageOpts                 images.ListOpts
+	sourceImageNameRegex            *regexp.Regexp
+	flavorRegex                     *regexp.Regexp
+	externalSourceImageChecksumAlgo string
+	externalSourceImageChecksum     string
+	// runUUID identifies this run of packer build in the instance metadata
+	// and the server group name.
+	runUUID string
+	// volumeAvailabilityZoneDefaulted tells whether VolumeAvailabilityZone
+	// is the Compute instance availability zone.
+	volumeAvailabilityZoneDefaulted bool
 }
 
 type ImageFilter struct {
@@ -193,14 +745,463 @@ type ImageFilter struct {
 
 type ImageFilterOptions struct {
 	Name       string            `mapstructure:"name"`
+	NameRegex  string            `mapstructure:"name_regex"`
 	Owner      string            `mapstructure:"owner"`
 	Tags       []string          `mapstructure:"tags"`
 	Visibility string            `mapstructure:"visibility"`
 	Properties map[string]string `mapstructure:"properties"`
 }
 
+// InstancePort describes a port created by Packer in the Networking service
+// and attached to the instance.
+type InstancePort struct {
+	// The ID or name of the network to create the port in.
+	Network string `mapstructure:"network" required:"true"`
+	// The name of the port. If this isn't specified, a random name is used.
+	Name string `mapstructure:"name" required:"false"`
+	// The fixed IP address to assign to the port. If this isn't specified,
+	// an address is allocated by the Networking service.
+	FixedIP string `mapstructure:"fixed_ip" required:"false"`
+	// The ID of the subnet to allocate the fixed IP address from. This is
+	// only required if the network has multiple subnets.
+	SubnetID string `mapstructure:"subnet_id" required:"false"`
+	// A list of security groups by ID or name to apply to the port. If this
+	// isn't specified, the default security group of the project is used.
+	SecurityGroups []string `mapstructure:"security_groups" required:"false"`
+	// The virtual NIC type of the port, for example `direct` to build on an
+	// SR-IOV capable port. One of `normal`, `direct`, `macvtap`,
+	// `direct-physical`, `baremetal`, `virtio-forwarder`, `smart-nic`,
+	// `vdpa` or `remote-managed`. If this isn't specified, the default
+	// enforced by your OpenStack cluster will be used.
+	VNICType string `mapstructure:"vnic_type" required:"false"`
+	// Makes the port the parent port of a trunk, delivering the networks of
+	// its subports to the instance as VLANs. See the trunk configuration
+	// below.
+	Trunk *InstancePortTrunk `mapstructure:"trunk" required:"false"`
+}
+
+// InstancePortTrunk describes a trunk created by Packer on top of an
+// instance port.
+type InstancePortTrunk struct {
+	// The name of the trunk. If this isn't specified, the name of the port
+	// is used.
+	Name string `mapstructure:"name" required:"false"`
+	// The subports of the trunk, each one is a port created by Packer in the
+	// given network.
+	Subports []TrunkSubport `mapstructure:"subport" required:"false"`
+}
+
+// TrunkSubport describes a subport of a trunk.
+type TrunkSubport struct {
+	// The ID or name of the network to create the subport in.
+	Network string `mapstructure:"network" required:"true"`
+	// The segmentation ID of the subport, for example the VLAN ID.
+	SegmentationID int `mapstructure:"segmentation_id" required:"true"`
+	// The segmentation type of the subport, `vlan` or `inherit`. Defaults to
+	// `vlan`.
+	SegmentationType string `mapstructure:"segmentation_type" required:"false"`
+}
+
+func (p *InstancePort) Prepare() []error {
+	var errs []error
+
+	if p.Network == "" {
+		errs = append(errs, errors.New("A network must be specified for each instance_port"))
+	}
+
+	if p.FixedIP != "" && net.ParseIP(p.FixedIP) == nil {
+		errs = append(errs, fmt.Errorf("Invalid instance_port fixed_ip: %s", p.FixedIP))
+	}
+
+	if p.VNICType != "" {
+		validVNICTypes := []string{"normal", "direct", "macvtap", "direct-physical",
+			"baremetal", "virtio-forwarder", "smart-nic", "vdpa", "remote-managed"}
+		valid := false
+		for _, vnicType := range validVNICTypes {
+			if p.VNICType == vnicType {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			errs = append(errs, fmt.Errorf("Unknown instance_port vnic_type value %s", p.VNICType))
+		}
+	}
+
+	if p.Name == "" {
+		p.Name = fmt.Sprintf("packer_%s", uuid.TimeOrderedUUID())
+	}
+
+	if p.Trunk != nil {
+		if p.Trunk.Name == "" {
+			p.Trunk.Name = p.Name
+		}
+
+		for i := range p.Trunk.Subports {
+			subport := &p.Trunk.Subports[i]
+			if subport.Network == "" {
+				errs = append(errs, errors.New("A network must be specified for each trunk subport"))
+			}
+
+			if subport.SegmentationType == "" {
+				subport.SegmentationType = "vlan"
+			}
+			switch subport.SegmentationType {
+			case "vlan":
+				if subport.SegmentationID < 1 || subport.SegmentationID > 4094 {
+					errs = append(errs, fmt.Errorf("Invalid trunk subport segmentation_id %d, must be between 1 and 4094", subport.SegmentationID))
+				}
+			case "inherit":
+			default:
+				errs = append(errs, fmt.Errorf("Unknown trunk subport segmentation_type value %s", subport.SegmentationType))
+			}
+		}
+	}
+
+	return errs
+}
+
+// SchedulerHints are the scheduler hints of the instance.
+type SchedulerHints struct {
+	// The ID of the server group to launch the instance in.
+	Group string `mapstructure:"group" required:"false"`
+	// Launch the instance on the same host as the given servers.
+	SameHost []string `mapstructure:"same_host" required:"false"`
+	// Launch the instance on a different host than the given servers.
+	DifferentHost []string `mapstructure:"different_host" required:"false"`
+	// A JSON query for the JsonFilter, for example
+	// `[">=", "$free_ram_mb", 1024]`.
+	Query string `mapstructure:"query" required:"false"`
+	// The name of the cell to launch the instance in.
+	TargetCell string `mapstructure:"target_cell" required:"false"`
+	// Additional hints passed as is, for custom scheduler filters.
+	AdditionalProperties map[string]string `mapstructure:"additional_properties" required:"false"`
+}
+
+func (h *SchedulerHints) Prepare() []error {
+	var errs []error
+
+	if h.Query != "" {
+		var query interface{}
+		if err := json.Unmarshal([]byte(h.Query), &query); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid scheduler_hints query, it must be JSON: %s", err))
+		}
+	}
+
+	return errs
+}
+
+// FlavorFilter selects the flavor of the instance by its size.
+type FlavorFilter struct {
+	// The minimum number of vCPUs of the flavor.
+	MinVCPUs int `mapstructure:"min_vcpus" required:"false"`
+	// The minimum amount of RAM of the flavor, in MB.
+	MinRAMMB int `mapstructure:"min_ram_mb" required:"false"`
+	// The minimum root disk size of the flavor, in GB. Flavors without a
+	// root disk size don't match when this is set.
+	MinDiskGB int `mapstructure:"min_disk_gb" required:"false"`
+	// Only select the flavors whose name starts with this prefix.
+	NamePrefix string `mapstructure:"name_prefix" required:"false"`
+	// The names or IDs of the flavors never to select.
+	Exclude []string `mapstructure:"exclude" required:"false"`
+}
+
+func (f *FlavorFilter) Empty() bool {
+	return f.MinVCPUs == 0 && f.MinRAMMB == 0 && f.MinDiskGB == 0 && f.NamePrefix == "" && len(f.Exclude) == 0
+}
+
+func (f *FlavorFilter) Prepare() []error {
+	var errs []error
+
+	if f.MinVCPUs < 0 || f.MinRAMMB < 0 || f.MinDiskGB < 0 {
+		errs = append(errs, errors.New("flavor_filter minimums must be greater than or equal to 0"))
+	}
+
+	return errs
+}
+
+// hints returns the scheduler hints of the server create request.
+func (h *SchedulerHints) hints() map[string]interface{} {
+	hints := make(map[string]interface{})
+	for key, value := range h.AdditionalProperties {
+		hints[key] = value
+	}
+	if h.Group != "" {
+		hints["group"] = h.Group
+	}
+	if len(h.SameHost) > 0 {
+		hints["same_host"] = h.SameHost
+	}
+	if len(h.DifferentHost) > 0 {
+		hints["different_host"] = h.DifferentHost
+	}
+	if h.Query != "" {
+		hints["query"] = h.Query
+	}
+	if h.TargetCell != "" {
+		hints["target_cell"] = h.TargetCell
+	}
+	return hints
+}
+
+// packerRunUUID returns the UUID of the packer build run, which is shared by its
+// builds, or a new UUID when Packer didn't set one.
+func packerRunUUID() string {
+	if id := os.Getenv("PACKER_RUN_UUID"); id != "" {
+		return id
+	}
+	return uuid.TimeOrderedUUID()
+}
+
+// instanceMetadataTemplate is the data available to the instance_metadata
+// values and instance_name.
+type instanceMetadataTemplate struct {
+	BuildName string
+	BuildType string
+	RunUUID   string
+}
+
+// validateInstanceName checks the name against the server names the Compute
+// service accepts.
+func validateInstanceName(name string) error {
+	if utf8.RuneCountInString(name) > maxInstanceNameSize {
+		return fmt.Errorf("instance_name too long (max %d characters): %s", maxInstanceNameSize, name)
+	}
+	if strings.TrimSpace(name) != name {
+		return fmt.Errorf("instance_name can't start or end with a space: %q", name)
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("instance_name can't contain control characters: %q", name)
+		}
+	}
+	return nil
+}
+
+// prepareInstanceMetadata renders the instance_name and instance_metadata
+// values, and adds the default instance_metadata keys.
+func (c *RunConfig) prepareInstanceMetadata(ctx *interpolate.Context) []error {
+	var errs []error
+
+	renderCtx := interpolate.Context{}
+	if ctx != nil {
+		renderCtx = *ctx
+	}
+	renderCtx.Data = &instanceMetadataTemplate{
+		BuildName: renderCtx.BuildName,
+		BuildType: renderCtx.BuildType,
+		RunUUID:   c.runUUID,
+	}
+
+	if c.InstanceName != "" {
+		name, err := interpolate.Render(c.InstanceName, &renderCtx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error rendering instance_name: %s", err))
+		}
+		c.InstanceName = name
+		if err := validateInstanceName(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	metadata := make(map[string]string, len(c.InstanceMetadata))
+	for key, value := range c.InstanceMetadata {
+		rendered, err := interpolate.Render(value, &renderCtx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error rendering instance_metadata %s: %s", key, err))
+			continue
+		}
+		metadata[key] = rendered
+	}
+
+	if c.InstanceMetadataDefaults {
+		defaults := map[string]string{
+			"packer_build_name": renderCtx.BuildName,
+			"packer_run_uuid":   c.runUUID,
+		}
+		for key, value := range defaults {
+			if _, ok := metadata[key]; !ok {
+				metadata[key] = value
+			}
+		}
+	}
+
+	if len(metadata) > 0 {
+		c.InstanceMetadata = metadata
+	}
+	return errs
+}
+
+// BlockDeviceMapping describes an additional volume attached to the
+// instance.
+type BlockDeviceMapping struct {
+	// The source of the volume: `blank` for an empty volume, `image`,
+	// `snapshot` for a volume snapshot or `volume` to attach an existing
+	// volume. Defaults to `blank`.
+	SourceType string `mapstructure:"source_type" required:"false"`
+	// The ID of the image, volume snapshot or volume. Required unless
+	// source_type is `blank`.
+	SourceID string `mapstructure:"source_id" required:"false"`
+	// Size of the volume in GB. Required for `blank` volumes, defaults to
+	// the size of the source otherwise.
+	VolumeSize int `mapstructure:"volume_size" required:"false"`
+	// Type of the volume. If this isn't specified, the default enforced by
+	// your OpenStack cluster will be used.
+	VolumeType string `mapstructure:"volume_type" required:"false"`
+	// Delete the volume once the build is done, also when it was detached
+	// before creating the image. When false, the volume is kept after a
+	// successful build. Can't be used with the `volume` source_type.
+	DeleteOnTermination bool `mapstructure:"delete_on_termination" required:"false"`
+	// The boot index of the volume. Boot index 0 is the root device.
+	// Defaults to -1, the volume isn't bootable.
+	BootIndex int `mapstructure:"boot_index" required:"false"`
+	// The device name of the volume in the instance, for example
+	// `/dev/vdb`. Nova may not honor it, depending on the hypervisor.
+	DeviceName string `mapstructure:"device_name" required:"false"`
+	// Detach the volume after the instance is stopped, so it doesn't end up
+	// in the image. This is the `detach` snapshot_mode. Defaults to false.
+	DetachBeforeImage bool `mapstructure:"detach_before_image" required:"false"`
+	// How the volume is handled when creating the image. The image of an
+	// instance booted from a volume refers to snapshots of the attached
+	// volumes in its `block_device_mapping` property, which the instances
+	// booted from the image get volumes from. One of:
+	//
+	// - `include` - The volume stays attached and is part of the image.
+	// - `detach` - The volume is detached after the instance is stopped,
+	//   and deleted after the build according to delete_on_termination.
+	// - `exclude` - The volume stays attached, and is removed from the
+	//   `block_device_mapping` property of the image once it's created,
+	//   its snapshot being deleted.
+	//
+	// Defaults to block_device_snapshot_mode.
+	SnapshotMode string `mapstructure:"snapshot_mode" required:"false"`
+}
+
+func (m *BlockDeviceMapping) Prepare() []error {
+	var errs []error
+
+	if m.SourceType == "" {
+		m.SourceType = "blank"
+	}
+	switch m.SourceType {
+	case "blank":
+		if m.SourceID != "" {
+			errs = append(errs, errors.New("A block_device_mappings source_id can't be used with the blank source_type"))
+		}
+		if m.VolumeSize == 0 {
+			errs = append(errs, errors.New("A volume_size must be specified for each blank block_device_mappings"))
+		}
+	case "image", "snapshot", "volume":
+		if m.SourceID == "" {
+			errs = append(errs, fmt.Errorf("A source_id must be specified for each %s block_device_mappings", m.SourceType))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("Unknown block_device_mappings source_type value %s", m.SourceType))
+	}
+
+	if m.SourceType == "volume" {
+		if m.VolumeSize != 0 || m.VolumeType != "" {
+			errs = append(errs, errors.New("A block_device_mappings volume_size or volume_type can't be used with the volume source_type"))
+		}
+		if m.DeleteOnTermination {
+			errs = append(errs, errors.New("A block_device_mappings delete_on_termination can't be used with the volume source_type"))
+		}
+	}
+	if m.VolumeSize < 0 {
+		errs = append(errs, errors.New("A block_device_mappings volume_size must be greater than or equal to 0"))
+	}
+
+	if m.DetachBeforeImage {
+		if m.SnapshotMode != "" && m.SnapshotMode != "detach" {
+			errs = append(errs, fmt.Errorf("A block_device_mappings detach_before_image can't be used with the %s snapshot_mode", m.SnapshotMode))
+		}
+		m.SnapshotMode = "detach"
+	}
+	if m.SnapshotMode == "" {
+		m.SnapshotMode = "include"
+	}
+	switch m.SnapshotMode {
+	case "include", "detach", "exclude":
+	default:
+		errs = append(errs, fmt.Errorf("Unknown block_device_mappings snapshot_mode value %s", m.SnapshotMode))
+	}
+
+	// Boot index 0 is the root device.
+	if m.BootIndex == 0 {
+		m.BootIndex = -1
+	}
+	if m.BootIndex < -1 {
+		errs = append(errs, fmt.Errorf("Invalid block_device_mappings boot_index: %d", m.BootIndex))
+	}
+
+	return errs
+}
+
+// AttachVolume is an existing volume attached to the instance during the
+// build.
+type AttachVolume struct {
+	// The ID or name of the volume. The volume must be `available`, or be a
+	// multiattach volume, which may be `in-use` by other servers such as the
+	// ones of concurrent builds. Attaching a multiattach volume requires the
+	// Compute API microversion 2.60, and only its attachment to the instance
+	// is detached after the build.
+	Volume string `mapstructure:"volume" required:"true"`
+	// The device name of the volume in the instance, for example
+	// `/dev/vdc`. Nova may not honor it, depending on the hypervisor.
+	Device string `mapstructure:"device" required:"false"`
+}
+
+func (v *AttachVolume) Prepare() []error {
+	var errs []error
+	if v.Volume == "" {
+		errs = append(errs, errors.New("A volume must be specified for each attach_volumes"))
+	}
+	return errs
+}
+
+// UserDataPart is a file of the multipart MIME user data.
+type UserDataPart struct {
+	// The path to the file.
+	File string `mapstructure:"file" required:"true"`
+	// The MIME type of the file, for example `text/cloud-config` or
+	// `text/x-shellscript`.
+	ContentType string `mapstructure:"content_type" required:"true"`
+}
+
+// PersonalityFile is a file injected into the instance at boot.
+type PersonalityFile struct {
+	// The path of the file in the instance.
+	Path string `mapstructure:"path" required:"true"`
+	// The path of the local file to inject.
+	File string `mapstructure:"file" required:"false"`
+	// The content of the file to inject, in place of `file`.
+	Content string `mapstructure:"content" required:"false"`
+}
+
+func (f *PersonalityFile) Prepare() []error {
+	var errs []error
+
+	if f.Path == "" {
+		errs = append(errs, errors.New("A personality path must be specified"))
+	}
+	if len(f.Path) > maxPersonalityPathSize {
+		errs = append(errs, fmt.Errorf("personality path too long (max %d bytes): %s", maxPersonalityPathSize, f.Path))
+	}
+	if (f.File == "") == (f.Content == "") {
+		errs = append(errs, fmt.Errorf("Exactly one of personality file or content must be specified for %s", f.Path))
+	}
+
+	return errs
+}
+
+// AddressPair is an IP address and MAC address pair allowed on a port.
+type AddressPair struct {
+	IPAddress  string `mapstructure:"ip_address" required:"true"`
+	MACAddress string `mapstructure:"mac_address" required:"false"`
+}
+
 func (f *ImageFilterOptions) Empty() bool {
-	return f.Name == "" && f.Owner == "" && len(f.Tags) == 0 && f.Visibility == "" && len(f.Properties) == 0
+	return f.Name == "" && f.NameRegex == "" && f.Owner == "" && len(f.Tags) == 0 && f.Visibility == "" && len(f.Properties) == 0
 }
 
 func (f *ImageFilterOptions) Build() (*images.ListOpts, error) {
@@ -222,7 +1223,8 @@ func (f *ImageFilterOptions) Build() (*images.ListOpts, error) {
 		opts.Tags = f.Tags
 	}
 	if f.Visibility != "" {
-		v, err := getImageVisibility(f.Visibility)
+		var v *images.ImageVisibility
+		v, err = getImageVisibility(f.Visibility)
 		if err == nil {
 			opts.Visibility = *v
 		}
@@ -235,9 +1237,9 @@ func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
 	// If we are not given an explicit ssh_keypair_name or
 	// ssh_private_key_file, then create a temporary one, but only if the
 	// temporary_key_pair_name has not been provided and we are not using
-	// ssh_password.
+	// ssh_password. An existing server doesn't get a key pair at all.
 	if c.Comm.SSHKeyPairName == "" && c.Comm.SSHTemporaryKeyPairName == "" &&
-		c.Comm.SSHPrivateKeyFile == "" && c.Comm.SSHPassword == "" {
+		c.Comm.SSHPrivateKeyFile == "" && c.Comm.SSHPassword == "" && c.InstanceID == "" {
 
 		c.Comm.SSHTemporaryKeyPairName = fmt.Sprintf("packer_%s", uuid.TimeOrderedUUID())
 	}
@@ -246,9 +1248,20 @@ func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
 		c.FloatingIPNetwork = c.FloatingIPPool
 	}
 
+	// Use the admin password for WinRM if no other password is set.
+	if c.Comm.Type == "winrm" && c.Comm.WinRMPassword == "" && c.AdminPassword != "" {
+		c.Comm.WinRMPassword = c.AdminPassword
+	}
+
 	// Validation
 	errs := c.Comm.Prepare(ctx)
 
+	// The WinRM password is encrypted with the key pair, which must be RSA.
+	if c.Comm.Type == "winrm" && c.Comm.WinRMPassword == "" && c.Comm.SSHTemporaryKeyPairName != "" &&
+		c.Comm.SSHTemporaryKeyPairType != "" && c.Comm.SSHTemporaryKeyPairType != "rsa" {
+		errs = append(errs, fmt.Errorf("temporary_key_pair_type must be rsa to retrieve the winrm password, not %s", c.Comm.SSHTemporaryKeyPairType))
+	}
+
 	if c.Comm.SSHKeyPairName != "" {
 		if c.Comm.Type == "winrm" && c.Comm.WinRMPassword == "" && c.Comm.SSHPrivateKeyFile == "" {
 			errs = append(errs, errors.New("A ssh_private_key_file must be provided to retrieve the winrm password when using ssh_keypair_name."))
@@ -257,11 +1270,15 @@ func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
 		}
 	}
 
-	if c.SourceImage == "" && c.SourceImageName == "" && c.ExternalSourceImageURL == "" && c.SourceImageFilters.Filters.Empty() {
-		errs = append(errs, errors.New("Either a source_image, a source_image_name, an external_source_image_url or source_image_filter must be specified"))
+	if c.InstanceID != "" {
+		if c.SourceImage != "" || c.SourceImageName != "" || c.ExternalSourceImageURL != "" || c.SourceImageFile != "" || c.SourceVolume != "" || c.SourceVolumeSnapshot != "" || !c.SourceImageFilters.Filters.Empty() {
+			errs = append(errs, errors.New("instance_id can't be used with source_image, source_image_name, external_source_image_url, source_image_file, source_volume, source_volume_snapshot or source_image_filter"))
+		}
+	} else if c.SourceImage == "" && c.SourceImageName == "" && c.ExternalSourceImageURL == "" && c.SourceImageFile == "" && c.SourceVolume == "" && c.SourceVolumeSnapshot == "" && c.SourceImageFilters.Filters.Empty() {
+		errs = append(errs, errors.New("Either a source_image, a source_image_name, an external_source_image_url, a source_image_file, a source_volume, a source_volume_snapshot or source_image_filter must be specified"))
 	} else {
 		// Make sure we've only set one image source option
-		thereCanBeOnlyOne := []bool{len(c.SourceImageName) > 0, len(c.SourceImage) > 0, len(c.ExternalSourceImageURL) > 0, !c.SourceImageFilters.Filters.Empty()}
+		thereCanBeOnlyOne := []bool{len(c.SourceImageName) > 0, len(c.SourceImage) > 0, len(c.ExternalSourceImageURL) > 0, len(c.SourceImageFile) > 0, len(c.SourceVolume) > 0, len(c.SourceVolumeSnapshot) > 0, !c.SourceImageFilters.Filters.Empty()}
 		numSet := 0
 		for _, val := range thereCanBeOnlyOne {
 			if val {
@@ -270,23 +1287,356 @@ func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
 		}
 
 		if numSet > 1 {
-			errs = append(errs, errors.New("Only one of the options source_image, source_image_name, external_source_image_url, or source_image_filter can be specified, not multiple."))
+			errs = append(errs, errors.New("Only one of the options source_image, source_image_name, external_source_image_url, source_image_file, source_volume, source_volume_snapshot, or source_image_filter can be specified, not multiple."))
 		}
 	}
 
+	if c.SourceVolume != "" {
+		c.UseBlockStorageVolume = true
+	} else if c.CloneSourceVolume {
+		errs = append(errs, errors.New("clone_source_volume can only be used together with source_volume"))
+	}
+	if c.SourceVolumeSnapshot != "" {
+		c.UseBlockStorageVolume = true
+	} else if c.SourceVolumeSnapshotMostRecent {
+		errs = append(errs, errors.New("source_volume_snapshot_most_recent can only be used together with source_volume_snapshot"))
+	}
+	if c.VolumeSize < 0 {
+		errs = append(errs, errors.New("volume_size must be greater than or equal to 0"))
+	}
+	if c.BootVolumeDeleteOnTermination && c.SourceVolume != "" && !c.CloneSourceVolume {
+		errs = append(errs, errors.New("boot_volume_delete_on_termination can't be used with source_volume unless clone_source_volume is true"))
+	}
+
 	// if external_source_image_format is not set use qcow2 as default
 	if c.ExternalSourceImageFormat == "" {
 		c.ExternalSourceImageFormat = "qcow2"
 	}
 
-	if c.Flavor == "" {
-		errs = append(errs, errors.New("A flavor must be specified"))
+	if c.SourceImageFile != "" {
+		if _, err := os.Stat(c.SourceImageFile); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid source_image_file: %s", err))
+		}
+	}
+	if c.ExternalSourceImageURL == "" && c.SourceImageFile == "" {
+		if c.ExternalSourceImageChecksum != "" {
+			errs = append(errs, errors.New("external_source_image_checksum can only be used together with external_source_image_url or source_image_file"))
+		}
+		if c.KeepSourceImage {
+			errs = append(errs, errors.New("keep_source_image can only be used together with external_source_image_url or source_image_file"))
+		}
+	}
+	if c.ExternalSourceImageChecksum != "" {
+		algo, value, err := parseChecksum(c.ExternalSourceImageChecksum)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid external_source_image_checksum: %s", err))
+		}
+		c.externalSourceImageChecksumAlgo, c.externalSourceImageChecksum = algo, value
+	}
+
+	if c.InstanceID != "" {
+		if c.Flavor != "" || c.FlavorRegex != "" || !c.FlavorFilter.Empty() || len(c.FlavorFallbacks) > 0 {
+			errs = append(errs, errors.New("instance_id can't be used with flavor, flavor_regex, flavor_filter or flavor_fallbacks"))
+		}
+	} else if c.Flavor == "" && c.FlavorRegex == "" && c.FlavorFilter.Empty() {
+		errs = append(errs, errors.New("A flavor, flavor_regex or flavor_filter must be specified"))
+	}
+	if c.FlavorRegex != "" {
+		if c.Flavor != "" || !c.FlavorFilter.Empty() {
+			errs = append(errs, errors.New("Only one of flavor_regex, flavor or flavor_filter can be specified, not multiple."))
+		}
+		// The whole flavor name must match.
+		re, err := regexp.Compile("^(?:" + c.FlavorRegex + ")$")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid flavor_regex: %s", err))
+		}
+		c.flavorRegex = re
+	}
+	switch c.FlavorRegexSelect {
+	case "":
+		c.FlavorRegexSelect = "error"
+	case "error", "name":
+	default:
+		errs = append(errs, fmt.Errorf("Unknown flavor_regex_select value %s", c.FlavorRegexSelect))
+	}
+	errs = append(errs, c.FlavorFilter.Prepare()...)
+
+	if c.FloatingIPAssociateRetries == nil {
+		retries := 3
+		c.FloatingIPAssociateRetries = &retries
+	}
+	if c.FloatingIPAssociateRetryDelay == 0 {
+		c.FloatingIPAssociateRetryDelay = 2 * time.Second
+	}
+	if c.FloatingIPActiveTimeout == 0 {
+		c.FloatingIPActiveTimeout = 2 * time.Minute
+	}
+	if c.FloatingIPPortActiveTimeout == 0 {
+		c.FloatingIPPortActiveTimeout = 2 * time.Minute
+	}
+
+	if c.AvailabilityZone != "" && len(c.AvailabilityZones) > 0 {
+		errs = append(errs, errors.New("Only one of availability_zone or availability_zones can be specified, not both."))
+	}
+	for _, zone := range c.AvailabilityZones {
+		if zone == "" {
+			errs = append(errs, errors.New("availability_zones can't contain an empty zone"))
+			break
+		}
+	}
+	for _, zone := range append([]string{c.AvailabilityZone}, c.AvailabilityZones...) {
+		if strings.Count(zone, ":") > 2 {
+			errs = append(errs, fmt.Errorf("Invalid availability zone %s, it must be a zone, zone:host or zone:host:node", zone))
+		}
+	}
+	if c.SchedulingRetries < 0 {
+		errs = append(errs, errors.New("scheduling_retries must be greater than or equal to 0"))
+	}
+	if c.SchedulingRetryDelay == 0 {
+		c.SchedulingRetryDelay = 30 * time.Second
+	}
+	for _, flavor := range c.FlavorFallbacks {
+		if flavor == "" {
+			errs = append(errs, errors.New("flavor_fallbacks can't contain an empty flavor"))
+			break
+		}
+	}
+	if c.WindowsPasswordTimeout == 0 {
+		c.WindowsPasswordTimeout = 20 * time.Minute
+	}
+	if c.WindowsPasswordPollInterval == 0 {
+		c.WindowsPasswordPollInterval = 5 * time.Second
+	}
+	if c.StatePollInterval == 0 {
+		c.StatePollInterval = defaultPollInterval
+	}
+	if c.StatePollMaxInterval == 0 {
+		c.StatePollMaxInterval = c.StatePollInterval
+	}
+	if c.StatePollInterval < 0 {
+		errs = append(errs, errors.New("state_poll_interval must be greater than 0"))
+	}
+	if c.StatePollMaxInterval < c.StatePollInterval {
+		errs = append(errs, errors.New("state_poll_max_interval must be greater than or equal to state_poll_interval"))
+	}
+	if c.CloudInitTimeout == 0 {
+		c.CloudInitTimeout = 30 * time.Minute
+	}
+	if c.CloudInitTimeout < 0 {
+		errs = append(errs, errors.New("cloud_init_timeout must be greater than 0"))
+	}
+	if c.WaitForCloudInit && c.Comm.Type == "none" {
+		errs = append(errs, errors.New("wait_for_cloud_init requires a communicator"))
+	}
+	if c.ConsoleLogLines < 0 {
+		errs = append(errs, errors.New("console_log_lines must be greater than or equal to 0"))
+	}
+	if !c.OnFailureConsoleLog && (c.ConsoleLogPath != "" || c.ConsoleLogLines != 0) {
+		errs = append(errs, errors.New("console_log_path and console_log_lines require on_failure_console_log"))
+	}
+
+	if c.AvailabilityZoneTimeout == 0 {
+		c.AvailabilityZoneTimeout = 10 * time.Minute
+	}
+	if c.AvailabilityZoneTimeout < 0 {
+		errs = append(errs, errors.New("availability_zone_timeout must be greater than 0"))
+	}
+	if *c.FloatingIPAssociateRetries < 0 {
+		errs = append(errs, errors.New("floating_ip_associate_retries must be greater than or equal to 0"))
+	}
+	if c.FloatingIPAssociateRetryDelay < 0 {
+		errs = append(errs, errors.New("floating_ip_associate_retry_delay must be greater than or equal to 0"))
+	}
+
+	if c.FloatingIP != "" && net.ParseIP(c.FloatingIP) == nil && !isUUID(c.FloatingIP) {
+		errs = append(errs, fmt.Errorf("floating_ip must be a floating IP ID or address: %s", c.FloatingIP))
+	}
+
+	if c.FloatingIPNetwork != "" && len(c.FloatingIPNetworks) > 0 {
+		errs = append(errs, errors.New("Only one of floating_ip_network or floating_ip_networks can be specified, not both."))
+	}
+
+	if c.FloatingIPSubnet != "" && len(c.floatingIPNetworks()) != 1 {
+		errs = append(errs, errors.New("A single floating_ip_network must be specified when floating_ip_subnet is set"))
+	}
+
+	if len(c.FloatingIPTags) > 0 && !c.ReuseIPs {
+		errs = append(errs, errors.New("floating_ip_tags can only be used together with reuse_ips"))
+	}
+
+	if c.KeepAttachedNetworks && len(c.AttachNetworksAfterBoot) == 0 {
+		errs = append(errs, errors.New("keep_attached_networks can only be used together with attach_networks_after_boot"))
+	}
+
+	if c.ForceNewFloatingIP {
+		if c.FloatingIP != "" || c.ReuseIPs {
+			errs = append(errs, errors.New("force_new_floating_ip can't be used together with floating_ip or reuse_ips"))
+		}
+	}
+
+	if len(c.TemporarySecurityGroupSourceCIDRs) > 0 && len(c.SecurityGroups) > 0 {
+		errs = append(errs, errors.New("Only one of temporary_security_group_source_cidrs or security_groups can be specified, not both."))
+	}
+	for _, cidr := range c.TemporarySecurityGroupSourceCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid temporary_security_group_source_cidrs value %s: %s", cidr, err))
+		}
+	}
+
+	if c.PortDNSDomain != "" && !strings.HasSuffix(c.PortDNSDomain, ".") {
+		errs = append(errs, fmt.Errorf("port_dns_domain must be a fully qualified domain name ending with a dot: %s", c.PortDNSDomain))
+	}
+
+	if c.CommunicatorNetwork != "" && c.SSHInterface != "" {
+		errs = append(errs, errors.New("Only one of communicator_network or ssh_interface can be specified, not both."))
+	}
+
+	for _, cidr := range c.NetworkDiscoveryCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid network_discovery_cidrs value %s: %s", cidr, err))
+		}
+	}
+
+	if len(c.NetworkDiscoveryTags) > 0 && len(c.NetworkDiscoveryCIDRs) > 0 {
+		errs = append(errs, errors.New("Only one of network_discovery_tags or network_discovery_cidrs can be specified, not both."))
+	}
+
+	if c.NetworkDiscoveryMatch == "" {
+		c.NetworkDiscoveryMatch = "single"
+	}
+	if c.NetworkDiscoveryMatch != "single" && c.NetworkDiscoveryMatch != "all" {
+		errs = append(errs, errors.New("network_discovery_match must be single or all"))
+	}
+
+	if c.NetworkDiscoveryIPVersion != 0 && c.NetworkDiscoveryIPVersion != 4 && c.NetworkDiscoveryIPVersion != 6 {
+		errs = append(errs, errors.New("network_discovery_ip_version must be 4 or 6"))
+	}
+
+	if c.UseIPv6 {
+		if c.SSHIPVersion == "4" {
+			errs = append(errs, errors.New("ssh_ip_version must be 6 when use_ipv6 is true"))
+		}
+		c.SSHIPVersion = "6"
+
+		if c.FloatingIP != "" || len(c.floatingIPNetworks()) > 0 || c.ReuseIPs || c.ForceNewFloatingIP {
+			errs = append(errs, errors.New("use_ipv6 can't be used together with floating_ip, floating_ip_network, floating_ip_networks, reuse_ips or force_new_floating_ip"))
+		}
+
+		if c.IPv6AddressTimeout == 0 {
+			c.IPv6AddressTimeout = 5 * time.Minute
+		}
+	}
+
+	if len(c.UserDataParts) > 0 && (c.UserData != "" || c.UserDataFile != "") {
+		errs = append(errs, errors.New("Only one of user_data, user_data_file or user_data_parts can be specified, not multiple."))
+	}
+	for i, part := range c.UserDataParts {
+		if part.File == "" || part.ContentType == "" {
+			errs = append(errs, fmt.Errorf("user_data_parts %d: file and content_type must be specified", i))
+		}
+	}
+
+	if len(c.TrustedImageCertificateIDs) > 0 && len(c.Personality) > 0 {
+		errs = append(errs, errors.New("personality can't be used with trusted_image_certificate_ids, it was removed in the Compute API microversion 2.57"))
+	}
+	if c.TrustedImageCertificateProperty && len(c.TrustedImageCertificateIDs) != 1 {
+		errs = append(errs, errors.New("trusted_image_certificate_property requires a single trusted_image_certificate_ids certificate"))
+	}
+
+	if utf8.RuneCountInString(c.InstanceDescription) > maxInstanceDescriptionSize {
+		errs = append(errs, fmt.Errorf("instance_description too long (max %d characters)", maxInstanceDescriptionSize))
+	}
+	if len(c.InstanceTags) > maxInstanceTags {
+		errs = append(errs, fmt.Errorf("Too many instance_tags (max %d)", maxInstanceTags))
+	}
+	for _, tag := range c.InstanceTags {
+		if tag == "" || utf8.RuneCountInString(tag) > maxInstanceTagSize || strings.ContainsAny(tag, "/,") {
+			errs = append(errs, fmt.Errorf("Invalid instance tag %q, it must be 1 to %d characters without / or ,", tag, maxInstanceTagSize))
+		}
+	}
+
+	for i := range c.Personality {
+		errs = append(errs, c.Personality[i].Prepare()...)
+	}
+
+	for networkID, ip := range c.NetworkFixedIPs {
+		if !containsString(c.Networks, networkID) {
+			errs = append(errs, fmt.Errorf("network_fixed_ips network %s must be one of the networks", networkID))
+		}
+		if net.ParseIP(ip) == nil {
+			errs = append(errs, fmt.Errorf("Invalid network_fixed_ips address for network %s: %s", networkID, ip))
+		}
+	}
+	for i := range c.InstancePorts {
+		errs = append(errs, c.InstancePorts[i].Prepare()...)
+	}
+
+	for i := range c.AttachVolumes {
+		errs = append(errs, c.AttachVolumes[i].Prepare()...)
+	}
+	switch c.BlockDeviceSnapshotMode {
+	case "", "include", "detach", "exclude":
+	default:
+		errs = append(errs, fmt.Errorf("Unknown block_device_snapshot_mode value %s", c.BlockDeviceSnapshotMode))
+	}
+	for i := range c.BlockDeviceMappings {
+		m := &c.BlockDeviceMappings[i]
+		if m.SnapshotMode == "" && !m.DetachBeforeImage {
+			m.SnapshotMode = c.BlockDeviceSnapshotMode
+		}
+		errs = append(errs, m.Prepare()...)
+		// The server is snapshotted when it's shelved, before the volumes
+		// would be detached.
+		if m.SnapshotMode == "detach" && c.ShelveInstance {
+			errs = append(errs, errors.New("The detach block_device_mappings snapshot_mode can't be used with shelve_instance"))
+		}
+	}
+
+	errs = append(errs, c.SchedulerHints.Prepare()...)
+
+	if c.ServerGroupPolicy != "" {
+		switch c.ServerGroupPolicy {
+		case "affinity", "anti-affinity", "soft-affinity", "soft-anti-affinity":
+		default:
+			errs = append(errs, fmt.Errorf("Unknown server_group_policy value %s", c.ServerGroupPolicy))
+		}
+		if c.SchedulerHints.Group != "" {
+			errs = append(errs, errors.New("server_group_policy can't be used together with the scheduler_hints group"))
+		}
+	}
+
+	switch c.SourceImageFlavorCheck {
+	case "":
+		c.SourceImageFlavorCheck = "warn"
+	case "warn", "error", "skip":
+	default:
+		errs = append(errs, fmt.Errorf("Unknown source_image_flavor_check value %s", c.SourceImageFlavorCheck))
+	}
+
+	if c.EphemeralSizeGB < 0 {
+		errs = append(errs, errors.New("ephemeral_size_gb must be greater than or equal to 0"))
+	}
+	if c.EphemeralGuestFormat != "" && c.EphemeralSizeGB == 0 {
+		errs = append(errs, errors.New("ephemeral_guest_format can only be used together with ephemeral_size_gb"))
+	}
+	if c.SwapSizeMB < 0 {
+		errs = append(errs, errors.New("swap_size_mb must be greater than or equal to 0"))
+	}
+
+	for _, pair := range c.AllowedAddressPairs {
+		if pair.IPAddress == "" {
+			errs = append(errs, errors.New("An ip_address must be specified for each allowed_address_pairs"))
+		}
 	}
 
 	if c.SSHIPVersion != "" && c.SSHIPVersion != "4" && c.SSHIPVersion != "6" {
 		errs = append(errs, errors.New("SSH IP version must be either 4 or 6"))
 	}
 
+	if c.runUUID == "" {
+		c.runUUID = packerRunUUID()
+	}
+	errs = append(errs, c.prepareInstanceMetadata(ctx)...)
 	for key, value := range c.InstanceMetadata {
 		if len(key) > 255 {
 			errs = append(errs, fmt.Errorf("Instance metadata key too long (max 255 bytes): %s", key))
@@ -296,22 +1646,94 @@ func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
 		}
 	}
 
+	if c.SnapshotConsistency == "" {
+		c.SnapshotConsistency = "stop"
+	}
+	switch c.SnapshotConsistency {
+	case "stop":
+	case "pause", "quiesce":
+		if c.UseBlockStorageVolume {
+			errs = append(errs, fmt.Errorf("snapshot_consistency %s can't be used with use_blockstorage_volume", c.SnapshotConsistency))
+		}
+		if c.ShelveInstance {
+			errs = append(errs, fmt.Errorf("snapshot_consistency %s can't be used with shelve_instance", c.SnapshotConsistency))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("snapshot_consistency must be one of stop, pause or quiesce: %s", c.SnapshotConsistency))
+	}
+
+	if c.SkipStopBeforeImage {
+		if c.UseBlockStorageVolume {
+			errs = append(errs, errors.New("skip_stop_before_image can't be used with use_blockstorage_volume"))
+		}
+		if c.ShelveInstance {
+			errs = append(errs, errors.New("skip_stop_before_image can't be used with shelve_instance"))
+		}
+		if c.SnapshotConsistency != "stop" {
+			errs = append(errs, fmt.Errorf("skip_stop_before_image can't be used with snapshot_consistency %s", c.SnapshotConsistency))
+		}
+	}
+
+	if c.InstanceID != "" {
+		if c.UseBlockStorageVolume {
+			errs = append(errs, errors.New("instance_id can't be used with use_blockstorage_volume"))
+		}
+		if c.ShelveInstance {
+			errs = append(errs, errors.New("instance_id can't be used with shelve_instance"))
+		}
+		// There's no temporary key pair for an existing server.
+		switch c.Comm.Type {
+		case "ssh":
+			if c.Comm.SSHPassword == "" && c.Comm.SSHPrivateKeyFile == "" && !c.Comm.SSHAgentAuth {
+				errs = append(errs, errors.New("An ssh_password, ssh_private_key_file or ssh_agent_auth must be provided with instance_id"))
+			}
+		case "winrm":
+			if c.Comm.WinRMPassword == "" && c.Comm.SSHPrivateKeyFile == "" {
+				errs = append(errs, errors.New("A winrm_password, or the ssh_private_key_file to retrieve it, must be provided with instance_id"))
+			}
+		}
+		if c.StopExistingInstance && (c.SkipStopBeforeImage || c.SnapshotConsistency != "stop") {
+			errs = append(errs, errors.New("stop_existing_instance can only be used with the stop snapshot_consistency, without skip_stop_before_image"))
+		}
+	} else if c.StopExistingInstance {
+		errs = append(errs, errors.New("stop_existing_instance can only be used together with instance_id"))
+	}
+
+	if c.ShelveOffload && !c.ShelveInstance {
+		errs = append(errs, errors.New("shelve_offload can only be used together with shelve_instance"))
+	}
+
 	if c.UseBlockStorageVolume {
 		// Use Compute instance availability zone for the Block Storage volume
 		// if it's not provided.
+		// The compute host of the zone:host form isn't a zone.
 		if c.VolumeAvailabilityZone == "" {
-			c.VolumeAvailabilityZone = c.AvailabilityZone
+			c.VolumeAvailabilityZone, _ = splitAvailabilityZone(c.AvailabilityZone)
+			c.volumeAvailabilityZoneDefaulted = c.VolumeAvailabilityZone != ""
 		}
 
 		// Use random name for the Block Storage volume if it's not provided.
 		if c.VolumeName == "" {
 			c.VolumeName = fmt.Sprintf("packer_%s", uuid.TimeOrderedUUID())
 		}
+		if c.ShelveInstance {
+			errs = append(errs, errors.New("shelve_instance can't be used with use_blockstorage_volume, shelving a volume-backed server doesn't snapshot it"))
+		}
+	} else {
+		if c.VolumeUploadForce {
+			errs = append(errs, errors.New("volume_upload_force can only be used together with use_blockstorage_volume"))
+		}
+		if c.KeepVolume {
+			errs = append(errs, errors.New("keep_volume can only be used together with use_blockstorage_volume"))
+		}
+		if c.BootVolumeDeleteOnTermination {
+			errs = append(errs, errors.New("boot_volume_delete_on_termination can only be used together with use_blockstorage_volume"))
+		}
 	}
 
 	// if neither ID, image name or external image URL is provided outside the filter,
 	// build the filter
-	if len(c.SourceImage) == 0 && len(c.SourceImageName) == 0 && len(c.ExternalSourceImageURL) == 0 {
+	if len(c.SourceImage) == 0 && len(c.SourceImageName) == 0 && len(c.ExternalSourceImageURL) == 0 && len(c.SourceImageFile) == 0 && len(c.SourceVolume) == 0 && len(c.SourceVolumeSnapshot) == 0 {
 
 		listOpts, filterErr := c.SourceImageFilters.Filters.Build()
 
@@ -319,16 +1741,105 @@ func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
 			errs = append(errs, filterErr)
 		}
 		c.sourceImageOpts = *listOpts
+		if c.SourceImageAcceptMembership {
+			// Pending shared images are listed too.
+			c.sourceImageOpts.MemberStatus = images.ImageMemberStatusAll
+		}
+
+		if c.SourceImageFilters.Filters.NameRegex != "" {
+			if c.SourceImageFilters.Filters.Name != "" {
+				errs = append(errs, errors.New("Only one of source_image_filter name or name_regex can be specified, not both."))
+			}
+			// The whole image name must match.
+			re, err := regexp.Compile("^(?:" + c.SourceImageFilters.Filters.NameRegex + ")$")
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Invalid source_image_filter name_regex: %s", err))
+			}
+			c.sourceImageNameRegex = re
+		}
 	}
 
-	// if c.ExternalSourceImageURL is set use a generated source image name
-	if c.ExternalSourceImageURL != "" {
+	// if c.ExternalSourceImageURL or c.SourceImageFile is set use a generated
+	// source image name
+	if c.ExternalSourceImageURL != "" || c.SourceImageFile != "" {
 		c.SourceImageName = fmt.Sprintf("packer_%s", uuid.TimeOrderedUUID())
 	}
 
 	return errs
 }
 
+// serverNetworks returns the networks to launch the instance with, and the
+// instance ports to create. With network_fixed_ip_ports, the networks with
+// a fixed IP are created as instance ports, in the order of the networks.
+func (c *RunConfig) serverNetworks() ([]string, []InstancePort) {
+	if !c.NetworkFixedIPPorts {
+		return c.Networks, c.InstancePorts
+	}
+
+	var networks []string
+	instancePorts := append([]InstancePort(nil), c.InstancePorts...)
+	for _, networkID := range c.Networks {
+		ip, ok := c.NetworkFixedIPs[networkID]
+		if !ok {
+			networks = append(networks, networkID)
+			continue
+		}
+		instancePorts = append(instancePorts, InstancePort{Network: networkID, FixedIP: ip})
+	}
+	return networks, instancePorts
+}
+
+// floatingIPNetworks returns the ordered list of networks floating IPs can be
+// allocated from.
+func (c *RunConfig) floatingIPNetworks() []string {
+	if c.FloatingIPNetwork != "" {
+		return []string{c.FloatingIPNetwork}
+	}
+	return c.FloatingIPNetworks
+}
+
+// computeMicroversionFeatures returns the options of the build depending on
+// the Compute API microversion. The build goes on without the instance tags
+// and description with older microversions.
+func (c *RunConfig) computeMicroversionFeatures() []microversionFeature {
+	var features []microversionFeature
+	if len(c.TrustedImageCertificateIDs) > 0 {
+		features = append(features, microversionFeature{Option: "trusted_image_certificate_ids", Microversion: "2.63"})
+	}
+	if len(c.InstanceTags) > 0 {
+		features = append(features, microversionFeature{Option: "instance_tags", Microversion: "2.52", Optional: true})
+	}
+	if c.InstanceDescription != "" {
+		features = append(features, microversionFeature{Option: "instance_description", Microversion: "2.19", Optional: true})
+	}
+	if strings.HasPrefix(c.ServerGroupPolicy, "soft-") {
+		features = append(features, microversionFeature{Option: "server_group_policy " + c.ServerGroupPolicy, Microversion: "2.15"})
+	}
+	if c.BootVolumeDeleteOnTermination {
+		features = append(features, microversionFeature{Option: "boot_volume_delete_on_termination", Microversion: "2.85"})
+	}
+	if len(c.Personality) > 0 {
+		features = append(features, microversionFeature{Option: "personality", RemovedIn: "2.57"})
+	}
+	return features
+}
+
+// parseChecksum splits a `<algorithm>:<value>` checksum, the algorithm
+// defaulting to sha256.
+func parseChecksum(checksum string) (string, string, error) {
+	algo, value := "sha256", checksum
+	if i := strings.Index(checksum, ":"); i >= 0 {
+		algo, value = strings.ToLower(checksum[:i]), checksum[i+1:]
+	}
+	if newHash(algo) == nil {
+		return "", "", fmt.Errorf("unknown checksum algorithm %s", algo)
+	}
+	if _, err := hex.DecodeString(value); err != nil || value == "" {
+		return "", "", fmt.Errorf("the checksum must be hexadecimal")
+	}
+	return algo, strings.ToLower(value), nil
+}
+
 // Retrieve the specific ImageVisibility using the exported const from images
 func getImageVisibility(visibility string) (*images.ImageVisibility, error) {
 	visibilities := [...]images.ImageVisibility{
@@ -5,11 +5,15 @@ package openstack
 
 import (
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -136,6 +140,1126 @@ func TestRunConfigPrepare_FloatingIPPoolCompat(t *testing.T) {
 	}
 }
 
+func TestRunConfigPrepare_FloatingIPNetworks(t *testing.T) {
+	c := testRunConfig()
+	c.FloatingIPNetworks = []string{"public-a", "public-b"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	if networks := c.floatingIPNetworks(); len(networks) != 2 || networks[0] != "public-a" {
+		t.Fatalf("invalid value: %v", networks)
+	}
+
+	c.FloatingIPNetwork = "public"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("setting both floating_ip_network and floating_ip_networks should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.FloatingIPNetwork = "public"
+	if networks := c.floatingIPNetworks(); len(networks) != 1 || networks[0] != "public" {
+		t.Fatalf("invalid value: %v", networks)
+	}
+}
+
+func TestRunConfigPrepare_FloatingIPSubnet(t *testing.T) {
+	c := testRunConfig()
+	c.FloatingIPSubnet = "public-a"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("floating_ip_subnet without floating_ip_network should error: %s", err)
+	}
+
+	c.FloatingIPNetwork = "public"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_FloatingIPTags(t *testing.T) {
+	c := testRunConfig()
+	c.FloatingIPTags = []string{"packer"}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("floating_ip_tags without reuse_ips should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.ReuseIPs = true
+	c.FloatingIPTags = []string{"packer"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_FloatingIP(t *testing.T) {
+	c := testRunConfig()
+	c.FloatingIP = "b8a3ef4c-7a9f-4b61-9a3f-bd3cc7a0b5e1"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.FloatingIP = "203.0.113.10"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.FloatingIP = "203.0.113.300"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("invalid floating_ip should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_ForceNewFloatingIP(t *testing.T) {
+	c := testRunConfig()
+	c.ForceNewFloatingIP = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.FloatingIPNetwork = "public"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.ReuseIPs = true
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("force_new_floating_ip with reuse_ips should error: %s", err)
+	}
+
+	c.ReuseIPs = false
+	c.FloatingIP = "b8a3ef4c-7a9f-4b61-9a3f-bd3cc7a0b5e1"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("force_new_floating_ip with floating_ip should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_FloatingIPAssociateRetries(t *testing.T) {
+	c := testRunConfig()
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	if *c.FloatingIPAssociateRetries != 3 {
+		t.Fatalf("invalid value: %d", *c.FloatingIPAssociateRetries)
+	}
+	if c.FloatingIPActiveTimeout != 2*time.Minute {
+		t.Fatalf("invalid value: %s", c.FloatingIPActiveTimeout)
+	}
+	if c.FloatingIPPortActiveTimeout != 2*time.Minute {
+		t.Fatalf("invalid value: %s", c.FloatingIPPortActiveTimeout)
+	}
+	if c.FloatingIPAssociateRetryDelay != 2*time.Second {
+		t.Fatalf("invalid value: %s", c.FloatingIPAssociateRetryDelay)
+	}
+
+	c = testRunConfig()
+	retries := 0
+	c.FloatingIPAssociateRetries = &retries
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if *c.FloatingIPAssociateRetries != 0 {
+		t.Fatalf("0 should disable the retries: %d", *c.FloatingIPAssociateRetries)
+	}
+
+	c = testRunConfig()
+	retries = -1
+	c.FloatingIPAssociateRetries = &retries
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("negative retries should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.FloatingIPAssociateRetryDelay = -time.Second
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("negative retry delay should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_TemporarySecurityGroupSourceCIDRs(t *testing.T) {
+	c := testRunConfig()
+	c.TemporarySecurityGroupSourceCIDRs = []string{"10.0.0.0/8", "2001:db8::/32"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.TemporarySecurityGroupSourceCIDRs = []string{"10.0.0.0"}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("invalid CIDR should error: %s", err)
+	}
+
+	c.TemporarySecurityGroupSourceCIDRs = []string{"10.0.0.0/8"}
+	c.SecurityGroups = []string{"default"}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("setting both temporary_security_group_source_cidrs and security_groups should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_PortDNSDomain(t *testing.T) {
+	c := testRunConfig()
+	c.PortDNSName = "packer-build"
+	c.PortDNSDomain = "example.com."
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.PortDNSDomain = "example.com"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("port_dns_domain without trailing dot should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_CommunicatorNetwork(t *testing.T) {
+	c := testRunConfig()
+	c.CommunicatorNetwork = "private"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.SSHInterface = "public"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("setting both communicator_network and ssh_interface should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_KeepAttachedNetworks(t *testing.T) {
+	c := testRunConfig()
+	c.KeepAttachedNetworks = true
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("keep_attached_networks without attach_networks_after_boot should error: %s", err)
+	}
+
+	c.AttachNetworksAfterBoot = []string{"storage"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_KeepVolume(t *testing.T) {
+	c := testRunConfig()
+	c.KeepVolume = true
+	c.VolumeUploadForce = true
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("keep_volume and volume_upload_force without use_blockstorage_volume should error: %s", err)
+	}
+
+	c.UseBlockStorageVolume = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_NetworkDiscoveryTags(t *testing.T) {
+	c := testRunConfig()
+	c.NetworkDiscoveryTags = []string{"packer", "provisioning"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c.NetworkDiscoveryMatch != "single" {
+		t.Fatalf("invalid value: %s", c.NetworkDiscoveryMatch)
+	}
+
+	c.NetworkDiscoveryMatch = "any"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("invalid network_discovery_match should error: %s", err)
+	}
+
+	c.NetworkDiscoveryMatch = "all"
+	c.NetworkDiscoveryCIDRs = []string{"10.0.0.0/16"}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("setting both network_discovery_tags and network_discovery_cidrs should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_NetworkDiscoveryCIDRs(t *testing.T) {
+	c := testRunConfig()
+	c.NetworkDiscoveryCIDRs = []string{"10.0.0.0/8", "2001:db8::/32"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.NetworkDiscoveryCIDRs = []string{"10.0.0.0/33"}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("invalid network_discovery_cidrs should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_NetworkDiscoveryIPVersion(t *testing.T) {
+	c := testRunConfig()
+	c.NetworkDiscoveryIPVersion = 6
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.NetworkDiscoveryIPVersion = 5
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("invalid network_discovery_ip_version should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_UseIPv6(t *testing.T) {
+	c := testRunConfig()
+	c.UseIPv6 = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c.SSHIPVersion != "6" {
+		t.Fatalf("invalid value: %s", c.SSHIPVersion)
+	}
+	if c.IPv6AddressTimeout != 5*time.Minute {
+		t.Fatalf("invalid value: %s", c.IPv6AddressTimeout)
+	}
+
+	c = testRunConfig()
+	c.UseIPv6 = true
+	c.SSHIPVersion = "4"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("use_ipv6 with ssh_ip_version 4 should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.UseIPv6 = true
+	c.FloatingIPNetwork = "public"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("use_ipv6 with floating_ip_network should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_InstancePorts(t *testing.T) {
+	c := testRunConfig()
+	c.InstancePorts = []InstancePort{
+		{Network: "private", FixedIP: "10.0.0.10"},
+	}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c.InstancePorts[0].Name == "" {
+		t.Fatalf("instance port name should have been generated")
+	}
+
+	c = testRunConfig()
+	c.InstancePorts = []InstancePort{
+		{FixedIP: "10.0.0.300"},
+	}
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("missing network and invalid fixed_ip should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.InstancePorts = []InstancePort{
+		{Network: "sriov", VNICType: "direct"},
+		{Network: "private", VNICType: "sriov"},
+	}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("invalid vnic_type should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_InstancePortTrunk(t *testing.T) {
+	c := testRunConfig()
+	c.InstancePorts = []InstancePort{
+		{
+			Network: "private",
+			Name:    "parent",
+			Trunk: &InstancePortTrunk{
+				Subports: []TrunkSubport{
+					{Network: "vlan-100", SegmentationID: 100},
+				},
+			},
+		},
+	}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	trunk := c.InstancePorts[0].Trunk
+	if trunk.Name != "parent" {
+		t.Fatalf("invalid trunk name: %s", trunk.Name)
+	}
+	if trunk.Subports[0].SegmentationType != "vlan" {
+		t.Fatalf("invalid segmentation_type: %s", trunk.Subports[0].SegmentationType)
+	}
+
+	c = testRunConfig()
+	c.InstancePorts = []InstancePort{
+		{
+			Network: "private",
+			Trunk: &InstancePortTrunk{
+				Subports: []TrunkSubport{
+					{SegmentationID: 100},
+					{Network: "vlan-5000", SegmentationID: 5000},
+					{Network: "vxlan", SegmentationID: 100, SegmentationType: "vxlan"},
+				},
+			},
+		},
+	}
+	if err := c.Prepare(nil); len(err) != 3 {
+		t.Fatalf("invalid subports should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_AllowedAddressPairs(t *testing.T) {
+	c := testRunConfig()
+	c.AllowedAddressPairs = []AddressPair{
+		{IPAddress: "10.0.0.100"},
+		{MACAddress: "fa:16:3e:00:00:01"},
+	}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("missing ip_address should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_BlockDeviceMappings(t *testing.T) {
+	c := testRunConfig()
+	c.BlockDeviceMappings = []BlockDeviceMapping{
+		{VolumeSize: 20, DeleteOnTermination: true},
+		{SourceType: "image", SourceID: "abcd"},
+	}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.BlockDeviceMappings[0].SourceType != "blank" {
+		t.Fatalf("source_type should default to blank: %s", c.BlockDeviceMappings[0].SourceType)
+	}
+	if c.BlockDeviceMappings[0].BootIndex != -1 {
+		t.Fatalf("boot_index should default to -1: %d", c.BlockDeviceMappings[0].BootIndex)
+	}
+
+	c = testRunConfig()
+	c.BlockDeviceMappings = []BlockDeviceMapping{
+		{},
+		{SourceType: "snapshot"},
+		{SourceType: "volume", SourceID: "abcd", DeleteOnTermination: true},
+		{SourceType: "disk", SourceID: "abcd"},
+	}
+	if err := c.Prepare(nil); len(err) != 4 {
+		t.Fatalf("invalid block_device_mappings should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_AttachVolumes(t *testing.T) {
+	c := testRunConfig()
+	c.AttachVolumes = []AttachVolume{
+		{Volume: "datasets", Device: "/dev/vdc"},
+		{Volume: "mirror"},
+	}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c = testRunConfig()
+	c.AttachVolumes = []AttachVolume{{Device: "/dev/vdc"}}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("attach_volumes without a volume should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_BlockDeviceSnapshotMode(t *testing.T) {
+	c := testRunConfig()
+	c.BlockDeviceSnapshotMode = "exclude"
+	c.BlockDeviceMappings = []BlockDeviceMapping{
+		{VolumeSize: 20},
+		{VolumeSize: 20, DetachBeforeImage: true},
+		{VolumeSize: 20, SnapshotMode: "include"},
+	}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	for i, mode := range []string{"exclude", "detach", "include"} {
+		if c.BlockDeviceMappings[i].SnapshotMode != mode {
+			t.Fatalf("block_device_mappings %d snapshot_mode should be %s: %s", i, mode, c.BlockDeviceMappings[i].SnapshotMode)
+		}
+	}
+
+	c = testRunConfig()
+	c.BlockDeviceMappings = []BlockDeviceMapping{{VolumeSize: 20}}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.BlockDeviceMappings[0].SnapshotMode != "include" {
+		t.Fatalf("snapshot_mode should default to include: %s", c.BlockDeviceMappings[0].SnapshotMode)
+	}
+
+	c = testRunConfig()
+	c.BlockDeviceSnapshotMode = "strip"
+	c.BlockDeviceMappings = []BlockDeviceMapping{
+		{VolumeSize: 20, SnapshotMode: "exclude", DetachBeforeImage: true},
+	}
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("invalid snapshot modes should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_BootVolumeDeleteOnTermination(t *testing.T) {
+	c := testRunConfig()
+	c.BootVolumeDeleteOnTermination = true
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("boot_volume_delete_on_termination without use_blockstorage_volume should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.UseBlockStorageVolume = true
+	c.BootVolumeDeleteOnTermination = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c = testRunConfig()
+	c.SourceImage = ""
+	c.SourceVolume = "abcd"
+	c.BootVolumeDeleteOnTermination = true
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("boot_volume_delete_on_termination with source_volume should error: %s", err)
+	}
+	c.CloneSourceVolume = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_SourceImageFlavorCheck(t *testing.T) {
+	c := testRunConfig()
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.SourceImageFlavorCheck != "warn" {
+		t.Fatalf("source_image_flavor_check should default to warn: %s", c.SourceImageFlavorCheck)
+	}
+
+	c = testRunConfig()
+	c.SourceImageFlavorCheck = "strict"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("unknown source_image_flavor_check should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_InstanceMetadata(t *testing.T) {
+	c := testRunConfig()
+	c.InstanceMetadata = map[string]string{
+		"cost_center":     "images-{{ .BuildName }}",
+		"packer_run_uuid": "custom",
+	}
+	c.InstanceMetadataDefaults = true
+	ctx := &interpolate.Context{BuildName: "ubuntu"}
+	if err := c.Prepare(ctx); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.InstanceMetadata["cost_center"] != "images-ubuntu" {
+		t.Fatalf("instance_metadata should be rendered: %s", c.InstanceMetadata["cost_center"])
+	}
+	if c.InstanceMetadata["packer_build_name"] != "ubuntu" {
+		t.Fatalf("packer_build_name should be added: %s", c.InstanceMetadata["packer_build_name"])
+	}
+	if c.InstanceMetadata["packer_run_uuid"] != "custom" {
+		t.Fatalf("packer_run_uuid shouldn't be overridden: %s", c.InstanceMetadata["packer_run_uuid"])
+	}
+
+	c = testRunConfig()
+	c.InstanceMetadata = map[string]string{
+		"run": strings.Repeat("{{ .RunUUID }}", 10),
+	}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("rendered value too long should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_SchedulerHints(t *testing.T) {
+	c := testRunConfig()
+	c.SchedulerHints = SchedulerHints{
+		Group:         "0ddc5e42-e4b3-4f45-9a02-a4e1b1f4ed4b",
+		DifferentHost: []string{"a0cf03a5-d921-4877-bb5c-86d26cf818e1"},
+		Query:         `[">=", "$free_ram_mb", 1024]`,
+		AdditionalProperties: map[string]string{
+			"rack": "r12",
+		},
+	}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	hints := c.SchedulerHints.hints()
+	if len(hints) != 4 || hints["rack"] != "r12" || hints["query"] != c.SchedulerHints.Query {
+		t.Fatalf("unexpected scheduler hints: %v", hints)
+	}
+
+	c.SchedulerHints.Query = "free_ram_mb >= 1024"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("invalid query should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_ServerGroupPolicy(t *testing.T) {
+	c := testRunConfig()
+	c.ServerGroupPolicy = "soft-anti-affinity"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.ServerGroupPolicy = "spread"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("unknown server_group_policy should error: %s", err)
+	}
+
+	c.ServerGroupPolicy = "anti-affinity"
+	c.SchedulerHints.Group = "0ddc5e42-e4b3-4f45-9a02-a4e1b1f4ed4b"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("server_group_policy with a scheduler_hints group should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_FlavorFilter(t *testing.T) {
+	c := testRunConfig()
+	c.Flavor = ""
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("missing flavor should error: %s", err)
+	}
+
+	c.FlavorFilter = FlavorFilter{MinVCPUs: 2, MinRAMMB: 4096}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.FlavorFilter.MinDiskGB = -1
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("negative min_disk_gb should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_FlavorRegex(t *testing.T) {
+	c := testRunConfig()
+	c.Flavor = ""
+	c.FlavorRegex = `build-worker-v\d+`
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.FlavorRegexSelect != "error" {
+		t.Fatalf("flavor_regex_select should default to error: %s", c.FlavorRegexSelect)
+	}
+	if !c.flavorRegex.MatchString("build-worker-v3") {
+		t.Fatal("flavor_regex should match the whole name")
+	}
+	if c.flavorRegex.MatchString("build-worker-v3-old") {
+		t.Fatal("flavor_regex should be anchored")
+	}
+
+	c.FlavorRegexSelect = "created"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("unknown flavor_regex_select should error: %s", err)
+	}
+
+	c.FlavorRegexSelect = "name"
+	c.Flavor = "m1.large"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("flavor_regex with flavor should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.Flavor = ""
+	c.FlavorRegex = "build-worker-("
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("invalid flavor_regex should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_UserDataParts(t *testing.T) {
+	c := testRunConfig()
+	c.UserDataParts = []UserDataPart{
+		{File: "cloud-config.yaml", ContentType: "text/cloud-config"},
+		{File: "setup.sh", ContentType: "text/x-shellscript"},
+	}
+	c.UserDataGzip = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.UserDataFile = "user-data"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("user_data_parts with user_data_file should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.UserDataParts = []UserDataPart{{File: "setup.sh"}}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("user_data_parts without content_type should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_Personality(t *testing.T) {
+	c := testRunConfig()
+	c.Personality = []PersonalityFile{
+		{Path: "/root/.ssh/authorized_keys", File: "id_rsa.pub"},
+		{Path: "/etc/motd", Content: "Built by Packer"},
+	}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.Personality = []PersonalityFile{{Path: "/etc/motd", File: "motd", Content: "Built by Packer"}}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("personality file with content should error: %s", err)
+	}
+
+	c.Personality = []PersonalityFile{{Path: "/" + strings.Repeat("a", 255), Content: "a"}}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("long personality path should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_AdminPassword(t *testing.T) {
+	c := testRunConfig()
+	c.Comm.Type = "winrm"
+	c.Comm.WinRMUser = "Administrator"
+	c.AdminPassword = "s3cr3t"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.Comm.WinRMPassword != "s3cr3t" {
+		t.Fatalf("winrm_password should default to admin_password: %s", c.Comm.WinRMPassword)
+	}
+
+	c = testRunConfig()
+	c.Comm.Type = "winrm"
+	c.Comm.WinRMUser = "Administrator"
+	c.Comm.WinRMPassword = "winrm"
+	c.AdminPassword = "s3cr3t"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.Comm.WinRMPassword != "winrm" {
+		t.Fatalf("winrm_password should win over admin_password: %s", c.Comm.WinRMPassword)
+	}
+}
+
+func TestRunConfigPrepare_TrustedImageCertificates(t *testing.T) {
+	c := testRunConfig()
+	c.TrustedImageCertificateIDs = []string{"cert-1"}
+	c.TrustedImageCertificateProperty = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.TrustedImageCertificateIDs = []string{"cert-1", "cert-2"}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("trusted_image_certificate_property with several certificates should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.TrustedImageCertificateIDs = []string{"cert-1"}
+	c.Personality = []PersonalityFile{{Path: "/etc/motd", Content: "Built by Packer"}}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("personality with trusted_image_certificate_ids should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_InstanceTags(t *testing.T) {
+	c := testRunConfig()
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if len(c.InstanceTags) != 0 {
+		t.Fatalf("instance_tags should default to no tags: %v", c.InstanceTags)
+	}
+	if microversion, errs := negotiateMicroversion("auto", "2.79", c.computeMicroversionFeatures()); len(errs) != 0 || microversion != "2.1" {
+		t.Fatalf("the default instance_tags shouldn't require a microversion: %q %s", microversion, errs)
+	}
+
+	c.InstanceTags = []string{"packer", "team/build", strings.Repeat("a", 61)}
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("invalid instance tags should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_InstanceDescription(t *testing.T) {
+	c := testRunConfig()
+	c.InstanceDescription = "temporary packer build, contact platform-team"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.InstanceDescription = strings.Repeat("a", 256)
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("long instance_description should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_InstanceName(t *testing.T) {
+	c := testRunConfig()
+	c.InstanceName = "packer-{{ .BuildName }}-{{ .RunUUID }}"
+	c.runUUID = "3f0c5a3e"
+	if err := c.Prepare(&interpolate.Context{BuildName: "ubuntu"}); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.InstanceName != "packer-ubuntu-3f0c5a3e" {
+		t.Fatalf("instance_name should be rendered: %s", c.InstanceName)
+	}
+
+	for _, name := range []string{strings.Repeat("a", 256), " packer", "packer\n"} {
+		c = testRunConfig()
+		c.InstanceName = name
+		if err := c.Prepare(nil); len(err) != 1 {
+			t.Fatalf("invalid instance_name %q should error: %s", name, err)
+		}
+	}
+}
+
+func TestRunConfigPrepare_ShelveInstance(t *testing.T) {
+	c := testRunConfig()
+	c.ShelveInstance = true
+	c.ShelveOffload = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c = testRunConfig()
+	c.ShelveOffload = true
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("shelve_offload without shelve_instance should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.ShelveInstance = true
+	c.UseBlockStorageVolume = true
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("shelve_instance with use_blockstorage_volume should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_SnapshotConsistency(t *testing.T) {
+	c := testRunConfig()
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.SnapshotConsistency != "stop" {
+		t.Fatalf("snapshot_consistency should default to stop: %s", c.SnapshotConsistency)
+	}
+
+	for _, consistency := range []string{"pause", "quiesce"} {
+		c = testRunConfig()
+		c.SnapshotConsistency = consistency
+		if err := c.Prepare(nil); len(err) != 0 {
+			t.Fatalf("err: %s", err)
+		}
+
+		c = testRunConfig()
+		c.SnapshotConsistency = consistency
+		c.UseBlockStorageVolume = true
+		if err := c.Prepare(nil); len(err) != 1 {
+			t.Fatalf("%s with use_blockstorage_volume should error: %s", consistency, err)
+		}
+	}
+
+	c = testRunConfig()
+	c.SnapshotConsistency = "freeze"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("bad snapshot_consistency should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_SkipStopBeforeImage(t *testing.T) {
+	c := testRunConfig()
+	c.SkipStopBeforeImage = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c = testRunConfig()
+	c.SkipStopBeforeImage = true
+	c.SnapshotConsistency = "pause"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("skip_stop_before_image with snapshot_consistency pause should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.SkipStopBeforeImage = true
+	c.ShelveInstance = true
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("skip_stop_before_image with shelve_instance should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_InstanceID(t *testing.T) {
+	c := testRunConfig()
+	c.SourceImage = ""
+	c.Flavor = ""
+	c.InstanceID = "builder-01"
+	c.StopExistingInstance = true
+	c.Comm.SSHPassword = "secret"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.Comm.SSHTemporaryKeyPairName != "" {
+		t.Fatalf("no temporary key pair should be created for an existing server: %s", c.Comm.SSHTemporaryKeyPairName)
+	}
+
+	c = testRunConfig()
+	c.InstanceID = "builder-01"
+	c.Comm.SSHPassword = "secret"
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("instance_id with source_image and flavor should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.SourceImage = ""
+	c.Flavor = ""
+	c.InstanceID = "builder-01"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("instance_id without ssh credentials should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.StopExistingInstance = true
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("stop_existing_instance without instance_id should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_CloudInitTimeout(t *testing.T) {
+	c := testRunConfig()
+	c.WaitForCloudInit = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.CloudInitTimeout != 30*time.Minute {
+		t.Fatalf("cloud_init_timeout should default to 30m: %s", c.CloudInitTimeout)
+	}
+
+	c = testRunConfig()
+	c.WaitForCloudInit = true
+	c.Comm.Type = "none"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("wait_for_cloud_init without a communicator should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_ConsoleLog(t *testing.T) {
+	c := testRunConfig()
+	c.OnFailureConsoleLog = true
+	c.ConsoleLogPath = "console.log"
+	c.ConsoleLogLines = 200
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c = testRunConfig()
+	c.OnFailureConsoleLog = true
+	c.ConsoleLogLines = -1
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("negative console_log_lines should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.ConsoleLogPath = "console.log"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("console_log_path without on_failure_console_log should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_StatePollInterval(t *testing.T) {
+	c := testRunConfig()
+	c.StatePollInterval = 5 * time.Second
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.StatePollMaxInterval != 5*time.Second {
+		t.Fatalf("state_poll_max_interval should default to state_poll_interval: %s", c.StatePollMaxInterval)
+	}
+
+	c = testRunConfig()
+	c.StatePollInterval = 5 * time.Second
+	c.StatePollMaxInterval = time.Second
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("state_poll_max_interval below state_poll_interval should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_SchedulingRetries(t *testing.T) {
+	c := testRunConfig()
+	c.SchedulingRetries = 2
+	c.FlavorFallbacks = []string{"m1.large"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.SchedulingRetryDelay != 30*time.Second {
+		t.Fatalf("scheduling_retry_delay should default to 30s: %s", c.SchedulingRetryDelay)
+	}
+
+	c = testRunConfig()
+	c.SchedulingRetries = -1
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("negative scheduling_retries should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.FlavorFallbacks = []string{"m1.large", ""}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("empty flavor_fallbacks entry should error: %s", err)
+	}
+}
+
+func TestRunConfig_ComputeMicroversion(t *testing.T) {
+	c := testRunConfig()
+	c.TrustedImageCertificateIDs = []string{"cert"}
+	c.InstanceTags = []string{"tag"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	features := c.computeMicroversionFeatures()
+
+	microversion, errs := negotiateMicroversion("auto", "2.79", features)
+	if len(errs) != 0 || microversion != "2.63" {
+		t.Fatalf("auto should negotiate the newest microversion the options require: %s %s", microversion, errs)
+	}
+
+	_, errs = negotiateMicroversion("auto", "2.60", features)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "2.63") || !strings.Contains(errs[0].Error(), "2.60") {
+		t.Fatalf("an option requiring a newer microversion than the cloud supports should error: %s", errs)
+	}
+
+	_, errs = negotiateMicroversion("2.60", "2.79", features)
+	if len(errs) != 1 {
+		t.Fatalf("an option requiring a newer microversion than compute_api_microversion should error: %s", errs)
+	}
+
+	_, errs = negotiateMicroversion("2.88", "2.79", nil)
+	if len(errs) != 1 {
+		t.Fatalf("a microversion the cloud doesn't support should error: %s", errs)
+	}
+
+	microversion, errs = negotiateMicroversion("auto", "2.40", []microversionFeature{
+		{Option: "instance_tags", Microversion: "2.52", Optional: true},
+	})
+	if len(errs) != 0 || microversion != "2.40" {
+		t.Fatalf("auto should use the cloud microversion for an optional option: %s %s", microversion, errs)
+	}
+}
+
+func TestRunConfigPrepare_NetworkFixedIPs(t *testing.T) {
+	c := testRunConfig()
+	c.Networks = []string{"net-1", "net-2", "net-3"}
+	c.NetworkFixedIPs = map[string]string{"net-2": "10.0.0.40"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	networks, instancePorts := c.serverNetworks()
+	if len(networks) != 3 || len(instancePorts) != 0 {
+		t.Fatalf("fixed IPs should be set on the networks: %v %v", networks, instancePorts)
+	}
+
+	c.NetworkFixedIPPorts = true
+	networks, instancePorts = c.serverNetworks()
+	if len(networks) != 2 || networks[0] != "net-1" || networks[1] != "net-3" {
+		t.Fatalf("networks with a fixed IP should be removed: %v", networks)
+	}
+	if len(instancePorts) != 1 || instancePorts[0].Network != "net-2" || instancePorts[0].FixedIP != "10.0.0.40" {
+		t.Fatalf("networks with a fixed IP should be instance ports: %v", instancePorts)
+	}
+
+	c.NetworkFixedIPs = map[string]string{"net-4": "10.0.0.300"}
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("unknown network and invalid fixed IP should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_TemporaryKeyPairType(t *testing.T) {
+	c := testRunConfig()
+	c.Comm.SSHTemporaryKeyPairType = "ed25519"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c = testRunConfig()
+	c.Comm.Type = "winrm"
+	c.Comm.WinRMUser = "Administrator"
+	c.Comm.SSHTemporaryKeyPairType = "ed25519"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("ed25519 key pair without winrm_password should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_WindowsPasswordTimeout(t *testing.T) {
+	c := testRunConfig()
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.WindowsPasswordTimeout != 20*time.Minute || c.WindowsPasswordPollInterval != 5*time.Second {
+		t.Fatalf("bad windows password defaults: %s %s", c.WindowsPasswordTimeout, c.WindowsPasswordPollInterval)
+	}
+}
+
+func TestRunConfigPrepare_AvailabilityZones(t *testing.T) {
+	c := testRunConfig()
+	c.AvailabilityZones = []string{"az1", "az2"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.AvailabilityZoneTimeout != 10*time.Minute {
+		t.Fatalf("availability_zone_timeout should default to 10m: %s", c.AvailabilityZoneTimeout)
+	}
+
+	c.AvailabilityZone = "az1"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("availability_zone with availability_zones should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.AvailabilityZones = []string{"az1", ""}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("empty availability zone should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.AvailabilityZones = []string{"az1", "az2"}
+	c.AvailabilityZoneTimeout = -time.Minute
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("negative availability_zone_timeout should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.AvailabilityZone = "nova:compute-17"
+	c.UseBlockStorageVolume = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.AvailabilityZone != "nova:compute-17" {
+		t.Fatalf("availability_zone should be left as is: %s", c.AvailabilityZone)
+	}
+	if c.VolumeAvailabilityZone != "nova" {
+		t.Fatalf("volume_availability_zone should default to the zone without the host: %s", c.VolumeAvailabilityZone)
+	}
+
+	c = testRunConfig()
+	c.AvailabilityZone = "nova:compute-17:node:extra"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("availability zone with too many parts should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_EphemeralSwap(t *testing.T) {
+	c := testRunConfig()
+	c.EphemeralSizeGB = 10
+	c.EphemeralGuestFormat = "ext4"
+	c.SwapSizeMB = 512
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c = testRunConfig()
+	c.EphemeralSizeGB = -1
+	c.SwapSizeMB = -1
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("negative sizes should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.EphemeralGuestFormat = "ext4"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("ephemeral_guest_format without ephemeral_size_gb should error: %s", err)
+	}
+}
+
 func TestRunConfigPrepare_ExternalSourceImageURL(t *testing.T) {
 	c := testRunConfig()
 	// test setting both ExternalSourceImageURL and SourceImage causes an error
@@ -203,6 +1327,156 @@ func TestRunConfigPrepare_ExternalSourceImageURL(t *testing.T) {
 
 }
 
+func TestRunConfigPrepare_SourceImageNameRegex(t *testing.T) {
+	c := testRunConfig()
+	c.SourceImage = ""
+	c.SourceImageFilters = ImageFilter{
+		Filters: ImageFilterOptions{
+			Name:      "ubuntu-22.04-base-v1.0.0",
+			NameRegex: `ubuntu-22\.04-base-v(`,
+		},
+	}
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("name with an invalid name_regex should error twice: %s", err)
+	}
+
+	c.SourceImageFilters.Filters.Name = ""
+	c.SourceImageFilters.Filters.NameRegex = `ubuntu-22\.04-base-v[0-9.]+`
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if !c.sourceImageNameRegex.MatchString("ubuntu-22.04-base-v1.2.3") {
+		t.Fatalf("name_regex should match")
+	}
+	if c.sourceImageNameRegex.MatchString("ubuntu-22.04-base-v1.2.3-rc") {
+		t.Fatalf("name_regex should be anchored")
+	}
+}
+
+func TestRunConfigPrepare_SourceImageAcceptMembership(t *testing.T) {
+	c := testRunConfig()
+	c.SourceImage = ""
+	c.SourceImageFilters = ImageFilter{
+		Filters: ImageFilterOptions{
+			Name: "ubuntu-22.04-base",
+		},
+	}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.sourceImageOpts.MemberStatus != images.ImageMemberStatusAccepted {
+		t.Fatalf("only accepted images should be listed: %s", c.sourceImageOpts.MemberStatus)
+	}
+
+	c.SourceImageAcceptMembership = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.sourceImageOpts.MemberStatus != images.ImageMemberStatusAll {
+		t.Fatalf("pending images should be listed: %s", c.sourceImageOpts.MemberStatus)
+	}
+}
+
+func TestRunConfigPrepare_ExternalSourceImageChecksum(t *testing.T) {
+	c := testRunConfig()
+	c.ExternalSourceImageChecksum = "sha256:abcd"
+	c.KeepSourceImage = true
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("external_source_image_checksum and keep_source_image without external_source_image_url should error: %s", err)
+	}
+
+	c = testRunConfig()
+	c.SourceImage = ""
+	c.ExternalSourceImageURL = "http://example.com/image.qcow2"
+	c.ExternalSourceImageChecksum = "ABCD"
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.externalSourceImageChecksumAlgo != "sha256" || c.externalSourceImageChecksum != "abcd" {
+		t.Fatalf("bad: %s:%s", c.externalSourceImageChecksumAlgo, c.externalSourceImageChecksum)
+	}
+
+	c.SourceImageName = ""
+	c.ExternalSourceImageChecksum = "sha1:abcd"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("unknown checksum algorithm should error: %s", err)
+	}
+
+	c.SourceImageName = ""
+	c.ExternalSourceImageChecksum = "sha512:xyz"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("non hexadecimal checksum should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_SourceImageFile(t *testing.T) {
+	c := testRunConfig()
+	c.SourceImage = ""
+	c.SourceImageFile = filepath.Join(t.TempDir(), "missing.qcow2")
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("missing source_image_file should error: %s", err)
+	}
+
+	c.SourceImageName = ""
+	c.SourceImageFile = filepath.Join(t.TempDir(), "image.qcow2")
+	if err := os.WriteFile(c.SourceImageFile, []byte("image"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	c.KeepSourceImage = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.SourceImageName == "" {
+		t.Fatalf("SourceImageName should be generated")
+	}
+
+	c.SourceImageName = ""
+	c.SourceImage = "abcd"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("source_image_file with source_image should error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_SourceVolume(t *testing.T) {
+	c := testRunConfig()
+	c.CloneSourceVolume = true
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("clone_source_volume without source_volume should error: %s", err)
+	}
+
+	c.SourceVolume = "golden"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("source_volume with source_image should error: %s", err)
+	}
+
+	c.SourceImage = ""
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if !c.UseBlockStorageVolume {
+		t.Fatalf("source_volume should imply use_blockstorage_volume")
+	}
+}
+
+func TestRunConfigPrepare_SourceVolumeSnapshot(t *testing.T) {
+	c := testRunConfig()
+	c.SourceVolumeSnapshotMostRecent = true
+	c.VolumeSize = -1
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("source_volume_snapshot_most_recent without source_volume_snapshot and a negative volume_size should error: %s", err)
+	}
+
+	c.SourceImage = ""
+	c.SourceVolumeSnapshot = "appliance"
+	c.VolumeSize = 0
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if !c.UseBlockStorageVolume {
+		t.Fatalf("source_volume_snapshot should imply use_blockstorage_volume")
+	}
+}
+
 // This test case confirms that only allowed fields will be set to values
 // The checked values are non-nil for their target type
 func TestBuildImageFilter(t *testing.T) {
@@ -233,6 +1507,34 @@ func TestBuildImageFilter(t *testing.T) {
 	}
 }
 
+func TestBuildImageFilter_BadVisibility(t *testing.T) {
+	filters := ImageFilterOptions{
+		Visibility: "protected",
+	}
+
+	if _, err := filters.Build(); err == nil {
+		t.Errorf("Expected an error building a filter with an unknown visibility")
+	}
+}
+
+func TestImageListOpts(t *testing.T) {
+	opts := imageListOpts{
+		ListOpts: images.ListOpts{
+			Name: "ubuntu",
+		},
+		Properties: map[string]string{"os_distro": "ubuntu"},
+		Hidden:     true,
+	}
+
+	query, err := opts.ToImageListQuery()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if query != "?name=ubuntu&os_distro=ubuntu&os_hidden=true" {
+		t.Fatalf("bad: %s", query)
+	}
+}
+
 func TestBuildBadImageFilter(t *testing.T) {
 	filterMap := map[string]interface{}{
 		"limit":    "3",
@@ -7,9 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/attachinterfaces"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -27,12 +30,19 @@ import (
 // may have happened while refreshing the state.
 type StateRefreshFunc func() (result interface{}, state string, progress int, err error)
 
+// errWaitInterrupted is returned by the waits when the build is cancelled.
+var errWaitInterrupted = errors.New("interrupted")
+
 // StateChangeConf is the configuration struct used for `WaitForState`.
 type StateChangeConf struct {
 	Pending   []string
 	Refresh   StateRefreshFunc
 	StepState multistep.StateBag
 	Target    []string
+	// Timeout is the maximum amount of time to wait, no limit when zero.
+	Timeout time.Duration
+	// Poll is how often to refresh the state.
+	Poll pollConfig
 }
 
 // ServerStateRefreshFunc returns a StateRefreshFunc that is used to watch
@@ -54,45 +64,83 @@ func ServerStateRefreshFunc(
 	}
 }
 
+// InterfaceStateRefreshFunc returns a StateRefreshFunc that is used to watch
+// an interface attached to an openstack server.
+func InterfaceStateRefreshFunc(
+	client *gophercloud.ServiceClient, instanceID, portID string) StateRefreshFunc {
+	return func() (interface{}, string, int, error) {
+		iface, err := attachinterfaces.Get(client, instanceID, portID).Extract()
+		if err != nil {
+			if _, ok := err.(gophercloud.ErrDefault404); ok {
+				log.Printf("[INFO] 404 on InterfaceStateRefresh, returning DETACHED")
+				return nil, "DETACHED", 0, nil
+			}
+			log.Printf("[ERROR] Error on InterfaceStateRefresh: %s", err)
+			return nil, "", 0, err
+		}
+
+		return iface, iface.PortState, 0, nil
+	}
+}
+
 // WaitForState watches an object and waits for it to achieve a certain
 // state.
 func WaitForState(conf *StateChangeConf) (i interface{}, err error) {
 	log.Printf("Waiting for state to become: %s", conf.Target)
 
+	var deadline time.Time
+	if conf.Timeout > 0 {
+		deadline = time.Now().Add(conf.Timeout)
+	}
+	poll := newPoller(conf.Poll)
 	for {
 		var currentProgress int
 		var currentState string
 		i, currentState, currentProgress, err = conf.Refresh()
-		if err != nil {
+		throttled := poll.Throttled(err)
+		if err != nil && !throttled {
 			return
 		}
 
-		for _, t := range conf.Target {
-			if currentState == t {
-				return
+		if !throttled {
+			for _, t := range conf.Target {
+				if currentState == t {
+					return
+				}
 			}
 		}
 
 		if conf.StepState != nil {
 			if _, ok := conf.StepState.GetOk(multistep.StateCancelled); ok {
-				return nil, errors.New("interrupted")
+				return nil, errWaitInterrupted
 			}
 		}
 
-		found := false
-		for _, allowed := range conf.Pending {
-			if currentState == allowed {
-				found = true
-				break
+		if !throttled {
+			found := false
+			for _, allowed := range conf.Pending {
+				if currentState == allowed {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return nil, fmt.Errorf("unexpected state '%s', wanted target '%s'", currentState, conf.Target)
 			}
 		}
 
-		if !found {
-			return nil, fmt.Errorf("unexpected state '%s', wanted target '%s'", currentState, conf.Target)
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			if throttled {
+				return nil, fmt.Errorf("timeout after %s waiting for state to become '%s': %s", conf.Timeout, conf.Target, err)
+			}
+			return nil, fmt.Errorf("timeout after %s waiting for state to become '%s', currently '%s'", conf.Timeout, conf.Target, currentState)
 		}
 
-		log.Printf("Waiting for state to become: %s currently %s (%d%%)", conf.Target, currentState, currentProgress)
-		time.Sleep(2 * time.Second)
+		if !throttled {
+			log.Printf("Waiting for state to become: %s currently %s (%d%%)", conf.Target, currentState, currentProgress)
+		}
+		poll.Wait()
 	}
 }
 
@@ -110,10 +158,22 @@ func DeleteServer(state multistep.StateBag, instance string) error {
 	maxNumErrors := 10
 	numErrors := 0
 
+	// The force delete action is missing without the soft delete
+	// extension, and may not be allowed by the policy.
+	forceDelete := config.ForceDelete
+	var forceDeleteErr error
+
 	ui.Say(fmt.Sprintf("Terminating the source server: %s ...", instance))
 	for {
-		if config.ForceDelete {
+		if forceDelete {
 			err = servers.ForceDelete(computeClient, instance).ExtractErr()
+			switch err.(type) {
+			case gophercloud.ErrDefault400, gophercloud.ErrDefault403:
+				ui.Error(fmt.Sprintf("Warning: force deleting server %s failed, deleting it normally: %s", instance, err))
+				forceDelete = false
+				forceDeleteErr = err
+				continue
+			}
 		} else {
 			err = servers.Delete(computeClient, instance).ExtractErr()
 		}
@@ -137,16 +197,170 @@ func DeleteServer(state multistep.StateBag, instance string) error {
 		return err
 	}
 
+	// A soft deleted server isn't gone, it holds on to its resources until
+	// it's reclaimed.
 	stateChange := StateChangeConf{
-		Pending: []string{"ACTIVE", "BUILD", "REBUILD", "SUSPENDED", "SHUTOFF", "STOPPED"},
+		Pending: []string{"ACTIVE", "BUILD", "REBUILD", "SUSPENDED", "PAUSED", "SHUTOFF", "STOPPED", "SHELVED", "SHELVED_OFFLOADED"},
 		Refresh: ServerStateRefreshFunc(computeClient, instance),
-		Target:  []string{"DELETED"},
+		Poll:    config.statePolling(),
+		Target:  []string{"DELETED", "SOFT_DELETED"},
 	}
 
-	_, err = WaitForState(&stateChange)
+	latest, err := WaitForState(&stateChange)
 	if err != nil {
 		err = fmt.Errorf("Error terminating server: %s", err)
 		return err
 	}
+	if server, ok := latest.(*servers.Server); ok && server.Status == "SOFT_DELETED" {
+		if forceDeleteErr != nil {
+			return fmt.Errorf("Error terminating server: server %s is soft deleted, and force deleting it isn't possible: %s", instance, forceDeleteErr)
+		}
+		return fmt.Errorf("Error terminating server: server %s is soft deleted until the cloud reclaims it, "+
+			"set force_delete to delete it right away", instance)
+	}
 	return nil
 }
+
+// updateServerDescription sets the description of the server, which
+// requires microversion 2.19.
+func updateServerDescription(client *gophercloud.ServiceClient, serverID, description string) error {
+	descriptionClient := withMicroversion(client, "2.19")
+	body := map[string]interface{}{
+		"server": map[string]interface{}{
+			"description": description,
+		},
+	}
+	_, err := descriptionClient.Put(descriptionClient.ServiceURL("servers", serverID), body, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{200},
+	})
+	return err
+}
+
+// computeMaxMicroversion returns the maximum microversion the Compute API
+// supports, from its version document.
+func computeMaxMicroversion(client *gophercloud.ServiceClient) (string, error) {
+	var body struct {
+		Version struct {
+			Version string `json:"version"`
+		} `json:"version"`
+	}
+	_, err := client.Get(client.ServiceURL(""), &body, &gophercloud.RequestOpts{
+		OkCodes: []int{200},
+	})
+	if err != nil {
+		return "", err
+	}
+	return body.Version.Version, nil
+}
+
+// withMicroversion returns a copy of the client using at least the given
+// microversion, keeping the compute_api_microversion when it's newer.
+func withMicroversion(client *gophercloud.ServiceClient, minimum string) *gophercloud.ServiceClient {
+	c := *client
+	if !microversionAtLeast(c.Microversion, minimum) {
+		c.Microversion = minimum
+	}
+	return &c
+}
+
+// withMaxMicroversion returns a copy of the client using at most the given
+// microversion, for the requests whose response changed in the following
+// one in a way gophercloud doesn't handle.
+func withMaxMicroversion(client *gophercloud.ServiceClient, maximum string) *gophercloud.ServiceClient {
+	c := *client
+	if c.Microversion != "" && microversionAtLeast(c.Microversion, maximum) {
+		c.Microversion = maximum
+	}
+	return &c
+}
+
+// requireMicroversion returns a copy of the client using at least the given
+// microversion, which the option requires. A pinned compute_api_microversion,
+// the newest microversion the build uses, must be at least the microversion.
+// Otherwise, including with auto, the cloud must support it.
+func (c *AccessConfig) requireMicroversion(client *gophercloud.ServiceClient, minimum, option string) (*gophercloud.ServiceClient, error) {
+	maxMicroversion, limit, err := c.maxComputeMicroversion(client)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the Compute API microversion: %s", err)
+	}
+	if !microversionAtLeast(maxMicroversion, minimum) {
+		return nil, fmt.Errorf("%s requires the Compute API microversion %s, %s", option, minimum, limit)
+	}
+	return withMicroversion(client, minimum), nil
+}
+
+// maxComputeMicroversion returns the newest Compute API microversion the
+// build may use, together with where the limit comes from for the error
+// messages: the pinned compute_api_microversion, or else the cloud, up to
+// which auto raises the microversion the options require at runtime.
+func (c *AccessConfig) maxComputeMicroversion(client *gophercloud.ServiceClient) (string, string, error) {
+	if client.Microversion != "" && c.ComputeAPIMicroversion != "auto" {
+		return client.Microversion, fmt.Sprintf("compute_api_microversion is %s", client.Microversion), nil
+	}
+	maxMicroversion, err := computeMaxMicroversion(client)
+	if err != nil {
+		return "", "", err
+	}
+	return maxMicroversion, fmt.Sprintf("the cloud supports up to %s", maxMicroversion), nil
+}
+
+// microversionFeature is an option of the build depending on the Compute API
+// microversion. The option requires the Microversion, unless Optional, the
+// build then going on without it. RemovedIn is the microversion the option
+// was removed in.
+type microversionFeature struct {
+	Option       string
+	Microversion string
+	Optional     bool
+	RemovedIn    string
+}
+
+// negotiateMicroversion returns the microversion to use with the features:
+// the requested one, or with auto the newest one the features use that the
+// cloud supports up to maxMicroversion.
+func negotiateMicroversion(requested, maxMicroversion string, features []microversionFeature) (string, []error) {
+	var errs []error
+	microversion := requested
+	reason := fmt.Sprintf("compute_api_microversion is %s", requested)
+	if requested == "auto" {
+		microversion = "2.1"
+		for _, f := range features {
+			if !microversionAtLeast(microversion, f.Microversion) {
+				microversion = f.Microversion
+			}
+		}
+		if !microversionAtLeast(maxMicroversion, microversion) {
+			microversion = maxMicroversion
+		}
+		reason = fmt.Sprintf("the cloud supports up to %s", maxMicroversion)
+	} else if !microversionAtLeast(maxMicroversion, microversion) {
+		errs = append(errs, fmt.Errorf("compute_api_microversion %s isn't supported, the cloud supports up to %s", microversion, maxMicroversion))
+	}
+
+	for _, f := range features {
+		if f.RemovedIn != "" && microversionAtLeast(microversion, f.RemovedIn) {
+			errs = append(errs, fmt.Errorf("%s was removed in the Compute API microversion %s, the build uses %s", f.Option, f.RemovedIn, microversion))
+		}
+		if !f.Optional && !microversionAtLeast(microversion, f.Microversion) {
+			errs = append(errs, fmt.Errorf("%s requires the Compute API microversion %s, %s", f.Option, f.Microversion, reason))
+		}
+	}
+	return microversion, errs
+}
+
+// microversionAtLeast tells whether the microversion, such as 2.63, is at
+// least the minimum one.
+func microversionAtLeast(version, minimum string) bool {
+	parse := func(v string) (int, int) {
+		parts := strings.SplitN(v, ".", 2)
+		if len(parts) != 2 {
+			return 0, 0
+		}
+		major, _ := strconv.Atoi(parts[0])
+		minor, _ := strconv.Atoi(parts[1])
+		return major, minor
+	}
+	major, minor := parse(version)
+	minMajor, minMinor := parse(minimum)
+	return major > minMajor || major == minMajor && minor >= minMinor
+}
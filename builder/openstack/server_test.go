@@ -0,0 +1,122 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestWithMaxMicroversion(t *testing.T) {
+	autoMicroversion, errs := negotiateMicroversion("auto", "2.79", []microversionFeature{
+		{Option: "instance_tags", Microversion: "2.52", Optional: true},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("err: %s", errs)
+	}
+
+	cases := []struct {
+		name         string
+		microversion string
+		expected     string
+	}{
+		{"default", "", ""},
+		{"older", "2.19", "2.19"},
+		{"auto", autoMicroversion, "2.44"},
+		{"pinned", "2.60", "2.44"},
+	}
+	for _, tc := range cases {
+		client := &gophercloud.ServiceClient{Microversion: tc.microversion}
+		if got := withMaxMicroversion(client, "2.44").Microversion; got != tc.expected {
+			t.Errorf("%s: expected microversion %q, got %q", tc.name, tc.expected, got)
+		}
+		if client.Microversion != tc.microversion {
+			t.Errorf("%s: the client shouldn't be modified: %q", tc.name, client.Microversion)
+		}
+	}
+}
+
+func TestWaitForState_Throttled(t *testing.T) {
+	throttled := func() (interface{}, string, int, error) {
+		return nil, "", 0, gophercloud.ErrDefault429{}
+	}
+
+	cancelled := new(multistep.BasicStateBag)
+	cancelled.Put(multistep.StateCancelled, true)
+	_, err := WaitForState(&StateChangeConf{
+		Pending:   []string{"BUILD"},
+		Target:    []string{"ACTIVE"},
+		Refresh:   throttled,
+		StepState: cancelled,
+		Poll:      pollConfig{Interval: time.Millisecond},
+	})
+	if err == nil || !errors.Is(err, errWaitInterrupted) {
+		t.Fatalf("a throttled wait should be interrupted: %v", err)
+	}
+
+	_, err = WaitForState(&StateChangeConf{
+		Pending: []string{"BUILD"},
+		Target:  []string{"ACTIVE"},
+		Refresh: throttled,
+		Timeout: time.Nanosecond,
+		Poll:    pollConfig{Interval: time.Millisecond},
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "timeout after") {
+		t.Fatalf("a throttled wait should time out: %v", err)
+	}
+}
+
+func TestRequireMicroversion(t *testing.T) {
+	cloud := newTestCloud(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"version": {"version": "2.79"}}`)
+	})
+
+	cases := []struct {
+		name         string
+		requested    string
+		microversion string
+		minimum      string
+		expected     string
+		err          string
+	}{
+		{"default", "", "", "2.60", "2.60", ""},
+		{"auto", "auto", "2.52", "2.60", "2.60", ""},
+		{"auto newer", "auto", "2.63", "2.60", "2.63", ""},
+		{"pinned", "2.63", "2.63", "2.60", "2.63", ""},
+		{"pinned older", "2.52", "2.52", "2.60", "", "option requires the Compute API microversion 2.60, compute_api_microversion is 2.52"},
+		{"cloud older", "", "", "2.85", "", "option requires the Compute API microversion 2.85, the cloud supports up to 2.79"},
+		{"auto cloud older", "auto", "2.79", "2.85", "", "option requires the Compute API microversion 2.85, the cloud supports up to 2.79"},
+	}
+	for _, tc := range cases {
+		config := cloud.state(t).Get("config").(*Config)
+		config.ComputeAPIMicroversion = tc.requested
+		client := &gophercloud.ServiceClient{
+			ProviderClient: config.osClient,
+			Endpoint:       cloud.URL + "/",
+			Microversion:   tc.microversion,
+		}
+		got, err := config.requireMicroversion(client, tc.minimum, "option")
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: err: %s", tc.name, err)
+			continue
+		}
+		if got.Microversion != tc.expected {
+			t.Errorf("%s: expected microversion %q, got %q", tc.name, tc.expected, got.Microversion)
+		}
+	}
+}
@@ -7,11 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 )
 
@@ -44,15 +47,34 @@ func CommHost(
 			return ip.FloatingIP, nil
 		}
 
-		if s.AccessIPv4 != "" {
-			log.Printf("[DEBUG] Using AccessIPv4 %s to connect", s.AccessIPv4)
-			return s.AccessIPv4, nil
+		// If we requested a fixed IP, use that
+		if fixedIP, ok := state.GetOk("fixed_ip"); ok {
+			addr := fixedIP.(string)
+			if strings.Contains(addr, ":") {
+				addr = fmt.Sprintf("[%s]", addr)
+			}
+			log.Printf("[DEBUG] Using fixed IP %s to connect", addr)
+			return addr, nil
 		}
 
-		// Try to get it from the requested interface
-		if addr := sshAddrFromPool(s, sshinterface, sshipversion); addr != "" {
-			log.Printf("[DEBUG] Using IP address %s to connect", addr)
-			return addr, nil
+		// If we have a communicator network, only use its addresses
+		if network, ok := state.GetOk("communicator_network"); ok {
+			name := network.(*networks.Network).Name
+			if addr := sshAddrFromPool(s, name, sshipversion); addr != "" {
+				log.Printf("[DEBUG] Using IP address %s from communicator network %s to connect", addr, name)
+				return addr, nil
+			}
+		} else {
+			if s.AccessIPv4 != "" {
+				log.Printf("[DEBUG] Using AccessIPv4 %s to connect", s.AccessIPv4)
+				return s.AccessIPv4, nil
+			}
+
+			// Try to get it from the requested interface
+			if addr := sshAddrFromPool(s, sshinterface, sshipversion); addr != "" {
+				log.Printf("[DEBUG] Using IP address %s to connect", addr)
+				return addr, nil
+			}
 		}
 
 		s, err := servers.Get(client, s.ID).Extract()
@@ -97,7 +119,9 @@ func sshAddrFromPool(s *servers.Server, desired string, sshIPVersion string) str
 					addr = address["addr"].(string)
 				}
 			} else if sshIPVersion == "6" {
-				if address["version"].(float64) == 6 {
+				// Link-local addresses can't be reached from outside the
+				// network, prefer the global ones.
+				if address["version"].(float64) == 6 && !isLinkLocal(address["addr"].(string)) {
 					addr = fmt.Sprintf("[%s]", address["addr"].(string))
 				}
 			} else {
@@ -117,3 +141,23 @@ func sshAddrFromPool(s *servers.Server, desired string, sshIPVersion string) str
 
 	return ""
 }
+
+// serverHasAddress tells whether the IP address is one of the addresses of
+// the server.
+func serverHasAddress(s *servers.Server, ip string) bool {
+	for _, networkAddresses := range s.Addresses {
+		elements, _ := networkAddresses.([]interface{})
+		for _, element := range elements {
+			address, _ := element.(map[string]interface{})
+			if addr, _ := address["addr"].(string); addr == ip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isLinkLocal(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLinkLocalUnicast()
+}
@@ -38,10 +38,14 @@ func (s *stepAddImageMembers) Run(ctx context.Context, state multistep.StateBag)
 
 	for _, member := range config.ImageMembers {
 		ui.Say(fmt.Sprintf("Adding member '%s' to image %s", member, imageId))
-		r := members.Create(imageClient, imageId, member)
-		if _, err = r.Extract(); err != nil {
-			err = fmt.Errorf("Error adding member to image: %s", err)
+		err = retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+			_, err := members.Create(imageClient, imageId, member).Extract()
+			return err
+		})
+		if err != nil {
+			err = fmt.Errorf("Error adding member to image %s: %s", imageId, err)
 			state.Put("error", err)
+			ui.Error(err.Error())
 			return multistep.ActionHalt
 		}
 	}
@@ -49,11 +53,22 @@ func (s *stepAddImageMembers) Run(ctx context.Context, state multistep.StateBag)
 	if config.ImageAutoAcceptMembers {
 		for _, member := range config.ImageMembers {
 			ui.Say(fmt.Sprintf("Accepting image %s for member '%s'", imageId, member))
-			r := members.Update(imageClient, imageId, member, members.UpdateOpts{Status: "accepted"})
-			if _, err = r.Extract(); err != nil {
-				err = fmt.Errorf("Error accepting image for member: %s", err)
-				state.Put("error", err)
-				return multistep.ActionHalt
+			memberClient, err := config.imageV2ClientForProject(member)
+			if err != nil {
+				ui.Error(fmt.Sprintf(
+					"Warning: unable to authenticate to member project '%s', the image %s has to be accepted manually: %s",
+					member, imageId, err))
+				continue
+			}
+
+			err = retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+				_, err := members.Update(memberClient, imageId, member, members.UpdateOpts{Status: "accepted"}).Extract()
+				return err
+			})
+			if err != nil {
+				ui.Error(fmt.Sprintf(
+					"Warning: unable to accept image %s for member '%s', the image has to be accepted manually: %s",
+					imageId, member, err))
 			}
 		}
 	}
@@ -6,18 +6,42 @@ package openstack
 import (
 	"context"
 	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
 
+	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/attributestags"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
 type StepAllocateIp struct {
-	FloatingIPNetwork     string
-	FloatingIP            string
-	ReuseIPs              bool
-	InstanceFloatingIPNet string
+	FloatingIPNetworks            []string
+	FloatingIP                    string
+	FloatingIPSubnet              string
+	FloatingIPDescription         string
+	ReuseIPs                      bool
+	ForceNewFloatingIP            bool
+	FloatingIPTags                []string
+	InstanceFloatingIPNet         string
+	InstanceFloatingIPNetFallback bool
+	AssociateRetries              int
+	AssociateRetryDelay           time.Duration
+	ActiveTimeout                 time.Duration
+	PortActiveTimeout             time.Duration
+
+	// Whether the floating IP was created by this step, and whether it must
+	// be kept after the build anyway.
+	floatingIPCreated bool
+	keepFloatingIP    bool
+	// Whether the floating IP was associated with the instance by this step.
+	floatingIPAssociated bool
 }
 
 func (s *StepAllocateIp) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -31,7 +55,7 @@ func (s *StepAllocateIp) Run(ctx context.Context, state multistep.StateBag) mult
 	// statebag below, because it is requested by Cleanup()
 	state.Put("access_ip", &instanceIP)
 
-	if s.FloatingIP == "" && !s.ReuseIPs && s.FloatingIPNetwork == "" {
+	if s.FloatingIP == "" && !s.ReuseIPs && !s.ForceNewFloatingIP && len(s.FloatingIPNetworks) == 0 {
 		ui.Message("Floating IP not required")
 		return multistep.ActionContinue
 	}
@@ -52,13 +76,57 @@ func (s *StepAllocateIp) Run(ctx context.Context, state multistep.StateBag) mult
 		return multistep.ActionHalt
 	}
 
+	searchOpts := FreeFloatingIPOpts{
+		Tags: s.FloatingIPTags,
+	}
+
+	// Resolve the floating IP subnet early, it restricts both the allocation
+	// and the reuse of floating IPs.
+	var floatingNetwork, floatingSubnet string
+	if s.FloatingIPSubnet != "" {
+		floatingNetwork, err = CheckFloatingIPNetwork(networkClient, s.FloatingIPNetworks[0])
+		if err != nil {
+			err := fmt.Errorf("Error using the provided floating_ip_network: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		subnet, err := CheckFloatingIPSubnet(networkClient, floatingNetwork, s.FloatingIPSubnet)
+		if err != nil {
+			err := fmt.Errorf("Error using the provided floating_ip_subnet: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		_, cidr, err := net.ParseCIDR(subnet.CIDR)
+		if err != nil {
+			err := fmt.Errorf("Error parsing CIDR of floating_ip_subnet '%s': %s", subnet.ID, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		floatingSubnet = subnet.ID
+		searchOpts.CIDR = cidr
+	}
+
 	// Try to Use the OpenStack floating IP by checking provided parameters in
 	// the following order:
+	//  - skip straight to the creation if "ForceNewFloatingIP" is set
 	//  - try to use "FloatingIP" ID directly if it's provided
-	//  - try to find free floating IP in the project if "ReuseIPs" is set
-	//  - create a new floating IP if "FloatingIPNetwork" is provided (it can be
-	//    ID or name of the network).
-	if s.FloatingIP != "" {
+	//  - try to find free floating IP in the project if "ReuseIPs" is set,
+	//    optionally restricted to the ones tagged with "FloatingIPTags" or
+	//    part of "FloatingIPSubnet"
+	//  - create a new floating IP if "FloatingIPNetworks" are provided (they
+	//    can be IDs or names of the networks) and no floating IP was selected
+	//    above. The external network is discovered if a new floating IP is
+	//    required but no network was provided.
+	reusedIP := false
+	if s.ForceNewFloatingIP {
+		ui.Message("Not reusing any floating IP, a new one will be allocated")
+	} else if s.FloatingIP != "" {
 		// Try to use FloatingIP if it was provided by the user.
 		freeFloatingIP, err := CheckFloatingIP(networkClient, s.FloatingIP)
 		if err != nil {
@@ -70,47 +138,119 @@ func (s *StepAllocateIp) Run(ctx context.Context, state multistep.StateBag) mult
 
 		instanceIP = *freeFloatingIP
 		ui.Message(fmt.Sprintf("Selected floating IP: '%s' (%s)", instanceIP.ID, instanceIP.FloatingIP))
-		state.Put("floatingip_istemp", false)
 	} else if s.ReuseIPs {
 		// If ReuseIPs is set to true and we have a free floating IP, use it rather
 		// than creating one.
-		ui.Say("Searching for unassociated floating IP")
-		freeFloatingIP, err := FindFreeFloatingIP(networkClient)
-		if err != nil {
+		if len(s.FloatingIPTags) > 0 {
+			if err := CheckTagsSupported(networkClient); err != nil {
+				err := fmt.Errorf("Error using floating_ip_tags: %s", err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+			ui.Say(fmt.Sprintf("Searching for unassociated floating IP tagged with %s",
+				strings.Join(s.FloatingIPTags, ", ")))
+		} else {
+			ui.Say("Searching for unassociated floating IP")
+		}
+		freeFloatingIP, err := FindFreeFloatingIP(networkClient, searchOpts)
+		if err == ErrNoFreeFloatingIP && len(s.FloatingIPTags) > 0 {
+			// No tagged floating IP is available, a new one will be allocated
+			// and tagged below.
+			ui.Message("No free tagged floating IP found, a new one will be allocated")
+		} else if err != nil {
 			err := fmt.Errorf("Error searching for floating IP: %s", err)
 			state.Put("error", err)
 			ui.Error(err.Error())
 			return multistep.ActionHalt
+		} else {
+			instanceIP = *freeFloatingIP
+			reusedIP = true
+			ui.Message(fmt.Sprintf("Selected floating IP: '%s' (%s)", instanceIP.ID, instanceIP.FloatingIP))
 		}
+	}
 
-		instanceIP = *freeFloatingIP
-		ui.Message(fmt.Sprintf("Selected floating IP: '%s' (%s)", instanceIP.ID, instanceIP.FloatingIP))
-		state.Put("floatingip_istemp", false)
-	} else if s.FloatingIPNetwork != "" {
-		// Lastly, if FloatingIPNetwork was provided by the user, we need to use it
-		// to allocate a new floating IP and associate it to the instance.
-		floatingNetwork, err := CheckFloatingIPNetwork(networkClient, s.FloatingIPNetwork)
+	floatingIPNetworks := s.FloatingIPNetworks
+	if instanceIP.ID == "" && len(floatingIPNetworks) == 0 && (s.ForceNewFloatingIP || s.ReuseIPs) {
+		ui.Say("Discovering external network...")
+		networkID, err := DiscoverExternalNetwork(networkClient)
 		if err != nil {
-			err := fmt.Errorf("Error using the provided floating_ip_network: %s", err)
+			err := fmt.Errorf("Error discovering the floating IP network: %s", err)
 			state.Put("error", err)
 			ui.Error(err.Error())
 			return multistep.ActionHalt
 		}
 
-		ui.Say(fmt.Sprintf("Creating floating IP using network %s ...", floatingNetwork))
-		newIP, err := floatingips.Create(networkClient, floatingips.CreateOpts{
-			FloatingNetworkID: floatingNetwork,
-		}).Extract()
-		if err != nil {
-			err := fmt.Errorf("Error creating floating IP from floating network '%s': %s", floatingNetwork, err)
-			state.Put("error", err)
-			ui.Error(err.Error())
-			return multistep.ActionHalt
+		ui.Message(fmt.Sprintf("Found external network ID: %s", networkID))
+		state.Put("floating_ip_network", networkID)
+		floatingIPNetworks = []string{networkID}
+	}
+
+	if instanceIP.ID == "" && len(floatingIPNetworks) > 0 {
+		// Lastly, if FloatingIPNetworks were provided by the user, we need to
+		// use them to allocate a new floating IP and associate it to the
+		// instance. Networks are tried in order, the next one is used if a
+		// network can't be found or has no floating IP left to allocate.
+		for i, networkRef := range floatingIPNetworks {
+			last := i == len(floatingIPNetworks)-1
+
+			network := floatingNetwork
+			if network == "" {
+				network, err = CheckFloatingIPNetwork(networkClient, networkRef)
+				if err != nil && !last {
+					ui.Message(fmt.Sprintf("Unable to use floating IP network '%s', trying the next one: %s", networkRef, err))
+					continue
+				} else if err != nil {
+					err := fmt.Errorf("Error using the provided floating_ip_network: %s", err)
+					state.Put("error", err)
+					ui.Error(err.Error())
+					return multistep.ActionHalt
+				}
+			}
+
+			ui.Say(fmt.Sprintf("Creating floating IP using network %s ...", network))
+			newIP, err := floatingips.Create(networkClient, floatingips.CreateOpts{
+				Description:       s.FloatingIPDescription,
+				FloatingNetworkID: network,
+				SubnetID:          floatingSubnet,
+			}).Extract()
+			if err != nil {
+				// Neutron answers with a conflict when the quota is exceeded or
+				// when the network ran out of addresses.
+				if _, ok := err.(gophercloud.ErrDefault409); ok && !last {
+					ui.Message(fmt.Sprintf("Unable to create floating IP from floating network '%s', trying the next one: %s", network, err))
+					continue
+				}
+				err := fmt.Errorf("Error creating floating IP from floating network '%s': %s", network, err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+
+			instanceIP = *newIP
+			ui.Message(fmt.Sprintf("Created floating IP: '%s' (%s) using network %s",
+				instanceIP.ID, instanceIP.FloatingIP, network))
+			s.floatingIPCreated = true
+			break
 		}
 
-		instanceIP = *newIP
-		ui.Message(fmt.Sprintf("Created floating IP: '%s' (%s)", instanceIP.ID, instanceIP.FloatingIP))
-		state.Put("floatingip_istemp", true)
+		// Tag the new floating IP so that it can be found and reused by
+		// future builds. It is kept after the build for the same reason.
+		if s.ReuseIPs && len(s.FloatingIPTags) > 0 {
+			_, err := attributestags.ReplaceAll(networkClient, "floatingips", instanceIP.ID, attributestags.ReplaceAllOpts{
+				Tags: s.FloatingIPTags,
+			}).Extract()
+			if err != nil {
+				err := fmt.Errorf("Error tagging floating IP '%s' (%s): %s", instanceIP.ID, instanceIP.FloatingIP, err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+
+			ui.Message(fmt.Sprintf("Tagged floating IP '%s' (%s) with %s",
+				instanceIP.ID, instanceIP.FloatingIP, strings.Join(s.FloatingIPTags, ", ")))
+			s.keepFloatingIP = true
+		}
 	}
 
 	// Assoctate a floating IP if it was obtained in the previous steps.
@@ -118,7 +258,24 @@ func (s *StepAllocateIp) Run(ctx context.Context, state multistep.StateBag) mult
 		ui.Say(fmt.Sprintf("Associating floating IP '%s' (%s) with instance port...",
 			instanceIP.ID, instanceIP.FloatingIP))
 
-		portID, err := GetInstancePortID(computeClient, server.ID, s.InstanceFloatingIPNet)
+		var instanceFloatingIPNet string
+		if s.InstanceFloatingIPNet != "" {
+			instanceFloatingIPNet, err = CheckNetwork(networkClient, s.InstanceFloatingIPNet)
+			if err != nil {
+				err := fmt.Errorf("Error using the provided instance_floating_ip_net: %s", err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		} else if network, ok := state.GetOk("communicator_network"); ok {
+			// Bind the floating IP to the port the communicator should use.
+			instanceFloatingIPNet = network.(*networks.Network).ID
+		}
+
+		// Binding the floating IP to a port that isn't ACTIVE yet may leave
+		// it without traffic, even once the port comes up.
+		portID, err := waitForActiveInstancePort(state, computeClient, networkClient, server.ID,
+			instanceFloatingIPNet, s.InstanceFloatingIPNetFallback, s.PortActiveTimeout, config.statePolling())
 		if err != nil {
 			err := fmt.Errorf("Error getting interfaces of the instance '%s': %s", server.ID, err)
 			state.Put("error", err)
@@ -126,38 +283,127 @@ func (s *StepAllocateIp) Run(ctx context.Context, state multistep.StateBag) mult
 			return multistep.ActionHalt
 		}
 
-		_, err = floatingips.Update(networkClient, instanceIP.ID, floatingips.UpdateOpts{
-			PortID: &portID,
-		}).Extract()
-		if err != nil {
-			err := fmt.Errorf(
-				"Error associating floating IP '%s' (%s) with instance port '%s': %s",
-				instanceIP.ID, instanceIP.FloatingIP, portID, err)
-			state.Put("error", err)
-			ui.Error(err.Error())
-			return multistep.ActionHalt
+		// A reused floating IP may be associated by a concurrent build in the
+		// meantime. In that case, look for another free floating IP and retry.
+		for attempt := 1; ; attempt++ {
+			_, err = floatingips.Update(networkClient, instanceIP.ID, floatingips.UpdateOpts{
+				PortID: &portID,
+			}).Extract()
+			if err == nil {
+				s.floatingIPAssociated = true
+				break
+			}
+
+			if _, ok := err.(gophercloud.ErrDefault409); !ok || !reusedIP || attempt > s.AssociateRetries {
+				err := fmt.Errorf(
+					"Error associating floating IP '%s' (%s) with instance port '%s': %s",
+					instanceIP.ID, instanceIP.FloatingIP, portID, err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+
+			ui.Message(fmt.Sprintf(
+				"Floating IP '%s' (%s) was taken by someone else, searching for another one (attempt %d/%d)...",
+				instanceIP.ID, instanceIP.FloatingIP, attempt, s.AssociateRetries))
+			searchOpts.Exclude = append(searchOpts.Exclude, instanceIP.ID)
+
+			// Back off with some jitter so that concurrent builds don't keep
+			// picking the same floating IP.
+			delay := s.AssociateRetryDelay*time.Duration(attempt) +
+				time.Duration(rand.Int63n(int64(s.AssociateRetryDelay)+1))
+			log.Printf("[DEBUG] Waiting %s before retrying floating IP association", delay)
+			select {
+			case <-ctx.Done():
+				state.Put("error", ctx.Err())
+				return multistep.ActionHalt
+			case <-time.After(delay):
+			}
+
+			freeFloatingIP, err := FindFreeFloatingIP(networkClient, searchOpts)
+			if err != nil {
+				err := fmt.Errorf("Error searching for floating IP: %s", err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+
+			instanceIP = *freeFloatingIP
+			ui.Message(fmt.Sprintf("Selected floating IP: '%s' (%s)", instanceIP.ID, instanceIP.FloatingIP))
 		}
 
 		ui.Message(fmt.Sprintf(
 			"Added floating IP '%s' (%s) to instance!", instanceIP.ID, instanceIP.FloatingIP))
+
+		// The floating IP only routes traffic to the instance once it's
+		// ACTIVE, which may take a while on some clouds.
+		ui.Say(fmt.Sprintf("Waiting for floating IP '%s' (%s) to become ACTIVE...",
+			instanceIP.ID, instanceIP.FloatingIP))
+		if err := s.waitForActive(state, networkClient, instanceIP.ID); err != nil {
+			err := fmt.Errorf("Error waiting for floating IP '%s' (%s): %s",
+				instanceIP.ID, instanceIP.FloatingIP, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
 	}
 
 	state.Put("access_ip", &instanceIP)
 	return multistep.ActionContinue
 }
 
+// waitForActive polls the floating IP until its status is ACTIVE. It fails
+// right away if the floating IP ends up in ERROR.
+func (s *StepAllocateIp) waitForActive(state multistep.StateBag, client *gophercloud.ServiceClient, id string) error {
+	config := state.Get("config").(*Config)
+	deadline := time.Now().Add(s.ActiveTimeout)
+	poll := newPoller(config.statePolling())
+	status := "unknown"
+	for {
+		ip, err := floatingips.Get(client, id).Extract()
+		throttled := poll.Throttled(err)
+		if err != nil && !throttled {
+			return err
+		}
+
+		if !throttled {
+			status = ip.Status
+			switch status {
+			case "ACTIVE":
+				return nil
+			case "ERROR":
+				return fmt.Errorf("floating IP status is %s", status)
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout after %s, floating IP status is %s", s.ActiveTimeout, status)
+		}
+
+		if _, ok := state.GetOk(multistep.StateCancelled); ok {
+			return errWaitInterrupted
+		}
+
+		if !throttled {
+			log.Printf("Waiting for floating IP to become ACTIVE, currently %s", status)
+		}
+		poll.Wait()
+	}
+}
+
 func (s *StepAllocateIp) Cleanup(state multistep.StateBag) {
 	config := state.Get("config").(*Config)
 	ui := state.Get("ui").(packersdk.Ui)
 	instanceIP := state.Get("access_ip").(*floatingips.FloatingIP)
 
 	// Don't clean up if unless required
-	if instanceIP.ID == "" && instanceIP.FloatingIP == "" {
+	if instanceIP.ID == "" {
 		return
 	}
 
-	// Don't delete pool addresses we didn't allocate
-	if state.Get("floatingip_istemp") == false {
+	// Floating IPs we didn't allocate are only disassociated, never deleted.
+	deleteIP := s.floatingIPCreated && !s.keepFloatingIP
+	if !deleteIP && !s.floatingIPAssociated {
 		return
 	}
 
@@ -165,11 +411,11 @@ func (s *StepAllocateIp) Cleanup(state multistep.StateBag) {
 	client, err := config.networkV2Client()
 	if err != nil {
 		ui.Error(fmt.Sprintf(
-			"Error deleting temporary floating IP '%s' (%s)", instanceIP.ID, instanceIP.FloatingIP))
+			"Error cleaning up floating IP '%s' (%s)", instanceIP.ID, instanceIP.FloatingIP))
 		return
 	}
 
-	if instanceIP.ID != "" {
+	if deleteIP {
 		if err := floatingips.Delete(client, instanceIP.ID).ExtractErr(); err != nil {
 			ui.Error(fmt.Sprintf(
 				"Error deleting temporary floating IP '%s' (%s)", instanceIP.ID, instanceIP.FloatingIP))
@@ -177,5 +423,19 @@ func (s *StepAllocateIp) Cleanup(state multistep.StateBag) {
 		}
 
 		ui.Say(fmt.Sprintf("Deleted temporary floating IP '%s' (%s)", instanceIP.ID, instanceIP.FloatingIP))
+		return
 	}
+
+	// An empty port ID disassociates the floating IP.
+	portID := ""
+	_, err = floatingips.Update(client, instanceIP.ID, floatingips.UpdateOpts{
+		PortID: &portID,
+	}).Extract()
+	if err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error disassociating floating IP '%s' (%s): %s", instanceIP.ID, instanceIP.FloatingIP, err))
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Disassociated floating IP '%s' (%s)", instanceIP.ID, instanceIP.FloatingIP))
 }
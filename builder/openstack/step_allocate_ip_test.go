@@ -0,0 +1,220 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// testCloud is a fake cloud recording the requests it gets, all the
+// services of its catalog pointing to it.
+type testCloud struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newTestCloud(t *testing.T, handler http.HandlerFunc) *testCloud {
+	cloud := &testCloud{}
+	cloud.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		cloud.mu.Lock()
+		cloud.requests = append(cloud.requests, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, body))
+		cloud.mu.Unlock()
+		if handler != nil {
+			handler(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(cloud.Close)
+	return cloud
+}
+
+// state returns a state bag with a config using the fake cloud.
+func (c *testCloud) state(t *testing.T) multistep.StateBag {
+	config := &Config{}
+	config.osClient = &gophercloud.ProviderClient{
+		EndpointLocator: func(gophercloud.EndpointOpts) (string, error) {
+			return c.URL + "/", nil
+		},
+	}
+	state := new(multistep.BasicStateBag)
+	state.Put("config", config)
+	state.Put("ui", packersdk.TestUi(t))
+	return state
+}
+
+func (c *testCloud) Requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.requests...)
+}
+
+func TestStepAllocateIp_Cleanup(t *testing.T) {
+	cases := []struct {
+		name     string
+		step     StepAllocateIp
+		ipID     string
+		expected []string
+	}{
+		{
+			name:     "fresh allocation",
+			step:     StepAllocateIp{floatingIPCreated: true, floatingIPAssociated: true},
+			ipID:     "fip",
+			expected: []string{"DELETE /v2.0/floatingips/fip "},
+		},
+		{
+			name:     "fresh allocation interrupted before the association",
+			step:     StepAllocateIp{floatingIPCreated: true},
+			ipID:     "fip",
+			expected: []string{"DELETE /v2.0/floatingips/fip "},
+		},
+		{
+			name:     "fresh allocation kept",
+			step:     StepAllocateIp{floatingIPCreated: true, keepFloatingIP: true, floatingIPAssociated: true},
+			ipID:     "fip",
+			expected: []string{`PUT /v2.0/floatingips/fip {"floatingip":{"port_id":null}}`},
+		},
+		{
+			name:     "reuse",
+			step:     StepAllocateIp{floatingIPAssociated: true},
+			ipID:     "fip",
+			expected: []string{`PUT /v2.0/floatingips/fip {"floatingip":{"port_id":null}}`},
+		},
+		{
+			name: "reuse interrupted before the association",
+			step: StepAllocateIp{},
+			ipID: "fip",
+		},
+		{
+			name: "interrupted before any floating IP",
+			step: StepAllocateIp{floatingIPCreated: true},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := newTestCloud(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprint(w, `{"floatingip": {"id": "fip"}}`)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			})
+			state := cloud.state(t)
+			state.Put("access_ip", &floatingips.FloatingIP{ID: tc.ipID, FloatingIP: "192.0.2.10"})
+
+			tc.step.Cleanup(state)
+
+			requests := cloud.Requests()
+			if len(requests) != len(tc.expected) {
+				t.Fatalf("expected requests %q, got %q", tc.expected, requests)
+			}
+			for i := range requests {
+				if requests[i] != tc.expected[i] {
+					t.Fatalf("expected requests %q, got %q", tc.expected, requests)
+				}
+			}
+		})
+	}
+}
+
+func TestStepAllocateIp_AssociateRetries(t *testing.T) {
+	cases := []struct {
+		name      string
+		conflicts int
+		action    multistep.StepAction
+		expected  []string
+	}{
+		{
+			name:      "taken once",
+			conflicts: 1,
+			action:    multistep.ActionContinue,
+			expected:  []string{"PUT /v2.0/floatingips/fip1", "PUT /v2.0/floatingips/fip2"},
+		},
+		{
+			name:      "retries exhausted",
+			conflicts: 3,
+			action:    multistep.ActionHalt,
+			expected:  []string{"PUT /v2.0/floatingips/fip1", "PUT /v2.0/floatingips/fip2", "PUT /v2.0/floatingips/fip3"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			conflicts := tc.conflicts
+			cloud := newTestCloud(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.URL.Path == "/servers/server/os-interface":
+					fmt.Fprint(w, `{"interfaceAttachments": [{"port_id": "port", "net_id": "net"}]}`)
+				case r.URL.Path == "/v2.0/ports/port":
+					fmt.Fprint(w, `{"port": {"id": "port", "status": "ACTIVE"}}`)
+				case r.URL.Path == "/v2.0/floatingips":
+					fmt.Fprint(w, `{"floatingips": [
+						{"id": "fip1", "floating_ip_address": "192.0.2.1", "status": "DOWN"},
+						{"id": "fip2", "floating_ip_address": "192.0.2.2", "status": "DOWN"},
+						{"id": "fip3", "floating_ip_address": "192.0.2.3", "status": "DOWN"}
+					]}`)
+				case r.Method == http.MethodPut:
+					mu.Lock()
+					defer mu.Unlock()
+					if conflicts > 0 {
+						conflicts--
+						w.WriteHeader(http.StatusConflict)
+						fmt.Fprint(w, `{"NeutronError": {"type": "FloatingIPPortAlreadyAssociated"}}`)
+						return
+					}
+					fmt.Fprintf(w, `{"floatingip": {"id": %q, "port_id": "port"}}`, strings.TrimPrefix(r.URL.Path, "/v2.0/floatingips/"))
+				default:
+					fmt.Fprintf(w, `{"floatingip": {"id": %q, "status": "ACTIVE"}}`, strings.TrimPrefix(r.URL.Path, "/v2.0/floatingips/"))
+				}
+			})
+			state := cloud.state(t)
+			state.Put("server", &servers.Server{ID: "server"})
+
+			step := &StepAllocateIp{
+				ReuseIPs:            true,
+				AssociateRetries:    2,
+				AssociateRetryDelay: time.Millisecond,
+				ActiveTimeout:       time.Second,
+				PortActiveTimeout:   time.Second,
+			}
+			if action := step.Run(context.Background(), state); action != tc.action {
+				t.Fatalf("expected action %v, got %v: %v", tc.action, action, state.Get("error"))
+			}
+
+			var associations []string
+			for _, request := range cloud.Requests() {
+				if fields := strings.Fields(request); fields[0] == http.MethodPut {
+					associations = append(associations, fields[0]+" "+fields[1])
+				}
+			}
+			if strings.Join(associations, ", ") != strings.Join(tc.expected, ", ") {
+				t.Fatalf("expected associations %q, got %q", tc.expected, associations)
+			}
+			if tc.action == multistep.ActionContinue {
+				if ip := state.Get("access_ip").(*floatingips.FloatingIP); ip.ID != "fip2" {
+					t.Fatalf("expected floating IP fip2, got %s", ip.ID)
+				}
+			}
+		})
+	}
+}
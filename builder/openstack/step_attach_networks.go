@@ -0,0 +1,105 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/attachinterfaces"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepAttachNetworks hot-attaches an interface on each of the networks once
+// the communicator is connected. The ports of the attached interfaces are put
+// in the state bag for StepDetachNetworks.
+type StepAttachNetworks struct {
+	Networks []string
+}
+
+func (s *StepAttachNetworks) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if len(s.Networks) == 0 {
+		return multistep.ActionContinue
+	}
+
+	config := state.Get("config").(*Config)
+	server := state.Get("server").(*servers.Server)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	// We need the v2 network client
+	networkClient, err := config.networkV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing network client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	var portIDs []string
+	for _, network := range s.Networks {
+		networkID, err := CheckNetwork(networkClient, network)
+		if err != nil {
+			err := fmt.Errorf("Error using the provided attach_networks_after_boot: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		ui.Say(fmt.Sprintf("Attaching network %s to server: %s ...", networkID, server.ID))
+		iface, err := attachinterfaces.Create(computeClient, server.ID, attachinterfaces.CreateOpts{
+			NetworkID: networkID,
+		}).Extract()
+		if err != nil {
+			err := fmt.Errorf("Error attaching network %s: %s", networkID, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		portIDs = append(portIDs, iface.PortID)
+		state.Put("attached_network_ports", portIDs)
+		if err := recordInstancePorts(state, computeClient, server.ID); err != nil {
+			log.Printf("[WARN] Error recording the ports of server %s: %s", server.ID, err)
+		}
+
+		ui.Message(fmt.Sprintf("Waiting for interface to become active: %s ...", iface.PortID))
+		stateChange := StateChangeConf{
+			Pending:   []string{"BUILD", "DOWN"},
+			Target:    []string{"ACTIVE"},
+			Refresh:   InterfaceStateRefreshFunc(computeClient, server.ID, iface.PortID),
+			Poll:      config.statePolling(),
+			StepState: state,
+		}
+		if _, err := WaitForState(&stateChange); err != nil {
+			err := fmt.Errorf("Error waiting for interface (%s) to become active: %s", iface.PortID, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepAttachNetworks) Cleanup(state multistep.StateBag) {
+	ids, ok := state.GetOk("attached_network_ports")
+	if !ok {
+		return
+	}
+
+	if err := detachNetworks(state, ids.([]string)); err != nil {
+		ui := state.Get("ui").(packersdk.Ui)
+		ui.Error(err.Error())
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/volumeattach"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepAttachVolumes attaches the existing attach_volumes volumes to the
+// server. A multiattach volume may be in-use by other servers, such as the
+// ones of concurrent builds, only the attachment to this server is waited for
+// and detached. The attached volumes are put in the state bag for
+// StepDetachVolumes, and detached during cleanup when the build fails before.
+type StepAttachVolumes struct {
+	Volumes []AttachVolume
+}
+
+func (s *StepAttachVolumes) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if len(s.Volumes) == 0 {
+		return multistep.ActionContinue
+	}
+
+	config := state.Get("config").(*Config)
+	server := state.Get("server").(*servers.Server)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	blockStorageClient, err := config.blockStorageV3Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing block storage client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	var volumeIDs []string
+	for _, v := range s.Volumes {
+		volume, err := findVolume(blockStorageClient, v.Volume)
+		if err != nil {
+			err := fmt.Errorf("Error using the provided attach_volumes: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if volume.Status != "available" && !(volume.Status == "in-use" && volume.Multiattach) {
+			err := fmt.Errorf("Error using the provided attach_volumes: volume %s is %s, it must be available or multiattach", volume.ID, volume.Status)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		// Attaching multiattach volumes was added in microversion 2.60.
+		attachClient := computeClient
+		if volume.Multiattach {
+			attachClient, err = config.requireMicroversion(computeClient, "2.60", fmt.Sprintf("Attaching multiattach volume %s", volume.ID))
+			if err != nil {
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		}
+
+		ui.Say(fmt.Sprintf("Attaching volume %s to server: %s ...", volume.ID, server.ID))
+		_, err = volumeattach.Create(attachClient, server.ID, volumeattach.CreateOpts{
+			VolumeID: volume.ID,
+			Device:   v.Device,
+		}).Extract()
+		if err != nil {
+			err := fmt.Errorf("Error attaching volume %s: %s", volume.ID, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		volumeIDs = append(volumeIDs, volume.ID)
+		state.Put("attached_volumes", volumeIDs)
+
+		ui.Message(fmt.Sprintf("Waiting for volume to be attached: %s ...", volume.ID))
+		stateChange := StateChangeConf{
+			Pending:   []string{"reserved", "attaching", "in-use"},
+			Target:    []string{"attached"},
+			Refresh:   volumeAttachmentRefreshFunc(blockStorageClient, volume.ID, server.ID),
+			Poll:      config.statePolling(),
+			StepState: state,
+		}
+		if _, err := WaitForState(&stateChange); err != nil {
+			err := fmt.Errorf("Error waiting for volume (%s) to be attached (%s): %s",
+				volume.ID, volumeAttachmentState(blockStorageClient, volume.ID), err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup detaches the volumes still attached, so they aren't left in-use
+// by the deleted server.
+func (s *StepAttachVolumes) Cleanup(state multistep.StateBag) {
+	ids, ok := state.GetOk("attached_volumes")
+	if !ok {
+		return
+	}
+
+	if err := detachVolumes(state, ids.([]string)); err != nil {
+		ui := state.Get("ui").(packersdk.Ui)
+		ui.Error(err.Error())
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCheckFlavor checks that the flavor, or the Block Storage service volume
+// when booting from one, is large enough for the source image, before any
+// resources are created for the build. The architecture and hardware
+// properties of the source image are checked against the flavor extra specs
+// too, unless PropertiesCheck is skip. With RequireGuestAgent, the source
+// image must enable the QEMU guest agent for a quiesced snapshot, and with
+// LiveSnapshot, a warning is shown when it doesn't require one. The
+// BootProperties must match the source image and the flavor, whatever the
+// PropertiesCheck.
+type StepCheckFlavor struct {
+	PropertiesCheck       string
+	BootProperties        []bootProperty
+	RequireGuestAgent     bool
+	LiveSnapshot          bool
+	UseBlockStorageVolume bool
+	VolumeSize            int
+}
+
+func (s *StepCheckFlavor) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+	flavor := state.Get("flavor").(*flavors.Flavor)
+
+	// There's no source image when booting from a source volume, and no
+	// details when the flavor couldn't be loaded.
+	sourceImage, ok := state.Get("source_image").(string)
+	if !ok && len(s.BootProperties) > 0 {
+		log.Printf("[INFO] No source image, not checking the boot mode")
+	}
+	if !ok || (flavor.Name == "" && !s.RequireGuestAgent && !s.LiveSnapshot && len(s.BootProperties) == 0) {
+		return multistep.ActionContinue
+	}
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	image, err := images.Get(imageClient, sourceImage).Extract()
+	if err != nil {
+		err := fmt.Errorf("Error getting source image %s: %s", sourceImage, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if s.RequireGuestAgent {
+		if err := checkGuestAgent(image); err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if !imagePropertyEnabled(image, "os_require_quiesce") {
+			ui.Error(fmt.Sprintf("Warning: source image %s doesn't set os_require_quiesce, "+
+				"the snapshot isn't quiesced if the guest agent doesn't respond", image.ID))
+		}
+	}
+	if s.LiveSnapshot && !(imagePropertyEnabled(image, "hw_qemu_guest_agent") && imagePropertyEnabled(image, "os_require_quiesce")) {
+		ui.Error(fmt.Sprintf("Warning: source image %s doesn't set hw_qemu_guest_agent and os_require_quiesce, "+
+			"the live snapshot may not be filesystem-consistent", image.ID))
+	}
+	if len(s.BootProperties) > 0 {
+		if err := s.checkBootMode(state, image, flavor); err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+	if flavor.Name == "" {
+		return multistep.ActionContinue
+	}
+
+	if err := s.checkFlavor(image, flavor); err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if s.PropertiesCheck == "skip" {
+		return multistep.ActionContinue
+	}
+
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	extraSpecs, err := flavors.ListExtraSpecs(computeClient, flavor.ID).Extract()
+	if err != nil {
+		log.Printf("[WARN] Error getting the extra specs of flavor %s, not checking the source image properties: %s", flavor.ID, err)
+		return multistep.ActionContinue
+	}
+
+	mismatches := flavorPropertyMismatches(image, extraSpecs)
+	if len(mismatches) == 0 {
+		return multistep.ActionContinue
+	}
+	if s.PropertiesCheck == "error" {
+		err := fmt.Errorf("Source image %s doesn't match flavor %s: %s",
+			image.ID, flavor.Name, strings.Join(mismatches, "; "))
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Error(fmt.Sprintf("Warning: source image %s may not boot with flavor %s: %s",
+		image.ID, flavor.Name, strings.Join(mismatches, "; ")))
+
+	return multistep.ActionContinue
+}
+
+// flavorPropertyMismatches compares the architecture, hw_machine_type and
+// hw_firmware_type properties of the image with the flavor extra specs. Only
+// the properties set on both sides are compared.
+func flavorPropertyMismatches(image *images.Image, extraSpecs map[string]string) []string {
+	var mismatches []string
+
+	if arch, _ := image.Properties["architecture"].(string); arch != "" {
+		arch = normalizeArchitecture(arch)
+		for key, value := range extraSpecs {
+			var flavorArch string
+			switch {
+			case key == "capabilities:cpu_info:arch":
+				// The value may be prefixed with an operator, e.g. "s== x86_64".
+				fields := strings.Fields(value)
+				if len(fields) > 0 {
+					flavorArch = normalizeArchitecture(fields[len(fields)-1])
+				}
+			case strings.HasPrefix(key, "trait:HW_ARCH_") && value == "required":
+				flavorArch = normalizeArchitecture(strings.TrimPrefix(key, "trait:HW_ARCH_"))
+			}
+			if flavorArch != "" && flavorArch != arch {
+				mismatches = append(mismatches, fmt.Sprintf("image architecture is %s, flavor %s is %s", arch, key, value))
+			}
+		}
+	}
+
+	for _, property := range []string{"hw_machine_type", "hw_firmware_type"} {
+		value, _ := image.Properties[property].(string)
+		key := "hw:" + strings.TrimPrefix(property, "hw_")
+		if flavorValue, ok := extraSpecs[key]; ok && value != "" && !strings.EqualFold(value, flavorValue) {
+			mismatches = append(mismatches, fmt.Sprintf("image %s is %s, flavor %s is %s", property, value, key, flavorValue))
+		}
+	}
+
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// checkBootMode checks that the source image and the flavor boot the server
+// the way the BootProperties require.
+func (s *StepCheckFlavor) checkBootMode(state multistep.StateBag, image *images.Image, flavor *flavors.Flavor) error {
+	config := state.Get("config").(*Config)
+
+	var extraSpecs map[string]string
+	computeClient, err := config.computeV2Client()
+	if err == nil {
+		extraSpecs, err = flavors.ListExtraSpecs(computeClient, flavor.ID).Extract()
+	}
+	if err != nil {
+		log.Printf("[WARN] Error getting the extra specs of flavor %s, only checking the source image boot mode: %s", flavor.ID, err)
+	}
+
+	// The volume created from the source image is given the properties.
+	mismatches := bootModeMismatches(s.BootProperties, image, extraSpecs, s.UseBlockStorageVolume)
+	if len(mismatches) > 0 {
+		return fmt.Errorf("Source image %s and flavor %s don't boot as requested: %s",
+			image.ID, flavor.ID, strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// bootModeMismatches compares the boot mode properties with the ones of the
+// image and the flavor extra specs, which must not set other values, nor
+// forbid the trait the property requires. Unless they're set on the volume
+// the server boots from, the properties other than the BIOS firmware must be
+// set by the image or the flavor, or the server would boot without them.
+func bootModeMismatches(props []bootProperty, image *images.Image, extraSpecs map[string]string, volumeProperties bool) []string {
+	var mismatches []string
+	for _, p := range props {
+		imageValue, _ := image.Properties[p.Property].(string)
+		if imageValue != "" && !strings.EqualFold(imageValue, p.Value) {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %s, image %s is %s", p.Option, p.Value, p.Property, imageValue))
+		}
+		flavorValue := extraSpecs[p.ExtraSpec]
+		if flavorValue != "" && !strings.EqualFold(flavorValue, p.Value) {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %s, flavor %s is %s", p.Option, p.Value, p.ExtraSpec, flavorValue))
+		}
+		if p.Trait != "" && extraSpecs["trait:"+p.Trait] == "forbidden" {
+			mismatches = append(mismatches, fmt.Sprintf("%s requires the %s trait, which the flavor forbids", p.Option, p.Trait))
+		}
+		if imageValue == "" && flavorValue == "" && !volumeProperties && !(p.Property == "hw_firmware_type" && p.Value == "bios") {
+			mismatches = append(mismatches, fmt.Sprintf("%s requires image %s or flavor %s to be %s", p.Option, p.Property, p.ExtraSpec, p.Value))
+		}
+	}
+	return mismatches
+}
+
+// checkGuestAgent checks that the image enables the QEMU guest agent, which
+// the Compute service quiesces the server through.
+func checkGuestAgent(image *images.Image) error {
+	if !imagePropertyEnabled(image, "hw_qemu_guest_agent") {
+		return fmt.Errorf("Source image %s doesn't set hw_qemu_guest_agent to yes, "+
+			"which the quiesce snapshot_consistency requires", image.ID)
+	}
+	return nil
+}
+
+// imagePropertyEnabled tells whether the boolean image property is set,
+// the Image service accepting both yes and true.
+func imagePropertyEnabled(image *images.Image, property string) bool {
+	switch value := image.Properties[property].(type) {
+	case string:
+		return strings.EqualFold(value, "yes") || strings.EqualFold(value, "true")
+	case bool:
+		return value
+	}
+	return false
+}
+
+// normalizeArchitecture returns the Glance name of the given architecture.
+func normalizeArchitecture(arch string) string {
+	arch = strings.ToLower(arch)
+	switch arch {
+	case "amd64", "x64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	}
+	return arch
+}
+
+func (s *StepCheckFlavor) checkFlavor(image *images.Image, flavor *flavors.Flavor) error {
+	if image.MinRAMMegabytes > flavor.RAM {
+		return fmt.Errorf("Source image %s requires %dMB RAM, flavor %s has %dMB",
+			image.ID, image.MinRAMMegabytes, flavor.Name, flavor.RAM)
+	}
+
+	// The volume size is derived from the source image when it isn't set.
+	if s.UseBlockStorageVolume {
+		if s.VolumeSize > 0 && image.MinDiskGigabytes > s.VolumeSize {
+			return fmt.Errorf("Source image %s requires %dGB disk, volume_size is %dGB",
+				image.ID, image.MinDiskGigabytes, s.VolumeSize)
+		}
+		return nil
+	}
+
+	// Flavors without a disk size boot with a disk sized to the image.
+	if flavor.Disk == 0 {
+		return nil
+	}
+	if image.MinDiskGigabytes > flavor.Disk {
+		return fmt.Errorf("Source image %s requires %dGB disk, flavor %s has %dGB",
+			image.ID, image.MinDiskGigabytes, flavor.Name, flavor.Disk)
+	}
+	if image.SizeBytes > int64(flavor.Disk)*1024*1024*1024 {
+		return fmt.Errorf("Source image %s is %d bytes, larger than the %dGB disk of flavor %s",
+			image.ID, image.SizeBytes, flavor.Disk, flavor.Name)
+	}
+	return nil
+}
+
+func (s *StepCheckFlavor) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,100 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+func TestFlavorPropertyMismatches(t *testing.T) {
+	cases := []struct {
+		name       string
+		properties map[string]interface{}
+		extraSpecs map[string]string
+		expected   []string
+	}{
+		{
+			name:       "no properties",
+			extraSpecs: map[string]string{"capabilities:cpu_info:arch": "x86_64", "hw:machine_type": "q35"},
+		},
+		{
+			name:       "no extra specs",
+			properties: map[string]interface{}{"architecture": "aarch64", "hw_machine_type": "virt"},
+		},
+		{
+			name:       "same architecture",
+			properties: map[string]interface{}{"architecture": "x86_64"},
+			extraSpecs: map[string]string{"capabilities:cpu_info:arch": "x86_64"},
+		},
+		{
+			name:       "architecture aliases",
+			properties: map[string]interface{}{"architecture": "amd64"},
+			extraSpecs: map[string]string{"capabilities:cpu_info:arch": "s== X86_64", "trait:HW_ARCH_X86_64": "required"},
+		},
+		{
+			name:       "different architecture",
+			properties: map[string]interface{}{"architecture": "arm64"},
+			extraSpecs: map[string]string{"capabilities:cpu_info:arch": "s== x86_64"},
+			expected:   []string{"image architecture is aarch64, flavor capabilities:cpu_info:arch is s== x86_64"},
+		},
+		{
+			name:       "required architecture trait",
+			properties: map[string]interface{}{"architecture": "x86_64"},
+			extraSpecs: map[string]string{"trait:HW_ARCH_AARCH64": "required"},
+			expected:   []string{"image architecture is x86_64, flavor trait:HW_ARCH_AARCH64 is required"},
+		},
+		{
+			name:       "forbidden architecture trait",
+			properties: map[string]interface{}{"architecture": "x86_64"},
+			extraSpecs: map[string]string{"trait:HW_ARCH_AARCH64": "forbidden"},
+		},
+		{
+			name:       "same machine type and firmware",
+			properties: map[string]interface{}{"hw_machine_type": "Q35", "hw_firmware_type": "uefi"},
+			extraSpecs: map[string]string{"hw:machine_type": "q35", "hw:firmware_type": "uefi"},
+		},
+		{
+			name:       "different machine type and firmware",
+			properties: map[string]interface{}{"hw_machine_type": "pc", "hw_firmware_type": "bios"},
+			extraSpecs: map[string]string{"hw:machine_type": "q35", "hw:firmware_type": "uefi"},
+			expected: []string{
+				"image hw_firmware_type is bios, flavor hw:firmware_type is uefi",
+				"image hw_machine_type is pc, flavor hw:machine_type is q35",
+			},
+		},
+	}
+	for _, tc := range cases {
+		image := &images.Image{Properties: tc.properties}
+		if mismatches := flavorPropertyMismatches(image, tc.extraSpecs); !reflect.DeepEqual(mismatches, tc.expected) {
+			t.Errorf("%s: expected mismatches %q, got %q", tc.name, tc.expected, mismatches)
+		}
+	}
+}
+
+func TestBootModeMismatches(t *testing.T) {
+	c := testImageConfig()
+	c.BootFirmware = "uefi"
+	c.VTPM = true
+	props := c.bootProperties()
+
+	image := &images.Image{Properties: map[string]interface{}{"hw_firmware_type": "uefi"}}
+	extraSpecs := map[string]string{"hw:tpm_version": "2.0"}
+	if mismatches := bootModeMismatches(props, image, extraSpecs, false); len(mismatches) != 0 {
+		t.Fatalf("shouldn't have mismatches: %v", mismatches)
+	}
+
+	image = &images.Image{Properties: map[string]interface{}{"hw_firmware_type": "bios"}}
+	extraSpecs = map[string]string{"trait:COMPUTE_SECURITY_TPM_2_0": "forbidden"}
+	if mismatches := bootModeMismatches(props, image, extraSpecs, false); len(mismatches) != 3 {
+		t.Fatalf("bios image, forbidden trait and missing TPM should mismatch: %v", mismatches)
+	}
+
+	image = &images.Image{Properties: map[string]interface{}{}}
+	if mismatches := bootModeMismatches(props, image, nil, true); len(mismatches) != 0 {
+		t.Fatalf("properties set on the volume shouldn't mismatch: %v", mismatches)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/quotas"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCheckFloatingIPQuota makes sure a floating IP can be allocated before
+// anything is created, rather than failing once the server is running.
+type StepCheckFloatingIPQuota struct {
+	Skip               bool
+	FloatingIPNetworks []string
+	ForceNewFloatingIP bool
+	FloatingIP         string
+	ReuseIPs           bool
+	FloatingIPTags     []string
+}
+
+func (s *StepCheckFloatingIPQuota) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	// The check only matters when a new floating IP may be allocated, reuse_ips
+	// allocates one from the external network when none is free.
+	if s.Skip || s.FloatingIP != "" || (!s.ForceNewFloatingIP && !s.ReuseIPs && len(s.FloatingIPNetworks) == 0) {
+		return multistep.ActionContinue
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 network client
+	networkClient, err := config.networkV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing network client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	// A free floating IP will be reused, whatever the quota.
+	if s.ReuseIPs {
+		_, err := FindFreeFloatingIP(networkClient, FreeFloatingIPOpts{Tags: s.FloatingIPTags})
+		if err == nil {
+			return multistep.ActionContinue
+		}
+		log.Printf("[DEBUG] No free floating IP to reuse: %s", err)
+	}
+
+	projectID, err := config.projectID()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Skipping floating IP quota check: %s", err))
+		return multistep.ActionContinue
+	}
+
+	quota, err := quotas.Get(networkClient, projectID).Extract()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Skipping floating IP quota check, unable to get the quota: %s", err))
+		return multistep.ActionContinue
+	}
+	if quota.FloatingIP < 0 {
+		return multistep.ActionContinue
+	}
+
+	allPages, err := floatingips.List(networkClient, floatingips.ListOpts{
+		ProjectID: projectID,
+	}).AllPages()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Skipping floating IP quota check, unable to list floating IPs: %s", err))
+		return multistep.ActionContinue
+	}
+	allFloatingIPs, err := floatingips.ExtractFloatingIPs(allPages)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Skipping floating IP quota check, unable to list floating IPs: %s", err))
+		return multistep.ActionContinue
+	}
+
+	log.Printf("[INFO] Floating IP usage: %d/%d", len(allFloatingIPs), quota.FloatingIP)
+	if len(allFloatingIPs) >= quota.FloatingIP {
+		hint := "free an address or enable reuse_ips"
+		if s.ReuseIPs && len(s.FloatingIPTags) > 0 {
+			hint = "free an address or tag a free one with the floating_ip_tags"
+		} else if s.ReuseIPs {
+			hint = "free an address"
+		}
+		err := fmt.Errorf("Floating IP quota exhausted (%d/%d); %s",
+			len(allFloatingIPs), quota.FloatingIP, hint)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCheckFloatingIPQuota) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,103 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepCheckFloatingIPQuota(t *testing.T) {
+	used := `{"floatingips": [
+		{"id": "fip1", "floating_ip_address": "192.0.2.1", "port_id": "port1", "status": "ACTIVE"},
+		{"id": "fip2", "floating_ip_address": "192.0.2.2", "port_id": "port2", "status": "ACTIVE"}
+	]}`
+	free := `{"floatingips": [
+		{"id": "fip1", "floating_ip_address": "192.0.2.1", "port_id": "port1", "status": "ACTIVE"},
+		{"id": "fip2", "floating_ip_address": "192.0.2.2", "status": "DOWN"}
+	]}`
+
+	cases := []struct {
+		name        string
+		step        StepCheckFloatingIPQuota
+		quota       int
+		floatingIPs string
+		err         string
+	}{
+		{
+			name:        "quota exhausted",
+			step:        StepCheckFloatingIPQuota{FloatingIPNetworks: []string{"public"}},
+			quota:       2,
+			floatingIPs: used,
+			err:         "Floating IP quota exhausted (2/2); free an address or enable reuse_ips",
+		},
+		{
+			name:        "quota exhausted without free floating IP",
+			step:        StepCheckFloatingIPQuota{ReuseIPs: true},
+			quota:       2,
+			floatingIPs: used,
+			err:         "Floating IP quota exhausted (2/2); free an address",
+		},
+		{
+			name:        "quota exhausted without tagged floating IP",
+			step:        StepCheckFloatingIPQuota{ReuseIPs: true, FloatingIPTags: []string{"packer"}},
+			quota:       2,
+			floatingIPs: used,
+			err:         "Floating IP quota exhausted (2/2); free an address or tag a free one with the floating_ip_tags",
+		},
+		{
+			name:        "free floating IP reused",
+			step:        StepCheckFloatingIPQuota{ReuseIPs: true},
+			quota:       2,
+			floatingIPs: free,
+		},
+		{
+			name:        "unlimited quota",
+			step:        StepCheckFloatingIPQuota{FloatingIPNetworks: []string{"public"}},
+			quota:       -1,
+			floatingIPs: used,
+		},
+		{
+			name:        "quota left",
+			step:        StepCheckFloatingIPQuota{FloatingIPNetworks: []string{"public"}},
+			quota:       3,
+			floatingIPs: used,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := newTestCloud(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/v2.0/quotas/project":
+					fmt.Fprintf(w, `{"quota": {"floatingip": %d}}`, tc.quota)
+				case "/v2.0/floatingips":
+					fmt.Fprint(w, tc.floatingIPs)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+			state := cloud.state(t)
+			state.Get("config").(*Config).TenantID = "project"
+
+			action := tc.step.Run(context.Background(), state)
+			if tc.err == "" {
+				if action != multistep.ActionContinue {
+					t.Fatalf("expected to continue, got %v", state.Get("error"))
+				}
+				return
+			}
+			if action != multistep.ActionHalt {
+				t.Fatalf("expected to halt")
+			}
+			if err := state.Get("error").(error); err.Error() != tc.err {
+				t.Fatalf("expected error %q, got %q", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/attachinterfaces"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCleanupPorts deletes the ports that were created because of the build
+// and are still around once the source server is gone, for example when
+// Nova didn't delete them or the build was interrupted. It runs before the
+// server is launched, so that its cleanup runs after the server deletion.
+type StepCleanupPorts struct {
+	// The pre-existing ports the instance is attached to, they are never
+	// deleted.
+	Ports []string
+}
+
+func (s *StepCleanupPorts) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	return multistep.ActionContinue
+}
+
+func (s *StepCleanupPorts) Cleanup(state multistep.StateBag) {
+	var portIDs []string
+	if ids, ok := state.GetOk("instance_port_ids"); ok {
+		portIDs = ids.([]string)
+	}
+	serverID, hasServer := state.GetOk("source_server_id")
+	if len(portIDs) == 0 && !hasServer {
+		return
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	networkClient, err := config.networkV2Client()
+	if err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error cleaning up instance ports. Please delete the ports manually: %v", portIDs))
+		return
+	}
+
+	// Ports Nova didn't delete may still reference the server.
+	if hasServer {
+		leftPorts, err := serverPorts(networkClient, serverID.(string))
+		if err != nil {
+			log.Printf("[WARN] Error listing ports of server %s: %s", serverID, err)
+		}
+		for _, port := range leftPorts {
+			if !containsString(portIDs, port.ID) {
+				portIDs = append(portIDs, port.ID)
+			}
+		}
+	}
+
+	for _, portID := range portIDs {
+		if containsString(s.Ports, portID) {
+			continue
+		}
+
+		port, err := ports.Get(networkClient, portID).Extract()
+		if err != nil {
+			if _, ok := err.(gophercloud.ErrDefault404); !ok {
+				log.Printf("[WARN] Error getting instance port %s: %s", portID, err)
+			}
+			continue
+		}
+		// The port may have been attached to something else in the meantime.
+		if port.DeviceID != "" && (!hasServer || port.DeviceID != serverID.(string)) {
+			log.Printf("[INFO] Not deleting port %s, attached to device %s", portID, port.DeviceID)
+			continue
+		}
+
+		ui.Say(fmt.Sprintf("Deleting leftover instance port: %s ...", portID))
+		if err := ports.Delete(networkClient, portID).ExtractErr(); err != nil {
+			if _, ok := err.(gophercloud.ErrDefault404); !ok {
+				ui.Error(fmt.Sprintf(
+					"Error cleaning up port. Please delete the port manually: %s", portID))
+			}
+		}
+	}
+}
+
+// serverPorts returns the ports whose device is the given server.
+func serverPorts(client *gophercloud.ServiceClient, serverID string) ([]ports.Port, error) {
+	allPages, err := ports.List(client, ports.ListOpts{
+		DeviceID: serverID,
+	}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	return ports.ExtractPorts(allPages)
+}
+
+// recordInstancePorts records the ports the server is attached to, so that
+// StepCleanupPorts can delete them if they outlive the server.
+func recordInstancePorts(state multistep.StateBag, client *gophercloud.ServiceClient, serverID string) error {
+	interfacesPage, err := attachinterfaces.List(client, serverID).AllPages()
+	if err != nil {
+		return err
+	}
+	interfaces, err := attachinterfaces.ExtractInterfaces(interfacesPage)
+	if err != nil {
+		return err
+	}
+
+	var portIDs []string
+	if ids, ok := state.GetOk("instance_port_ids"); ok {
+		portIDs = ids.([]string)
+	}
+	for _, iface := range interfaces {
+		if !containsString(portIDs, iface.PortID) {
+			portIDs = append(portIDs, iface.PortID)
+		}
+	}
+
+	state.Put("instance_port_ids", portIDs)
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCommunicatorNetwork resolves the network the communicator connects
+// through and makes sure the instance is attached to it. The network is put
+// in the state bag for the floating IP association and the host lookup.
+type StepCommunicatorNetwork struct {
+	Network string
+}
+
+func (s *StepCommunicatorNetwork) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if s.Network == "" {
+		return multistep.ActionContinue
+	}
+
+	config := state.Get("config").(*Config)
+	server := state.Get("server").(*servers.Server)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	// We need the v2 network client
+	networkClient, err := config.networkV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing network client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	networkID, err := CheckNetwork(networkClient, s.Network)
+	if err != nil {
+		err := fmt.Errorf("Error using the provided communicator_network: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	network, err := networks.Get(networkClient, networkID).Extract()
+	if err != nil {
+		err := fmt.Errorf("Error getting communicator_network '%s': %s", networkID, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if _, err := GetInstancePortID(computeClient, server.ID, network.ID, false); err != nil {
+		err := fmt.Errorf("Error using the provided communicator_network: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf("Using communicator network: %s (%s)", network.Name, network.ID))
+	state.Put("communicator_network", network)
+	return multistep.ActionContinue
+}
+
+func (s *StepCommunicatorNetwork) Cleanup(state multistep.StateBag) {}
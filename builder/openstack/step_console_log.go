@@ -0,0 +1,92 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepConsoleLog saves the console log of the server to Path when the build
+// fails, during cleanup before the server is deleted. The Compute service
+// returning 409 for a stopped or shelved server, the console log fetched
+// before the server is stopped is saved instead.
+type StepConsoleLog struct {
+	Enabled bool
+	Path    string
+	Lines   int
+}
+
+func (s *StepConsoleLog) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	return multistep.ActionContinue
+}
+
+func (s *StepConsoleLog) Cleanup(state multistep.StateBag) {
+	if !s.Enabled {
+		return
+	}
+	if _, ok := state.GetOk(multistep.StateHalted); !ok {
+		return
+	}
+	serverID, ok := state.Get("instance_id").(string)
+	if !ok || serverID == "" {
+		return
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error initializing compute client: %s", err))
+		return
+	}
+
+	output, err := consoleLog(computeClient, serverID, s.Lines)
+	if err != nil {
+		cached, ok := state.Get("console_log").(string)
+		if !ok {
+			ui.Error(fmt.Sprintf("Warning: error getting the console log of server %s: %s", serverID, err))
+			return
+		}
+		log.Printf("[INFO] Error getting the console log of server %s, saving the one fetched before it was stopped: %s", serverID, err)
+		output = cached
+	}
+
+	if err := os.WriteFile(s.Path, []byte(output), 0600); err != nil {
+		ui.Error(fmt.Sprintf("Warning: error saving the console log of server %s to %s: %s", serverID, s.Path, err))
+		return
+	}
+	ui.Error(fmt.Sprintf("Console log of server %s saved to: %s", serverID, s.Path))
+}
+
+// consoleLog returns the last lines of the console log of the server, or
+// the whole console log when lines is 0.
+func consoleLog(client *gophercloud.ServiceClient, serverID string, lines int) (string, error) {
+	return servers.ShowConsoleOutput(client, serverID, servers.ShowConsoleOutputOpts{
+		Length: lines,
+	}).Extract()
+}
+
+// saveConsoleLogBeforeStop keeps the console log of the server in the state
+// bag for StepConsoleLog, before the server is stopped or shelved.
+func saveConsoleLogBeforeStop(state multistep.StateBag, client *gophercloud.ServiceClient, serverID string) {
+	config := state.Get("config").(*Config)
+	if !config.OnFailureConsoleLog {
+		return
+	}
+	output, err := consoleLog(client, serverID, config.ConsoleLogLines)
+	if err != nil {
+		log.Printf("[WARN] Error getting the console log of server %s before stopping it: %s", serverID, err)
+		return
+	}
+	state.Put("console_log", output)
+}
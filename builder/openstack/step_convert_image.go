@@ -0,0 +1,303 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/imagedata"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/imageimport"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepConvertImage converts the snapshot to image_disk_format when it has
+// another format, or imports it when image_use_import is true. The snapshot
+// is imported into a new image through the Glance interoperable import,
+// which converts it when the glance-image-conversion plugin is enabled. The
+// snapshot is deleted once the imported image is active, and the imported
+// image becomes the artifact.
+type stepConvertImage struct{}
+
+func (s *stepConvertImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	// Volume based images are uploaded by Cinder in image_disk_format.
+	if config.SkipCreateImage || ((config.ImageDiskFormat == "" || config.UseBlockStorageVolume) && !config.ImageUseImport) {
+		return multistep.ActionContinue
+	}
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	snapshotId := state.Get("image").(string)
+	snapshot, err := images.Get(imageClient, snapshotId).Extract()
+	if err != nil {
+		err := fmt.Errorf("Error getting image %s: %s", snapshotId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	diskFormat := config.ImageDiskFormat
+	if diskFormat == "" || config.UseBlockStorageVolume {
+		diskFormat = snapshot.DiskFormat
+	}
+	if snapshot.DiskFormat == diskFormat {
+		if !config.ImageUseImport {
+			log.Printf("[INFO] Image %s already has disk format %s", snapshotId, snapshot.DiskFormat)
+			return multistep.ActionContinue
+		}
+		ui.Say(fmt.Sprintf("Importing image %s...", snapshotId))
+	} else {
+		ui.Say(fmt.Sprintf("Converting image %s from %s to %s...", snapshotId, snapshot.DiskFormat, diskFormat))
+	}
+	convertCtx, cancel := context.WithTimeout(ctx, config.ImageConversionTimeout)
+	defer cancel()
+
+	createOpts := images.CreateOpts{
+		Name:            config.ImageName,
+		ContainerFormat: snapshot.ContainerFormat,
+		MinDisk:         snapshot.MinDiskGigabytes,
+		MinRAM:          snapshot.MinRAMMegabytes,
+		Properties:      state.Get("image_metadata").(map[string]string),
+	}
+
+	imageId, err := importConvertedImage(convertCtx, imageClient, snapshot, createOpts, diskFormat, config.statePolling())
+	if err != nil && config.ImageConversionLocalFallback {
+		ui.Message(fmt.Sprintf("Glance couldn't convert the image, converting it locally: %s", err))
+		imageId, err = uploadConvertedImage(convertCtx, imageClient, snapshot, createOpts, diskFormat, config.statePolling())
+	}
+	if err != nil {
+		err := fmt.Errorf("Error converting image %s: %s", snapshotId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf("Imported image: %s", imageId))
+	state.Put("image", imageId)
+
+	ui.Say(fmt.Sprintf("Deleting intermediate image: %s", snapshotId))
+	if err := images.Delete(imageClient, snapshotId).ExtractErr(); err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error deleting intermediate image. Please delete the image manually: %s", snapshotId))
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepConvertImage) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
+
+// importConvertedImage imports the snapshot data into a new image through
+// the glance-direct import method, and checks that Glance converted it to
+// image_disk_format.
+func importConvertedImage(ctx context.Context, client *gophercloud.ServiceClient, snapshot *images.Image, createOpts images.CreateOpts, diskFormat string, polling pollConfig) (string, error) {
+	info, err := imageimport.Get(client).Extract()
+	if err != nil {
+		return "", fmt.Errorf("error getting the image import methods: %s", err)
+	}
+	if !containsString(info.ImportMethods.Value, string(imageimport.GlanceDirectMethod)) {
+		return "", fmt.Errorf("the %s import method isn't available", imageimport.GlanceDirectMethod)
+	}
+
+	// The image is created with the snapshot format, the conversion plugin
+	// updates it to the format it converted the data to.
+	createOpts.DiskFormat = snapshot.DiskFormat
+	image, err := createConvertedImage(client, createOpts)
+	if err != nil {
+		return "", err
+	}
+
+	err = func() error {
+		data, err := imagedata.Download(client, snapshot.ID).Extract()
+		if err != nil {
+			return fmt.Errorf("error downloading image %s: %s", snapshot.ID, err)
+		}
+		defer data.Close()
+
+		log.Printf("[INFO] Staging image %s into image %s", snapshot.ID, image.ID)
+		if err := imagedata.Stage(client, image.ID, data).ExtractErr(); err != nil {
+			return fmt.Errorf("error staging image %s: %s", image.ID, err)
+		}
+
+		err = imageimport.Create(client, image.ID, imageimport.CreateOpts{
+			Name: imageimport.GlanceDirectMethod,
+		}).ExtractErr()
+		if err != nil {
+			return fmt.Errorf("error importing image %s: %s", image.ID, err)
+		}
+
+		if err := waitForImageImport(ctx, client, image.ID, polling); err != nil {
+			return fmt.Errorf("error waiting for image %s: %s", image.ID, err)
+		}
+
+		converted, err := images.Get(client, image.ID).Extract()
+		if err != nil {
+			return fmt.Errorf("error getting image %s: %s", image.ID, err)
+		}
+		if converted.DiskFormat != diskFormat {
+			return fmt.Errorf("the imported image has disk format %s, the glance-image-conversion plugin "+
+				"isn't enabled or converts to another format", converted.DiskFormat)
+		}
+		return nil
+	}()
+	if err != nil {
+		deleteConvertedImage(client, image.ID)
+		return "", err
+	}
+
+	return image.ID, nil
+}
+
+// uploadConvertedImage downloads the snapshot, converts it with qemu-img
+// and uploads the result into a new image.
+func uploadConvertedImage(ctx context.Context, client *gophercloud.ServiceClient, snapshot *images.Image, createOpts images.CreateOpts, diskFormat string, polling pollConfig) (string, error) {
+	dir, err := os.MkdirTemp("", "packer-openstack-image")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+	target := filepath.Join(dir, "target")
+
+	if err := downloadImage(client, snapshot.ID, source); err != nil {
+		return "", fmt.Errorf("error downloading image %s: %s", snapshot.ID, err)
+	}
+
+	cmd := exec.CommandContext(ctx, "qemu-img", "convert",
+		"-f", snapshot.DiskFormat, "-O", diskFormat, source, target)
+	log.Printf("[INFO] Running %s", cmd.String())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("error running qemu-img: %s: %s", err, output)
+	}
+
+	createOpts.DiskFormat = diskFormat
+	image, err := createConvertedImage(client, createOpts)
+	if err != nil {
+		return "", err
+	}
+
+	err = func() error {
+		data, err := os.Open(target)
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+
+		log.Printf("[INFO] Uploading converted image into image %s", image.ID)
+		if err := imagedata.Upload(client, image.ID, data).ExtractErr(); err != nil {
+			return fmt.Errorf("error uploading image %s: %s", image.ID, err)
+		}
+
+		if err := WaitForImage(ctx, nil, client, image.ID, polling); err != nil {
+			return fmt.Errorf("error waiting for image %s: %s", image.ID, err)
+		}
+		return nil
+	}()
+	if err != nil {
+		deleteConvertedImage(client, image.ID)
+		return "", err
+	}
+
+	return image.ID, nil
+}
+
+// waitForImageImport waits for the import of the given image to finish. The
+// build fails with the message of the import task when the import fails.
+func waitForImageImport(ctx context.Context, client *gophercloud.ServiceClient, imageId string, polling pollConfig) error {
+	poll := newPoller(polling)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		image, err := images.Get(client, imageId).Extract()
+		if poll.Throttled(err) {
+			poll.Wait()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if image.Status == images.ImageStatusActive {
+			return nil
+		}
+		if image.Status == images.ImageStatusKilled {
+			return fmt.Errorf("the image was killed while importing")
+		}
+
+		var tasks struct {
+			Tasks []struct {
+				ID      string `json:"id"`
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"tasks"`
+		}
+		// The tasks of an image are only listed by Glance since Wallaby.
+		_, err = client.Get(client.ServiceURL("images", imageId, "tasks"), &tasks, nil)
+		if err != nil {
+			log.Printf("[DEBUG] Error getting the import tasks of image %s: %s", imageId, err)
+		}
+		for _, task := range tasks.Tasks {
+			if task.Status == "failure" {
+				return fmt.Errorf("import task %s failed: %s", task.ID, task.Message)
+			}
+		}
+
+		log.Printf("Waiting for image %s import, status: %s", imageId, image.Status)
+		poll.Wait()
+	}
+}
+
+func createConvertedImage(client *gophercloud.ServiceClient, createOpts images.CreateOpts) (*images.Image, error) {
+	image, err := images.Create(client, createOpts).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("error creating image: %s", err)
+	}
+
+	log.Printf("[INFO] Created image %s with disk format %s", image.ID, createOpts.DiskFormat)
+	return image, nil
+}
+
+func deleteConvertedImage(client *gophercloud.ServiceClient, imageId string) {
+	log.Printf("[INFO] Deleting partially converted image %s", imageId)
+	if err := images.Delete(client, imageId).ExtractErr(); err != nil {
+		log.Printf("[WARN] Error deleting image %s: %s", imageId, err)
+	}
+}
+
+func downloadImage(client *gophercloud.ServiceClient, imageId, path string) error {
+	data, err := imagedata.Download(client, imageId).Extract()
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,188 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/imagedata"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepCopyImageRegions copies the image to image_copy_regions. The image data
+// is streamed from the build region into a new image in each region. The
+// copies that succeeded are kept when another region fails, but are only
+// hidden, protected or deactivated once every region succeeded, so that they
+// can still be deleted.
+type stepCopyImageRegions struct{}
+
+func (s *stepCopyImageRegions) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	if config.SkipCreateImage || len(config.ImageCopyRegions) == 0 {
+		return multistep.ActionContinue
+	}
+
+	imageId := state.Get("image").(string)
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	image, err := images.Get(imageClient, imageId).Extract()
+	if err != nil {
+		err := fmt.Errorf("Error getting image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	createOpts := images.CreateOpts{
+		Name:            image.Name,
+		Tags:            config.ImageTags,
+		ContainerFormat: image.ContainerFormat,
+		DiskFormat:      image.DiskFormat,
+		MinDisk:         image.MinDiskGigabytes,
+		MinRAM:          image.MinRAMMegabytes,
+		Properties:      state.Get("image_metadata").(map[string]string),
+	}
+	// Members are project specific, a shared copy has no members yet.
+	if config.ImageVisibility != "" {
+		visibility := config.ImageVisibility
+		createOpts.Visibility = &visibility
+	}
+
+	copies := make(map[string]string, len(config.ImageCopyRegions))
+	var failed []string
+	for _, region := range config.ImageCopyRegions {
+		ui.Say(fmt.Sprintf("Copying image %s to region %s...", imageId, region))
+		copyId, err := copyImageToRegion(ctx, ui, config, imageClient, image, region, createOpts)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Error copying image %s to region %s: %s", imageId, region, err))
+			failed = append(failed, region)
+			continue
+		}
+
+		ui.Message(fmt.Sprintf("Image copy in region %s: %s", region, copyId))
+		copies[region] = copyId
+	}
+	state.Put("image_copies", copies)
+
+	if len(failed) > 0 {
+		err := fmt.Errorf("Error copying image %s to regions: %s", imageId, strings.Join(failed, ", "))
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	for _, region := range config.ImageCopyRegions {
+		if err := finishImageCopy(ctx, config, region, copies[region]); err != nil {
+			err := fmt.Errorf("Error updating image copy %s in region %s: %s", copies[region], region, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCopyImageRegions) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
+
+// copyImageToRegion streams the image data into a new image in region, and
+// returns the ID of the new image once it's active. The new image is
+// deleted if the copy fails.
+func copyImageToRegion(ctx context.Context, ui packersdk.Ui, config *Config, client *gophercloud.ServiceClient, image *images.Image, region string, createOpts images.CreateOpts) (string, error) {
+	regionClient, err := config.imageV2ClientForRegion(region)
+	if err != nil {
+		return "", fmt.Errorf("error initializing image service client: %s", err)
+	}
+
+	imageCopy, err := images.Create(regionClient, createOpts).Extract()
+	if err != nil {
+		return "", fmt.Errorf("error creating image: %s", err)
+	}
+
+	err = func() error {
+		data, err := imagedata.Download(client, image.ID).Extract()
+		if err != nil {
+			return fmt.Errorf("error downloading image %s: %s", image.ID, err)
+		}
+		defer data.Close()
+
+		body := ui.TrackProgress(fmt.Sprintf("%s (%s)", image.Name, region), 0, image.SizeBytes, data)
+		defer body.Close()
+
+		log.Printf("[INFO] Uploading image %s into image %s in region %s", image.ID, imageCopy.ID, region)
+		if err := imagedata.Upload(regionClient, imageCopy.ID, body).ExtractErr(); err != nil {
+			return fmt.Errorf("error uploading image %s: %s", imageCopy.ID, err)
+		}
+
+		if err := WaitForImage(ctx, nil, regionClient, imageCopy.ID, config.statePolling()); err != nil {
+			return fmt.Errorf("error waiting for image %s: %s", imageCopy.ID, err)
+		}
+		return nil
+	}()
+	if err != nil {
+		log.Printf("[INFO] Deleting partial image copy %s in region %s", imageCopy.ID, region)
+		if err := images.Delete(regionClient, imageCopy.ID).ExtractErr(); err != nil {
+			log.Printf("[WARN] Error deleting image %s in region %s: %s", imageCopy.ID, region, err)
+		}
+		return "", err
+	}
+
+	return imageCopy.ID, nil
+}
+
+// finishImageCopy hides, deactivates and protects the image copy in region,
+// as the image is in the build region.
+func finishImageCopy(ctx context.Context, config *Config, region, copyId string) error {
+	if !config.ImageHidden && !config.ImageDeactivate && !config.ImageProtected {
+		return nil
+	}
+	regionClient, err := config.imageV2ClientForRegion(region)
+	if err != nil {
+		return fmt.Errorf("error initializing image service client: %s", err)
+	}
+
+	if config.ImageHidden {
+		err := retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+			_, err := images.Update(regionClient, copyId, images.UpdateOpts{replaceImageHidden{NewHidden: true}}).Extract()
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("error hiding image: %s", err)
+		}
+	}
+	if config.ImageDeactivate {
+		err := retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+			return deactivateImage(regionClient, copyId)
+		})
+		if err != nil {
+			return fmt.Errorf("error deactivating image: %s", err)
+		}
+	}
+	if config.ImageProtected {
+		err := retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+			_, err := images.Update(regionClient, copyId, images.UpdateOpts{replaceImageProtected{NewProtected: true}}).Extract()
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("error protecting image: %s", err)
+		}
+	}
+	return nil
+}
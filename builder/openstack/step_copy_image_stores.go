@@ -0,0 +1,168 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/imageimport"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepCopyImageStores copies the image to the image_stores it isn't in yet,
+// through the copy-image import method of Glance multi-store.
+type stepCopyImageStores struct{}
+
+func (s *stepCopyImageStores) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	if config.SkipCreateImage || len(config.ImageStores) == 0 {
+		return multistep.ActionContinue
+	}
+
+	imageId := state.Get("image").(string)
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	image, err := images.Get(imageClient, imageId).Extract()
+	if err != nil {
+		err := fmt.Errorf("Error getting image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	var stores []string
+	for _, store := range config.ImageStores {
+		if !containsString(imageStores(image, "stores"), store) {
+			stores = append(stores, store)
+		}
+	}
+
+	if len(stores) > 0 {
+		ui.Say(fmt.Sprintf("Copying image %s to stores %s...", imageId, strings.Join(stores, ", ")))
+		err = imageimport.Create(imageClient, imageId, copyImageImportOpts{
+			Stores: stores,
+		}).ExtractErr()
+		if err != nil {
+			err := fmt.Errorf("Error copying image %s to stores: %s", imageId, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		image, err = waitForImageStores(ctx, imageClient, imageId, config.ImageStoresTimeout, config.statePolling())
+		if err != nil {
+			err := fmt.Errorf("Error waiting for image %s to be copied to stores: %s", imageId, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	current := imageStores(image, "stores")
+	state.Put("image_stores", current)
+
+	var failed []string
+	for _, store := range config.ImageStores {
+		if containsString(current, store) {
+			ui.Message(fmt.Sprintf("Image %s is in store: %s", imageId, store))
+		} else {
+			failed = append(failed, store)
+		}
+	}
+	if len(failed) > 0 {
+		err := fmt.Errorf("Error copying image %s to stores: %s", imageId, strings.Join(failed, ", "))
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCopyImageStores) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
+
+// waitForImageStores waits for Glance to be done importing the image to
+// stores, and returns the image.
+func waitForImageStores(ctx context.Context, client *gophercloud.ServiceClient, imageId string, timeout time.Duration, polling pollConfig) (*images.Image, error) {
+	deadline := time.Now().Add(timeout)
+	poll := newPoller(polling)
+	var importing []string
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		image, err := images.Get(client, imageId).Extract()
+		throttled := poll.Throttled(err)
+		if err != nil && !throttled {
+			return nil, err
+		}
+
+		if !throttled {
+			importing = imageStores(image, "os_glance_importing_to_stores")
+			if len(importing) == 0 {
+				if failed := imageStores(image, "os_glance_failed_import"); len(failed) > 0 {
+					log.Printf("[WARN] Glance failed to copy image %s to stores: %s", imageId, strings.Join(failed, ", "))
+				}
+				return image, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout after %s, still copying to stores: %s", timeout, strings.Join(importing, ", "))
+		}
+
+		if !throttled {
+			log.Printf("Waiting for image %s to be copied to stores: %s", imageId, strings.Join(importing, ", "))
+		}
+		poll.Wait()
+	}
+}
+
+// imageStores returns the stores listed in the given comma separated image
+// property.
+func imageStores(image *images.Image, property string) []string {
+	value, _ := image.Properties[property].(string)
+
+	var stores []string
+	for _, store := range strings.Split(value, ",") {
+		if store = strings.TrimSpace(store); store != "" {
+			stores = append(stores, store)
+		}
+	}
+	return stores
+}
+
+// copyImageImportOpts are the options of the copy-image import method.
+type copyImageImportOpts struct {
+	Stores []string
+}
+
+// ToImportCreateMap constructs a request body from copyImageImportOpts.
+func (opts copyImageImportOpts) ToImportCreateMap() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"method": map[string]interface{}{
+			"name": "copy-image",
+		},
+		"stores":                  opts.Stores,
+		"all_stores_must_succeed": false,
+	}, nil
+}
@@ -0,0 +1,244 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/bootfromvolume"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// blockDeviceVolume is a volume of block_device_mappings and the mapping it
+// was set up for.
+type blockDeviceVolume struct {
+	VolumeID string
+	Mapping  BlockDeviceMapping
+	// Created tells whether the volume was created by Packer.
+	Created     bool
+	Multiattach bool
+}
+
+// blockDevice returns the block device mapping attaching the volume to the
+// server.
+func (v blockDeviceVolume) blockDevice() bootfromvolume.BlockDevice {
+	return bootfromvolume.BlockDevice{
+		BootIndex:           v.Mapping.BootIndex,
+		DeleteOnTermination: v.Mapping.DeleteOnTermination,
+		DestinationType:     bootfromvolume.DestinationVolume,
+		SourceType:          bootfromvolume.SourceVolume,
+		UUID:                v.VolumeID,
+	}
+}
+
+// blockDeviceMappings returns the block device mappings attaching the
+// volumes to the server.
+func blockDeviceMappings(volumes []blockDeviceVolume) []bootfromvolume.BlockDevice {
+	var mappings []bootfromvolume.BlockDevice
+	for _, v := range volumes {
+		mappings = append(mappings, v.blockDevice())
+	}
+	return mappings
+}
+
+// StepCreateBlockDevices creates the volumes of block_device_mappings in the
+// Block Storage service. The volumes are attached to the server through its
+// block device mapping, and tracked here so they can be deleted once the
+// build is done whether or not the Compute service deleted them.
+type StepCreateBlockDevices struct {
+	BlockDeviceMappings     []BlockDeviceMapping
+	VolumeAvailabilityZone  string
+	DefaultAvailabilityZone bool
+	volumes                 []blockDeviceVolume
+}
+
+func (s *StepCreateBlockDevices) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if len(s.BlockDeviceMappings) == 0 {
+		return multistep.ActionContinue
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	blockStorageClient, err := config.blockStorageV3Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing block storage client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	zone, err := volumeAvailabilityZone(ui, blockStorageClient, s.VolumeAvailabilityZone, s.DefaultAvailabilityZone)
+	if err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Creating block device volumes...")
+	for i, mapping := range s.BlockDeviceMappings {
+		if err := s.createVolume(state, blockStorageClient, i, mapping, zone); err != nil {
+			err := fmt.Errorf("Error creating block_device_mappings volume %d: %s", i, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	state.Put("block_device_volumes", s.volumes)
+	return multistep.ActionContinue
+}
+
+func (s *StepCreateBlockDevices) createVolume(state multistep.StateBag, blockStorageClient *gophercloud.ServiceClient, index int, mapping BlockDeviceMapping, zone string) error {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	if mapping.SourceType == "volume" {
+		volume, err := volumes.Get(blockStorageClient, mapping.SourceID).Extract()
+		if err != nil {
+			return fmt.Errorf("error getting volume %s: %s", mapping.SourceID, err)
+		}
+		if volume.Status != "available" && !(volume.Status == "in-use" && volume.Multiattach) {
+			return fmt.Errorf("volume %s is %s, it must be available or multiattach", volume.ID, volume.Status)
+		}
+		ui.Message(fmt.Sprintf("Attaching volume: %s", volume.ID))
+		s.volumes = append(s.volumes, blockDeviceVolume{
+			VolumeID:    volume.ID,
+			Mapping:     mapping,
+			Multiattach: volume.Multiattach,
+		})
+		return nil
+	}
+
+	opts := volumes.CreateOpts{
+		Size:             mapping.VolumeSize,
+		VolumeType:       mapping.VolumeType,
+		AvailabilityZone: zone,
+		Name:             fmt.Sprintf("%s-block-device-%d", config.InstanceName, index),
+	}
+	switch mapping.SourceType {
+	case "image":
+		opts.ImageID = mapping.SourceID
+		if opts.Size == 0 {
+			imageClient, err := config.imageV2Client()
+			if err != nil {
+				return fmt.Errorf("error initializing image client: %s", err)
+			}
+			opts.Size, err = GetVolumeSize(imageClient, mapping.SourceID)
+			if err != nil {
+				return err
+			}
+		}
+	case "snapshot":
+		opts.SnapshotID = mapping.SourceID
+	}
+
+	volume, err := volumes.Create(blockStorageClient, opts).Extract()
+	if err != nil {
+		return err
+	}
+	s.volumes = append(s.volumes, blockDeviceVolume{
+		VolumeID: volume.ID,
+		Mapping:  mapping,
+		Created:  true,
+	})
+
+	ui.Message(fmt.Sprintf("Waiting for volume %s (volume id: %s) to become available...", opts.Name, volume.ID))
+	if err := WaitForVolume(blockStorageClient, volume.ID, config.statePolling()); err != nil {
+		return fmt.Errorf("error waiting for volume %s: %s", volume.ID, err)
+	}
+	return nil
+}
+
+func (s *StepCreateBlockDevices) Cleanup(state multistep.StateBag) {
+	if len(s.volumes) == 0 {
+		return
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+
+	blockStorageClient, err := config.blockStorageV3Client()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error initializing block storage client: %s", err))
+		return
+	}
+
+	for _, v := range s.volumes {
+		if !v.Created {
+			continue
+		}
+		if !v.Mapping.DeleteOnTermination && !cancelled && !halted {
+			ui.Say(fmt.Sprintf("Keeping volume: %s", v.VolumeID))
+			continue
+		}
+
+		if err := deleteBlockDeviceVolume(blockStorageClient, v.VolumeID, config.statePolling()); err != nil {
+			ui.Error(fmt.Sprintf(
+				"Error cleaning up volume. Please delete the volume manually: %s: %s", v.VolumeID, err))
+		}
+	}
+}
+
+// deleteBlockDeviceVolume deletes the volume once it's detached, unless the
+// Compute service already deleted it together with the server.
+func deleteBlockDeviceVolume(blockStorageClient *gophercloud.ServiceClient, volumeID string, polling pollConfig) error {
+	isGone := func(err error) bool {
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			return true
+		}
+		status, err := GetVolumeStatus(blockStorageClient, volumeID)
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			return true
+		}
+		return err == nil && status == "deleting"
+	}
+
+	if err := WaitForVolume(blockStorageClient, volumeID, polling); err != nil {
+		if isGone(err) {
+			return nil
+		}
+		return err
+	}
+
+	log.Printf("[INFO] Deleting volume: %s", volumeID)
+	err := volumes.Delete(blockStorageClient, volumeID, volumes.DeleteOpts{}).ExtractErr()
+	if err != nil && !isGone(err) {
+		return err
+	}
+	return nil
+}
+
+// blockDeviceNamesExt sets the device names of the block device mapping of
+// the server, the bootfromvolume extension doesn't support them.
+type blockDeviceNamesExt struct {
+	servers.CreateOptsBuilder
+	DeviceNames []string
+}
+
+// ToServerCreateMap adds the device names to the block device mapping
+// options.
+func (opts blockDeviceNamesExt) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	serverMap := base["server"].(map[string]interface{})
+	blockDevices, _ := serverMap["block_device_mapping_v2"].([]map[string]interface{})
+	for i, name := range opts.DeviceNames {
+		if name != "" && i < len(blockDevices) {
+			blockDevices[i]["device_name"] = name
+		}
+	}
+	return base, nil
+}
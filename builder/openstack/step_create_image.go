@@ -7,15 +7,20 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
 	"time"
 
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
 
 	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+
+	"github.com/hashicorp/packer-plugin-openstack/version"
 )
 
 type stepCreateImage struct {
@@ -48,6 +53,9 @@ func (s *stepCreateImage) Run(ctx context.Context, state multistep.StateBag) mul
 		return multistep.ActionHalt
 	}
 
+	metadata := imageMetadata(state)
+	state.Put("image_metadata", metadata)
+
 	// Create the image.
 	// Image source depends on the type of the Compute instance. It can be
 	// Block Storage service volume or regular Compute service local volume.
@@ -64,10 +72,20 @@ func (s *stepCreateImage) Run(ctx context.Context, state multistep.StateBag) mul
 		}
 		volume := state.Get("volume_id").(string)
 
+		// The volume is uploaded once it's detached from the deleted server.
+		if !config.VolumeUploadForce {
+			if err := WaitForVolume(blockStorageClient, volume, config.statePolling()); err != nil {
+				err := fmt.Errorf("Error waiting for volume %s to become available: %s", volume, err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		}
+
 		// set ImageMetadata before uploading to glance so the new image captured the desired values
-		if len(config.ImageMetadata) > 0 {
+		if len(metadata) > 0 {
 			err = volumeactions.SetImageMetadata(blockStorageClient, volume, volumeactions.ImageMetadataOpts{
-				Metadata: config.ImageMetadata,
+				Metadata: metadata,
 			}).ExtractErr()
 			if err != nil {
 				err := fmt.Errorf("Error setting image metadata: %s", err)
@@ -76,8 +94,10 @@ func (s *stepCreateImage) Run(ctx context.Context, state multistep.StateBag) mul
 		}
 
 		image, err := volumeactions.UploadImage(blockStorageClient, volume, volumeactions.UploadImageOpts{
-			DiskFormat: config.ImageDiskFormat,
-			ImageName:  config.ImageName,
+			ContainerFormat: config.ImageContainerFormat,
+			DiskFormat:      config.ImageDiskFormat,
+			ImageName:       config.ImageName,
+			Force:           config.VolumeUploadForce,
 		}).Extract()
 		if err != nil {
 			err := fmt.Errorf("Error creating image: %s", err)
@@ -86,10 +106,21 @@ func (s *stepCreateImage) Run(ctx context.Context, state multistep.StateBag) mul
 			return multistep.ActionHalt
 		}
 		imageId = image.ImageID
+	} else if shelvedImageId, ok := state.GetOk("shelved_image_id"); ok {
+		imageId = shelvedImageId.(string)
+		if err := adoptShelvedImage(imageClient, imageId, config.ImageName, metadata); err != nil {
+			err := fmt.Errorf("Error creating image from the shelved server snapshot %s: %s", imageId, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		state.Remove("shelved_image_id")
 	} else {
-		imageId, err = servers.CreateImage(computeClient, server.ID, servers.CreateImageOpts{
+		// Since microversion 2.45, the image ID is in the response body
+		// instead of the Location header gophercloud reads it from.
+		imageId, err = servers.CreateImage(withMaxMicroversion(computeClient, "2.44"), server.ID, servers.CreateImageOpts{
 			Name:     config.ImageName,
-			Metadata: config.ImageMetadata,
+			Metadata: metadata,
 		}).ExtractImageID()
 		if err != nil {
 			err := fmt.Errorf("Error creating image: %s", err)
@@ -105,7 +136,16 @@ func (s *stepCreateImage) Run(ctx context.Context, state multistep.StateBag) mul
 
 	// Wait for the image to become ready
 	ui.Say(fmt.Sprintf("Waiting for image %s (image id: %s) to become ready...", config.ImageName, imageId))
-	if err := WaitForImage(ctx, imageClient, imageId); err != nil {
+	if config.SkipStopBeforeImage {
+		ui.Message("The image stays queued while the live snapshot of the server is taken, which may take a while")
+	}
+	waitCtx := ctx
+	if config.ImageCreationTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, config.ImageCreationTimeout)
+		defer cancel()
+	}
+	if err := WaitForImage(waitCtx, ui, imageClient, imageId, config.statePolling()); err != nil {
 		err := fmt.Errorf("Error waiting for image: %s", err)
 		state.Put("error", err)
 		ui.Error(err.Error())
@@ -119,17 +159,121 @@ func (s *stepCreateImage) Cleanup(multistep.StateBag) {
 	// No cleanup...
 }
 
-// WaitForImage waits for the given Image ID to become ready.
-func WaitForImage(ctx context.Context, client *gophercloud.ServiceClient, imageId string) error {
+// adoptShelvedImage turns the snapshot of the shelved server into the image:
+// it's renamed, given the image metadata and unprotected, the server being
+// deleted already.
+func adoptShelvedImage(imageClient *gophercloud.ServiceClient, imageId, name string, metadata map[string]string) error {
+	opts := images.UpdateOpts{
+		images.ReplaceImageName{
+			NewName: name,
+		},
+		replaceImageProtected{
+			NewProtected: false,
+		},
+	}
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		opts = append(opts, images.UpdateImageProperty{
+			Op:    images.AddOp,
+			Name:  key,
+			Value: metadata[key],
+		})
+	}
+
+	_, err := images.Update(imageClient, imageId, opts).Extract()
+	return err
+}
+
+// imageMetadata returns image_metadata, along with the provenance metadata
+// when image_provenance_metadata is true and the certificate property when
+// trusted_image_certificate_property is true. The user metadata wins over
+// the others.
+func imageMetadata(state multistep.StateBag) map[string]string {
+	config := state.Get("config").(*Config)
+	if !config.ImageProvenanceMetadata && !config.TrustedImageCertificateProperty {
+		return config.ImageMetadata
+	}
+
+	metadata := make(map[string]string, len(config.ImageMetadata))
+	if config.ImageProvenanceMetadata {
+		for k, v := range provenanceMetadata(state) {
+			metadata[k] = v
+		}
+	}
+	if config.TrustedImageCertificateProperty {
+		metadata["img_signature_certificate_uuid"] = config.TrustedImageCertificateIDs[0]
+	}
+	for k, v := range config.ImageMetadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+// provenanceMetadata returns the provenance metadata of the image, and puts
+// it in the state.
+func provenanceMetadata(state multistep.StateBag) map[string]string {
+	config := state.Get("config").(*Config)
+
+	provenance := map[string]string{
+		"packer:build_name":     config.PackerBuildName,
+		"packer:build_uuid":     config.runUUID,
+		"packer:build_start":    state.Get("build_start").(time.Time).Format(time.RFC3339),
+		"packer:build_end":      time.Now().UTC().Format(time.RFC3339),
+		"packer:plugin_version": version.PluginVersion.String(),
+	}
+	if config.PackerCoreVersion != "" {
+		provenance["packer:packer_version"] = config.PackerCoreVersion
+	}
+	if flavorID, ok := state.GetOk("flavor_id"); ok {
+		provenance["packer:flavor"] = flavorID.(string)
+	}
+	if flavor, ok := state.Get("flavor").(*flavors.Flavor); ok && flavor.Name != "" {
+		provenance["packer:flavor_name"] = flavor.Name
+	}
+	if from, ok := state.GetOk("flavor_fallback_from"); ok {
+		provenance["packer:flavor_fallback_from"] = from.(string)
+	}
+	if sourceImage, ok := state.GetOk("source_image"); ok {
+		provenance["packer:source_image"] = sourceImage.(string)
+		if imageClient, err := config.imageV2Client(); err == nil {
+			if image, err := images.Get(imageClient, sourceImage.(string)).Extract(); err == nil {
+				provenance["packer:source_image_name"] = image.Name
+			} else {
+				log.Printf("[WARN] Error getting source image %s: %s", sourceImage, err)
+			}
+		}
+	}
+	state.Put("image_provenance", provenance)
+
+	return provenance
+}
+
+// WaitForImage waits for the given Image ID to become ready. When ui isn't
+// nil, the image status is reported periodically.
+func WaitForImage(ctx context.Context, ui packersdk.Ui, client *gophercloud.ServiceClient, imageId string, polling pollConfig) error {
 	maxNumErrors := 10
 	numErrors := 0
+	lastStatus := "unknown"
+	lastReport := time.Now()
 
+	poll := newPoller(polling)
 	for {
 		if err := ctx.Err(); err != nil {
+			if err == context.DeadlineExceeded {
+				return fmt.Errorf("timeout waiting for image %s to become active, last status: %s", imageId, lastStatus)
+			}
 			return err
 		}
 		image, err := images.Get(client, imageId).Extract()
 		if err != nil {
+			if poll.Throttled(err) {
+				poll.Wait()
+				continue
+			}
 			errCode, ok := err.(*gophercloud.ErrUnexpectedResponseCode)
 			if ok && (errCode.Actual == 500 || errCode.Actual == 404) {
 				numErrors++
@@ -145,11 +289,52 @@ func WaitForImage(ctx context.Context, client *gophercloud.ServiceClient, imageI
 			return err
 		}
 
-		if image.Status == "active" {
+		switch image.Status {
+		case images.ImageStatusActive:
 			return nil
+		case images.ImageStatusKilled, images.ImageStatusDeleted:
+			return fmt.Errorf("image %s is %s, it won't become active", imageId, image.Status)
 		}
+		lastStatus = string(image.Status)
 
 		log.Printf("Waiting for image creation status: %s", image.Status)
-		time.Sleep(2 * time.Second)
+		if ui != nil && time.Since(lastReport) >= 30*time.Second {
+			if image.SizeBytes > 0 {
+				ui.Message(fmt.Sprintf("Image %s status: %s, %d bytes uploaded", imageId, image.Status, image.SizeBytes))
+			} else {
+				ui.Message(fmt.Sprintf("Image %s status: %s", imageId, image.Status))
+			}
+			lastReport = time.Now()
+		}
+		poll.Wait()
+	}
+}
+
+// retryImageUpdate calls update until it succeeds, retrying with an
+// exponential backoff as long as Glance answers with a conflict, which
+// happens while the image is still transitioning, or a transient error.
+func retryImageUpdate(ctx context.Context, timeout time.Duration, update func() error) error {
+	return retry.Config{
+		StartTimeout: timeout,
+		ShouldRetry:  isRetryableImageError,
+		RetryDelay: (&retry.Backoff{
+			InitialBackoff: 2 * time.Second,
+			MaxBackoff:     30 * time.Second,
+			Multiplier:     2,
+		}).Linear,
+	}.Run(ctx, func(context.Context) error {
+		return update()
+	})
+}
+
+func isRetryableImageError(err error) bool {
+	switch err := err.(type) {
+	case gophercloud.ErrDefault409, gophercloud.ErrDefault500, gophercloud.ErrDefault503:
+		return true
+	case gophercloud.ErrUnexpectedResponseCode:
+		return err.Actual == 502 || err.Actual == 504
+	case *gophercloud.ErrUnexpectedResponseCode:
+		return err.Actual == 502 || err.Actual == 504
 	}
+	return false
 }
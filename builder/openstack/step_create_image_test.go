@@ -0,0 +1,43 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWaitForImage(t *testing.T) {
+	cases := []struct {
+		status string
+		err    string
+	}{
+		{"active", ""},
+		{"killed", "image 1234 is killed, it won't become active"},
+		{"deleted", "image 1234 is deleted, it won't become active"},
+	}
+	for _, tc := range cases {
+		cloud := newTestCloud(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id": "1234", "status": %q}`, tc.status)
+		})
+		client, err := cloud.state(t).Get("config").(*Config).imageV2Client()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = WaitForImage(ctx, nil, client, "1234", pollConfig{Interval: time.Millisecond})
+		cancel()
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: err: %s", tc.status, err)
+		}
+		if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%s: expected error %q, got %v", tc.status, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/portsbinding"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/trunks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCreatePorts creates the instance ports in the Networking service and
+// adds them to the networks the server is launched with.
+type StepCreatePorts struct {
+	InstancePorts []InstancePort
+	portIDs       []string
+	trunks        []createdTrunk
+}
+
+// createdTrunk is a trunk created by StepCreatePorts along with its subport
+// ports.
+type createdTrunk struct {
+	id         string
+	subportIDs []string
+}
+
+func (s *StepCreatePorts) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if len(s.InstancePorts) == 0 {
+		return multistep.ActionContinue
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+	networks := state.Get("networks").([]servers.Network)
+
+	networkClient, err := config.networkV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing network client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	for _, instancePort := range s.InstancePorts {
+		networkID, err := CheckNetwork(networkClient, instancePort.Network)
+		if err != nil {
+			err := fmt.Errorf("Error using the provided instance_port network: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		createOpts := ports.CreateOpts{
+			NetworkID: networkID,
+			Name:      instancePort.Name,
+		}
+
+		// ports.IP always sends the subnet_id, which Neutron refuses when
+		// empty, so build the fixed IP by hand.
+		fixedIP := map[string]string{}
+		if instancePort.FixedIP != "" {
+			fixedIP["ip_address"] = instancePort.FixedIP
+		}
+		if instancePort.SubnetID != "" {
+			fixedIP["subnet_id"] = instancePort.SubnetID
+		}
+		if len(fixedIP) > 0 {
+			createOpts.FixedIPs = []map[string]string{fixedIP}
+		}
+
+		if len(instancePort.SecurityGroups) > 0 {
+			securityGroups := make([]string, 0, len(instancePort.SecurityGroups))
+			for _, group := range instancePort.SecurityGroups {
+				groupID, err := CheckSecurityGroup(networkClient, group)
+				if err != nil {
+					err := fmt.Errorf("Error using the provided instance_port security group: %s", err)
+					state.Put("error", err)
+					ui.Error(err.Error())
+					return multistep.ActionHalt
+				}
+				securityGroups = append(securityGroups, groupID)
+			}
+			createOpts.SecurityGroups = &securityGroups
+		}
+
+		var createOptsExt ports.CreateOptsBuilder = createOpts
+		if instancePort.VNICType != "" {
+			createOptsExt = portsbinding.CreateOptsExt{
+				CreateOptsBuilder: createOptsExt,
+				VNICType:          instancePort.VNICType,
+			}
+		}
+
+		ui.Say(fmt.Sprintf("Creating port %s in network %s ...", instancePort.Name, networkID))
+		port, err := ports.Create(networkClient, createOptsExt).Extract()
+		if err != nil {
+			err := fmt.Errorf("Error creating port %s: %s", instancePort.Name, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		// Port was created, so remember to clean it up.
+		s.portIDs = append(s.portIDs, port.ID)
+
+		ui.Message(fmt.Sprintf("Port ID: %s", port.ID))
+
+		if instancePort.Trunk != nil {
+			if err := s.createTrunk(ui, networkClient, port.ID, instancePort.Trunk); err != nil {
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		}
+		networks = append(networks, servers.Network{Port: port.ID})
+	}
+
+	state.Put("networks", networks)
+	return multistep.ActionContinue
+}
+
+// createTrunk creates the trunk with the given parent port, along with the
+// ports of its subports.
+func (s *StepCreatePorts) createTrunk(ui packersdk.Ui, client *gophercloud.ServiceClient, parentID string, trunk *InstancePortTrunk) error {
+	if err := checkExtension(client, "trunk", "trunks"); err != nil {
+		return fmt.Errorf("Error using instance_port trunk: %s", err)
+	}
+
+	created := createdTrunk{}
+	subports := make([]trunks.Subport, 0, len(trunk.Subports))
+	for _, subport := range trunk.Subports {
+		networkID, err := CheckNetwork(client, subport.Network)
+		if err != nil {
+			return fmt.Errorf("Error using the provided trunk subport network: %s", err)
+		}
+
+		name := fmt.Sprintf("%s_%d", trunk.Name, subport.SegmentationID)
+		ui.Say(fmt.Sprintf("Creating subport %s in network %s ...", name, networkID))
+		port, err := ports.Create(client, ports.CreateOpts{
+			NetworkID: networkID,
+			Name:      name,
+		}).Extract()
+		if err != nil {
+			// Keep track of the subports created so far for the cleanup.
+			s.trunks = append(s.trunks, created)
+			return fmt.Errorf("Error creating subport %s: %s", name, err)
+		}
+		created.subportIDs = append(created.subportIDs, port.ID)
+
+		subports = append(subports, trunks.Subport{
+			PortID:           port.ID,
+			SegmentationID:   subport.SegmentationID,
+			SegmentationType: subport.SegmentationType,
+		})
+	}
+
+	ui.Say(fmt.Sprintf("Creating trunk %s on port %s ...", trunk.Name, parentID))
+	t, err := trunks.Create(client, trunks.CreateOpts{
+		Name:     trunk.Name,
+		PortID:   parentID,
+		Subports: subports,
+	}).Extract()
+	if err != nil {
+		s.trunks = append(s.trunks, created)
+		return fmt.Errorf("Error creating trunk %s: %s", trunk.Name, err)
+	}
+	created.id = t.ID
+	s.trunks = append(s.trunks, created)
+
+	ui.Message(fmt.Sprintf("Trunk ID: %s", t.ID))
+	return nil
+}
+
+func (s *StepCreatePorts) Cleanup(state multistep.StateBag) {
+	if len(s.portIDs) == 0 {
+		return
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	networkClient, err := config.networkV2Client()
+	if err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error cleaning up ports. Please delete the ports manually: %v", s.portIDs))
+		return
+	}
+
+	// Subports have to be removed from the trunk, and the trunk deleted,
+	// before any of their ports can be deleted.
+	for _, trunk := range s.trunks {
+		if trunk.id != "" {
+			if len(trunk.subportIDs) > 0 {
+				removeOpts := trunks.RemoveSubportsOpts{}
+				for _, portID := range trunk.subportIDs {
+					removeOpts.Subports = append(removeOpts.Subports, trunks.RemoveSubport{PortID: portID})
+				}
+				if _, err := trunks.RemoveSubports(networkClient, trunk.id, removeOpts).Extract(); err != nil {
+					ui.Error(fmt.Sprintf(
+						"Error removing subports from trunk %s: %s", trunk.id, err))
+				}
+			}
+
+			ui.Say(fmt.Sprintf("Deleting trunk: %s ...", trunk.id))
+			if err := trunks.Delete(networkClient, trunk.id).ExtractErr(); err != nil {
+				ui.Error(fmt.Sprintf(
+					"Error cleaning up trunk. Please delete the trunk manually: %s", trunk.id))
+			}
+		}
+
+		for _, portID := range trunk.subportIDs {
+			ui.Say(fmt.Sprintf("Deleting subport: %s ...", portID))
+			if err := ports.Delete(networkClient, portID).ExtractErr(); err != nil {
+				ui.Error(fmt.Sprintf(
+					"Error cleaning up port. Please delete the port manually: %s", portID))
+			}
+		}
+	}
+
+	for _, portID := range s.portIDs {
+		ui.Say(fmt.Sprintf("Deleting port: %s ...", portID))
+		if err := ports.Delete(networkClient, portID).ExtractErr(); err != nil {
+			ui.Error(fmt.Sprintf(
+				"Error cleaning up port. Please delete the port manually: %s", portID))
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCreateServerGroup creates the server group the server is launched in.
+// The builds of a packer build run share the server group with the given
+// name: the first build creates it, and the last one deletes it. A build
+// deleting the server group while another one is about to launch its
+// server, StepRunSourceServer creates it again when it's gone.
+type StepCreateServerGroup struct {
+	Policy string
+	Name   string
+	group  *serverGroup
+}
+
+// serverGroup is the server group shared by the builds of the run.
+type serverGroup struct {
+	ID     string
+	Name   string
+	Policy string
+}
+
+func (s *StepCreateServerGroup) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if s.Policy == "" {
+		return multistep.ActionContinue
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Using %s server group: %s", s.Policy, s.Name))
+	group := &serverGroup{
+		Name:   s.Name,
+		Policy: s.Policy,
+	}
+	err = withServerGroupLock(s.Name, func() error {
+		return group.ensure(ui, computeClient)
+	})
+	if err != nil {
+		err := fmt.Errorf("Error creating server group %s: %s", s.Name, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	s.group = group
+	state.Put("server_group", group)
+	return multistep.ActionContinue
+}
+
+func (s *StepCreateServerGroup) Cleanup(state multistep.StateBag) {
+	if s.group == nil || s.group.ID == "" {
+		return
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error cleaning up server group. Please delete the server group manually: %s", s.group.ID))
+		return
+	}
+
+	// The server group may have been created again by the launch of the
+	// server, under a new ID.
+	groupID := s.group.ID
+	err = withServerGroupLock(s.Name, func() error {
+		group, err := servergroups.Get(computeClient, groupID).Extract()
+		if err != nil {
+			return err
+		}
+		// Other builds of the run still use the server group.
+		if len(group.Members) > 0 {
+			log.Printf("[INFO] Keeping server group %s, it has members: %s", groupID, strings.Join(group.Members, ", "))
+			return nil
+		}
+
+		ui.Say(fmt.Sprintf("Deleting server group: %s ...", groupID))
+		return servergroups.Delete(computeClient, groupID).ExtractErr()
+	})
+	if _, ok := err.(gophercloud.ErrDefault404); ok {
+		return
+	}
+	if err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error cleaning up server group. Please delete the server group manually: %s: %s", groupID, err))
+	}
+}
+
+// ensure looks up the server group, and creates it when it's missing. Another
+// build of the run may have deleted it since it was looked up, when it had
+// no members. It must be called while holding the server group lock.
+func (g *serverGroup) ensure(ui packersdk.Ui, client *gophercloud.ServiceClient) error {
+	if g.ID != "" {
+		_, err := servergroups.Get(client, g.ID).Extract()
+		if _, ok := err.(gophercloud.ErrDefault404); !ok {
+			return err
+		}
+		log.Printf("[INFO] Server group %s was deleted by another build", g.ID)
+	}
+
+	id, err := findServerGroup(client, g.Name)
+	if err != nil || id != "" {
+		g.ID = id
+		return err
+	}
+
+	// The soft policies were added in microversion 2.15, and the
+	// policies became a single policy in 2.64.
+	createClient := client
+	if strings.HasPrefix(g.Policy, "soft-") {
+		createClient = withMicroversion(client, "2.15")
+	}
+	opts := servergroups.CreateOpts{
+		Name:     g.Name,
+		Policies: []string{g.Policy},
+	}
+	if microversionAtLeast(createClient.Microversion, "2.64") {
+		opts = servergroups.CreateOpts{
+			Name:   g.Name,
+			Policy: g.Policy,
+		}
+	}
+	group, err := servergroups.Create(createClient, opts).Extract()
+	if err != nil {
+		return err
+	}
+	ui.Message(fmt.Sprintf("Created server group: %s", group.ID))
+	g.ID = group.ID
+	return nil
+}
+
+// findServerGroup returns the ID of the server group with the given name, or
+// an empty ID when there's none. The first one by ID is returned when there
+// are several of them.
+func findServerGroup(client *gophercloud.ServiceClient, name string) (string, error) {
+	allPages, err := servergroups.List(client).AllPages()
+	if err != nil {
+		return "", err
+	}
+	groups, err := servergroups.ExtractServerGroups(allPages)
+	if err != nil {
+		return "", err
+	}
+
+	var ids []string
+	for _, group := range groups {
+		if group.Name == name {
+			ids = append(ids, group.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return "", nil
+	}
+	sort.Strings(ids)
+	return ids[0], nil
+}
+
+// withServerGroupLock runs fn while holding a lock file for the server group,
+// so that the builds of a run, which may run in different processes, don't
+// create or delete the server group concurrently. A lock left behind by a
+// crashed build is ignored after a minute.
+func withServerGroupLock(name string, fn func() error) error {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("packer-openstack-%s.lock", name))
+	deadline := time.Now().Add(time.Minute)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			defer os.Remove(path)
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			log.Printf("[WARN] Ignoring the stale server group lock %s", path)
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return fn()
+}
@@ -0,0 +1,43 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestServerGroupEnsure_Deleted(t *testing.T) {
+	cloud := newTestCloud(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/os-server-groups/deleted":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet:
+			fmt.Fprint(w, `{"server_groups": []}`)
+		case r.Method == http.MethodPost:
+			fmt.Fprint(w, `{"server_group": {"id": "created", "name": "group"}}`)
+		}
+	})
+	state := cloud.state(t)
+	client, err := state.Get("config").(*Config).computeV2Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	group := &serverGroup{ID: "deleted", Name: "group", Policy: "anti-affinity"}
+	if err := group.ensure(state.Get("ui").(packersdk.Ui), client); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if group.ID != "created" {
+		t.Fatalf("the deleted server group should be created again: %s", group.ID)
+	}
+	requests := cloud.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("expected the server group to be looked up and created, got %q", requests)
+	}
+}
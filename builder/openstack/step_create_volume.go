@@ -6,7 +6,11 @@ package openstack
 import (
 	"context"
 	"fmt"
+	"log"
+	"strings"
 
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -17,8 +21,21 @@ type StepCreateVolume struct {
 	VolumeName             string
 	VolumeType             string
 	VolumeAvailabilityZone string
-	volumeID               string
-	doCleanup              bool
+	// DefaultAvailabilityZone tells whether VolumeAvailabilityZone is the
+	// Compute instance availability zone, which is only used when the Block
+	// Storage service has it.
+	DefaultAvailabilityZone bool
+	KeepVolume              bool
+	SourceVolume            string
+	CloneSourceVolume       bool
+	SourceVolumeSnapshot    string
+	SnapshotMostRecent      bool
+	// BootProperties are set in the image metadata of the volume created
+	// from the source image, which the Compute service boots the server
+	// with.
+	BootProperties []bootProperty
+	volumeID       string
+	doCleanup      bool
 }
 
 func (s *StepCreateVolume) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -29,7 +46,6 @@ func (s *StepCreateVolume) Run(ctx context.Context, state multistep.StateBag) mu
 
 	config := state.Get("config").(*Config)
 	ui := state.Get("ui").(packersdk.Ui)
-	sourceImage := state.Get("source_image").(string)
 
 	// We will need Block Storage and Image services clients.
 	blockStorageClient, err := config.blockStorageV3Client()
@@ -39,6 +55,21 @@ func (s *StepCreateVolume) Run(ctx context.Context, state multistep.StateBag) mu
 		return multistep.ActionHalt
 	}
 
+	s.VolumeAvailabilityZone, err = volumeAvailabilityZone(ui, blockStorageClient, s.VolumeAvailabilityZone, s.DefaultAvailabilityZone)
+	if err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if s.SourceVolume != "" {
+		return s.useSourceVolume(state, blockStorageClient)
+	}
+	if s.SourceVolumeSnapshot != "" {
+		return s.useSourceVolumeSnapshot(state, blockStorageClient)
+	}
+
+	sourceImage := state.Get("source_image").(string)
 	volumeSize := config.VolumeSize
 
 	// Get needed volume size from the source image.
@@ -78,7 +109,7 @@ func (s *StepCreateVolume) Run(ctx context.Context, state multistep.StateBag) mu
 
 	// Wait for volume to become available.
 	ui.Say(fmt.Sprintf("Waiting for volume %s (volume id: %s) to become available...", config.VolumeName, volume.ID))
-	if err := WaitForVolume(blockStorageClient, volume.ID); err != nil {
+	if err := WaitForVolume(blockStorageClient, volume.ID, config.statePolling()); err != nil {
 		err := fmt.Errorf("Error waiting for volume: %s", err)
 		state.Put("error", err)
 		ui.Error(err.Error())
@@ -93,6 +124,174 @@ func (s *StepCreateVolume) Run(ctx context.Context, state multistep.StateBag) mu
 	state.Put("volume_id", volume.ID)
 	s.volumeID = volume.ID
 
+	if len(s.BootProperties) > 0 {
+		metadata := make(map[string]string, len(s.BootProperties))
+		for _, p := range s.BootProperties {
+			metadata[p.Property] = p.Value
+		}
+		log.Printf("[INFO] Setting the boot mode image metadata of volume %s: %v", volume.ID, metadata)
+		err := volumeactions.SetImageMetadata(blockStorageClient, volume.ID, volumeactions.ImageMetadataOpts{
+			Metadata: metadata,
+		}).ExtractErr()
+		if err != nil {
+			err := fmt.Errorf("Error setting the boot mode image metadata of volume %s: %s", volume.ID, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+// volumeAvailabilityZone checks that the Block Storage service has the
+// volume availability zone, and returns the zone to create volumes in. The
+// Compute instance availability zone, used when defaulted is true, is
+// dropped when the Block Storage service doesn't have it.
+func volumeAvailabilityZone(ui packersdk.Ui, blockStorageClient *gophercloud.ServiceClient, zone string, defaulted bool) (string, error) {
+	if zone == "" {
+		return "", nil
+	}
+
+	zones, err := GetVolumeAvailabilityZones(blockStorageClient)
+	if err != nil {
+		log.Printf("[WARN] Error listing the volume availability zones, not checking %s: %s", zone, err)
+		return zone, nil
+	}
+	if containsString(zones, zone) {
+		return zone, nil
+	}
+
+	if defaulted {
+		ui.Message(fmt.Sprintf("The Block Storage service has no availability zone %s, "+
+			"creating the volume in the default availability zone", zone))
+		return "", nil
+	}
+	return "", fmt.Errorf("Unknown volume_availability_zone %s, the available zones are: %s",
+		zone, strings.Join(zones, ", "))
+}
+
+// useSourceVolume boots the server from the source volume, or from a clone
+// of it when CloneSourceVolume is true.
+func (s *StepCreateVolume) useSourceVolume(state multistep.StateBag, blockStorageClient *gophercloud.ServiceClient) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	sourceVolume, err := findVolume(blockStorageClient, s.SourceVolume)
+	if err != nil {
+		err := fmt.Errorf("Error getting source volume %s: %s", s.SourceVolume, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if sourceVolume.Bootable != "true" {
+		err := fmt.Errorf("Source volume %s isn't bootable", sourceVolume.ID)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if sourceVolume.Status != "available" && !(sourceVolume.Status == "in-use" && sourceVolume.Multiattach) {
+		err := fmt.Errorf("Source volume %s is %s, it must be available or multiattach", sourceVolume.ID, sourceVolume.Status)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Message(fmt.Sprintf("Source volume: %s (volume id: %s)", sourceVolume.Name, sourceVolume.ID))
+
+	if !s.CloneSourceVolume {
+		state.Put("volume_id", sourceVolume.ID)
+		state.Put("volume_multiattach", sourceVolume.Multiattach)
+		return multistep.ActionContinue
+	}
+
+	volumeSize := config.VolumeSize
+	if volumeSize < sourceVolume.Size {
+		volumeSize = sourceVolume.Size
+	}
+
+	ui.Say(fmt.Sprintf("Cloning source volume %s...", sourceVolume.ID))
+	return s.createVolume(state, blockStorageClient, volumes.CreateOpts{
+		Size:             volumeSize,
+		VolumeType:       s.VolumeType,
+		AvailabilityZone: s.VolumeAvailabilityZone,
+		Name:             s.VolumeName,
+		SourceVolID:      sourceVolume.ID,
+		Metadata:         config.ImageMetadata,
+	})
+}
+
+// useSourceVolumeSnapshot boots the server from a new volume created from the
+// source volume snapshot.
+func (s *StepCreateVolume) useSourceVolumeSnapshot(state multistep.StateBag, blockStorageClient *gophercloud.ServiceClient) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	snapshot, err := findVolumeSnapshot(blockStorageClient, s.SourceVolumeSnapshot, s.SnapshotMostRecent)
+	if err != nil {
+		err := fmt.Errorf("Error getting source volume snapshot %s: %s", s.SourceVolumeSnapshot, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if snapshot.Status != "available" {
+		err := fmt.Errorf("Source volume snapshot %s is %s, it must be available", snapshot.ID, snapshot.Status)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Message(fmt.Sprintf("Source volume snapshot: %s (snapshot id: %s)", snapshot.Name, snapshot.ID))
+
+	volumeSize := config.VolumeSize
+	if volumeSize == 0 {
+		volumeSize = snapshot.Size
+	}
+	if volumeSize < snapshot.Size {
+		err := fmt.Errorf("The volume_size %d is smaller than the %d GB of source volume snapshot %s",
+			volumeSize, snapshot.Size, snapshot.ID)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Creating volume from snapshot %s...", snapshot.ID))
+	return s.createVolume(state, blockStorageClient, volumes.CreateOpts{
+		Size:             volumeSize,
+		VolumeType:       s.VolumeType,
+		AvailabilityZone: s.VolumeAvailabilityZone,
+		Name:             s.VolumeName,
+		SnapshotID:       snapshot.ID,
+		Metadata:         config.ImageMetadata,
+	})
+}
+
+// createVolume creates the volume the server boots from, and waits for it to
+// become available.
+func (s *StepCreateVolume) createVolume(state multistep.StateBag, blockStorageClient *gophercloud.ServiceClient, opts volumes.CreateOpts) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	volume, err := volumes.Create(blockStorageClient, opts).Extract()
+	if err != nil {
+		err := fmt.Errorf("Error creating volume: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	// Volume was created, so remember to clean it up.
+	s.doCleanup = true
+	s.volumeID = volume.ID
+
+	ui.Say(fmt.Sprintf("Waiting for volume %s (volume id: %s) to become available...", s.VolumeName, volume.ID))
+	if err := WaitForVolume(blockStorageClient, volume.ID, config.statePolling()); err != nil {
+		err := fmt.Errorf("Error waiting for volume: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf("Volume ID: %s", volume.ID))
+	state.Put("volume_id", volume.ID)
 	return multistep.ActionContinue
 }
 
@@ -104,6 +303,13 @@ func (s *StepCreateVolume) Cleanup(state multistep.StateBag) {
 	config := state.Get("config").(*Config)
 	ui := state.Get("ui").(packersdk.Ui)
 
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if s.KeepVolume && !cancelled && !halted {
+		ui.Say(fmt.Sprintf("Keeping volume: %s", s.volumeID))
+		return
+	}
+
 	blockStorageClient, err := config.blockStorageV3Client()
 	if err != nil {
 		ui.Error(fmt.Sprintf(
@@ -113,6 +319,11 @@ func (s *StepCreateVolume) Cleanup(state multistep.StateBag) {
 
 	// Wait for volume to become available.
 	status, err := GetVolumeStatus(blockStorageClient, s.volumeID)
+	if _, ok := err.(gophercloud.ErrDefault404); ok {
+		// The Compute service deleted the volume together with the server.
+		log.Printf("[INFO] Volume %s is already deleted", s.volumeID)
+		return
+	}
 	if err != nil {
 		ui.Error(fmt.Sprintf(
 			"Error getting the volume information. Please delete the volume manually: %s", s.volumeID))
@@ -122,7 +333,11 @@ func (s *StepCreateVolume) Cleanup(state multistep.StateBag) {
 	if status != "available" {
 		ui.Say(fmt.Sprintf(
 			"Waiting for volume %s (volume id: %s) to become available...", s.VolumeName, s.volumeID))
-		if err := WaitForVolume(blockStorageClient, s.volumeID); err != nil {
+		if err := WaitForVolume(blockStorageClient, s.volumeID, config.statePolling()); err != nil {
+			if _, ok := err.(gophercloud.ErrDefault404); ok {
+				log.Printf("[INFO] Volume %s is already deleted", s.volumeID)
+				return
+			}
 			ui.Error(fmt.Sprintf(
 				"Error getting the volume information. Please delete the volume manually: %s", s.volumeID))
 			return
@@ -0,0 +1,61 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepDeactivateImage deactivates the image so that nobody can boot it until
+// it's reactivated. It runs once the image data isn't needed anymore, after
+// the other image updates and before the image is protected.
+type stepDeactivateImage struct{}
+
+func (s *stepDeactivateImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	if config.SkipCreateImage || !config.ImageDeactivate {
+		return multistep.ActionContinue
+	}
+
+	imageId := state.Get("image").(string)
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Deactivating image %s", imageId))
+	err = retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+		return deactivateImage(imageClient, imageId)
+	})
+	if err != nil {
+		err = fmt.Errorf("Error deactivating image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepDeactivateImage) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
+
+// deactivateImage calls the Glance deactivate action on the given image.
+func deactivateImage(client *gophercloud.ServiceClient, imageId string) error {
+	_, err := client.Post(client.ServiceURL("images", imageId, "actions", "deactivate"), nil, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{204},
+	})
+	return err
+}
@@ -5,22 +5,39 @@ package openstack
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/gophercloud/gophercloud"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
 type StepDeleteServer struct {
 	UseBlockStorageVolume bool
+	// ClearDeleteOnTermination clears the delete_on_termination flag of the
+	// volume before the server is deleted.
+	ClearDeleteOnTermination bool
+	// ShelveInstance deletes the shelved server, before its snapshot is
+	// taken over as the image.
+	ShelveInstance bool
 }
 
 func (s *StepDeleteServer) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	// Only if we have a blockstorage volume we need to detach it to upload it as an image
-	if !s.UseBlockStorageVolume {
+	if !s.UseBlockStorageVolume && !s.ShelveInstance {
 		return multistep.ActionContinue
 	}
 
 	instance := state.Get("instance_id").(string)
 
+	if s.UseBlockStorageVolume && s.ClearDeleteOnTermination {
+		if err := keepServerVolume(state, instance, state.Get("volume_id").(string)); err != nil {
+			state.Put("error", err)
+			state.Get("ui").(packersdk.Ui).Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
 	err := DeleteServer(state, instance)
 	if err != nil {
 		state.Put("error", err)
@@ -31,3 +48,32 @@ func (s *StepDeleteServer) Run(ctx context.Context, state multistep.StateBag) mu
 
 func (s *StepDeleteServer) Cleanup(state multistep.StateBag) {
 }
+
+// keepServerVolume clears the delete_on_termination flag of the volume
+// attached to the server, so the volume isn't deleted together with it.
+func keepServerVolume(state multistep.StateBag, serverID, volumeID string) error {
+	config := state.Get("config").(*Config)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		return fmt.Errorf("Error initializing compute client: %s", err)
+	}
+
+	// Updating delete_on_termination was added in microversion 2.85.
+	client := withMicroversion(computeClient, "2.85")
+	body := map[string]interface{}{
+		"volumeAttachment": map[string]interface{}{
+			"volumeId":              volumeID,
+			"delete_on_termination": false,
+		},
+	}
+	_, err = client.Put(client.ServiceURL("servers", serverID, "os-volume_attachments", volumeID), body, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		return fmt.Errorf("Error keeping volume %s when deleting the server, "+
+			"boot_volume_delete_on_termination requires the Compute API microversion 2.85: %s", volumeID, err)
+	}
+	return nil
+}
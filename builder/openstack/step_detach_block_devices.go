@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/volumeattach"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepDetachBlockDevices detaches the block_device_mappings volumes with the
+// detach snapshot_mode from the stopped server, so they don't end up in the
+// image.
+type StepDetachBlockDevices struct{}
+
+func (s *StepDetachBlockDevices) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	blockDevices, ok := state.Get("block_device_volumes").([]blockDeviceVolume)
+	if !ok {
+		return multistep.ActionContinue
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+	serverID := state.Get("source_server_id").(string)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	blockStorageClient, err := config.blockStorageV3Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing block storage client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	for _, v := range blockDevices {
+		if v.Mapping.SnapshotMode != "detach" {
+			continue
+		}
+
+		ui.Say(fmt.Sprintf("Detaching volume %s from server: %s ...", v.VolumeID, serverID))
+		if err := volumeattach.Delete(computeClient, serverID, v.VolumeID).ExtractErr(); err != nil {
+			if _, ok := err.(gophercloud.ErrDefault404); !ok {
+				err := fmt.Errorf("Error detaching volume %s (%s): %s", v.VolumeID, volumeAttachmentState(blockStorageClient, v.VolumeID), err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		}
+
+		// A multiattach volume stays in use when attached elsewhere, only
+		// the attachment to this server goes away.
+		if v.Multiattach {
+			log.Printf("[INFO] Waiting for multiattach volume %s to be detached from server %s", v.VolumeID, serverID)
+			stateChange := StateChangeConf{
+				Pending:   []string{"attached", "detaching"},
+				Target:    []string{"detached", "in-use"},
+				Refresh:   volumeAttachmentRefreshFunc(blockStorageClient, v.VolumeID, serverID),
+				Poll:      config.statePolling(),
+				StepState: state,
+			}
+			if _, err := WaitForState(&stateChange); err != nil {
+				err := fmt.Errorf("Error waiting for volume (%s) to detach (%s): %s", v.VolumeID, volumeAttachmentState(blockStorageClient, v.VolumeID), err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+			continue
+		}
+		if err := WaitForVolume(blockStorageClient, v.VolumeID, config.statePolling()); err != nil {
+			err := fmt.Errorf("Error waiting for volume (%s) to detach (%s): %s", v.VolumeID, volumeAttachmentState(blockStorageClient, v.VolumeID), err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepDetachBlockDevices) Cleanup(state multistep.StateBag) {}
+
+// volumeAttachmentState describes the status of the volume and the servers
+// it's attached to, for the detach errors.
+func volumeAttachmentState(blockStorageClient *gophercloud.ServiceClient, volumeID string) string {
+	volume, err := volumes.Get(blockStorageClient, volumeID).Extract()
+	if err != nil {
+		return fmt.Sprintf("unknown attachment state: %s", err)
+	}
+	if len(volume.Attachments) == 0 {
+		return fmt.Sprintf("status %s, not attached", volume.Status)
+	}
+	attachments := make([]string, 0, len(volume.Attachments))
+	for _, a := range volume.Attachments {
+		attachments = append(attachments, fmt.Sprintf("%s as %s", a.ServerID, a.Device))
+	}
+	return fmt.Sprintf("status %s, attached to %s", volume.Status, strings.Join(attachments, ", "))
+}
@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/attachinterfaces"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepDetachNetworks detaches the interfaces attached by StepAttachNetworks
+// before the server is stopped, unless they are to be kept in the image.
+type StepDetachNetworks struct {
+	KeepAttachedNetworks bool
+}
+
+func (s *StepDetachNetworks) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ids, ok := state.GetOk("attached_network_ports")
+	if !ok {
+		return multistep.ActionContinue
+	}
+
+	if s.KeepAttachedNetworks {
+		// The interfaces go away together with the server.
+		state.Remove("attached_network_ports")
+		return multistep.ActionContinue
+	}
+
+	if err := detachNetworks(state, ids.([]string)); err != nil {
+		state.Put("error", err)
+		state.Get("ui").(packersdk.Ui).Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepDetachNetworks) Cleanup(state multistep.StateBag) {}
+
+// detachNetworks detaches the interfaces on the given ports from the server
+// and waits for them to be gone. The ports that are detached are removed
+// from the state bag.
+func detachNetworks(state multistep.StateBag, portIDs []string) error {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+	serverID := state.Get("source_server_id").(string)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		return fmt.Errorf("Error initializing compute client: %s", err)
+	}
+
+	for len(portIDs) > 0 {
+		portID := portIDs[0]
+
+		ui.Say(fmt.Sprintf("Detaching interface %s from server: %s ...", portID, serverID))
+		if err := attachinterfaces.Delete(computeClient, serverID, portID).ExtractErr(); err != nil {
+			if _, ok := err.(gophercloud.ErrDefault404); !ok {
+				return fmt.Errorf("Error detaching interface %s: %s", portID, err)
+			}
+		}
+
+		stateChange := StateChangeConf{
+			Pending: []string{"ACTIVE", "BUILD", "DOWN"},
+			Target:  []string{"DETACHED"},
+			Refresh: InterfaceStateRefreshFunc(computeClient, serverID, portID),
+			Poll:    config.statePolling(),
+		}
+		if _, err := WaitForState(&stateChange); err != nil {
+			return fmt.Errorf("Error waiting for interface (%s) to detach: %s", portID, err)
+		}
+
+		portIDs = portIDs[1:]
+		if len(portIDs) == 0 {
+			state.Remove("attached_network_ports")
+		} else {
+			state.Put("attached_network_ports", portIDs)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/volumeattach"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepDetachVolumes detaches the volumes attached by StepAttachVolumes before
+// the server is stopped, so they don't end up in the image.
+type StepDetachVolumes struct{}
+
+func (s *StepDetachVolumes) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ids, ok := state.GetOk("attached_volumes")
+	if !ok {
+		return multistep.ActionContinue
+	}
+
+	if err := detachVolumes(state, ids.([]string)); err != nil {
+		state.Put("error", err)
+		state.Get("ui").(packersdk.Ui).Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepDetachVolumes) Cleanup(state multistep.StateBag) {}
+
+// detachVolumes detaches the given volumes from the server and waits for
+// them to be detached. The volumes that are detached are removed from the
+// state bag.
+func detachVolumes(state multistep.StateBag, volumeIDs []string) error {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+	serverID := state.Get("source_server_id").(string)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		return fmt.Errorf("Error initializing compute client: %s", err)
+	}
+
+	blockStorageClient, err := config.blockStorageV3Client()
+	if err != nil {
+		return fmt.Errorf("Error initializing block storage client: %s", err)
+	}
+
+	for len(volumeIDs) > 0 {
+		volumeID := volumeIDs[0]
+
+		ui.Say(fmt.Sprintf("Detaching volume %s from server: %s ...", volumeID, serverID))
+		if err := volumeattach.Delete(computeClient, serverID, volumeID).ExtractErr(); err != nil {
+			if _, ok := err.(gophercloud.ErrDefault404); !ok {
+				return fmt.Errorf("Error detaching volume %s (%s): %s",
+					volumeID, volumeAttachmentState(blockStorageClient, volumeID), err)
+			}
+		}
+
+		// A multiattach volume stays in-use when attached elsewhere.
+		stateChange := StateChangeConf{
+			Pending: []string{"attached", "detaching"},
+			Target:  []string{"detached", "in-use"},
+			Refresh: volumeAttachmentRefreshFunc(blockStorageClient, volumeID, serverID),
+			Poll:    config.statePolling(),
+		}
+		if _, err := WaitForState(&stateChange); err != nil {
+			return fmt.Errorf("Error waiting for volume (%s) to detach (%s): %s",
+				volumeID, volumeAttachmentState(blockStorageClient, volumeID), err)
+		}
+
+		volumeIDs = volumeIDs[1:]
+		if len(volumeIDs) == 0 {
+			state.Remove("attached_volumes")
+		} else {
+			state.Put("attached_volumes", volumeIDs)
+		}
+	}
+
+	return nil
+}
@@ -6,6 +6,8 @@ package openstack
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
@@ -15,7 +17,13 @@ import (
 type StepDiscoverNetwork struct {
 	Networks              []string
 	NetworkDiscoveryCIDRs []string
+	IPVersion             int
+	RequireDHCP           bool
+	Tags                  []string
+	MatchAll              bool
 	Ports                 []string
+	InstancePorts         []InstancePort
+	FixedIPs              map[string]string
 }
 
 func (s *StepDiscoverNetwork) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -34,14 +42,35 @@ func (s *StepDiscoverNetwork) Run(ctx context.Context, state multistep.StateBag)
 		networks = append(networks, servers.Network{Port: port})
 	}
 	for _, uuid := range s.Networks {
-		networks = append(networks, servers.Network{UUID: uuid})
+		networks = append(networks, servers.Network{UUID: uuid, FixedIP: s.FixedIPs[uuid]})
+	}
+
+	// The fixed IPs are checked here, the Compute service only reports an
+	// error once the server fails.
+	var fixedIPs []string
+	for networkID, ip := range s.FixedIPs {
+		if err := CheckFixedIP(networkClient, networkID, ip); err != nil {
+			err := fmt.Errorf("Error using the provided network_fixed_ips: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		fixedIPs = append(fixedIPs, ip)
+	}
+	if len(fixedIPs) > 0 {
+		sort.Strings(fixedIPs)
+		state.Put("fixed_ips", fixedIPs)
 	}
 
 	cidrs := s.NetworkDiscoveryCIDRs
-	if len(networks) == 0 && len(cidrs) > 0 {
+	if len(networks) == 0 && len(s.InstancePorts) == 0 && len(cidrs) > 0 {
 		ui.Say("Discovering provisioning network...")
 
-		networkID, err := DiscoverProvisioningNetwork(networkClient, cidrs)
+		networkID, err := DiscoverProvisioningNetwork(networkClient, ProvisioningNetworkOpts{
+			CIDRs:       cidrs,
+			IPVersion:   s.IPVersion,
+			RequireDHCP: s.RequireDHCP,
+		})
 		if err != nil {
 			state.Put("error", err)
 			return multistep.ActionHalt
@@ -51,6 +80,21 @@ func (s *StepDiscoverNetwork) Run(ctx context.Context, state multistep.StateBag)
 		networks = append(networks, servers.Network{UUID: networkID})
 	}
 
+	if len(networks) == 0 && len(s.InstancePorts) == 0 && len(s.Tags) > 0 {
+		ui.Say(fmt.Sprintf("Discovering networks tagged with %s...", strings.Join(s.Tags, ", ")))
+
+		networkIDs, err := DiscoverNetworksByTags(networkClient, s.Tags, !s.MatchAll)
+		if err != nil {
+			state.Put("error", err)
+			return multistep.ActionHalt
+		}
+
+		for _, networkID := range networkIDs {
+			ui.Message(fmt.Sprintf("Found network ID: %s", networkID))
+			networks = append(networks, servers.Network{UUID: networkID})
+		}
+	}
+
 	state.Put("networks", networks)
 	return multistep.ActionContinue
 }
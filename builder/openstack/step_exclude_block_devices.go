@@ -0,0 +1,166 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepExcludeBlockDevices removes the block_device_mappings volumes with the
+// exclude snapshot_mode from the block_device_mapping property of the image,
+// and deletes the snapshots the Compute service took of them.
+type stepExcludeBlockDevices struct{}
+
+func (s *stepExcludeBlockDevices) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	if config.SkipCreateImage {
+		return multistep.ActionContinue
+	}
+
+	blockDevices, _ := state.Get("block_device_volumes").([]blockDeviceVolume)
+	excluded := make(map[string]bool)
+	for _, v := range blockDevices {
+		if v.Mapping.SnapshotMode == "exclude" {
+			excluded[v.VolumeID] = true
+		}
+	}
+	if len(excluded) == 0 {
+		return multistep.ActionContinue
+	}
+
+	imageId := state.Get("image").(string)
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	blockStorageClient, err := config.blockStorageV3Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing block storage client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	image, err := images.Get(imageClient, imageId).Extract()
+	if err != nil {
+		err := fmt.Errorf("Error getting image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	property, ok := image.Properties["block_device_mapping"].(string)
+	if !ok {
+		log.Printf("[INFO] Image %s has no block_device_mapping property, no volume to exclude", imageId)
+		return multistep.ActionContinue
+	}
+
+	var mappings []map[string]interface{}
+	if err := json.Unmarshal([]byte(property), &mappings); err != nil {
+		err := fmt.Errorf("Error parsing the block_device_mapping property of image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	kept, snapshotIDs, err := excludeBlockDeviceMappings(blockStorageClient, mappings, excluded)
+	if err != nil {
+		err := fmt.Errorf("Error excluding volumes from image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if len(kept) == len(mappings) {
+		log.Printf("[INFO] The block_device_mapping property of image %s has no excluded volume", imageId)
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Excluding %d volume(s) from the block_device_mapping property of image %s", len(mappings)-len(kept), imageId))
+	opts := images.UpdateOpts{
+		images.UpdateImageProperty{
+			Op:   images.RemoveOp,
+			Name: "block_device_mapping",
+		},
+	}
+	if len(kept) > 0 {
+		value, err := json.Marshal(kept)
+		if err != nil {
+			err := fmt.Errorf("Error excluding volumes from image %s: %s", imageId, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		opts = images.UpdateOpts{
+			images.UpdateImageProperty{
+				Op:    images.ReplaceOp,
+				Name:  "block_device_mapping",
+				Value: string(value),
+			},
+		}
+	}
+	err = retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+		_, err := images.Update(imageClient, imageId, opts).Extract()
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("Error updating the block_device_mapping property of image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	// The image no longer refers to the snapshots.
+	for _, id := range snapshotIDs {
+		ui.Message(fmt.Sprintf("Deleting volume snapshot: %s", id))
+		if err := snapshots.Delete(blockStorageClient, id).ExtractErr(); err != nil {
+			ui.Error(fmt.Sprintf("Warning: error deleting volume snapshot %s: %s", id, err))
+		}
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepExcludeBlockDevices) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
+
+// excludeBlockDeviceMappings returns the block device mappings of the image
+// property which don't refer to the excluded volumes, directly or through a
+// snapshot of them, and the snapshots of the excluded volumes.
+func excludeBlockDeviceMappings(blockStorageClient *gophercloud.ServiceClient, mappings []map[string]interface{}, excluded map[string]bool) ([]map[string]interface{}, []string, error) {
+	var kept []map[string]interface{}
+	var snapshotIDs []string
+	for _, mapping := range mappings {
+		volumeID, _ := mapping["volume_id"].(string)
+		snapshotID, _ := mapping["snapshot_id"].(string)
+		if volumeID == "" && snapshotID != "" {
+			snapshot, err := snapshots.Get(blockStorageClient, snapshotID).Extract()
+			if err != nil {
+				return nil, nil, fmt.Errorf("error getting volume snapshot %s: %s", snapshotID, err)
+			}
+			volumeID = snapshot.VolumeID
+		}
+		if !excluded[volumeID] {
+			kept = append(kept, mapping)
+			continue
+		}
+		log.Printf("[INFO] Excluding volume %s from the image block device mapping: %v", volumeID, mapping)
+		if snapshotID != "" {
+			snapshotIDs = append(snapshotIDs, snapshotID)
+		}
+	}
+	return kept, snapshotIDs, nil
+}
@@ -0,0 +1,200 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+)
+
+// stepExportImage downloads the image data to image_export_path. Dropped
+// downloads are resumed where they stopped, and the file is verified against
+// the checksum reported by Glance.
+type stepExportImage struct{}
+
+func (s *stepExportImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	if config.SkipCreateImage || config.ImageExportPath == "" {
+		return multistep.ActionContinue
+	}
+
+	imageId := state.Get("image").(string)
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	image, err := images.Get(imageClient, imageId).Extract()
+	if err != nil {
+		err := fmt.Errorf("Error getting image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	path := config.ImageExportPath
+	ui.Say(fmt.Sprintf("Exporting image %s to %s...", imageId, path))
+	err = func() error {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		// Start from scratch, only the downloads of this build are resumed.
+		if err := os.Truncate(path, 0); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		err := retry.Config{
+			Tries: 5,
+			RetryDelay: (&retry.Backoff{
+				InitialBackoff: 2 * time.Second,
+				MaxBackoff:     30 * time.Second,
+				Multiplier:     2,
+			}).Linear,
+		}.Run(ctx, func(context.Context) error {
+			return downloadImageData(ui, imageClient, image, path)
+		})
+		if err != nil {
+			return err
+		}
+
+		return verifyImageData(image, path)
+	}()
+	if err != nil {
+		err := fmt.Errorf("Error exporting image %s to %s: %s", imageId, path, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf("Exported image: %s", path))
+	state.Put("image_export_path", path)
+	return multistep.ActionContinue
+}
+
+func (s *stepExportImage) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
+
+// downloadImageData appends the image data to the file at path, starting
+// from the size of the file.
+func downloadImageData(ui packersdk.Ui, client *gophercloud.ServiceClient, image *images.Image, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	offset := info.Size()
+	if image.SizeBytes > 0 && offset >= image.SizeBytes {
+		return nil
+	}
+
+	headers := map[string]string{}
+	if offset > 0 {
+		log.Printf("[INFO] Resuming the download of image %s at byte %d", image.ID, offset)
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+	resp, err := client.Get(client.ServiceURL("images", image.ID, "file"), nil, &gophercloud.RequestOpts{
+		MoreHeaders:      headers,
+		OkCodes:          []int{200, 206},
+		KeepResponseBody: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Glance sends the whole image when it doesn't support ranges.
+	if offset > 0 && resp.StatusCode == 200 {
+		log.Printf("[INFO] Glance doesn't support resuming downloads, restarting the download of image %s", image.ID)
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		offset = 0
+	}
+
+	body := ui.TrackProgress(filepath.Base(path), offset, image.SizeBytes, resp.Body)
+	defer body.Close()
+
+	_, err = io.Copy(file, body)
+	return err
+}
+
+// verifyImageData checks the file at path against the multihash reported by
+// Glance, or against the MD5 checksum when there's no multihash.
+func verifyImageData(image *images.Image, path string) error {
+	h, expected := imageHash(image)
+	if h == nil {
+		log.Printf("[WARN] Glance didn't report a checksum for image %s, not verifying %s", image.ID, path)
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch, expected %s but got %s", expected, actual)
+	}
+	return nil
+}
+
+// imageHash returns the hash to verify the image data with and the expected
+// value.
+func imageHash(image *images.Image) (hash.Hash, string) {
+	algo, _ := image.Properties["os_hash_algo"].(string)
+	value, _ := image.Properties["os_hash_value"].(string)
+	if h := newHash(algo); value != "" && h != nil {
+		return h, value
+	}
+
+	if image.Checksum != "" {
+		return md5.New(), image.Checksum
+	}
+	return nil, ""
+}
+
+// newHash returns a hash for the given algorithm, or nil when the algorithm
+// isn't supported.
+func newHash(algo string) hash.Hash {
+	switch algo {
+	case "sha512":
+		return sha512.New()
+	case "sha256":
+		return sha256.New()
+	case "md5":
+		return md5.New()
+	}
+	return nil
+}
@@ -20,9 +20,11 @@ import (
 // StepGetPassword reads the password from a booted OpenStack server and sets
 // it on the WinRM config.
 type StepGetPassword struct {
-	Debug     bool
-	Comm      *communicator.Config
-	BuildName string
+	Debug        bool
+	Comm         *communicator.Config
+	BuildName    string
+	Timeout      time.Duration
+	PollInterval time.Duration
 }
 
 func (s *StepGetPassword) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -60,17 +62,42 @@ func (s *StepGetPassword) Run(ctx context.Context, state multistep.StateBag) mul
 		return multistep.ActionHalt
 	}
 
-	for ; password == "" && err == nil; password, err = servers.GetPassword(computeClient, server.ID).ExtractPassword(privateKey.(*rsa.PrivateKey)) {
+	deadline := time.Now().Add(s.Timeout)
+	poll := newPoller(pollConfig{Interval: s.PollInterval})
+	for attempt := 1; ; attempt++ {
+		password, err = servers.GetPassword(computeClient, server.ID).ExtractPassword(privateKey.(*rsa.PrivateKey))
+		throttled := poll.Throttled(err)
+		if err != nil && !throttled {
+			err = fmt.Errorf("Error retrieving the administrator password: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if password != "" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			err := fmt.Errorf("Timeout after %s waiting for the administrator password of server %s. "+
+				"The image must run cloudbase-init with the SetUserPasswordPlugin to post the password, "+
+				"or set winrm_password instead", s.Timeout, server.ID)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
 
 		// Check for an interrupt in between attempts.
 		if _, ok := state.GetOk(multistep.StateCancelled); ok {
 			return multistep.ActionHalt
 		}
 
-		log.Printf("Retrying to get a administrator password evry 5 seconds.")
-		time.Sleep(5 * time.Second)
+		if !throttled {
+			ui.Message(fmt.Sprintf("Password not available yet (attempt %d), retrying in %s...", attempt, s.PollInterval))
+		}
+		poll.Wait()
 	}
 
+	packersdk.LogSecretFilter.Set(password)
 	ui.Message("Password retrieved!")
 	s.Comm.WinRMPassword = password
 
@@ -80,8 +107,6 @@ func (s *StepGetPassword) Run(ctx context.Context, state multistep.StateBag) mul
 			"Password (since debug is enabled) \"%s\"", s.Comm.WinRMPassword))
 	}
 
-	packersdk.LogSecretFilter.Set(s.Comm.WinRMPassword)
-
 	return multistep.ActionContinue
 }
 
@@ -0,0 +1,152 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepImageRetention retires the older images of the build according to
+// image_retention. It runs once the image is complete, and failing to retire
+// an image doesn't fail the build.
+type stepImageRetention struct{}
+
+func (s *stepImageRetention) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+	retention := &config.ImageRetention
+
+	if config.SkipCreateImage || retention.Keep == 0 {
+		return multistep.ActionContinue
+	}
+
+	imageId := state.Get("image").(string)
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Applying image retention, keeping %d images...", retention.Keep))
+	imgs, err := retentionImages(imageClient, config)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error listing images for image retention, no image was retired: %s", err))
+		return multistep.ActionContinue
+	}
+
+	for _, image := range retention.retiredImages(imgs, imageId) {
+		if image.Protected {
+			ui.Message(fmt.Sprintf("Not retiring protected image: %s (%s)", image.Name, image.ID))
+			continue
+		}
+
+		inUse, err := imageInUse(computeClient, image.ID)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Error checking whether image %s is in use, not retiring it: %s", image.ID, err))
+			continue
+		}
+		if inUse {
+			ui.Message(fmt.Sprintf("Not retiring image used by servers: %s (%s)", image.Name, image.ID))
+			continue
+		}
+
+		if retention.DryRun {
+			ui.Message(fmt.Sprintf("Would %s image: %s (%s), created at %s",
+				retention.Action, image.Name, image.ID, image.CreatedAt))
+			continue
+		}
+
+		ui.Message(fmt.Sprintf("Retiring image with action %s: %s (%s)", retention.Action, image.Name, image.ID))
+		if err := retireImage(imageClient, image, retention); err != nil {
+			ui.Error(fmt.Sprintf("Error retiring image %s: %s", image.ID, err))
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepImageRetention) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
+
+// retentionImages lists the images of the project matched by
+// image_retention.
+func retentionImages(client *gophercloud.ServiceClient, config *Config) ([]images.Image, error) {
+	projectID, err := config.projectID()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := images.ListOpts{
+		Owner: projectID,
+	}
+	if config.ImageRetention.NamePrefix == "" && config.ImageRetention.NameRegex == "" {
+		opts.Name = config.ImageName
+	}
+
+	allPages, err := images.List(client, opts).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	allImages, err := images.ExtractImages(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	var imgs []images.Image
+	for _, image := range allImages {
+		if image.Owner == projectID && config.ImageRetention.matches(config.ImageName, image.Name) {
+			imgs = append(imgs, image)
+		}
+	}
+	return imgs, nil
+}
+
+// imageInUse tells whether servers of the project are booted from the image.
+func imageInUse(client *gophercloud.ServiceClient, imageId string) (bool, error) {
+	allPages, err := servers.List(client, servers.ListOpts{
+		Image: imageId,
+	}).AllPages()
+	if err != nil {
+		return false, err
+	}
+	srvs, err := servers.ExtractServers(allPages)
+	if err != nil {
+		return false, err
+	}
+	return len(srvs) > 0, nil
+}
+
+func retireImage(client *gophercloud.ServiceClient, image images.Image, retention *ImageRetention) error {
+	switch retention.Action {
+	case "deactivate":
+		return deactivateImage(client, image.ID)
+	case "rename":
+		_, err := images.Update(client, image.ID, images.UpdateOpts{
+			images.ReplaceImageName{
+				NewName: image.Name + retention.RenameSuffix,
+			},
+		}).Extract()
+		return err
+	default:
+		return images.Delete(client, image.ID).ExtractErr()
+	}
+}
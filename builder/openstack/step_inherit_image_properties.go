@@ -0,0 +1,85 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepInheritImageProperties copies the image_inherit_properties allowed
+// properties of the source image onto the image, and removes the denied
+// ones.
+type stepInheritImageProperties struct{}
+
+func (s *stepInheritImageProperties) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	if config.SkipCreateImage || config.ImageInheritProperties.empty() {
+		return multistep.ActionContinue
+	}
+
+	imageId := state.Get("image").(string)
+	// An existing server booted from a volume has no source image.
+	sourceImageId, ok := state.Get("source_image").(string)
+	if !ok {
+		err := fmt.Errorf("Error inheriting image properties: the server wasn't booted from an image")
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	sourceImage, err := images.Get(imageClient, sourceImageId).Extract()
+	if err != nil {
+		err := fmt.Errorf("Error getting source image %s: %s", sourceImageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	image, err := images.Get(imageClient, imageId).Extract()
+	if err != nil {
+		err := fmt.Errorf("Error getting image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	opts := config.ImageInheritProperties.updateOpts(sourceImage, image, state.Get("image_metadata").(map[string]string))
+	if len(opts) == 0 {
+		log.Printf("[INFO] Image %s already has the inherited properties", imageId)
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Updating the properties of image %s from source image %s", imageId, sourceImageId))
+	err = retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+		image, err = images.Update(imageClient, imageId, opts).Extract()
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("Error updating the properties of image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	log.Printf("[INFO] Properties of image %s: %v", imageId, image.Properties)
+	return multistep.ActionContinue
+}
+
+func (s *stepInheritImageProperties) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"runtime"
 
+	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
@@ -19,6 +20,8 @@ type StepKeyPair struct {
 	Debug        bool
 	Comm         *communicator.Config
 	DebugKeyPath string
+	// SavePath is where the generated private key is saved, if set.
+	SavePath string
 
 	doCleanup bool
 }
@@ -72,7 +75,14 @@ func (s *StepKeyPair) Run(ctx context.Context, state multistep.StateBag) multist
 		PublicKey: string(s.Comm.SSHPublicKey),
 	}).Err
 	if err != nil {
-		state.Put("error", fmt.Errorf("Error uploading temporary keypair to compute server: %s", err))
+		_, badRequest := err.(gophercloud.ErrDefault400)
+		err = fmt.Errorf("Error uploading temporary keypair to compute server: %s", err)
+		// Older Compute services only accept RSA, DSA and ECDSA keys.
+		if keyType := s.Comm.SSHTemporaryKeyPairType; badRequest && keyType != "" && keyType != "rsa" {
+			err = fmt.Errorf("%s\n\nThe Compute service may not support %s keys, try setting temporary_key_pair_type to rsa", err, keyType)
+		}
+		state.Put("error", err)
+		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
 
@@ -82,26 +92,22 @@ func (s *StepKeyPair) Run(ctx context.Context, state multistep.StateBag) multist
 	// directory.
 	if s.Debug {
 		ui.Message(fmt.Sprintf("Saving key for debug purposes: %s", s.DebugKeyPath))
-		f, err := os.Create(s.DebugKeyPath)
-		if err != nil {
+		if err := writePrivateKey(s.DebugKeyPath, s.Comm.SSHPrivateKey); err != nil {
 			state.Put("error", fmt.Errorf("Error saving debug key: %s", err))
 			return multistep.ActionHalt
 		}
-		defer f.Close()
+	}
 
-		// Write the key out
-		if _, err := f.Write(s.Comm.SSHPrivateKey); err != nil {
-			state.Put("error", fmt.Errorf("Error saving debug key: %s", err))
+	// The saved key is kept once the build is done, even when it fails.
+	if s.SavePath != "" {
+		ui.Message(fmt.Sprintf("Saving temporary private key: %s", s.SavePath))
+		if err := writePrivateKey(s.SavePath, s.Comm.SSHPrivateKey); err != nil {
+			err = fmt.Errorf("Error saving temporary private key: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
 			return multistep.ActionHalt
 		}
-
-		// Chmod it so that it is SSH ready
-		if runtime.GOOS != "windows" {
-			if err := f.Chmod(0600); err != nil {
-				state.Put("error", fmt.Errorf("Error setting permissions of debug key: %s", err))
-				return multistep.ActionHalt
-			}
-		}
+		state.Put("temporary_key_pair_path", s.SavePath)
 	}
 
 	// we created a temporary key, so remember to clean it up
@@ -136,3 +142,23 @@ func (s *StepKeyPair) Cleanup(state multistep.StateBag) {
 			"Error cleaning up keypair. Please delete the key manually: %s", s.Comm.SSHTemporaryKeyPairName))
 	}
 }
+
+// writePrivateKey writes the private key to the file at path, readable by
+// the user only so that it is SSH ready.
+func writePrivateKey(path string, key []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Chmod it in case the file already existed
+	if runtime.GOOS != "windows" {
+		if err := f.Chmod(0600); err != nil {
+			return fmt.Errorf("error setting permissions: %s", err)
+		}
+	}
+
+	_, err = f.Write(key)
+	return err
+}
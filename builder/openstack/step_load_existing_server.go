@@ -0,0 +1,122 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepLoadExistingServer loads the existing server of instance_id, in place
+// of the steps launching the source server. The server is never deleted.
+type StepLoadExistingServer struct {
+	InstanceID string
+}
+
+func (s *StepLoadExistingServer) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Using existing server: %s", s.InstanceID))
+	server, err := findExistingServer(computeClient, s.InstanceID)
+	if err != nil {
+		err := fmt.Errorf("Error loading existing server %s: %s", s.InstanceID, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if server.Status != "ACTIVE" {
+		err := fmt.Errorf("Existing server %s is %s, it must be ACTIVE", server.ID, server.Status)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Message(fmt.Sprintf("Server ID: %s", server.ID))
+	log.Printf("server id: %s", server.ID)
+
+	// The source image is unknown for a server booted from a volume.
+	if imageID, ok := server.Image["id"].(string); ok && imageID != "" {
+		state.Put("source_image", imageID)
+	}
+	if flavorID, ok := server.Flavor["id"].(string); ok && flavorID != "" {
+		flavor, err := flavors.Get(computeClient, flavorID).Extract()
+		if err != nil {
+			log.Printf("[WARN] Error getting flavor %s of the existing server: %s", flavorID, err)
+			flavor = &flavors.Flavor{ID: flavorID}
+		}
+		state.Put("flavor_id", flavor.ID)
+		state.Put("flavor", flavor)
+	} else if name, ok := server.Flavor["original_name"].(string); ok && name != "" {
+		// Since microversion 2.47, the server has a copy of its flavor, which
+		// may no longer exist, with the flavor name instead of its ID.
+		if flavor, err := loadFlavor(computeClient, name); err != nil {
+			log.Printf("[WARN] Error loading flavor %s of the existing server: %s", name, err)
+		} else {
+			state.Put("flavor_id", flavor.ID)
+			state.Put("flavor", flavor)
+		}
+	}
+
+	state.Put("source_server_id", server.ID)
+	state.Put("server", server)
+	state.Put("instance_id", server.ID)
+	if zone, err := serverAvailabilityZone(computeClient, server.ID); err != nil {
+		log.Printf("[WARN] Error getting the availability zone of server %s: %s", server.ID, err)
+	} else if zone != "" {
+		ui.Message(fmt.Sprintf("Availability zone: %s", zone))
+		state.Put("availability_zone", zone)
+	}
+	return multistep.ActionContinue
+}
+
+// findExistingServer returns the server with the given ID, or else the one
+// with the given name, which must be unique.
+func findExistingServer(client *gophercloud.ServiceClient, idOrName string) (*servers.Server, error) {
+	server, err := servers.Get(client, idOrName).Extract()
+	if err == nil {
+		return server, nil
+	}
+	if _, ok := err.(gophercloud.ErrDefault404); !ok {
+		return nil, err
+	}
+
+	// The name filter of the Compute service is a regular expression.
+	allPages, err := servers.List(client, servers.ListOpts{
+		Name: "^" + regexp.QuoteMeta(idOrName) + "$",
+	}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	allServers, err := servers.ExtractServers(allPages)
+	if err != nil {
+		return nil, err
+	}
+	switch len(allServers) {
+	case 0:
+		return nil, fmt.Errorf("no server with ID or name %s", idOrName)
+	case 1:
+		return &allServers[0], nil
+	}
+	return nil, fmt.Errorf("%d servers are named %s, use the server ID", len(allServers), idOrName)
+}
+
+// Cleanup leaves the existing server alone.
+func (s *StepLoadExistingServer) Cleanup(state multistep.StateBag) {}
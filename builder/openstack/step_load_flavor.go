@@ -7,7 +7,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
 	flavors_utils "github.com/gophercloud/utils/openstack/compute/v2/flavors"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
@@ -16,9 +21,18 @@ import (
 
 // StepLoadFlavor gets the FlavorRef from a Flavor. It first assumes
 // that the Flavor is a ref and verifies it. Otherwise, it tries to find
-// the flavor by name.
+// the flavor by name. Without a Flavor, the flavor whose name matches the
+// FlavorRegex, or else the smallest flavor matching the FlavorFilter, is
+// selected. The FlavorFallbacks are loaded too, for StepRunSourceServer
+// to fall back to.
 type StepLoadFlavor struct {
-	Flavor string
+	Flavor          string
+	FlavorFallbacks []string
+	FlavorFilter    FlavorFilter
+	FlavorRegex     *regexp.Regexp
+	RegexSelect     string
+	EphemeralSizeGB int
+	SwapSizeMB      int
 }
 
 func (s *StepLoadFlavor) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -33,34 +47,228 @@ func (s *StepLoadFlavor) Run(ctx context.Context, state multistep.StateBag) mult
 		return multistep.ActionHalt
 	}
 
-	ui.Say(fmt.Sprintf("Loading flavor: %s", s.Flavor))
-	log.Printf("[INFO] Loading flavor by ID: %s", s.Flavor)
-	flavor, err := flavors.Get(client, s.Flavor).Extract()
-	if err != nil {
-		log.Printf("[ERROR] Failed to find flavor by ID: %s", err)
-		geterr := err
-
-		log.Printf("[INFO] Loading flavor by name: %s", s.Flavor)
-		id, err := flavors_utils.IDFromName(client, s.Flavor)
+	if s.Flavor == "" {
+		ui.Say("Selecting flavor...")
+		flavor, err := s.selectFlavor(client)
 		if err != nil {
-			log.Printf("[ERROR] Failed to find flavor by name: %s", err)
-			err = fmt.Errorf(
-				"Unable to find specified flavor by ID or name!\n\n"+
-					"Error from ID lookup: %s\n\n"+
-					"Error from name lookup: %s",
-				geterr,
-				err)
+			err := fmt.Errorf("Error selecting flavor: %s", err)
 			state.Put("error", err)
+			ui.Error(err.Error())
 			return multistep.ActionHalt
 		}
+		ui.Message(fmt.Sprintf("Selected flavor %s. ID: %s", flavor.Name, flavor.ID))
+		log.Printf("[INFO] Selected flavor %s (%s): %d vCPUs, %dMB RAM, %dGB disk",
+			flavor.Name, flavor.ID, flavor.VCPUs, flavor.RAM, flavor.Disk)
+		s.checkFlavorDisks(ui, flavor)
+		state.Put("flavor_id", flavor.ID)
+		state.Put("flavor", flavor)
+		return s.loadFallbacks(state, client)
+	}
 
-		flavor = &flavors.Flavor{ID: id}
+	ui.Say(fmt.Sprintf("Loading flavor: %s", s.Flavor))
+	flavor, err := loadFlavor(client, s.Flavor)
+	if err != nil {
+		state.Put("error", err)
+		return multistep.ActionHalt
 	}
 
 	ui.Message(fmt.Sprintf("Verified flavor. ID: %s", flavor.ID))
+	s.checkFlavorDisks(ui, flavor)
 	state.Put("flavor_id", flavor.ID)
+	state.Put("flavor", flavor)
+	return s.loadFallbacks(state, client)
+}
+
+// loadFallbacks loads the FlavorFallbacks, in order.
+func (s *StepLoadFlavor) loadFallbacks(state multistep.StateBag, client *gophercloud.ServiceClient) multistep.StepAction {
+	if len(s.FlavorFallbacks) == 0 {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packersdk.Ui)
+
+	var fallbacks []*flavors.Flavor
+	for _, ref := range s.FlavorFallbacks {
+		flavor, err := loadFlavor(client, ref)
+		if err != nil {
+			err := fmt.Errorf("Error loading fallback flavor %s: %s", ref, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		ui.Message(fmt.Sprintf("Verified fallback flavor %s. ID: %s", ref, flavor.ID))
+		fallbacks = append(fallbacks, flavor)
+	}
+	state.Put("flavor_fallbacks", fallbacks)
 	return multistep.ActionContinue
 }
 
+// loadFlavor gets the flavor with the given ID, or else the given name.
+func loadFlavor(client *gophercloud.ServiceClient, ref string) (*flavors.Flavor, error) {
+	log.Printf("[INFO] Loading flavor by ID: %s", ref)
+	flavor, err := flavors.Get(client, ref).Extract()
+	if err == nil {
+		return flavor, nil
+	}
+	log.Printf("[ERROR] Failed to find flavor by ID: %s", err)
+	geterr := err
+
+	log.Printf("[INFO] Loading flavor by name: %s", ref)
+	id, err := flavors_utils.IDFromName(client, ref)
+	if err != nil {
+		log.Printf("[ERROR] Failed to find flavor by name: %s", err)
+		return nil, fmt.Errorf(
+			"Unable to find specified flavor by ID or name!\n\n"+
+				"Error from ID lookup: %s\n\n"+
+				"Error from name lookup: %s",
+			geterr,
+			err)
+	}
+
+	flavor = &flavors.Flavor{ID: id}
+	if f, err := flavors.Get(client, id).Extract(); err == nil {
+		flavor = f
+	} else {
+		log.Printf("[WARN] Failed to get flavor %s, not checking it: %s", id, err)
+	}
+	return flavor, nil
+}
+
+// selectFlavor lists the flavors available to the project and returns the
+// smallest one matching the FlavorFilter.
+func (s *StepLoadFlavor) selectFlavor(client *gophercloud.ServiceClient) (*flavors.Flavor, error) {
+	allPages, err := flavors.ListDetail(client, flavors.ListOpts{AccessType: flavors.AllAccess}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := flavors.ExtractFlavors(allPages)
+	if err != nil {
+		return nil, err
+	}
+	if s.FlavorRegex != nil {
+		return selectFlavorByRegex(candidates, s.FlavorRegex, s.RegexSelect)
+	}
+	return selectFlavor(candidates, s.FlavorFilter)
+}
+
+// selectFlavorByRegex returns the flavor whose name matches re. When several
+// of them match, the last one by name is returned if regexSelect is name,
+// otherwise it's an error.
+func selectFlavorByRegex(candidates []flavors.Flavor, re *regexp.Regexp, regexSelect string) (*flavors.Flavor, error) {
+	var matches []flavors.Flavor
+	for _, flavor := range candidates {
+		if re.MatchString(flavor.Name) {
+			matches = append(matches, flavor)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return naturalLess(matches[i].Name, matches[j].Name)
+	})
+
+	switch {
+	case len(matches) == 0:
+		return nil, fmt.Errorf("no flavor name matches flavor_regex %s", re)
+	case len(matches) == 1 || regexSelect == "name":
+		return &matches[len(matches)-1], nil
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, flavor := range matches {
+		names = append(names, flavor.Name)
+	}
+	return nil, fmt.Errorf("several flavors match flavor_regex %s, set flavor_regex_select to name to use the last one: %s",
+		re, strings.Join(names, ", "))
+}
+
+// naturalLess compares a and b by their runs of digits by value, and by
+// their other characters as strings, so that "v9" sorts before "v10".
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		chunkA, restA := splitNaturalChunk(a)
+		chunkB, restB := splitNaturalChunk(b)
+		if chunkA != chunkB {
+			numA, errA := strconv.ParseUint(chunkA, 10, 64)
+			numB, errB := strconv.ParseUint(chunkB, 10, 64)
+			if errA == nil && errB == nil && numA != numB {
+				return numA < numB
+			}
+			return chunkA < chunkB
+		}
+		a, b = restA, restB
+	}
+	return a == "" && b != ""
+}
+
+// splitNaturalChunk splits the leading run of digits, or of other
+// characters, from s.
+func splitNaturalChunk(s string) (string, string) {
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	i := 1
+	for i < len(s) && isDigit(s[i]) == isDigit(s[0]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// selectFlavor returns the smallest flavor matching the filter, by RAM then
+// vCPUs, then disk and name so the choice is stable.
+func selectFlavor(candidates []flavors.Flavor, filter FlavorFilter) (*flavors.Flavor, error) {
+	var matches []flavors.Flavor
+	for _, flavor := range candidates {
+		switch {
+		case flavor.VCPUs < filter.MinVCPUs,
+			flavor.RAM < filter.MinRAMMB,
+			flavor.Disk < filter.MinDiskGB,
+			!strings.HasPrefix(flavor.Name, filter.NamePrefix),
+			containsString(filter.Exclude, flavor.Name),
+			containsString(filter.Exclude, flavor.ID):
+			continue
+		}
+		matches = append(matches, flavor)
+	}
+
+	if len(matches) == 0 {
+		names := make([]string, 0, len(candidates))
+		for _, flavor := range candidates {
+			names = append(names, fmt.Sprintf("%s (%d vCPUs, %dMB RAM, %dGB disk)",
+				flavor.Name, flavor.VCPUs, flavor.RAM, flavor.Disk))
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("no flavor matches flavor_filter, the candidates are: %s", strings.Join(names, ", "))
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.RAM != b.RAM {
+			return a.RAM < b.RAM
+		}
+		if a.VCPUs != b.VCPUs {
+			return a.VCPUs < b.VCPUs
+		}
+		if a.Disk != b.Disk {
+			return a.Disk < b.Disk
+		}
+		return a.Name < b.Name
+	})
+	return &matches[0], nil
+}
+
+// checkFlavorDisks warns when the ephemeral or swap disk is larger than what
+// the flavor allows, Nova refuses to launch the server then.
+func (s *StepLoadFlavor) checkFlavorDisks(ui packersdk.Ui, flavor *flavors.Flavor) {
+	// Only flavors found by name lack their details.
+	if flavor.Name == "" {
+		return
+	}
+	if s.EphemeralSizeGB > flavor.Ephemeral {
+		ui.Error(fmt.Sprintf("Warning: ephemeral_size_gb %d is larger than the %d GB ephemeral disk of flavor %s",
+			s.EphemeralSizeGB, flavor.Ephemeral, flavor.Name))
+	}
+	if s.SwapSizeMB > flavor.Swap {
+		ui.Error(fmt.Sprintf("Warning: swap_size_mb %d is larger than the %d MB swap disk of flavor %s",
+			s.SwapSizeMB, flavor.Swap, flavor.Name))
+	}
+}
+
 func (s *StepLoadFlavor) Cleanup(state multistep.StateBag) {
 }
@@ -0,0 +1,78 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+)
+
+func TestNaturalLess(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"v9", "v10", true},
+		{"v10", "v9", false},
+		{"build-worker-v2", "build-worker-v10", true},
+		{"m1.large", "m1.small", true},
+		{"m1", "m1.large", true},
+		{"m1.large", "m1", false},
+		{"m1.large", "m1.large", false},
+		{"v010", "v10", true},
+		{"v10", "v010", false},
+		{"v2.10", "v2.9", false},
+		{"10", "9a", false},
+		{"", "a", true},
+		{"a", "", false},
+	}
+	for _, tc := range cases {
+		if got := naturalLess(tc.a, tc.b); got != tc.expected {
+			t.Errorf("naturalLess(%q, %q): expected %t, got %t", tc.a, tc.b, tc.expected, got)
+		}
+	}
+}
+
+func TestSelectFlavorByRegex(t *testing.T) {
+	candidates := []flavors.Flavor{
+		{ID: "1", Name: "build-worker-v10"},
+		{ID: "2", Name: "build-worker-v9"},
+		{ID: "3", Name: "build-worker-v2"},
+		{ID: "4", Name: "m1.small"},
+	}
+
+	cases := []struct {
+		name        string
+		regex       string
+		regexSelect string
+		expected    string
+		err         string
+	}{
+		{"single match", "m1\\..*", "error", "4", ""},
+		{"no match", "m2\\..*", "error", "", "no flavor name matches flavor_regex"},
+		{"whole name", "build-worker", "name", "", "no flavor name matches flavor_regex"},
+		{"several matches", "build-worker-v.*", "error", "", "several flavors match flavor_regex ^(?:build-worker-v.*)$, set flavor_regex_select to name to use the last one: build-worker-v2, build-worker-v9, build-worker-v10"},
+		{"last by name", "build-worker-v.*", "name", "1", ""},
+	}
+	for _, tc := range cases {
+		re := regexp.MustCompile("^(?:" + tc.regex + ")$")
+		flavor, err := selectFlavorByRegex(candidates, re, tc.regexSelect)
+		if tc.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: err: %s", tc.name, err)
+			continue
+		}
+		if flavor.ID != tc.expected {
+			t.Errorf("%s: expected flavor %s, got %s", tc.name, tc.expected, flavor.ID)
+		}
+	}
+}
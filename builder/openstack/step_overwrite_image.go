@@ -0,0 +1,78 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepOverwriteImage deletes the images of the project with the same name
+// as the created image. It runs once the image is complete, so that a failed
+// build never leaves the name without an image.
+type stepOverwriteImage struct{}
+
+func (s *stepOverwriteImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	if config.SkipCreateImage || !config.OverwriteImage {
+		return multistep.ActionContinue
+	}
+
+	imageId := state.Get("image").(string)
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	projectID, err := config.projectID()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error getting the project ID, no image named %s was deleted: %s", config.ImageName, err))
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Deleting the previous images named %s...", config.ImageName))
+	allPages, err := images.List(imageClient, images.ListOpts{
+		Name:  config.ImageName,
+		Owner: projectID,
+	}).AllPages()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error listing images, no image named %s was deleted: %s", config.ImageName, err))
+		return multistep.ActionContinue
+	}
+	imgs, err := images.ExtractImages(allPages)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error listing images, no image named %s was deleted: %s", config.ImageName, err))
+		return multistep.ActionContinue
+	}
+
+	for _, image := range imgs {
+		if image.ID == imageId || image.Name != config.ImageName || image.Owner != projectID {
+			continue
+		}
+		if image.Protected {
+			ui.Message(fmt.Sprintf("Not deleting protected image: %s", image.ID))
+			continue
+		}
+
+		ui.Message(fmt.Sprintf("Deleting image: %s", image.ID))
+		if err := images.Delete(imageClient, image.ID).ExtractErr(); err != nil {
+			ui.Error(fmt.Sprintf("Error deleting image %s: %s", image.ID, err))
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepOverwriteImage) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/pauseunpause"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepPauseServer keeps the server running for the snapshot instead of
+// stopping it. With the pause snapshot_consistency, the server is paused for
+// a crash-consistent snapshot, and unpaused again during cleanup. With
+// quiesce, it's left running for the Compute service to freeze its
+// filesystems through the QEMU guest agent.
+type StepPauseServer struct {
+	Consistency string
+	paused      bool
+}
+
+func (s *StepPauseServer) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+	server := state.Get("server").(*servers.Server)
+
+	if s.Consistency == "quiesce" {
+		ui.Say(fmt.Sprintf("Keeping server running for a quiesced snapshot: %s ...", server.ID))
+		return multistep.ActionContinue
+	}
+
+	// We need the v2 compute client
+	client, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Pausing server: %s ...", server.ID))
+	if err := pauseunpause.Pause(client, server.ID).ExtractErr(); err != nil {
+		err = fmt.Errorf("Error pausing server: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	s.paused = true
+
+	ui.Message(fmt.Sprintf("Waiting for server to pause: %s ...", server.ID))
+	stateChange := StateChangeConf{
+		Pending:   []string{"ACTIVE"},
+		Target:    []string{"PAUSED"},
+		Refresh:   ServerStateRefreshFunc(client, server.ID),
+		Poll:      config.statePolling(),
+		StepState: state,
+	}
+	if _, err := WaitForState(&stateChange); err != nil {
+		err := fmt.Errorf("Error waiting for server (%s) to pause: %s", server.ID, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	// Keep the description of the server accurate.
+	if description, ok := state.GetOk("instance_description"); ok {
+		pausedDescription := fmt.Sprintf("%s (paused for image creation)", description)
+		if err := updateServerDescription(client, server.ID, pausedDescription); err != nil {
+			log.Printf("[WARN] Error updating the description of server %s: %s", server.ID, err)
+		}
+	}
+	return multistep.ActionContinue
+}
+
+// Cleanup unpauses the server, whether or not the image was created.
+func (s *StepPauseServer) Cleanup(state multistep.StateBag) {
+	if !s.paused {
+		return
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+	server := state.Get("server").(*servers.Server)
+
+	client, err := config.computeV2Client()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error unpausing server %s: %s", server.ID, err))
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Unpausing server: %s ...", server.ID))
+	err = pauseunpause.Unpause(client, server.ID).ExtractErr()
+	if _, ok := err.(gophercloud.ErrDefault404); ok {
+		return
+	}
+	if err == nil {
+		stateChange := StateChangeConf{
+			Pending: []string{"PAUSED"},
+			Target:  []string{"ACTIVE"},
+			Refresh: ServerStateRefreshFunc(client, server.ID),
+			Poll:    config.statePolling(),
+		}
+		_, err = WaitForState(&stateChange)
+	}
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error unpausing server %s: %s", server.ID, err))
+	}
+}
@@ -14,7 +14,10 @@ import (
 )
 
 type StepPreValidate struct {
-	ForceImageName    bool
+	ForceImageName bool
+	// QoSPolicy is the port_qos_policy, resolved to its ID before the
+	// server is launched for StepUpdateInstancePort.
+	QoSPolicy string
 }
 
 func (s *StepPreValidate) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -29,6 +32,25 @@ func (s *StepPreValidate) Run(ctx context.Context, state multistep.StateBag) mul
 		return multistep.ActionHalt
 	}
 
+	if s.QoSPolicy != "" {
+		networkClient, err := config.networkV2Client()
+		if err != nil {
+			err = fmt.Errorf("Error initializing network client: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		policyID, err := CheckQoSPolicy(networkClient, s.QoSPolicy)
+		if err != nil {
+			err := fmt.Errorf("Error using the provided port_qos_policy: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		state.Put("qos_policy_id", policyID)
+	}
+
 	if s.ForceImageName {
 		ui.Say("ForceImageName flag found, skipping prevalidating Image Name")
 		return multistep.ActionContinue
@@ -5,35 +5,68 @@ package openstack
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/availabilityzones"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/bootfromvolume"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/tags"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
 type StepRunSourceServer struct {
-	Name                  string
-	SecurityGroups        []string
-	AvailabilityZone      string
-	UserData              string
-	UserDataFile          string
-	ConfigDrive           bool
-	InstanceMetadata      map[string]string
-	UseBlockStorageVolume bool
-	ForceDelete           bool
-	server                *servers.Server
+	Name             string
+	AvailabilityZone string
+	// AvailabilityZones are tried in turn when the server can't be launched
+	// in one of them, waiting at most AttemptTimeout for each.
+	AvailabilityZones []string
+	AttemptTimeout    time.Duration
+	// SchedulingRetries is the number of times the server is launched again,
+	// SchedulingRetryDelay apart, when it can't be scheduled. The fallback
+	// flavors loaded by StepLoadFlavor are then tried in turn.
+	SchedulingRetries    int
+	SchedulingRetryDelay time.Duration
+	UserData             string
+	UserDataFile         string
+	UserDataParts        []UserDataPart
+	UserDataGzip         bool
+	Personality          []PersonalityFile
+	AdminPassword        string
+	// TrustedImageCertificateIDs are the certificates used to validate the
+	// signature of the source image, they require microversion 2.63.
+	TrustedImageCertificateIDs []string
+	InstanceTags               []string
+	Description                string
+	ConfigDrive                bool
+	InstanceMetadata           map[string]string
+	SchedulerHints             map[string]interface{}
+	UseBlockStorageVolume      bool
+	// DeleteOnTermination tells whether the Compute service deletes the
+	// Block Storage service volume together with the server.
+	DeleteOnTermination  bool
+	EphemeralSizeGB      int
+	EphemeralGuestFormat string
+	SwapSizeMB           int
+	ForceDelete          bool
+	server               *servers.Server
 }
 
 func (s *StepRunSourceServer) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	config := state.Get("config").(*Config)
 	flavor := state.Get("flavor_id").(string)
-	sourceImage := state.Get("source_image").(string)
+	// There's no source image when booting from a source volume.
+	sourceImage, _ := state.Get("source_image").(string)
 	networks := state.Get("networks").([]servers.Network)
+	securityGroups := state.Get("security_groups").([]string)
 	ui := state.Get("ui").(packersdk.Ui)
 
 	// We need the v2 compute client
@@ -53,6 +86,44 @@ func (s *StepRunSourceServer) Run(ctx context.Context, state multistep.StateBag)
 			return multistep.ActionHalt
 		}
 	}
+	if len(s.UserDataParts) > 0 {
+		userData, err = multipartUserData(s.UserDataParts)
+		if err != nil {
+			err = fmt.Errorf("Error assembling user data: %s", err)
+			state.Put("error", err)
+			return multistep.ActionHalt
+		}
+	}
+	if s.UserDataGzip && len(userData) > 0 {
+		userData, err = gzipUserData(userData)
+		if err != nil {
+			err = fmt.Errorf("Error compressing user data: %s", err)
+			state.Put("error", err)
+			return multistep.ActionHalt
+		}
+	}
+	if err := checkUserDataSize(userData); err != nil {
+		err = fmt.Errorf("Error launching source server: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	personality, err := serverPersonality(s.Personality)
+	if err != nil {
+		err = fmt.Errorf("Error launching source server: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if len(personality) > 0 {
+		if err := checkPersonalityLimits(computeClient, personality); err != nil {
+			err = fmt.Errorf("Error launching source server: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
 
 	ui.Say("Launching server...")
 
@@ -60,39 +131,98 @@ func (s *StepRunSourceServer) Run(ctx context.Context, state multistep.StateBag)
 		Name:             s.Name,
 		ImageRef:         sourceImage,
 		FlavorRef:        flavor,
-		SecurityGroups:   s.SecurityGroups,
+		SecurityGroups:   securityGroups,
 		Networks:         networks,
 		AvailabilityZone: s.AvailabilityZone,
 		UserData:         userData,
 		ConfigDrive:      &s.ConfigDrive,
 		ServiceClient:    computeClient,
 		Metadata:         s.InstanceMetadata,
+		Personality:      personality,
+		AdminPass:        s.AdminPassword,
 	}
 
 	var serverOptsExt servers.CreateOptsBuilder
 
+	// The volumes of block_device_mappings follow the root device, then
+	// the ephemeral and swap disks.
+	blockDevices, _ := state.Get("block_device_volumes").([]blockDeviceVolume)
+	extraMappings := blockDeviceMappings(blockDevices)
+	if s.EphemeralSizeGB > 0 {
+		extraMappings = append(extraMappings, bootfromvolume.BlockDevice{
+			BootIndex:           -1,
+			DeleteOnTermination: true,
+			DestinationType:     bootfromvolume.DestinationLocal,
+			SourceType:          bootfromvolume.SourceBlank,
+			GuestFormat:         s.EphemeralGuestFormat,
+			VolumeSize:          s.EphemeralSizeGB,
+		})
+	}
+	if s.SwapSizeMB > 0 {
+		// The size of swap disks is in MB.
+		extraMappings = append(extraMappings, bootfromvolume.BlockDevice{
+			BootIndex:           -1,
+			DeleteOnTermination: true,
+			DestinationType:     bootfromvolume.DestinationLocal,
+			SourceType:          bootfromvolume.SourceBlank,
+			GuestFormat:         "swap",
+			VolumeSize:          s.SwapSizeMB,
+		})
+	}
+
 	// Create root volume in the Block Storage service if required.
 	// Add block device mapping v2 to the server create options if required.
 	if s.UseBlockStorageVolume {
 		volume := state.Get("volume_id").(string)
 		blockDeviceMappingV2 := []bootfromvolume.BlockDevice{
 			{
-				BootIndex:       0,
-				DestinationType: bootfromvolume.DestinationVolume,
-				SourceType:      bootfromvolume.SourceVolume,
-				UUID:            volume,
+				BootIndex:           0,
+				DeleteOnTermination: s.DeleteOnTermination,
+				DestinationType:     bootfromvolume.DestinationVolume,
+				SourceType:          bootfromvolume.SourceVolume,
+				UUID:                volume,
 			},
 		}
 		// ImageRef and block device mapping is an invalid options combination.
 		serverOpts.ImageRef = ""
 		serverOptsExt = bootfromvolume.CreateOptsExt{
 			CreateOptsBuilder: serverOpts,
-			BlockDevice:       blockDeviceMappingV2,
+			BlockDevice:       append(blockDeviceMappingV2, extraMappings...),
+		}
+	} else if len(extraMappings) > 0 {
+		// The root device is the source image on the Compute service local
+		// volume.
+		blockDeviceMappingV2 := []bootfromvolume.BlockDevice{
+			{
+				BootIndex:           0,
+				DeleteOnTermination: true,
+				DestinationType:     bootfromvolume.DestinationLocal,
+				SourceType:          bootfromvolume.SourceImage,
+				UUID:                sourceImage,
+			},
+		}
+		serverOptsExt = bootfromvolume.CreateOptsExt{
+			CreateOptsBuilder: serverOpts,
+			BlockDevice:       append(blockDeviceMappingV2, extraMappings...),
 		}
 	} else {
 		serverOptsExt = serverOpts
 	}
 
+	// Add the device names of the block_device_mappings volumes.
+	deviceNames := []string{""}
+	setDeviceNames := false
+	for _, v := range blockDevices {
+		deviceNames = append(deviceNames, v.Mapping.DeviceName)
+		setDeviceNames = setDeviceNames || v.Mapping.DeviceName != ""
+	}
+	if setDeviceNames {
+		serverOptsExt = blockDeviceNamesExt{
+			CreateOptsBuilder: serverOptsExt,
+			DeviceNames:       deviceNames,
+		}
+	}
+
 	// Add keypair to the server create options.
 	keyName := config.Comm.SSHKeyPairName
 	if keyName != "" {
@@ -102,35 +232,268 @@ func (s *StepRunSourceServer) Run(ctx context.Context, state multistep.StateBag)
 		}
 	}
 
-	ui.Say("Launching server...")
-	s.server, err = servers.Create(computeClient, serverOptsExt).Extract()
-	if err != nil {
-		err := fmt.Errorf("Error launching source server: %s", err)
-		state.Put("error", err)
-		ui.Error(err.Error())
-		return multistep.ActionHalt
+	// Add scheduler hints to the server create options, with the server
+	// group created for the build.
+	schedulerHints := make(map[string]interface{}, len(s.SchedulerHints))
+	for key, value := range s.SchedulerHints {
+		schedulerHints[key] = value
+	}
+	group, _ := state.Get("server_group").(*serverGroup)
+	if group != nil {
+		schedulerHints["group"] = group.ID
+	}
+	if len(schedulerHints) > 0 {
+		log.Printf("[INFO] Using scheduler hints: %v", schedulerHints)
+		serverOptsExt = schedulerHintsExt{
+			CreateOptsBuilder: serverOptsExt,
+			SchedulerHints:    schedulerHints,
+		}
 	}
 
-	ui.Message(fmt.Sprintf("Server ID: %s", s.server.ID))
-	log.Printf("server id: %s", s.server.ID)
-
-	ui.Say("Waiting for server to become ready...")
-	stateChange := StateChangeConf{
-		Pending:   []string{"BUILD"},
-		Target:    []string{"ACTIVE"},
-		Refresh:   ServerStateRefreshFunc(computeClient, s.server.ID),
-		StepState: state,
+	// Trusted image certificates were added in microversion 2.63, booting
+	// with multiattach volumes in 2.60, tags on creation in 2.52 and
+	// descriptions in 2.19. Older clouds get the tags once the server is
+	// created, and no description. A pinned compute_api_microversion is the
+	// newest microversion the build uses, auto going up to the one of the
+	// cloud.
+	multiattach, _ := state.Get("volume_multiattach").(bool)
+	for _, v := range blockDevices {
+		multiattach = multiattach || v.Multiattach
 	}
-	latestServer, err := WaitForState(&stateChange)
-	if err != nil {
-		err := fmt.Errorf("Error waiting for server (%s) to become ready: %s", s.server.ID, err)
-		state.Put("error", err)
-		ui.Error(err.Error())
-		return multistep.ActionHalt
+	var maxMicroversion, limit, microversion string
+	if len(s.TrustedImageCertificateIDs) > 0 || multiattach || len(s.InstanceTags) > 0 || s.Description != "" {
+		maxMicroversion, limit, err = config.maxComputeMicroversion(computeClient)
+		if err != nil && (len(s.TrustedImageCertificateIDs) > 0 || multiattach) {
+			err := fmt.Errorf("Error getting the Compute API microversion: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if err != nil {
+			log.Printf("[WARN] Error getting the Compute API microversion, assuming 2.1: %s", err)
+			maxMicroversion, limit = "2.1", "assuming the cloud supports up to 2.1"
+		}
+	}
+	if len(s.TrustedImageCertificateIDs) > 0 {
+		if !microversionAtLeast(maxMicroversion, "2.63") {
+			err := fmt.Errorf("trusted_image_certificate_ids requires the Compute API microversion 2.63, %s", limit)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		microversion = "2.63"
+		serverOptsExt = trustedImageCertificatesExt{
+			CreateOptsBuilder: serverOptsExt,
+			CertificateIDs:    s.TrustedImageCertificateIDs,
+		}
+	}
+	if multiattach {
+		if !microversionAtLeast(maxMicroversion, "2.60") {
+			err := fmt.Errorf("Booting the server with a multiattach volume requires the Compute API microversion 2.60, %s", limit)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if microversion == "" {
+			microversion = "2.60"
+		}
+	}
+	tagOnCreate := len(s.InstanceTags) > 0 && microversionAtLeast(maxMicroversion, "2.52")
+	if len(s.InstanceTags) > 0 {
+		log.Printf("[INFO] Using instance tags: %s", strings.Join(s.InstanceTags, ", "))
+	}
+	if tagOnCreate {
+		if microversion == "" {
+			microversion = "2.52"
+		}
+		serverOptsExt = instanceTagsExt{
+			CreateOptsBuilder: serverOptsExt,
+			Tags:              s.InstanceTags,
+		}
+	}
+	if s.Description != "" {
+		if microversionAtLeast(maxMicroversion, "2.19") {
+			if microversion == "" {
+				microversion = "2.19"
+			}
+			serverOptsExt = descriptionExt{
+				CreateOptsBuilder: serverOptsExt,
+				Description:       s.Description,
+			}
+			state.Put("instance_description", s.Description)
+		} else {
+			log.Printf("[INFO] Not setting instance_description, it requires the Compute API microversion 2.19, %s", limit)
+		}
+	}
+	createClient := computeClient
+	if microversion != "" {
+		createClient = withMicroversion(computeClient, microversion)
+	}
+	if microversionAtLeast(createClient.Microversion, "2.37") {
+		serverOptsExt = requiredNetworksExt{
+			CreateOptsBuilder: serverOptsExt,
+		}
+	}
+
+	ui.Say("Launching server...")
+	ui.Message(fmt.Sprintf("Server name: %s", s.Name))
+	log.Printf("[INFO] Server name: %s", s.Name)
+	attempts := s.launchAttempts(state)
+	var latestServer interface{}
+	var attempt launchAttempt
+	for i := range attempts {
+		attempt = attempts[i]
+		var next *launchAttempt
+		if i < len(attempts)-1 {
+			next = &attempts[i+1]
+		}
+		log.Printf("[INFO] Launch attempt %d of %d: flavor %s, retry %d, availability zone %q",
+			i+1, len(attempts), attempt.flavorName(flavor), attempt.Retry, attempt.Zone)
+
+		if attempt.Retry > 0 && attempt.ZoneIndex == 0 {
+			select {
+			case <-ctx.Done():
+				state.Put("error", ctx.Err())
+				return multistep.ActionHalt
+			case <-time.After(s.SchedulingRetryDelay):
+			}
+		}
+
+		opts := serverOptsExt
+		if attempt.Flavor != nil {
+			opts = flavorExt{
+				CreateOptsBuilder: opts,
+				FlavorRef:         attempt.Flavor.ID,
+			}
+		}
+		if len(s.AvailabilityZones) > 0 {
+			ui.Message(fmt.Sprintf("Trying availability zone: %s", attempt.Zone))
+			opts = availabilityZoneExt{
+				CreateOptsBuilder: opts,
+				AvailabilityZone:  attempt.Zone,
+			}
+		}
+
+		if group != nil {
+			// The last build of the run deletes the server group when it
+			// has no members, which this server isn't yet.
+			err = withServerGroupLock(group.Name, func() error {
+				if err := group.ensure(ui, computeClient); err != nil {
+					return fmt.Errorf("error creating server group %s: %s", group.Name, err)
+				}
+				schedulerHints["group"] = group.ID
+				s.server, err = servers.Create(createClient, opts).Extract()
+				return err
+			})
+		} else {
+			s.server, err = servers.Create(createClient, opts).Extract()
+		}
+		if err != nil {
+			err := fmt.Errorf("Error launching source server: %s", forcedHostError(personalityError(err), attempt.Zone))
+			if attempt.nextZone(next) {
+				ui.Error(fmt.Sprintf("Warning: %s, trying the next availability zone", err))
+				continue
+			}
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		ui.Message(fmt.Sprintf("Server ID: %s", s.server.ID))
+		log.Printf("server id: %s", s.server.ID)
+		state.Put("source_server_id", s.server.ID)
+		if len(s.InstanceTags) > 0 && !tagOnCreate {
+			tagServer(ui, computeClient, s.server.ID, s.InstanceTags, maxMicroversion, limit)
+		}
+
+		ui.Say("Waiting for server to become ready...")
+		stateChange := StateChangeConf{
+			Pending:   []string{"BUILD"},
+			Target:    []string{"ACTIVE"},
+			Refresh:   ServerStateRefreshFunc(computeClient, s.server.ID),
+			Poll:      config.statePolling(),
+			StepState: state,
+		}
+		if len(s.AvailabilityZones) > 0 {
+			stateChange.Timeout = s.AttemptTimeout
+		}
+		latestServer, err = WaitForState(&stateChange)
+		if err == nil {
+			break
+		}
+
+		// A server that timed out is only launched again in the next
+		// availability zone, one that couldn't be scheduled with any remaining
+		// attempt.
+		interrupted := errors.Is(err, errWaitInterrupted)
+		retry := attempt.nextZone(next)
+		if server, getErr := servers.Get(computeClient, s.server.ID).Extract(); getErr == nil && server.Status == "ERROR" {
+			if server.Fault.Message != "" {
+				err = fmt.Errorf("%s: %s", err, server.Fault.Message)
+			}
+			log.Printf("[INFO] Server %s fault: %d %s", s.server.ID, server.Fault.Code, server.Fault.Message)
+			retry = next != nil && isSchedulingFault(server.Fault)
+		}
+		retry = retry && !interrupted
+		err = fmt.Errorf("Error waiting for server (%s) to become ready: %s", s.server.ID, err)
+		if !retry {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		switch {
+		case attempt.nextZone(next):
+			ui.Error(fmt.Sprintf("Warning: %s, trying the next availability zone", err))
+		case next.Flavor == attempt.Flavor:
+			ui.Error(fmt.Sprintf("Warning: %s, retrying in %s (%d of %d)",
+				err, s.SchedulingRetryDelay, next.Retry, s.SchedulingRetries))
+		default:
+			ui.Error(fmt.Sprintf("Warning: %s, falling back to flavor %s", err, next.flavorName(flavor)))
+		}
+		if err := DeleteServer(state, s.server.ID); err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		s.server = nil
+		state.Remove("source_server_id")
 	}
 
 	s.server = latestServer.(*servers.Server)
 	state.Put("server", s.server)
+	if attempt.Flavor != nil {
+		if original, ok := state.Get("flavor").(*flavors.Flavor); ok && original.Name != "" {
+			state.Put("flavor_fallback_from", original.Name)
+		} else {
+			state.Put("flavor_fallback_from", flavor)
+		}
+		state.Put("flavor_id", attempt.Flavor.ID)
+		state.Put("flavor", attempt.Flavor)
+		ui.Message(fmt.Sprintf("Fell back to flavor: %s", attempt.flavorName(flavor)))
+	}
+	log.Printf("[INFO] Server %s launched with flavor %s", s.server.ID, attempt.flavorName(flavor))
+	if zone, err := serverAvailabilityZone(computeClient, s.server.ID); err != nil {
+		log.Printf("[WARN] Error getting the availability zone of server %s: %s", s.server.ID, err)
+	} else if zone != "" {
+		ui.Message(fmt.Sprintf("Availability zone: %s", zone))
+		state.Put("availability_zone", zone)
+	}
+	if fixedIPs, ok := state.Get("fixed_ips").([]string); ok {
+		for _, ip := range fixedIPs {
+			if !serverHasAddress(s.server, ip) {
+				ui.Error(fmt.Sprintf("Warning: fixed IP %s isn't assigned to server %s", ip, s.server.ID))
+				continue
+			}
+			ui.Message(fmt.Sprintf("Fixed IP: %s", ip))
+			if _, ok := state.GetOk("fixed_ip"); !ok {
+				state.Put("fixed_ip", ip)
+			}
+		}
+	}
+	if err := recordInstancePorts(state, computeClient, s.server.ID); err != nil {
+		log.Printf("[WARN] Error recording ports of server %s: %s", s.server.ID, err)
+	}
 	// instance_id is the generic term used so that users can have access to the
 	// instance id inside of the provisioners, used in step_provision.
 	state.Put("instance_id", s.server.ID)
@@ -150,3 +513,262 @@ func (s *StepRunSourceServer) Cleanup(state multistep.StateBag) {
 		ui.Error(err.Error())
 	}
 }
+
+// launchAttempt is an attempt at launching the source server, with a flavor,
+// in an availability zone.
+type launchAttempt struct {
+	// Flavor is the fallback flavor of the attempt, nil for the flavor of the
+	// build.
+	Flavor    *flavors.Flavor
+	Retry     int
+	Zone      string
+	ZoneIndex int
+}
+
+// launchAttempts returns the attempts at launching the server, in order:
+// every availability zone is tried in each retry, and every retry with each
+// flavor.
+func (s *StepRunSourceServer) launchAttempts(state multistep.StateBag) []launchAttempt {
+	zones := s.AvailabilityZones
+	if len(zones) == 0 {
+		zones = []string{s.AvailabilityZone}
+	}
+	flavorChoices := []*flavors.Flavor{nil}
+	if fallbacks, ok := state.Get("flavor_fallbacks").([]*flavors.Flavor); ok {
+		flavorChoices = append(flavorChoices, fallbacks...)
+	}
+
+	var attempts []launchAttempt
+	for _, flavor := range flavorChoices {
+		for retry := 0; retry <= s.SchedulingRetries; retry++ {
+			for i, zone := range zones {
+				attempts = append(attempts, launchAttempt{
+					Flavor:    flavor,
+					Retry:     retry,
+					Zone:      zone,
+					ZoneIndex: i,
+				})
+			}
+		}
+	}
+	return attempts
+}
+
+// nextZone tells whether the next attempt is in the next availability zone,
+// with the same flavor and retry.
+func (a launchAttempt) nextZone(next *launchAttempt) bool {
+	return next != nil && next.Flavor == a.Flavor && next.Retry == a.Retry
+}
+
+// flavorName returns the name of the flavor of the attempt, or the ID of the
+// flavor of the build.
+func (a launchAttempt) flavorName(flavorID string) string {
+	switch {
+	case a.Flavor == nil:
+		return flavorID
+	case a.Flavor.Name != "":
+		return a.Flavor.Name
+	}
+	return a.Flavor.ID
+}
+
+// flavorExt sets the flavor of the server create options, overriding the
+// one of the base options.
+type flavorExt struct {
+	servers.CreateOptsBuilder
+	FlavorRef string
+}
+
+// ToServerCreateMap sets the flavor in the base server creation options.
+func (opts flavorExt) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	serverMap := base["server"].(map[string]interface{})
+	serverMap["flavorRef"] = opts.FlavorRef
+	return base, nil
+}
+
+// schedulerHintsExt adds the scheduler hints to the server create options.
+// The hints are passed as is, unlike with the schedulerhints extension which
+// validates them.
+type schedulerHintsExt struct {
+	servers.CreateOptsBuilder
+	SchedulerHints map[string]interface{}
+}
+
+// ToServerCreateMap adds the scheduler hints to the base server creation
+// options.
+func (opts schedulerHintsExt) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	base["os:scheduler_hints"] = opts.SchedulerHints
+	return base, nil
+}
+
+// availabilityZoneExt sets the availability zone of the server create
+// options, overriding the one of the base options.
+type availabilityZoneExt struct {
+	servers.CreateOptsBuilder
+	AvailabilityZone string
+}
+
+// ToServerCreateMap sets the availability zone in the base server creation
+// options.
+func (opts availabilityZoneExt) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	serverMap := base["server"].(map[string]interface{})
+	serverMap["availability_zone"] = opts.AvailabilityZone
+	return base, nil
+}
+
+// trustedImageCertificatesExt sets the certificates validating the signature
+// of the image of the server.
+type trustedImageCertificatesExt struct {
+	servers.CreateOptsBuilder
+	CertificateIDs []string
+}
+
+// ToServerCreateMap adds the trusted image certificates to the base server
+// creation options.
+func (opts trustedImageCertificatesExt) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	serverMap := base["server"].(map[string]interface{})
+	serverMap["trusted_image_certificates"] = opts.CertificateIDs
+	return base, nil
+}
+
+// instanceTagsExt sets the tags of the server create options.
+type instanceTagsExt struct {
+	servers.CreateOptsBuilder
+	Tags []string
+}
+
+// ToServerCreateMap adds the tags to the base server creation options.
+func (opts instanceTagsExt) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	serverMap := base["server"].(map[string]interface{})
+	serverMap["tags"] = opts.Tags
+	return base, nil
+}
+
+// descriptionExt sets the description of the server create options.
+type descriptionExt struct {
+	servers.CreateOptsBuilder
+	Description string
+}
+
+// ToServerCreateMap adds the description to the base server creation
+// options.
+func (opts descriptionExt) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	serverMap := base["server"].(map[string]interface{})
+	serverMap["description"] = opts.Description
+	return base, nil
+}
+
+// requiredNetworksExt lets the Compute service allocate the network of the
+// server when none is set, as networks are required since microversion
+// 2.37.
+type requiredNetworksExt struct {
+	servers.CreateOptsBuilder
+}
+
+// ToServerCreateMap sets the networks of the base server creation options
+// when they're missing.
+func (opts requiredNetworksExt) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	serverMap := base["server"].(map[string]interface{})
+	if _, ok := serverMap["networks"]; !ok {
+		serverMap["networks"] = "auto"
+	}
+	return base, nil
+}
+
+// The maximum number of tags of a server, and length of a tag, of the
+// description and of the name the Compute service accepts.
+const (
+	maxInstanceTags            = 50
+	maxInstanceTagSize         = 60
+	maxInstanceDescriptionSize = 255
+	maxInstanceNameSize        = 255
+)
+
+// tagServer sets the tags of a created server with the tags API, added in
+// microversion 2.26, for the clouds that don't support tags on creation.
+// The build goes on without the tags when they can't be set.
+func tagServer(ui packersdk.Ui, computeClient *gophercloud.ServiceClient, serverID string, serverTags []string, maxMicroversion, limit string) {
+	if !microversionAtLeast(maxMicroversion, "2.26") {
+		ui.Error(fmt.Sprintf("Warning: not tagging server %s, instance tags require the Compute API microversion 2.26, %s",
+			serverID, limit))
+		return
+	}
+
+	client := withMicroversion(computeClient, "2.26")
+	_, err := tags.ReplaceAll(client, serverID, tags.ReplaceAllOpts{Tags: serverTags}).Extract()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Warning: error tagging server %s: %s", serverID, err))
+	}
+}
+
+// isSchedulingFault tells whether the server went to ERROR because the
+// scheduler couldn't place it, so that it may be launched elsewhere.
+func isSchedulingFault(fault servers.Fault) bool {
+	return strings.Contains(fault.Message, "No valid host") ||
+		strings.Contains(fault.Message, "Exceeded maximum number of retries")
+}
+
+// splitAvailabilityZone splits an availability zone of the zone:host or
+// zone:host:node form into the zone and the compute host, with the node.
+func splitAvailabilityZone(zone string) (string, string) {
+	zone, host, _ := strings.Cut(zone, ":")
+	return zone, host
+}
+
+// forcedHostError explains the error of the Compute service refusing to
+// force the compute host of the availability zone.
+func forcedHostError(err error, zone string) error {
+	if _, host := splitAvailabilityZone(zone); host == "" {
+		return err
+	}
+	if _, ok := err.(gophercloud.ErrDefault403); ok {
+		return fmt.Errorf("forcing the compute host of availability zone %s requires admin credentials: %s", zone, err)
+	}
+	return err
+}
+
+// serverAvailabilityZone returns the availability zone the server runs in.
+func serverAvailabilityZone(client *gophercloud.ServiceClient, serverID string) (string, error) {
+	var server struct {
+		availabilityzones.ServerAvailabilityZoneExt
+	}
+	if err := servers.Get(client, serverID).ExtractInto(&server); err != nil {
+		return "", err
+	}
+	return server.AvailabilityZone, nil
+}
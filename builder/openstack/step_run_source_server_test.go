@@ -0,0 +1,101 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepRunSourceServer_LaunchAttempts(t *testing.T) {
+	fallback := &flavors.Flavor{ID: "2", Name: "m1.large"}
+
+	cases := []struct {
+		name     string
+		step     StepRunSourceServer
+		flavors  []*flavors.Flavor
+		expected []string
+	}{
+		{
+			name:     "single attempt",
+			step:     StepRunSourceServer{AvailabilityZone: "nova"},
+			expected: []string{"1/0/nova"},
+		},
+		{
+			name:     "availability zones",
+			step:     StepRunSourceServer{AvailabilityZone: "nova", AvailabilityZones: []string{"az1", "az2"}},
+			expected: []string{"1/0/az1", "1/0/az2"},
+		},
+		{
+			name:     "retries",
+			step:     StepRunSourceServer{SchedulingRetries: 2},
+			expected: []string{"1/0/", "1/1/", "1/2/"},
+		},
+		{
+			name:    "everything",
+			step:    StepRunSourceServer{AvailabilityZones: []string{"az1", "az2"}, SchedulingRetries: 1},
+			flavors: []*flavors.Flavor{fallback},
+			expected: []string{
+				"1/0/az1", "1/0/az2", "1/1/az1", "1/1/az2",
+				"m1.large/0/az1", "m1.large/0/az2", "m1.large/1/az1", "m1.large/1/az2",
+			},
+		},
+	}
+	for _, tc := range cases {
+		state := new(multistep.BasicStateBag)
+		if tc.flavors != nil {
+			state.Put("flavor_fallbacks", tc.flavors)
+		}
+
+		var got []string
+		for _, attempt := range tc.step.launchAttempts(state) {
+			got = append(got, fmt.Sprintf("%s/%d/%s", attempt.flavorName("1"), attempt.Retry, attempt.Zone))
+			zones := tc.step.AvailabilityZones
+			if len(zones) > 0 && zones[attempt.ZoneIndex] != attempt.Zone {
+				t.Errorf("%s: zone index %d of %s is wrong", tc.name, attempt.ZoneIndex, attempt.Zone)
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(tc.expected, " ") {
+			t.Errorf("%s: expected attempts %q, got %q", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestLaunchAttempt_NextZone(t *testing.T) {
+	step := StepRunSourceServer{AvailabilityZones: []string{"az1", "az2"}, SchedulingRetries: 1}
+	state := new(multistep.BasicStateBag)
+	state.Put("flavor_fallbacks", []*flavors.Flavor{{ID: "2"}})
+	attempts := step.launchAttempts(state)
+
+	// What the next attempt after each one is: the next availability zone,
+	// a retry of the same flavor, a fallback flavor or nothing.
+	expected := []string{"zone", "retry", "zone", "fallback", "zone", "retry", "zone", "none"}
+	if len(attempts) != len(expected) {
+		t.Fatalf("expected %d attempts, got %d", len(expected), len(attempts))
+	}
+	for i, attempt := range attempts {
+		var next *launchAttempt
+		if i < len(attempts)-1 {
+			next = &attempts[i+1]
+		}
+
+		got := "none"
+		switch {
+		case attempt.nextZone(next):
+			got = "zone"
+		case next == nil:
+		case next.Flavor == attempt.Flavor:
+			got = "retry"
+		default:
+			got = "fallback"
+		}
+		if got != expected[i] {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, expected[i], got)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
+)
+
+// StepSecurityGroups resolves the security groups of the instance to their
+// IDs, so that an unknown or ambiguous name fails the build before anything
+// is created. When no security group is given and source CIDRs are, a
+// temporary security group allowing the communicator in is created instead.
+type StepSecurityGroups struct {
+	SecurityGroups                    []string
+	TemporarySecurityGroupSourceCIDRs []string
+	Comm                              *communicator.Config
+
+	temporaryGroupID string
+}
+
+func (s *StepSecurityGroups) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	securityGroups := []string{}
+	if len(s.SecurityGroups) > 0 || len(s.TemporarySecurityGroupSourceCIDRs) > 0 {
+		// We need the v2 network client
+		networkClient, err := config.networkV2Client()
+		if err != nil {
+			err = fmt.Errorf("Error initializing network client: %s", err)
+			state.Put("error", err)
+			return multistep.ActionHalt
+		}
+
+		if len(s.SecurityGroups) == 0 {
+			groupID, err := s.createTemporaryGroup(ui, networkClient)
+			if err != nil {
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+			securityGroups = append(securityGroups, groupID)
+		}
+
+		if len(s.SecurityGroups) > 0 {
+			ui.Say("Resolving security groups...")
+		}
+		for _, group := range s.SecurityGroups {
+			groupID, err := CheckSecurityGroup(networkClient, group)
+			if err != nil {
+				err := fmt.Errorf("Error using the provided security_groups: %s", err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+			if groupID != group {
+				ui.Message(fmt.Sprintf("Using security group %s (%s)", group, groupID))
+			}
+			securityGroups = append(securityGroups, groupID)
+		}
+	}
+
+	state.Put("security_groups", securityGroups)
+	return multistep.ActionContinue
+}
+
+func (s *StepSecurityGroups) createTemporaryGroup(ui packersdk.Ui, client *gophercloud.ServiceClient) (string, error) {
+	name := fmt.Sprintf("packer_%s", uuid.TimeOrderedUUID())
+
+	ui.Say(fmt.Sprintf("Creating temporary security group: %s", name))
+	group, err := groups.Create(client, groups.CreateOpts{
+		Name:        name,
+		Description: "Temporary security group created by Packer",
+	}).Extract()
+	if err != nil {
+		return "", fmt.Errorf("Error creating temporary security group: %s", err)
+	}
+	s.temporaryGroupID = group.ID
+
+	port := s.Comm.Port()
+	if port == 0 {
+		log.Printf("[DEBUG] No communicator port, not adding any rule to the temporary security group")
+		return group.ID, nil
+	}
+
+	for _, cidr := range s.TemporarySecurityGroupSourceCIDRs {
+		etherType := rules.EtherType4
+		if ip, _, err := net.ParseCIDR(cidr); err == nil && ip.To4() == nil {
+			etherType = rules.EtherType6
+		}
+
+		_, err := rules.Create(client, rules.CreateOpts{
+			Direction:      rules.DirIngress,
+			EtherType:      etherType,
+			Protocol:       rules.ProtocolTCP,
+			PortRangeMin:   port,
+			PortRangeMax:   port,
+			RemoteIPPrefix: cidr,
+			SecGroupID:     group.ID,
+		}).Extract()
+		if err != nil {
+			return "", fmt.Errorf("Error adding rule for %s to temporary security group: %s", cidr, err)
+		}
+		ui.Message(fmt.Sprintf("Allowed port %d from %s", port, cidr))
+	}
+
+	return group.ID, nil
+}
+
+func (s *StepSecurityGroups) Cleanup(state multistep.StateBag) {
+	if s.temporaryGroupID == "" {
+		return
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 network client
+	networkClient, err := config.networkV2Client()
+	if err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error cleaning up temporary security group. Please delete the group manually: %s", s.temporaryGroupID))
+		return
+	}
+
+	ui.Say("Deleting temporary security group...")
+
+	// The ports of the server may take a little while to go away after the
+	// server is deleted, and the group can't be deleted while in use.
+	maxNumErrors := 10
+	poll := newPoller(config.statePolling())
+	for numErrors := 0; ; numErrors++ {
+		err = groups.Delete(networkClient, s.temporaryGroupID).ExtractErr()
+		if err == nil {
+			break
+		}
+		if poll.Throttled(err) {
+			poll.Wait()
+			continue
+		}
+		if _, ok := err.(gophercloud.ErrDefault409); !ok || numErrors >= maxNumErrors {
+			ui.Error(fmt.Sprintf(
+				"Error cleaning up temporary security group. Please delete the group manually: %s: %s",
+				s.temporaryGroupID, err))
+			return
+		}
+		log.Printf("Temporary security group %s still in use, retrying ...", s.temporaryGroupID)
+		poll.Wait()
+	}
+
+	s.temporaryGroupID = ""
+}
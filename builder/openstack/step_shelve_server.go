@@ -0,0 +1,188 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/shelveunshelve"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepShelveServer shelves the server instead of stopping it, and offloads
+// it when Offload is true. The snapshot the Compute service takes when
+// shelving the server is protected until stepCreateImage takes it over, as
+// the Compute service deletes it together with the shelved server.
+type StepShelveServer struct {
+	Offload bool
+}
+
+func (s *StepShelveServer) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+	server := state.Get("server").(*servers.Server)
+
+	// We need the v2 compute client
+	client, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	// We need the v2 image client
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	saveConsoleLogBeforeStop(state, client, server.ID)
+	ui.Say(fmt.Sprintf("Shelving server: %s ...", server.ID))
+	if err := shelveunshelve.Shelve(client, server.ID).ExtractErr(); err != nil {
+		err = fmt.Errorf("Error shelving server: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf("Waiting for server to be shelved: %s ...", server.ID))
+	stateChange := StateChangeConf{
+		Pending:   []string{"ACTIVE", "SHUTOFF", "STOPPED"},
+		Target:    []string{"SHELVED", "SHELVED_OFFLOADED"},
+		Refresh:   ServerStateRefreshFunc(client, server.ID),
+		Poll:      config.statePolling(),
+		StepState: state,
+	}
+	shelved, err := WaitForState(&stateChange)
+	if err != nil {
+		err := fmt.Errorf("Error waiting for server (%s) to be shelved: %s", server.ID, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if s.Offload && shelved.(*servers.Server).Status == "SHELVED" {
+		ui.Say(fmt.Sprintf("Offloading server: %s ...", server.ID))
+		err := shelveunshelve.ShelveOffload(client, server.ID).ExtractErr()
+		// The Compute service may have offloaded it in the meantime.
+		if _, ok := err.(gophercloud.ErrDefault409); ok {
+			log.Printf("[WARN] 409 on offloading the shelved server, continuing")
+			err = nil
+		}
+		if err == nil {
+			stateChange := StateChangeConf{
+				Pending:   []string{"SHELVED"},
+				Target:    []string{"SHELVED_OFFLOADED"},
+				Refresh:   ServerStateRefreshFunc(client, server.ID),
+				Poll:      config.statePolling(),
+				StepState: state,
+			}
+			_, err = WaitForState(&stateChange)
+		}
+		if err != nil {
+			err := fmt.Errorf("Error offloading server (%s): %s", server.ID, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	imageID, err := findShelvedImage(imageClient, server)
+	if err != nil {
+		err := fmt.Errorf("Error finding the snapshot of shelved server %s: %s", server.ID, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Message(fmt.Sprintf("Shelved server snapshot: %s", imageID))
+
+	r := images.Update(imageClient, imageID, images.UpdateOpts{
+		replaceImageProtected{
+			NewProtected: true,
+		},
+	})
+	if _, err := r.Extract(); err != nil {
+		err := fmt.Errorf("Error protecting the snapshot %s of shelved server %s: %s", imageID, server.ID, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	state.Put("shelved_image_id", imageID)
+
+	// Keep the description of the server accurate.
+	if description, ok := state.GetOk("instance_description"); ok {
+		shelvedDescription := fmt.Sprintf("%s (shelved for image creation)", description)
+		if err := updateServerDescription(client, server.ID, shelvedDescription); err != nil {
+			log.Printf("[WARN] Error updating the description of server %s: %s", server.ID, err)
+		}
+	}
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the snapshot of the shelved server when the build didn't
+// get to take it over.
+func (s *StepShelveServer) Cleanup(state multistep.StateBag) {
+	imageID, ok := state.GetOk("shelved_image_id")
+	if !ok {
+		return
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error cleaning up shelved server snapshot. Please delete the image manually: %s", imageID))
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Deleting shelved server snapshot: %s ...", imageID))
+	r := images.Update(imageClient, imageID.(string), images.UpdateOpts{
+		replaceImageProtected{
+			NewProtected: false,
+		},
+	})
+	if _, err = r.Extract(); err == nil {
+		err = images.Delete(imageClient, imageID.(string)).ExtractErr()
+	}
+	if _, ok := err.(gophercloud.ErrDefault404); ok {
+		return
+	}
+	if err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error cleaning up shelved server snapshot. Please delete the image manually: %s: %s", imageID, err))
+	}
+}
+
+// findShelvedImage returns the ID of the snapshot the Compute service took of
+// the shelved server. The snapshot is named after the server, and has its ID
+// in the instance_uuid property.
+func findShelvedImage(imageClient *gophercloud.ServiceClient, server *servers.Server) (string, error) {
+	allPages, err := images.List(imageClient, images.ListOpts{
+		Name: fmt.Sprintf("%s-shelved", server.Name),
+	}).AllPages()
+	if err != nil {
+		return "", err
+	}
+	allImages, err := images.ExtractImages(allPages)
+	if err != nil {
+		return "", err
+	}
+
+	for _, image := range allImages {
+		if uuid, _ := image.Properties["instance_uuid"].(string); uuid == server.ID {
+			return image.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no image named %s-shelved with instance_uuid %s", server.Name, server.ID)
+}
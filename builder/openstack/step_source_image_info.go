@@ -5,12 +5,21 @@ package openstack
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
-	"time"
-
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/imagedata"
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/imageimport"
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/members"
 	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -20,11 +29,20 @@ type StepSourceImageInfo struct {
 	SourceImage                   string
 	SourceImageName               string
 	ExternalSourceImageURL        string
+	SourceImageFile               string
 	ExternalSourceImageFormat     string
 	ExternalSourceImageProperties map[string]string
+	ExternalSourceImageChecksum   string
+	ExternalSourceImageHashAlgo   string
+	KeepSourceImage               bool
 	SourceImageOpts               images.ListOpts
 	SourceMostRecent              bool
 	SourceProperties              map[string]string
+	SourceImageNameRegex          *regexp.Regexp
+	SourceVolume                  string
+	SourceVolumeSnapshot          string
+	AcceptMembership              bool
+	verified                      bool
 }
 
 func PropertiesSatisfied(image *images.Image, props *map[string]string) bool {
@@ -41,6 +59,11 @@ func (s *StepSourceImageInfo) Run(ctx context.Context, state multistep.StateBag)
 	config := state.Get("config").(*Config)
 	ui := state.Get("ui").(packersdk.Ui)
 
+	// The server boots from the source volume or volume snapshot.
+	if s.SourceVolume != "" || s.SourceVolumeSnapshot != "" {
+		return multistep.ActionContinue
+	}
+
 	client, err := config.imageV2Client()
 	if err != nil {
 		err := fmt.Errorf("error creating image client: %s", err)
@@ -50,6 +73,24 @@ func (s *StepSourceImageInfo) Run(ctx context.Context, state multistep.StateBag)
 	}
 
 	if s.ExternalSourceImageURL != "" {
+		info, err := imageimport.Get(client).Extract()
+		if err != nil {
+			err := fmt.Errorf("Error getting the image import methods: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if !containsString(info.ImportMethods.Value, string(imageimport.WebDownloadMethod)) {
+			err := fmt.Errorf("The %s image import method isn't enabled on this cloud, "+
+				"external_source_image_url can't be used", imageimport.WebDownloadMethod)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	if s.ExternalSourceImageURL != "" || s.SourceImageFile != "" {
+
 		createOpts := images.CreateOpts{
 			Name:            s.SourceImageName,
 			ContainerFormat: "bare",
@@ -69,14 +110,20 @@ func (s *StepSourceImageInfo) Run(ctx context.Context, state multistep.StateBag)
 		}
 
 		ui.Say("Created image with ID " + image.ID)
+		s.SourceImage = image.ID
 
-		importOpts := imageimport.CreateOpts{
-			Name: imageimport.WebDownloadMethod,
-			URI:  s.ExternalSourceImageURL,
-		}
+		if s.SourceImageFile != "" {
+			ui.Say("Uploading source image file " + s.SourceImageFile)
+			err = uploadSourceImageFile(ctx, ui, client, image.ID, s.SourceImageFile)
+		} else {
+			importOpts := imageimport.CreateOpts{
+				Name: imageimport.WebDownloadMethod,
+				URI:  s.ExternalSourceImageURL,
+			}
 
-		ui.Say("Importing External Source Image from URL " + s.ExternalSourceImageURL)
-		err = imageimport.Create(client, image.ID, importOpts).ExtractErr()
+			ui.Say("Importing External Source Image from URL " + s.ExternalSourceImageURL)
+			err = imageimport.Create(client, image.ID, importOpts).ExtractErr()
+		}
 
 		if err != nil {
 			err := fmt.Errorf("Error importing source image: %s", err)
@@ -85,47 +132,72 @@ func (s *StepSourceImageInfo) Run(ctx context.Context, state multistep.StateBag)
 			return multistep.ActionHalt
 		}
 
-		for image.Status != images.ImageStatusActive {
-			ui.Message("Image not Active, retrying in 10 seconds")
-			time.Sleep(10 * time.Second)
-
-			img, err := images.Get(client, image.ID).Extract()
+		ui.Message("Waiting for the source image to become active...")
+		if err := waitForImageImport(ctx, client, image.ID, config.statePolling()); err != nil {
+			err := fmt.Errorf("Error importing source image: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
 
-			if err != nil {
-				err := fmt.Errorf("Error querying image: %s", err)
+		if s.ExternalSourceImageChecksum != "" {
+			ui.Message(fmt.Sprintf("Verifying the %s checksum of the source image...", s.ExternalSourceImageHashAlgo))
+			if err := verifyImageChecksum(client, image.ID, s.ExternalSourceImageHashAlgo, s.ExternalSourceImageChecksum); err != nil {
+				err := fmt.Errorf("Error verifying source image: %s", err)
 				state.Put("error", err)
 				ui.Error(err.Error())
 				return multistep.ActionHalt
 			}
-
-			image = img
 		}
-
-		s.SourceImage = image.ID
+		s.verified = true
 	}
 
 	if s.SourceImage != "" {
+		if err := s.acceptMembership(ui, config, client, s.SourceImage); err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
 		state.Put("source_image", s.SourceImage)
 
 		return multistep.ActionContinue
 	}
 
+	// The properties are filtered by Glance, and checked again in case the
+	// cloud ignores some of them.
+	listOpts := []images.ListOptsBuilder{
+		imageListOpts{ListOpts: s.SourceImageOpts, Properties: s.SourceProperties},
+	}
 	if s.SourceImageName != "" {
 		s.SourceImageOpts = images.ListOpts{
 			Name: s.SourceImageName,
 		}
+		if s.AcceptMembership {
+			// Pending shared images are listed too.
+			s.SourceImageOpts.MemberStatus = images.ImageMemberStatusAll
+		}
+		// An image looked up by its name may be hidden, and hidden images
+		// are only listed when asked for.
+		listOpts = []images.ListOptsBuilder{
+			imageListOpts{ListOpts: s.SourceImageOpts, Properties: s.SourceProperties},
+			imageListOpts{ListOpts: s.SourceImageOpts, Properties: s.SourceProperties, Hidden: true},
+		}
 	}
 
 	log.Printf("Using Image Filters %+v", s.SourceImageOpts)
 	image := &images.Image{}
 	count := 0
-	err = images.List(client, s.SourceImageOpts).EachPage(func(page pagination.Page) (bool, error) {
+	var matches []string
+	eachPage := func(page pagination.Page) (bool, error) {
 		imgs, err := images.ExtractImages(page)
 		if err != nil {
 			return false, err
 		}
 
 		for _, img := range imgs {
+			if s.SourceImageNameRegex != nil && !s.SourceImageNameRegex.MatchString(img.Name) {
+				continue
+			}
 			// Check if all Properties are satisfied
 			if PropertiesSatisfied(&img, &s.SourceProperties) {
 				count++
@@ -133,10 +205,7 @@ func (s *StepSourceImageInfo) Run(ctx context.Context, state multistep.StateBag)
 					// Tentatively return this result.
 					*image = img
 				}
-				// Don't iterate over entries we will never use.
-				if count > 1 {
-					break
-				}
+				matches = append(matches, fmt.Sprintf("%s (%s)", img.Name, img.ID))
 			}
 		}
 
@@ -153,10 +222,16 @@ func (s *StepSourceImageInfo) Run(ctx context.Context, state multistep.StateBag)
 				return false, nil
 			}
 			return false, fmt.Errorf(
-				"Your query returned more than one result. Please try a more specific search, or set most_recent to true. Search filters: %+v properties %+v",
-				s.SourceImageOpts, s.SourceProperties)
+				"Your query returned more than one result. Please try a more specific search, or set most_recent to true. Search filters: %+v properties %+v. Matching images: %s",
+				s.SourceImageOpts, s.SourceProperties, strings.Join(matches, ", "))
 		}
-	})
+	}
+	for _, opts := range listOpts {
+		err = images.List(client, opts).EachPage(eachPage)
+		if err != nil || (count > 0 && s.SourceMostRecent) {
+			break
+		}
+	}
 
 	if err != nil {
 		err := fmt.Errorf("Error querying image: %s", err)
@@ -168,22 +243,204 @@ func (s *StepSourceImageInfo) Run(ctx context.Context, state multistep.StateBag)
 	if image.ID == "" {
 		err := fmt.Errorf("No image was found matching filters: %+v properties %+v",
 			s.SourceImageOpts, s.SourceProperties)
+		if s.SourceImageNameRegex != nil {
+			err = fmt.Errorf("No image was found matching filters: %+v name regex %s properties %+v",
+				s.SourceImageOpts, s.SourceImageNameRegex, s.SourceProperties)
+		}
 		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
 
-	ui.Message(fmt.Sprintf("Found Image ID: %s", image.ID))
+	ui.Message(fmt.Sprintf("Found Image ID: %s (name: %s)", image.ID, image.Name))
+
+	if err := s.acceptMembership(ui, config, client, image.ID); err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
 
 	state.Put("source_image", image.ID)
 	return multistep.ActionContinue
 }
 
+// acceptMembership accepts the membership of the project on the source
+// image when it's shared with the project and not accepted yet.
+func (s *StepSourceImageInfo) acceptMembership(ui packersdk.Ui, config *Config, client *gophercloud.ServiceClient, imageId string) error {
+	if !s.AcceptMembership {
+		return nil
+	}
+
+	image, err := images.Get(client, imageId).Extract()
+	if err != nil {
+		return fmt.Errorf("Error getting source image %s: %s", imageId, err)
+	}
+	if image.Visibility != images.ImageVisibilityShared {
+		return nil
+	}
+
+	projectID, err := config.projectID()
+	if err != nil {
+		return fmt.Errorf("Error accepting the membership on source image %s: %s", imageId, err)
+	}
+	if image.Owner == projectID {
+		return nil
+	}
+
+	member, err := members.Get(client, imageId, projectID).Extract()
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			log.Printf("[INFO] Project %s isn't a member of source image %s", projectID, imageId)
+			return nil
+		}
+		return fmt.Errorf("Error getting the membership of project %s on source image %s: %s", projectID, imageId, err)
+	}
+	if member.Status == "accepted" {
+		return nil
+	}
+
+	ui.Say(fmt.Sprintf("Accepting source image %s for project %s (status: %s)", imageId, projectID, member.Status))
+	_, err = members.Update(client, imageId, projectID, members.UpdateOpts{Status: "accepted"}).Extract()
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault403); ok {
+			return fmt.Errorf("Error accepting source image %s, the credentials aren't allowed to "+
+				"update the membership of project %s: %s", imageId, projectID, err)
+		}
+		return fmt.Errorf("Error accepting source image %s for project %s: %s", imageId, projectID, err)
+	}
+	return nil
+}
+
+// uploadSourceImageFile uploads the file at path into the given image. The
+// file is staged and imported through the glance-direct method when the
+// cloud doesn't allow uploads.
+func uploadSourceImageFile(ctx context.Context, ui packersdk.Ui, client *gophercloud.ServiceClient, imageId, path string) error {
+	upload := func(send func(io.Reader) error) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		body := ui.TrackProgress(filepath.Base(path), 0, info.Size(), &contextReader{ctx: ctx, ReadCloser: file})
+		defer body.Close()
+		return send(body)
+	}
+
+	err := upload(func(r io.Reader) error {
+		return imagedata.Upload(client, imageId, r).ExtractErr()
+	})
+	if _, ok := err.(gophercloud.ErrDefault403); !ok {
+		return err
+	}
+
+	log.Printf("[INFO] Uploads aren't allowed, staging image %s instead: %s", imageId, err)
+	err = upload(func(r io.Reader) error {
+		return imagedata.Stage(client, imageId, r).ExtractErr()
+	})
+	if err != nil {
+		return err
+	}
+	return imageimport.Create(client, imageId, imageimport.CreateOpts{
+		Name: imageimport.GlanceDirectMethod,
+	}).ExtractErr()
+}
+
+// contextReader stops reading once the context is done, so that an
+// interrupted build doesn't wait for the upload to finish.
+type contextReader struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// verifyImageChecksum checks the image data against the given checksum,
+// downloading the data when Glance didn't compute a checksum with the same
+// algorithm.
+func verifyImageChecksum(client *gophercloud.ServiceClient, imageId, algo, expected string) error {
+	image, err := images.Get(client, imageId).Extract()
+	if err != nil {
+		return err
+	}
+
+	actual := ""
+	if hashAlgo, _ := image.Properties["os_hash_algo"].(string); hashAlgo == algo {
+		actual, _ = image.Properties["os_hash_value"].(string)
+	} else if algo == "md5" {
+		actual = image.Checksum
+	}
+
+	if actual == "" {
+		log.Printf("[INFO] Glance didn't compute the %s checksum of image %s, downloading it", algo, imageId)
+		data, err := imagedata.Download(client, imageId).Extract()
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+
+		h := newHash(algo)
+		if _, err := io.Copy(h, data); err != nil {
+			return err
+		}
+		actual = hex.EncodeToString(h.Sum(nil))
+	}
+
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch, expected %s but got %s", expected, actual)
+	}
+	return nil
+}
+
+// imageListOpts lists the images matching ListOpts and having the given
+// properties. The hidden images, which Glance leaves out of the image list
+// by default, are listed instead of the other images when Hidden is true.
+type imageListOpts struct {
+	images.ListOpts
+	Properties map[string]string
+	Hidden     bool
+}
+
+// ToImageListQuery formats an imageListOpts into a query string.
+func (opts imageListOpts) ToImageListQuery() (string, error) {
+	q, err := opts.ListOpts.ToImageListQuery()
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(q)
+	if err != nil {
+		return "", err
+	}
+	params := u.Query()
+	for key, value := range opts.Properties {
+		params.Set(key, value)
+	}
+	if opts.Hidden {
+		params.Set("os_hidden", "true")
+	}
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
 func (s *StepSourceImageInfo) Cleanup(state multistep.StateBag) {
-	if s.ExternalSourceImageURL != "" {
+	if (s.ExternalSourceImageURL != "" || s.SourceImageFile != "") && s.SourceImage != "" {
 		config := state.Get("config").(*Config)
 		ui := state.Get("ui").(packersdk.Ui)
 
+		if s.KeepSourceImage && s.verified {
+			ui.Say(fmt.Sprintf("Keeping external source image: %s (image id: %s)", s.SourceImageName, s.SourceImage))
+			return
+		}
+
 		client, err := config.imageV2Client()
 		if err != nil {
 			err := fmt.Errorf("error creating image client: %s", err)
@@ -15,13 +15,22 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
-type StepStopServer struct{}
+// StepStopServer stops the server before the image is created, unless Skip
+// is true for a live snapshot of the running server.
+type StepStopServer struct {
+	Skip bool
+}
 
 func (s *StepStopServer) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 	config := state.Get("config").(*Config)
 	server := state.Get("server").(*servers.Server)
 
+	if s.Skip {
+		ui.Say(fmt.Sprintf("Skipping server stop, taking a live snapshot of server: %s ...", server.ID))
+		return multistep.ActionContinue
+	}
+
 	// We need the v2 compute client
 	client, err := config.computeV2Client()
 	if err != nil {
@@ -30,6 +39,7 @@ func (s *StepStopServer) Run(ctx context.Context, state multistep.StateBag) mult
 		return multistep.ActionHalt
 	}
 
+	saveConsoleLogBeforeStop(state, client, server.ID)
 	ui.Say(fmt.Sprintf("Stopping server: %s ...", server.ID))
 	if err := startstop.Stop(client, server.ID).ExtractErr(); err != nil {
 		if _, ok := err.(gophercloud.ErrDefault409); ok {
@@ -48,6 +58,7 @@ func (s *StepStopServer) Run(ctx context.Context, state multistep.StateBag) mult
 		Pending:   []string{"ACTIVE"},
 		Target:    []string{"SHUTOFF", "STOPPED"},
 		Refresh:   ServerStateRefreshFunc(client, server.ID),
+		Poll:      config.statePolling(),
 		StepState: state,
 	}
 	if _, err := WaitForState(&stateChange); err != nil {
@@ -56,6 +67,14 @@ func (s *StepStopServer) Run(ctx context.Context, state multistep.StateBag) mult
 		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
+
+	// Keep the description of the server accurate.
+	if description, ok := state.GetOk("instance_description"); ok {
+		stoppedDescription := fmt.Sprintf("%s (stopped for image creation)", description)
+		if err := updateServerDescription(client, server.ID, stoppedDescription); err != nil {
+			log.Printf("[WARN] Error updating the description of server %s: %s", server.ID, err)
+		}
+	}
 	return multistep.ActionContinue
 }
 
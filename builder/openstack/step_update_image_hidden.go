@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepUpdateImageHidden hides the image from the default image list.
+type stepUpdateImageHidden struct{}
+
+func (s *stepUpdateImageHidden) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	if config.SkipCreateImage {
+		ui.Say("Skipping image update hidden...")
+		return multistep.ActionContinue
+	}
+
+	imageId := state.Get("image").(string)
+
+	if !config.ImageHidden {
+		return multistep.ActionContinue
+	}
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Hiding image %s", imageId))
+	err = retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+		r := images.Update(
+			imageClient,
+			imageId,
+			images.UpdateOpts{
+				replaceImageHidden{
+					NewHidden: true,
+				},
+			},
+		)
+		_, err := r.Extract()
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("Error hiding image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepUpdateImageHidden) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
+
+// replaceImageHidden represents an updated os_hidden property request.
+type replaceImageHidden struct {
+	NewHidden bool
+}
+
+// ToImagePatchMap assembles a request body based on replaceImageHidden.
+func (r replaceImageHidden) ToImagePatchMap() map[string]interface{} {
+	return map[string]interface{}{
+		"op":    "replace",
+		"path":  "/os_hidden",
+		"value": r.NewHidden,
+	}
+}
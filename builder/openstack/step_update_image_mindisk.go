@@ -6,7 +6,10 @@ package openstack
 import (
 	"context"
 	"fmt"
+	"log"
 
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -14,7 +17,7 @@ import (
 
 type stepUpdateImageMinDisk struct{}
 
-func (s *stepUpdateImageMinDisk) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *stepUpdateImageMinDisk) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 	config := state.Get("config").(*Config)
 
@@ -25,9 +28,36 @@ func (s *stepUpdateImageMinDisk) Run(_ context.Context, state multistep.StateBag
 
 	imageId := state.Get("image").(string)
 
-	if config.ImageMinDisk == 0 {
+	minDisk := config.imageMinDisk
+	if config.autoImageMinDisk {
+		var err error
+		minDisk, err = s.rootDiskSize(state)
+		if err != nil {
+			err := fmt.Errorf("Error computing image min disk: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		log.Printf("[INFO] Computed image min disk: %d", minDisk)
+	}
+
+	var opts images.UpdateOpts
+	if minDisk != 0 {
+		ui.Say(fmt.Sprintf("Updating image min disk to %d", minDisk))
+		opts = append(opts, images.ReplaceImageMinDisk{
+			NewMinDisk: minDisk,
+		})
+	}
+	if config.ImageMinRam != 0 {
+		ui.Say(fmt.Sprintf("Updating image min ram to %d", config.ImageMinRam))
+		opts = append(opts, images.ReplaceImageMinRam{
+			NewMinRam: config.ImageMinRam,
+		})
+	}
+	if len(opts) == 0 {
 		return multistep.ActionContinue
 	}
+
 	imageClient, err := config.imageV2Client()
 	if err != nil {
 		err := fmt.Errorf("Error initializing image service client: %s", err)
@@ -35,27 +65,65 @@ func (s *stepUpdateImageMinDisk) Run(_ context.Context, state multistep.StateBag
 		return multistep.ActionHalt
 	}
 
-	ui.Say(fmt.Sprintf("Updating image min disk to %d", config.ImageMinDisk))
-
-	r := images.Update(
-		imageClient,
-		imageId,
-		images.UpdateOpts{
-			images.ReplaceImageMinDisk{
-				NewMinDisk: config.ImageMinDisk,
-			},
-		},
-	)
-
-	if _, err := r.Extract(); err != nil {
-		err = fmt.Errorf("Error updating image min disk: %s", err)
+	err = retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+		_, err := images.Update(imageClient, imageId, opts).Extract()
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("Error updating image min disk and min ram of image %s: %s", imageId, err)
 		state.Put("error", err)
+		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
 
+	state.Put("image_min_disk", minDisk)
+	state.Put("image_min_ram", config.ImageMinRam)
 	return multistep.ActionContinue
 }
 
 func (s *stepUpdateImageMinDisk) Cleanup(multistep.StateBag) {
 	// No cleanup...
 }
+
+// rootDiskSize returns the size of the root disk the image was created from,
+// which is the boot volume when a block storage volume is used, and the
+// flavor disk otherwise.
+func (s *stepUpdateImageMinDisk) rootDiskSize(state multistep.StateBag) (int, error) {
+	config := state.Get("config").(*Config)
+
+	if config.UseBlockStorageVolume {
+		// We need the v3 block storage client.
+		blockStorageClient, err := config.blockStorageV3Client()
+		if err != nil {
+			return 0, fmt.Errorf("Error initializing block storage client: %s", err)
+		}
+
+		volumeID := state.Get("volume_id").(string)
+		volume, err := volumes.Get(blockStorageClient, volumeID).Extract()
+		if err != nil {
+			return 0, fmt.Errorf("Error getting volume %s: %s", volumeID, err)
+		}
+		return volume.Size, nil
+	}
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		return 0, fmt.Errorf("Error initializing compute client: %s", err)
+	}
+
+	flavorID, ok := state.Get("flavor_id").(string)
+	if !ok {
+		return 0, fmt.Errorf("the flavor of the server is unknown, set image_min_disk to a size instead of auto")
+	}
+	flavor, err := flavors.Get(computeClient, flavorID).Extract()
+	if err != nil {
+		return 0, fmt.Errorf("Error getting flavor %s: %s", flavorID, err)
+	}
+	if flavor.Disk == 0 {
+		// The root disk is then sized after the image, there is nothing to
+		// compute the minimum disk from.
+		return 0, fmt.Errorf("flavor %s has no root disk, set image_min_disk to a size instead of auto", flavorID)
+	}
+	return flavor.Disk, nil
+}
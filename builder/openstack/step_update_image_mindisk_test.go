@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepUpdateImageMinDisk_Auto(t *testing.T) {
+	cases := []struct {
+		name     string
+		disk     int
+		expected []string
+		err      string
+	}{
+		{
+			name: "flavor disk",
+			disk: 20,
+			expected: []string{
+				"GET /flavors/1 ",
+				`PATCH /v2/images/image [{"op":"replace","path":"/min_disk","value":20}]`,
+			},
+		},
+		{
+			name:     "flavor without root disk",
+			expected: []string{"GET /flavors/1 "},
+			err:      "Error computing image min disk: flavor 1 has no root disk, set image_min_disk to a size instead of auto",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := newTestCloud(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/flavors/1":
+					fmt.Fprintf(w, `{"flavor": {"id": "1", "disk": %d}}`, tc.disk)
+				default:
+					fmt.Fprint(w, `{"id": "image", "status": "active"}`)
+				}
+			})
+			state := cloud.state(t)
+			state.Get("config").(*Config).autoImageMinDisk = true
+			state.Put("image", "image")
+			state.Put("flavor_id", "1")
+
+			step := &stepUpdateImageMinDisk{}
+			action := step.Run(context.Background(), state)
+
+			requests := cloud.Requests()
+			if fmt.Sprint(requests) != fmt.Sprint(tc.expected) {
+				t.Fatalf("expected requests %q, got %q", tc.expected, requests)
+			}
+			if tc.err != "" {
+				if action != multistep.ActionHalt {
+					t.Fatalf("expected to halt")
+				}
+				if err := state.Get("error").(error); err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %q", tc.err, err)
+				}
+				return
+			}
+			if action != multistep.ActionContinue {
+				t.Fatalf("expected to continue, got %v", state.Get("error"))
+			}
+			if minDisk := state.Get("image_min_disk").(int); minDisk != tc.disk {
+				t.Fatalf("expected image_min_disk %d in the state, got %d", tc.disk, minDisk)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepUpdateImageProtected protects the image against deletion. It must be
+// the last of the image steps, so that a failed build never leaves a
+// protected image behind.
+type stepUpdateImageProtected struct{}
+
+func (s *stepUpdateImageProtected) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	if config.SkipCreateImage {
+		ui.Say("Skipping image update protected...")
+		return multistep.ActionContinue
+	}
+
+	imageId := state.Get("image").(string)
+
+	if !config.ImageProtected {
+		return multistep.ActionContinue
+	}
+	imageClient, err := config.imageV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing image service client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Protecting image %s", imageId))
+	err = retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+		r := images.Update(
+			imageClient,
+			imageId,
+			images.UpdateOpts{
+				replaceImageProtected{
+					NewProtected: true,
+				},
+			},
+		)
+		_, err := r.Extract()
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("Error protecting image %s: %s", imageId, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("image_protected", true)
+	return multistep.ActionContinue
+}
+
+func (s *stepUpdateImageProtected) Cleanup(multistep.StateBag) {
+	// No cleanup...
+}
+
+// replaceImageProtected represents an updated protected property request.
+type replaceImageProtected struct {
+	NewProtected bool
+}
+
+// ToImagePatchMap assembles a request body based on replaceImageProtected.
+func (r replaceImageProtected) ToImagePatchMap() map[string]interface{} {
+	return map[string]interface{}{
+		"op":    "replace",
+		"path":  "/protected",
+		"value": r.NewProtected,
+	}
+}
@@ -7,10 +7,12 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
-	imageservice "github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
 )
 
 type stepUpdateImageTags struct{}
@@ -36,21 +38,25 @@ func (s *stepUpdateImageTags) Run(ctx context.Context, state multistep.StateBag)
 		return multistep.ActionHalt
 	}
 
-	ui.Say(fmt.Sprintf("Updating image tags to %s", strings.Join(config.ImageTags, ", ")))
-	r := imageservice.Update(
-		imageClient,
-		imageId,
-		imageservice.UpdateOpts{
-			imageservice.ReplaceImageTags{
-				NewTags: config.ImageTags,
-			},
-		},
-	)
-
-	if _, err = r.Extract(); err != nil {
-		err = fmt.Errorf("Error updating image tags: %s", err)
-		state.Put("error", err)
-		return multistep.ActionHalt
+	ui.Say(fmt.Sprintf("Adding image tags %s", strings.Join(config.ImageTags, ", ")))
+	for _, tag := range config.ImageTags {
+		err = retry.Config{
+			Tries:        5,
+			StartTimeout: config.ImageUpdateTimeout,
+			RetryDelay: (&retry.Backoff{
+				InitialBackoff: 2 * time.Second,
+				MaxBackoff:     30 * time.Second,
+				Multiplier:     2,
+			}).Linear,
+		}.Run(ctx, func(context.Context) error {
+			return addImageTag(imageClient, imageId, tag)
+		})
+		if err != nil {
+			err = fmt.Errorf("Error adding tag %s to image %s: %s", tag, imageId, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
 	}
 
 	return multistep.ActionContinue
@@ -59,3 +65,12 @@ func (s *stepUpdateImageTags) Run(ctx context.Context, state multistep.StateBag)
 func (s *stepUpdateImageTags) Cleanup(multistep.StateBag) {
 	// No cleanup...
 }
+
+// addImageTag adds a tag to the image through the Glance tags API, adding a
+// tag the image already has is a no-op.
+func addImageTag(client *gophercloud.ServiceClient, imageId, tag string) error {
+	_, err := client.Put(client.ServiceURL("images", imageId, "tags", tag), nil, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{204},
+	})
+	return err
+}
@@ -36,19 +36,23 @@ func (s *stepUpdateImageVisibility) Run(ctx context.Context, state multistep.Sta
 	}
 
 	ui.Say(fmt.Sprintf("Updating image visibility to %s", config.ImageVisibility))
-	r := imageservice.Update(
-		imageClient,
-		imageId,
-		imageservice.UpdateOpts{
-			imageservice.UpdateVisibility{
-				Visibility: config.ImageVisibility,
+	err = retryImageUpdate(ctx, config.ImageUpdateTimeout, func() error {
+		r := imageservice.Update(
+			imageClient,
+			imageId,
+			imageservice.UpdateOpts{
+				imageservice.UpdateVisibility{
+					Visibility: config.ImageVisibility,
+				},
 			},
-		},
-	)
-
-	if _, err = r.Extract(); err != nil {
-		err = fmt.Errorf("Error updating image visibility: %s", err)
+		)
+		_, err := r.Extract()
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("Error updating image visibility of image %s: %s", imageId, err)
 		state.Put("error", err)
+		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
 
@@ -0,0 +1,274 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/portsecurity"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/qos/policies"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepUpdateInstancePort applies the port level settings to the primary
+// port of the instance once it is running.
+type StepUpdateInstancePort struct {
+	AllowedAddressPairs []AddressPair
+	QoSPolicy           string
+	DNSName             string
+	DNSDomain           string
+	// The pre-existing ports the instance is attached to, their settings are
+	// restored in cleanup.
+	Ports []string
+
+	portID              string
+	previousQoSPolicyID *string
+}
+
+// portWithExtensions is a port along with its port security status and QoS
+// policy.
+type portWithExtensions struct {
+	ports.Port
+	portsecurity.PortSecurityExt
+	policies.QoSPolicyExt
+}
+
+func (s *StepUpdateInstancePort) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if len(s.AllowedAddressPairs) == 0 && s.QoSPolicy == "" && s.DNSName == "" && s.DNSDomain == "" {
+		return multistep.ActionContinue
+	}
+
+	config := state.Get("config").(*Config)
+	server := state.Get("server").(*servers.Server)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	// We need the v2 network client
+	networkClient, err := config.networkV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing network client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	portID, err := GetInstancePortID(computeClient, server.ID, "", false)
+	if err != nil {
+		err := fmt.Errorf("Error getting interfaces of the instance '%s': %s", server.ID, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	var port portWithExtensions
+	if err := ports.Get(networkClient, portID).ExtractInto(&port); err != nil {
+		err := fmt.Errorf("Error getting instance port '%s': %s", portID, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if s.QoSPolicy != "" {
+		policyID := state.Get("qos_policy_id").(string)
+		ui.Say(fmt.Sprintf("Applying QoS policy '%s' to instance port '%s'...", policyID, portID))
+		_, err = ports.Update(networkClient, portID, policies.PortUpdateOptsExt{
+			UpdateOptsBuilder: ports.UpdateOpts{},
+			QoSPolicyID:       &policyID,
+		}).Extract()
+		if err != nil {
+			err := fmt.Errorf("Error applying QoS policy to instance port '%s': %s", portID, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		// Ports that aren't ours outlive the build, their policy is
+		// restored in cleanup.
+		if containsString(s.Ports, portID) {
+			previousQoSPolicyID := port.QoSPolicyID
+			s.portID = portID
+			s.previousQoSPolicyID = &previousQoSPolicyID
+		}
+	}
+
+	if s.DNSName != "" || s.DNSDomain != "" {
+		if err := CheckDNSSupported(networkClient, s.DNSDomain != ""); err != nil {
+			err := fmt.Errorf("Error using port_dns_name or port_dns_domain: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		ui.Say(fmt.Sprintf("Setting DNS name of instance port '%s'...", portID))
+		_, err = ports.Update(networkClient, portID, portDNSUpdateOpts{
+			UpdateOptsBuilder: ports.UpdateOpts{},
+			DNSName:           s.DNSName,
+			DNSDomain:         s.DNSDomain,
+		}).Extract()
+		if err != nil {
+			err := fmt.Errorf("Error setting DNS name of instance port '%s': %s", portID, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	if len(s.AllowedAddressPairs) > 0 {
+		if port.PortSecurityEnabled {
+			if err := s.addAddressPairs(ui, networkClient, port, config.statePolling()); err != nil {
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		} else {
+			ui.Error(fmt.Sprintf(
+				"Port security is disabled on instance port '%s', ignoring allowed_address_pairs", portID))
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+// portDNSUpdateOpts adds the DNS name and domain to the base
+// ports.UpdateOpts. Unlike dns.PortUpdateOptsExt, it supports the domain.
+type portDNSUpdateOpts struct {
+	ports.UpdateOptsBuilder
+	DNSName   string
+	DNSDomain string
+}
+
+func (opts portDNSUpdateOpts) ToPortUpdateMap() (map[string]interface{}, error) {
+	base, err := opts.UpdateOptsBuilder.ToPortUpdateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	port := base["port"].(map[string]interface{})
+	if opts.DNSName != "" {
+		port["dns_name"] = opts.DNSName
+	}
+	if opts.DNSDomain != "" {
+		port["dns_domain"] = opts.DNSDomain
+	}
+
+	return base, nil
+}
+
+func (s *StepUpdateInstancePort) addAddressPairs(ui packersdk.Ui, client *gophercloud.ServiceClient, port portWithExtensions, polling pollConfig) error {
+	// Keep the address pairs already set on the port.
+	pairs := port.AllowedAddressPairs
+	for _, pair := range s.AllowedAddressPairs {
+		if !containsAddressPair(pairs, pair) {
+			pairs = append(pairs, ports.AddressPair{
+				IPAddress:  pair.IPAddress,
+				MACAddress: pair.MACAddress,
+			})
+		}
+	}
+
+	ui.Say(fmt.Sprintf("Adding allowed address pairs to instance port '%s'...", port.ID))
+	_, err := ports.Update(client, port.ID, ports.UpdateOpts{
+		AllowedAddressPairs: &pairs,
+	}).Extract()
+	if err != nil {
+		return fmt.Errorf("Error updating allowed address pairs of instance port '%s': %s", port.ID, err)
+	}
+
+	if err := waitForAddressPairs(client, port.ID, s.AllowedAddressPairs, polling); err != nil {
+		return fmt.Errorf("Error waiting for allowed address pairs of instance port '%s': %s", port.ID, err)
+	}
+
+	ui.Message(fmt.Sprintf("Allowed address pairs added to instance port '%s'", port.ID))
+	return nil
+}
+
+func (s *StepUpdateInstancePort) Cleanup(state multistep.StateBag) {
+	if s.previousQoSPolicyID == nil {
+		return
+	}
+
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 network client
+	networkClient, err := config.networkV2Client()
+	if err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error restoring QoS policy of port '%s': %s", s.portID, err))
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Restoring QoS policy of port '%s'...", s.portID))
+	_, err = ports.Update(networkClient, s.portID, policies.PortUpdateOptsExt{
+		UpdateOptsBuilder: ports.UpdateOpts{},
+		QoSPolicyID:       s.previousQoSPolicyID,
+	}).Extract()
+	if err != nil {
+		ui.Error(fmt.Sprintf(
+			"Error restoring QoS policy of port '%s': %s", s.portID, err))
+		return
+	}
+
+	s.previousQoSPolicyID = nil
+}
+
+// waitForAddressPairs waits for the given address pairs to be part of the port.
+func waitForAddressPairs(client *gophercloud.ServiceClient, portID string, pairs []AddressPair, polling pollConfig) error {
+	maxNumAttempts := 10
+
+	poll := newPoller(polling)
+	missing := len(pairs)
+	for attempt := 1; ; attempt++ {
+		port, err := ports.Get(client, portID).Extract()
+		throttled := poll.Throttled(err)
+		if err != nil && !throttled {
+			return err
+		}
+
+		if !throttled {
+			missing = 0
+			for _, pair := range pairs {
+				if !containsAddressPair(port.AllowedAddressPairs, pair) {
+					missing++
+				}
+			}
+			if missing == 0 {
+				return nil
+			}
+		}
+
+		if attempt >= maxNumAttempts {
+			return fmt.Errorf("%d allowed address pairs still missing after %d attempts", missing, attempt)
+		}
+
+		if !throttled {
+			log.Printf("Waiting for %d allowed address pairs to be set on port %s", missing, portID)
+		}
+		poll.Wait()
+	}
+}
+
+// containsAddressPair returns true whenever `pair` is part of `pairs`. An empty
+// MAC address matches any MAC address, since it defaults to the one of the
+// port.
+func containsAddressPair(pairs []ports.AddressPair, pair AddressPair) bool {
+	for _, p := range pairs {
+		if p.IPAddress == pair.IPAddress && (pair.MACAddress == "" || p.MACAddress == pair.MACAddress) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const (
+	cloudInitStatusCommand     = "cloud-init status --format json"
+	cloudInitLongStatusCommand = "cloud-init status --long"
+	// The cloudbase-init service stops once it's done booting the instance.
+	cloudbaseInitStatusCommand = `powershell -NoProfile -NonInteractive -Command "` +
+		`$s = Get-Service cloudbase-init -ErrorAction SilentlyContinue; ` +
+		`if (-not $s) { 'status: missing' } elseif ($s.Status -ne 'Stopped') { 'status: running' } else { 'status: done'; ` +
+		`Select-String -Path (Join-Path $env:ProgramFiles 'Cloudbase Solutions\Cloudbase-Init\log\cloudbase-init.log') -Pattern ' ERROR ' -ErrorAction SilentlyContinue | ` +
+		`Select-Object -Last 5 | ForEach-Object { 'error: ' + $_.Line } }"`
+)
+
+// StepWaitForCloudInit waits for cloud-init, or cloudbase-init with WinRM,
+// to finish booting the server before the provisioners run.
+type StepWaitForCloudInit struct {
+	Wait          bool
+	WinRM         bool
+	Timeout       time.Duration
+	AllowDegraded bool
+}
+
+// cloudInitStatus is the status cloud-init reports.
+type cloudInitStatus struct {
+	Status   string
+	Degraded bool
+	Errors   []string
+}
+
+func (s *StepWaitForCloudInit) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if !s.Wait {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packersdk.Ui)
+	comm := state.Get("communicator").(packersdk.Communicator)
+
+	name := "cloud-init"
+	if s.WinRM {
+		name = "cloudbase-init"
+	}
+	ui.Say(fmt.Sprintf("Waiting for %s to finish...", name))
+
+	waitCtx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	var status cloudInitStatus
+	for {
+		var err error
+		if s.WinRM {
+			status, err = cloudbaseInitStatus(waitCtx, comm)
+		} else {
+			status, err = linuxCloudInitStatus(waitCtx, comm)
+		}
+		if err == nil && status.Status != "running" && status.Status != "not started" && status.Status != "not run" {
+			break
+		}
+		if err != nil {
+			log.Printf("[WARN] Error getting the %s status: %s", name, err)
+		} else {
+			log.Printf("Waiting for %s, status: %s", name, status.Status)
+		}
+
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				state.Put("error", ctx.Err())
+				return multistep.ActionHalt
+			}
+			err := fmt.Errorf("Timeout after %s waiting for %s to finish, last status: %s", s.Timeout, name, status.Status)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	switch {
+	case status.Status == "missing":
+		err := fmt.Errorf("Error waiting for %s: it isn't installed on the server", name)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	case status.Status == "disabled":
+		ui.Error(fmt.Sprintf("Warning: %s is disabled on the server, not waiting for it", name))
+	case status.Status != "done":
+		err := fmt.Errorf("%s finished with status %s: %s", name, status.Status, strings.Join(status.Errors, "; "))
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	case status.Degraded && s.AllowDegraded:
+		ui.Error(fmt.Sprintf("Warning: %s finished degraded: %s", name, strings.Join(status.Errors, "; ")))
+	case status.Degraded:
+		err := fmt.Errorf("%s finished degraded: %s", name, strings.Join(status.Errors, "; "))
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	default:
+		ui.Message(fmt.Sprintf("%s finished", name))
+	}
+	return multistep.ActionContinue
+}
+
+func (s *StepWaitForCloudInit) Cleanup(state multistep.StateBag) {}
+
+// runCommand runs the command on the server and returns its exit status and
+// output. The error output is only logged.
+func runCommand(ctx context.Context, comm packersdk.Communicator, command string) (int, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := &packersdk.RemoteCmd{
+		Command: command,
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return 0, "", err
+	}
+	exitStatus := cmd.Wait()
+	if stderr.Len() > 0 {
+		log.Printf("[DEBUG] %s: %s", command, stderr.String())
+	}
+	return exitStatus, stdout.String(), nil
+}
+
+// linuxCloudInitStatus returns the cloud-init status, falling back to the
+// text status of the versions of cloud-init without JSON output.
+func linuxCloudInitStatus(ctx context.Context, comm packersdk.Communicator) (cloudInitStatus, error) {
+	exitStatus, output, err := runCommand(ctx, comm, cloudInitStatusCommand)
+	if err != nil {
+		return cloudInitStatus{}, err
+	}
+	if exitStatus == 127 {
+		return cloudInitStatus{Status: "missing"}, nil
+	}
+	if status, ok := parseCloudInitJSON(output); ok {
+		return status, nil
+	}
+
+	_, output, err = runCommand(ctx, comm, cloudInitLongStatusCommand)
+	if err != nil {
+		return cloudInitStatus{}, err
+	}
+	return parseCloudInitText(output), nil
+}
+
+// parseCloudInitJSON parses the output of cloud-init status --format json.
+// The extended status of recent versions tells whether it's degraded.
+func parseCloudInitJSON(output string) (cloudInitStatus, bool) {
+	var result struct {
+		Status         string   `json:"status"`
+		ExtendedStatus string   `json:"extended_status"`
+		Errors         []string `json:"errors"`
+		// The recoverable errors are listed by log level.
+		RecoverableErrors map[string][]string `json:"recoverable_errors"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil || result.Status == "" {
+		return cloudInitStatus{}, false
+	}
+
+	status := cloudInitStatus{
+		Status:   result.Status,
+		Degraded: strings.HasPrefix(result.ExtendedStatus, "degraded"),
+		Errors:   result.Errors,
+	}
+	for level, messages := range result.RecoverableErrors {
+		for _, message := range messages {
+			status.Errors = append(status.Errors, fmt.Sprintf("%s: %s", level, message))
+		}
+	}
+	return status, true
+}
+
+// parseCloudInitText parses the "key: value" lines of the status output of
+// cloud-init and cloudbase-init, the errors being in the detail or error
+// lines. Older versions of cloud-init put the detail on the next line.
+func parseCloudInitText(output string) cloudInitStatus {
+	var status cloudInitStatus
+	detailNext := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if detailNext && line != "" {
+			detailNext = false
+			status.Errors = append(status.Errors, line)
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "status":
+			status.Status = value
+		case "extended_status":
+			status.Degraded = strings.HasPrefix(value, "degraded")
+		case "detail":
+			if value != "" {
+				status.Errors = append(status.Errors, value)
+			}
+			detailNext = value == ""
+		case "error":
+			status.Degraded = true
+			status.Errors = append(status.Errors, value)
+		}
+	}
+	if status.Status == "" {
+		status.Status = "running"
+	}
+	return status
+}
+
+// cloudbaseInitStatus returns the cloudbase-init status. It's degraded when
+// the log has errors, cloudbase-init carrying on when a plugin fails.
+func cloudbaseInitStatus(ctx context.Context, comm packersdk.Communicator) (cloudInitStatus, error) {
+	_, output, err := runCommand(ctx, comm, cloudbaseInitStatusCommand)
+	if err != nil {
+		return cloudInitStatus{}, err
+	}
+	return parseCloudInitText(output), nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCloudInitJSON(t *testing.T) {
+	cases := []struct {
+		name     string
+		output   string
+		ok       bool
+		expected cloudInitStatus
+	}{
+		{
+			name: "done",
+			output: `{
+  "boot_status_code": "enabled-by-generator",
+  "datasource": "openstack",
+  "detail": "DataSourceOpenStackLocal [net,ver=2]",
+  "errors": [],
+  "extended_status": "done",
+  "last_update": "Thu, 01 Jan 1970 00:00:38 +0000",
+  "recoverable_errors": {},
+  "status": "done"
+}`,
+			ok:       true,
+			expected: cloudInitStatus{Status: "done", Errors: []string{}},
+		},
+		{
+			name: "running",
+			output: `{
+  "boot_status_code": "enabled-by-generator",
+  "datasource": "",
+  "detail": "Running in stage: init",
+  "errors": [],
+  "extended_status": "running",
+  "last_update": "Thu, 01 Jan 1970 00:00:21 +0000",
+  "recoverable_errors": {},
+  "status": "running"
+}`,
+			ok:       true,
+			expected: cloudInitStatus{Status: "running", Errors: []string{}},
+		},
+		{
+			name: "degraded",
+			output: `{
+  "boot_status_code": "enabled-by-generator",
+  "datasource": "openstack",
+  "detail": "DataSourceOpenStackLocal [net,ver=2]",
+  "errors": [],
+  "extended_status": "degraded done",
+  "last_update": "Thu, 01 Jan 1970 00:00:38 +0000",
+  "recoverable_errors": {
+    "WARNING": [
+      "Failed at merging in cloud config part from part-001: empty cloud config"
+    ]
+  },
+  "status": "done"
+}`,
+			ok: true,
+			expected: cloudInitStatus{
+				Status:   "done",
+				Degraded: true,
+				Errors:   []string{"WARNING: Failed at merging in cloud config part from part-001: empty cloud config"},
+			},
+		},
+		{
+			name: "error",
+			output: `{
+  "boot_status_code": "enabled-by-generator",
+  "datasource": "openstack",
+  "detail": "DataSourceOpenStackLocal [net,ver=2]",
+  "errors": [
+    "('scripts_user', RuntimeError('Runparts: 1 failures (part-001) in 1 attempted commands'))"
+  ],
+  "extended_status": "error - done",
+  "last_update": "Thu, 01 Jan 1970 00:00:40 +0000",
+  "recoverable_errors": {},
+  "status": "error"
+}`,
+			ok: true,
+			expected: cloudInitStatus{
+				Status: "error",
+				Errors: []string{"('scripts_user', RuntimeError('Runparts: 1 failures (part-001) in 1 attempted commands'))"},
+			},
+		},
+		{
+			name: "without extended status",
+			output: `{
+  "datasource": "openstack",
+  "detail": "DataSourceOpenStackLocal [net,ver=2]",
+  "errors": [],
+  "last_update": "Thu, 01 Jan 1970 00:00:38 +0000",
+  "status": "done"
+}`,
+			ok:       true,
+			expected: cloudInitStatus{Status: "done", Errors: []string{}},
+		},
+		{
+			name:   "without JSON output",
+			output: "usage: /usr/bin/cloud-init status [-h] [-l] [-w]\n/usr/bin/cloud-init status: error: unrecognized arguments: --format json\n",
+		},
+	}
+	for _, tc := range cases {
+		status, ok := parseCloudInitJSON(tc.output)
+		if ok != tc.ok {
+			t.Errorf("%s: expected ok %t, got %t", tc.name, tc.ok, ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(status, tc.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, status)
+		}
+	}
+}
+
+func TestParseCloudInitText(t *testing.T) {
+	cases := []struct {
+		name     string
+		output   string
+		expected cloudInitStatus
+	}{
+		{
+			name:     "done",
+			output:   "status: done\ntime: Thu, 01 Jan 1970 00:00:38 +0000\ndetail:\nDataSourceOpenStackLocal [net,ver=2]\n",
+			expected: cloudInitStatus{Status: "done", Errors: []string{"DataSourceOpenStackLocal [net,ver=2]"}},
+		},
+		{
+			name:     "running",
+			output:   "status: running\ntime: Thu, 01 Jan 1970 00:00:21 +0000\ndetail:\nRunning in stage: init\n",
+			expected: cloudInitStatus{Status: "running", Errors: []string{"Running in stage: init"}},
+		},
+		{
+			name:     "not started",
+			output:   "status: not run\ntime: Thu, 01 Jan 1970 00:00:00 +0000\ndetail:\nCloud-init enabled on systemd\n",
+			expected: cloudInitStatus{Status: "not run", Errors: []string{"Cloud-init enabled on systemd"}},
+		},
+		{
+			name:   "error",
+			output: "status: error\ntime: Thu, 01 Jan 1970 00:00:40 +0000\ndetail:\n('scripts-user', RuntimeError('Runparts: 1 failures in 1 attempted commands'))\n",
+			expected: cloudInitStatus{
+				Status: "error",
+				Errors: []string{"('scripts-user', RuntimeError('Runparts: 1 failures in 1 attempted commands'))"},
+			},
+		},
+		{
+			name:   "degraded",
+			output: "status: done\nextended_status: degraded done\nboot_status_code: enabled-by-generator\nlast_update: Thu, 01 Jan 1970 00:00:38 +0000\ndetail: DataSourceOpenStackLocal [net,ver=2]\n",
+			expected: cloudInitStatus{
+				Status:   "done",
+				Degraded: true,
+				Errors:   []string{"DataSourceOpenStackLocal [net,ver=2]"},
+			},
+		},
+		{
+			name:     "empty",
+			expected: cloudInitStatus{Status: "running"},
+		},
+		{
+			name:   "cloudbase-init errors",
+			output: "status: done\r\nerror: 2023-05-01 10:00:00.000 1234 ERROR cloudbaseinit.init [-] plugin 'SetUserPasswordPlugin' failed\r\n",
+			expected: cloudInitStatus{
+				Status:   "done",
+				Degraded: true,
+				Errors:   []string{"2023-05-01 10:00:00.000 1234 ERROR cloudbaseinit.init [-] plugin 'SetUserPasswordPlugin' failed"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		if status := parseCloudInitText(tc.output); !reflect.DeepEqual(status, tc.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, status)
+		}
+	}
+}
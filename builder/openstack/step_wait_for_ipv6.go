@@ -0,0 +1,116 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepWaitForIPv6 waits for the server to be given a global IPv6 address, so
+// that the communicator can connect to it without a floating IP.
+type StepWaitForIPv6 struct {
+	UseIPv6 bool
+	Timeout time.Duration
+}
+
+func (s *StepWaitForIPv6) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if !s.UseIPv6 {
+		return multistep.ActionContinue
+	}
+
+	config := state.Get("config").(*Config)
+	server := state.Get("server").(*servers.Server)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	// We need the v2 compute client
+	computeClient, err := config.computeV2Client()
+	if err != nil {
+		err = fmt.Errorf("Error initializing compute client: %s", err)
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Waiting for server (%s) to get an IPv6 address...", server.ID))
+	deadline := time.Now().Add(s.Timeout)
+	poll := newPoller(config.statePolling())
+	for {
+		if addr := globalIPv6Address(server); addr != "" {
+			ui.Message(fmt.Sprintf("Found IPv6 address: %s", addr))
+			state.Put("server", server)
+			return multistep.ActionContinue
+		}
+
+		if time.Now().After(deadline) {
+			err := fmt.Errorf("Timeout waiting for server (%s) to get an IPv6 address, found addresses: [%s]",
+				server.ID, strings.Join(serverAddresses(server), ", "))
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		if _, ok := state.GetOk(multistep.StateCancelled); ok {
+			return multistep.ActionHalt
+		}
+
+		log.Printf("Waiting for IPv6 address, currently %v", serverAddresses(server))
+		poll.Wait()
+
+		latest, err := servers.Get(computeClient, server.ID).Extract()
+		if poll.Throttled(err) {
+			continue
+		}
+		if err != nil {
+			err := fmt.Errorf("Error getting server (%s): %s", server.ID, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		server = latest
+	}
+}
+
+func (s *StepWaitForIPv6) Cleanup(state multistep.StateBag) {}
+
+// globalIPv6Address returns the first global unicast IPv6 address of the
+// server, or an empty string if there is none yet.
+func globalIPv6Address(s *servers.Server) string {
+	for _, addr := range serverAddresses(s) {
+		ip := net.ParseIP(addr)
+		if ip != nil && ip.To4() == nil && ip.IsGlobalUnicast() {
+			return addr
+		}
+	}
+	return ""
+}
+
+// serverAddresses returns all the addresses of the server, in all pools.
+func serverAddresses(s *servers.Server) []string {
+	var addrs []string
+	for _, networkAddresses := range s.Addresses {
+		elements, ok := networkAddresses.([]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, element := range elements {
+			address, ok := element.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if addr, ok := address["addr"].(string); ok {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs
+}
@@ -6,7 +6,6 @@ package openstack
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
@@ -36,18 +35,24 @@ func (s *StepWaitForRackConnect) Run(ctx context.Context, state multistep.StateB
 
 	ui.Say(fmt.Sprintf(
 		"Waiting for server (%s) to become RackConnect ready...", server.ID))
+	poll := newPoller(config.statePolling())
 	for {
-		server, err = servers.Get(computeClient, server.ID).Extract()
+		latest, err := servers.Get(computeClient, server.ID).Extract()
+		if poll.Throttled(err) {
+			poll.Wait()
+			continue
+		}
 		if err != nil {
 			return multistep.ActionHalt
 		}
+		server = latest
 
 		if server.Metadata["rackconnect_automation_status"] == "DEPLOYED" {
 			state.Put("server", server)
 			break
 		}
 
-		time.Sleep(2 * time.Second)
+		poll.Wait()
 	}
 
 	return multistep.ActionContinue
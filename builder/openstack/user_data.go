@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+)
+
+// maxUserDataSize is the maximum size of the base64 encoded user data the
+// Compute API accepts.
+const maxUserDataSize = 65535
+
+// multipartUserData assembles the user data parts into a multipart MIME
+// archive, as cloud-init expects when combining several of them.
+func multipartUserData(parts []UserDataPart) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range parts {
+		content, err := ioutil.ReadFile(part.File)
+		if err != nil {
+			return nil, fmt.Errorf("error reading user data part: %s", err)
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", fmt.Sprintf("%s; charset=\"utf-8\"", part.ContentType))
+		header.Set("MIME-Version", "1.0")
+		header.Set("Content-Transfer-Encoding", "8bit")
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(part.File)))
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var archive bytes.Buffer
+	fmt.Fprintf(&archive, "Content-Type: multipart/mixed; boundary=%q\r\n", writer.Boundary())
+	fmt.Fprintf(&archive, "MIME-Version: 1.0\r\n\r\n")
+	archive.Write(body.Bytes())
+	return archive.Bytes(), nil
+}
+
+// gzipUserData compresses the user data, cloud-init detects and decompresses
+// it.
+func gzipUserData(userData []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(userData); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkUserDataSize checks that the user data fits in the Compute API limit
+// once base64 encoded.
+func checkUserDataSize(userData []byte) error {
+	if size := base64.StdEncoding.EncodedLen(len(userData)); size > maxUserDataSize {
+		return fmt.Errorf("user data is %d bytes once base64 encoded, larger than the %d bytes allowed by the Compute API", size, maxUserDataSize)
+	}
+	return nil
+}
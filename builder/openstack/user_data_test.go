@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultipartUserData(t *testing.T) {
+	dir := t.TempDir()
+	parts := []UserDataPart{
+		{File: filepath.Join(dir, "cloud-config.yaml"), ContentType: "text/cloud-config"},
+		{File: filepath.Join(dir, "setup.sh"), ContentType: "text/x-shellscript"},
+	}
+	contents := []string{
+		"#cloud-config\npackages:\n  - nginx\n",
+		"#!/bin/sh\necho \"--boundary look-alike\"\n",
+	}
+	for i, part := range parts {
+		if err := os.WriteFile(part.File, []byte(contents[i]), 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	archive, err := multipartUserData(parts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	message, err := mail.ReadMessage(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("the archive should be a MIME message: %s", err)
+	}
+	if version := message.Header.Get("MIME-Version"); version != "1.0" {
+		t.Fatalf("bad MIME-Version: %s", version)
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("the archive should be multipart/mixed: %s %s", mediaType, err)
+	}
+
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for i, part := range parts {
+		p, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %s", i, err)
+		}
+		contentType, _, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		if err != nil || contentType != part.ContentType {
+			t.Fatalf("part %d: expected content type %s, got %s", i, part.ContentType, p.Header.Get("Content-Type"))
+		}
+		if filename := p.FileName(); filename != filepath.Base(part.File) {
+			t.Fatalf("part %d: expected file name %s, got %s", i, filepath.Base(part.File), filename)
+		}
+		content, err := ioutil.ReadAll(p)
+		if err != nil {
+			t.Fatalf("part %d: %s", i, err)
+		}
+		if string(content) != contents[i] {
+			t.Fatalf("part %d: expected content %q, got %q", i, contents[i], content)
+		}
+	}
+	if _, err := reader.NextPart(); err == nil {
+		t.Fatalf("the archive should only have %d parts", len(parts))
+	}
+
+	if _, err := multipartUserData([]UserDataPart{{File: filepath.Join(dir, "missing"), ContentType: "text/x-shellscript"}}); err == nil {
+		t.Fatalf("a missing part should error")
+	}
+}
+
+func TestGzipUserData(t *testing.T) {
+	userData := []byte("#cloud-config\n" + strings.Repeat("write_files: []\n", 1000))
+
+	compressed, err := gzipUserData(userData)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(compressed) >= len(userData) {
+		t.Fatalf("the user data should be compressed: %d bytes, was %d", len(compressed), len(userData))
+	}
+	if err := checkUserDataSize(compressed); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("the user data should be gzipped: %s", err)
+	}
+	decompressed, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(decompressed, userData) {
+		t.Fatalf("the user data should round-trip, got %q", decompressed)
+	}
+}
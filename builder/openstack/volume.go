@@ -4,22 +4,31 @@
 package openstack
 
 import (
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 )
 
 // WaitForVolume waits for the given volume to become available.
-func WaitForVolume(blockStorageClient *gophercloud.ServiceClient, volumeID string) error {
+func WaitForVolume(blockStorageClient *gophercloud.ServiceClient, volumeID string, polling pollConfig) error {
 	maxNumErrors := 10
 	numErrors := 0
 
+	poll := newPoller(polling)
 	for {
 		status, err := GetVolumeStatus(blockStorageClient, volumeID)
 		if err != nil {
+			if poll.Throttled(err) {
+				poll.Wait()
+				continue
+			}
 			errCode, ok := err.(*gophercloud.ErrUnexpectedResponseCode)
 			if ok && (errCode.Actual == 500 || errCode.Actual == 404) {
 				numErrors++
@@ -40,7 +49,7 @@ func WaitForVolume(blockStorageClient *gophercloud.ServiceClient, volumeID strin
 		}
 
 		log.Printf("Waiting for volume creation status: %s", status)
-		time.Sleep(2 * time.Second)
+		poll.Wait()
 	}
 }
 
@@ -77,3 +86,126 @@ func GetVolumeStatus(blockStorageClient *gophercloud.ServiceClient, volumeID str
 
 	return volume.Status, nil
 }
+
+// findVolume returns the volume with the given ID, or the single volume with
+// the given name.
+func findVolume(blockStorageClient *gophercloud.ServiceClient, idOrName string) (*volumes.Volume, error) {
+	volume, err := volumes.Get(blockStorageClient, idOrName).Extract()
+	if err == nil {
+		return volume, nil
+	}
+	if _, ok := err.(gophercloud.ErrDefault404); !ok {
+		return nil, err
+	}
+
+	allPages, err := volumes.List(blockStorageClient, volumes.ListOpts{
+		Name: idOrName,
+	}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	vols, err := volumes.ExtractVolumes(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(vols) {
+	case 0:
+		return nil, fmt.Errorf("no volume found with ID or name %s", idOrName)
+	case 1:
+		return &vols[0], nil
+	default:
+		return nil, fmt.Errorf("more than one volume named %s, use the volume ID", idOrName)
+	}
+}
+
+// findVolumeSnapshot returns the volume snapshot with the given ID, or the
+// single volume snapshot with the given name. The newest volume snapshot with
+// the name is returned when mostRecent is true.
+func findVolumeSnapshot(blockStorageClient *gophercloud.ServiceClient, idOrName string, mostRecent bool) (*snapshots.Snapshot, error) {
+	snapshot, err := snapshots.Get(blockStorageClient, idOrName).Extract()
+	if err == nil {
+		return snapshot, nil
+	}
+	if _, ok := err.(gophercloud.ErrDefault404); !ok {
+		return nil, err
+	}
+
+	allPages, err := snapshots.List(blockStorageClient, snapshots.ListOpts{
+		Name: idOrName,
+	}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := snapshots.ExtractSnapshots(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(snaps) == 0:
+		return nil, fmt.Errorf("no volume snapshot found with ID or name %s", idOrName)
+	case len(snaps) == 1:
+		return &snaps[0], nil
+	case mostRecent:
+		sort.SliceStable(snaps, func(i, j int) bool {
+			return snaps[i].CreatedAt.After(snaps[j].CreatedAt)
+		})
+		return &snaps[0], nil
+	default:
+		ids := make([]string, 0, len(snaps))
+		for _, snap := range snaps {
+			ids = append(ids, snap.ID)
+		}
+		return nil, fmt.Errorf("more than one volume snapshot named %s: %s. Use the snapshot ID, "+
+			"or set source_volume_snapshot_most_recent to true", idOrName, strings.Join(ids, ", "))
+	}
+}
+
+// GetVolumeAvailabilityZones returns the names of the available availability
+// zones of the Block Storage service.
+func GetVolumeAvailabilityZones(blockStorageClient *gophercloud.ServiceClient) ([]string, error) {
+	var result struct {
+		AvailabilityZoneInfo []struct {
+			ZoneName  string `json:"zoneName"`
+			ZoneState struct {
+				Available bool `json:"available"`
+			} `json:"zoneState"`
+		} `json:"availabilityZoneInfo"`
+	}
+	_, err := blockStorageClient.Get(blockStorageClient.ServiceURL("os-availability-zone"), &result, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []string
+	for _, zone := range result.AvailabilityZoneInfo {
+		if zone.ZoneState.Available {
+			zones = append(zones, zone.ZoneName)
+		}
+	}
+	return zones, nil
+}
+
+// volumeAttachmentRefreshFunc returns a StateRefreshFunc telling whether the
+// volume is attached to the server, or else its status while it's being
+// attached or detached. The volume is detached once it's no longer attached
+// to the server, a multiattach volume attached elsewhere being in-use.
+func volumeAttachmentRefreshFunc(blockStorageClient *gophercloud.ServiceClient, volumeID, serverID string) StateRefreshFunc {
+	return func() (interface{}, string, int, error) {
+		volume, err := volumes.Get(blockStorageClient, volumeID).Extract()
+		if err != nil {
+			return nil, "", 0, err
+		}
+		for _, a := range volume.Attachments {
+			if a.ServerID == serverID {
+				return volume, "attached", 0, nil
+			}
+		}
+		switch volume.Status {
+		case "reserved", "attaching", "detaching", "in-use":
+			return volume, volume.Status, 0, nil
+		}
+		return volume, "detached", 0, nil
+	}
+}
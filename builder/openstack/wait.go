@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package openstack
+
+import (
+	"log"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// maxThrottledPollInterval is the interval the polling backs off to when
+// the cloud rate limits the requests, whatever the maximum interval.
+const maxThrottledPollInterval = time.Minute
+
+// defaultPollInterval is the interval of the polls when none is configured.
+const defaultPollInterval = 2 * time.Second
+
+// pollConfig is how the state waits poll, from state_poll_interval and
+// state_poll_max_interval.
+type pollConfig struct {
+	Interval    time.Duration
+	MaxInterval time.Duration
+}
+
+// statePolling returns how the state waits of the build poll.
+func (c *RunConfig) statePolling() pollConfig {
+	return pollConfig{
+		Interval:    c.StatePollInterval,
+		MaxInterval: c.StatePollMaxInterval,
+	}
+}
+
+// poller paces the polls of a state wait. The interval doubles after each
+// poll up to the maximum interval, and up to maxThrottledPollInterval after
+// a poll answered with 429 Too Many Requests. The waits check their timeout
+// and the cancellation of the build after every poll, throttled or not.
+type poller struct {
+	interval    time.Duration
+	maxInterval time.Duration
+	throttled   bool
+}
+
+func newPoller(config pollConfig) *poller {
+	if config.Interval <= 0 {
+		config.Interval = defaultPollInterval
+	}
+	if config.MaxInterval < config.Interval {
+		config.MaxInterval = config.Interval
+	}
+	return &poller{
+		interval:    config.Interval,
+		maxInterval: config.MaxInterval,
+	}
+}
+
+// Wait sleeps until the next poll, for a stretched interval when the last
+// poll was throttled.
+func (p *poller) Wait() {
+	throttled := p.throttled
+	p.throttled = false
+	interval := p.next(throttled)
+	if throttled {
+		log.Printf("[WARN] Rate limited while polling, retrying in %s", interval)
+	}
+	time.Sleep(interval)
+}
+
+// Throttled tells whether the poll failed with 429 Too Many Requests, the
+// next Wait then sleeping for a stretched interval.
+func (p *poller) Throttled(err error) bool {
+	if !isThrottled(err) {
+		return false
+	}
+	log.Printf("[WARN] Rate limited while polling: %s", err)
+	p.throttled = true
+	return true
+}
+
+// next returns the interval until the next poll, and backs off.
+func (p *poller) next(throttled bool) time.Duration {
+	if throttled {
+		maxInterval := p.maxInterval
+		if maxInterval < maxThrottledPollInterval {
+			maxInterval = maxThrottledPollInterval
+		}
+		p.interval = minDuration(p.interval*2, maxInterval)
+		return p.interval
+	}
+
+	// The interval goes back down to the maximum once no longer throttled.
+	interval := minDuration(p.interval, p.maxInterval)
+	p.interval = minDuration(interval*2, p.maxInterval)
+	return interval
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func isThrottled(err error) bool {
+	switch err := err.(type) {
+	case gophercloud.ErrDefault429:
+		return true
+	case gophercloud.ErrUnexpectedResponseCode:
+		return err.Actual == 429
+	case *gophercloud.ErrUnexpectedResponseCode:
+		return err.Actual == 429
+	}
+	return false
+}